@@ -0,0 +1,35 @@
+// cmd/api/gc: "api gc" subcommand; removes uploaded files no longer referenced by any row.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/gc"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"gorm.io/gorm"
+)
+
+// runGC runs one collection and prints the report as JSON. Returns the process exit code.
+func runGC(db *gorm.DB, cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report orphaned files without deleting them")
+	grace := fs.Duration("grace", cfg.GCGrace, "only collect files older than this")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	collector := gc.New(repository.NewStorageRepository(db), repository.NewBlobRepository(db), repository.NewTransactor(db), cfg.UploadDir)
+	rep, err := collector.Run(context.Background(), *grace, *dryRun)
+	if err != nil {
+		log.Printf("gc: %v", err)
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(rep)
+	return 0
+}
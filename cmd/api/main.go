@@ -12,15 +12,25 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"time"
+	_ "time/tzdata" // subscriber timezones must resolve in minimal containers
 
 	_ "github.com/aliakbar-zohour/go_blog/docs"
 	"github.com/aliakbar-zohour/go_blog/internal/config"
 	"github.com/aliakbar-zohour/go_blog/internal/database"
+	"github.com/aliakbar-zohour/go_blog/internal/gc"
+	"github.com/aliakbar-zohour/go_blog/internal/mail"
+	"github.com/aliakbar-zohour/go_blog/internal/mailqueue"
+	"github.com/aliakbar-zohour/go_blog/internal/outbox"
+	"github.com/aliakbar-zohour/go_blog/internal/pubsub"
 	"github.com/aliakbar-zohour/go_blog/internal/repository"
 	"github.com/aliakbar-zohour/go_blog/internal/router"
 	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/internal/webhook"
 	"github.com/joho/godotenv"
 )
 
@@ -31,21 +41,103 @@ func main() {
 	if err != nil {
 		log.Fatalf("database: %v", err)
 	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(db, os.Args[2:]))
+	}
+	if err := checkSchema(db, cfg); err != nil {
+		log.Fatalf("database: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		os.Exit(runGC(db, cfg, os.Args[2:]))
+	}
+	if replicas := database.ReplicasOf(db); replicas != nil {
+		go replicas.Start(context.Background(), cfg.DBReplicaCheck)
+	}
 	postRepo := repository.NewPostRepository(db)
 	mediaRepo := repository.NewMediaRepository(db)
 	authorRepo := repository.NewAuthorRepository(db)
 	categoryRepo := repository.NewCategoryRepository(db)
 	commentRepo := repository.NewCommentRepository(db)
 	evRepo := repository.NewEmailVerificationRepository(db)
-	postSvc := service.NewPostService(postRepo, mediaRepo, cfg)
-	authorSvc := service.NewAuthorService(authorRepo, cfg)
+	uploadRepo := repository.NewUploadRepository(db)
+	blobRepo := repository.NewBlobRepository(db)
+	mediaURLSvc := service.NewMediaURLService(repository.NewStorageRepository(db), cfg)
+	usageSvc := service.NewUsageService(repository.NewUsageRepository(db), authorRepo, cfg)
+	tx := repository.NewTransactor(db)
+	authorSvc := service.NewAuthorService(authorRepo, blobRepo, usageSvc, tx, cfg)
 	categorySvc := service.NewCategoryService(categoryRepo)
-	commentSvc := service.NewCommentService(commentRepo, postRepo)
-	authSvc := service.NewAuthService(authorRepo, evRepo, cfg)
-	r := router.New(db, postSvc, authorSvc, categorySvc, commentSvc, authSvc, cfg)
+	transport, err := mail.New(cfg)
+	if err != nil {
+		log.Fatalf("mail: %v", err)
+	}
+	mailQueue := mailqueue.New(repository.NewOutboxEmailRepository(db), transport, mailqueue.Options{Workers: cfg.MailWorkers, MaxAttempts: cfg.MailAttempts})
+	go mailQueue.Start(context.Background())
+	webhooks := webhook.New(repository.NewWebhookRepository(db), webhook.Options{Workers: cfg.WebhookWorkers, MaxAttempts: cfg.WebhookAttempts, Timeout: cfg.WebhookTimeout, AllowPrivate: cfg.WebhookPrivate})
+	go webhooks.Start(context.Background())
+	templates := mail.NewTemplates(cfg.MailTemplates, cfg.MailLocale)
+	events := pubsub.New(cfg.SSEHistory)
+	outboxRepo := repository.NewOutboxEventRepository(db)
+	relay := outbox.New(outboxRepo, outbox.Options{Retention: cfg.OutboxRetention})
+	relay.Add(outbox.HubSink{Hub: events}, outbox.Local)
+	relay.Add(webhooks, outbox.Shared)
+	if cfg.OutboxLog {
+		relay.Add(outbox.LogSink{}, outbox.Shared)
+	}
+	notificationSvc := service.NewNotificationService(repository.NewNotificationRepository(db), authorRepo, categoryRepo, postRepo, commentRepo, mailQueue, templates, tx, outboxRepo, cfg)
+	relay.Add(notificationSvc, outbox.Shared)
+	newsletterSvc := service.NewNewsletterService(repository.NewSubscriptionRepository(db), postRepo, authorRepo, categoryRepo, mailQueue, templates, tx, cfg)
+	relay.Add(newsletterSvc, outbox.Shared)
+	outboxRepo.OnAppend(relay.Notify)
+	go relay.Start(context.Background())
+	authSvc := service.NewAuthService(authorRepo, evRepo, mailQueue, templates, tx, outboxRepo, cfg)
+	postSvc := service.NewPostService(postRepo, mediaRepo, uploadRepo, blobRepo, mediaURLSvc, usageSvc, tx, outboxRepo, cfg)
+	commentSvc := service.NewCommentService(commentRepo, postRepo, tx, outboxRepo)
+	uploadSvc := service.NewUploadService(uploadRepo, usageSvc, tx, cfg)
+	mediaSvc := service.NewMediaService(mediaRepo, blobRepo, mediaURLSvc, usageSvc, tx, cfg)
+	go purgeExpiredUploads(uploadSvc, time.Hour)
+	if cfg.DigestInterval > 0 {
+		go sendDigests(newsletterSvc, cfg.DigestInterval)
+	}
+	if cfg.GCInterval > 0 {
+		collector := gc.New(repository.NewStorageRepository(db), blobRepo, tx, cfg.UploadDir)
+		go collector.Start(context.Background(), cfg.GCInterval, cfg.GCGrace)
+	}
+	r := router.New(db, postSvc, authorSvc, categorySvc, commentSvc, authSvc, uploadSvc, mediaSvc, mediaURLSvc, newsletterSvc, notificationSvc, mailQueue, webhooks, events, cfg)
 	addr := ":" + cfg.ServerPort
 	log.Printf("server listening on %s", addr)
 	if err := http.ListenAndServe(addr, r); err != nil {
 		log.Fatalf("server: %v", err)
 	}
 }
+
+// purgeExpiredUploads periodically removes expired resumable uploads and their partial files.
+func purgeExpiredUploads(svc *service.UploadService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		n, err := svc.PurgeExpired(context.Background())
+		if err != nil {
+			log.Printf("[upload] purge expired: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("[upload] purged %d expired uploads", n)
+		}
+	}
+}
+
+// sendDigests periodically sends the daily and weekly digests that are due.
+func sendDigests(svc *service.NewsletterService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		n, err := svc.SendDigests(context.Background(), time.Now())
+		if err != nil {
+			log.Printf("[newsletter] digests: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("[newsletter] sent %d digests", n)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// cmd/api/migrate: "api migrate" subcommand and the schema check run before the server starts.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/migrate"
+	"gorm.io/gorm"
+)
+
+const migrateUsage = "usage: api migrate up | down [n] | to <version> | status"
+
+// runMigrate runs "migrate up", "migrate down [n]" (default 1), "migrate to <version>" or "migrate status" and
+// prints the migrations run, or the status as JSON. Returns the process exit code.
+func runMigrate(db *gorm.DB, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	m, err := migrate.New(db)
+	if err != nil {
+		log.Printf("migrate: %v", err)
+		return 1
+	}
+	ctx := context.Background()
+	var done []migrate.Migration
+	switch args[0] {
+	case "up":
+		done, err = m.Up(ctx)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				return 2
+			}
+		}
+		done, err = m.Down(ctx, n)
+	case "to":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		version, perr := strconv.ParseInt(args[1], 10, 64)
+		if perr != nil || version < 0 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		done, err = m.To(ctx, version)
+	case "status":
+		list, err := m.Status(ctx)
+		if err != nil {
+			log.Printf("migrate: %v", err)
+			return 1
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(list)
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	for _, mig := range done {
+		fmt.Printf("%s %d_%s\n", args[0], mig.Version, mig.Name)
+	}
+	if err != nil {
+		log.Printf("migrate: %v", err)
+		return 1
+	}
+	if len(done) == 0 {
+		fmt.Println("nothing to do")
+	}
+	return 0
+}
+
+// checkSchema applies pending migrations when DB_MIGRATE_ON_START is set, then fails unless the schema is current.
+func checkSchema(db *gorm.DB, cfg *config.Config) error {
+	m, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if cfg.DBMigrate {
+		done, err := m.Up(ctx)
+		for _, mig := range done {
+			log.Printf("[migrate] applied %d_%s", mig.Version, mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := m.Check(ctx); err != nil {
+		return fmt.Errorf("%w (run \"api migrate up\" or set DB_MIGRATE_ON_START=true)", err)
+	}
+	return nil
+}
@@ -1,4 +1,5 @@
-// Integration test: requires PostgreSQL (env or .env). Skips if DB unavailable.
+// Integration test: runs against the database configured in env or .env, or an SQLite file in a temp dir
+// when none is. Skips if the DB is unavailable.
 package main
 
 import (
@@ -6,33 +7,47 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/aliakbar-zohour/go_blog/internal/config"
 	"github.com/aliakbar-zohour/go_blog/internal/database"
+	"github.com/aliakbar-zohour/go_blog/internal/mail"
+	"github.com/aliakbar-zohour/go_blog/internal/mailqueue"
+	"github.com/aliakbar-zohour/go_blog/internal/migrate"
+	"github.com/aliakbar-zohour/go_blog/internal/pubsub"
 	"github.com/aliakbar-zohour/go_blog/internal/repository"
 	"github.com/aliakbar-zohour/go_blog/internal/router"
 	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/internal/webhook"
 	"github.com/joho/godotenv"
 )
 
 func TestIntegration_HealthAndPosts(t *testing.T) {
 	_ = godotenv.Load()
-	if os.Getenv("DB_HOST") == "" && os.Getenv("DB_NAME") == "" {
-		t.Skip("skip integration test when DB env not set")
-	}
 	cfg := config.Load()
+	if os.Getenv("DB_DRIVER") == "" && os.Getenv("DB_HOST") == "" && os.Getenv("DB_NAME") == "" {
+		cfg.DBDriver, cfg.DBPath = database.DriverSQLite, filepath.Join(t.TempDir(), "blog.db")
+	}
 	db, err := database.New(cfg)
 	if err != nil {
 		t.Skipf("database not available (set env for integration): %v", err)
 	}
 	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := sqlDB.PingContext(ctx); err != nil {
 		t.Skipf("database ping failed: %v", err)
 	}
+	migrator, err := migrate.New(db)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
 
 	postRepo := repository.NewPostRepository(db)
 	mediaRepo := repository.NewMediaRepository(db)
@@ -40,12 +55,26 @@ func TestIntegration_HealthAndPosts(t *testing.T) {
 	categoryRepo := repository.NewCategoryRepository(db)
 	commentRepo := repository.NewCommentRepository(db)
 	evRepo := repository.NewEmailVerificationRepository(db)
-	postSvc := service.NewPostService(postRepo, mediaRepo, cfg)
-	authorSvc := service.NewAuthorService(authorRepo, cfg)
+	uploadRepo := repository.NewUploadRepository(db)
+	blobRepo := repository.NewBlobRepository(db)
+	mediaURLSvc := service.NewMediaURLService(repository.NewStorageRepository(db), cfg)
+	usageSvc := service.NewUsageService(repository.NewUsageRepository(db), authorRepo, cfg)
+	tx := repository.NewTransactor(db)
+	authorSvc := service.NewAuthorService(authorRepo, blobRepo, usageSvc, tx, cfg)
 	categorySvc := service.NewCategoryService(categoryRepo)
-	commentSvc := service.NewCommentService(commentRepo, postRepo)
-	authSvc := service.NewAuthService(authorRepo, evRepo, cfg)
-	r := router.New(db, postSvc, authorSvc, categorySvc, commentSvc, authSvc, cfg)
+	mailQueue := mailqueue.New(repository.NewOutboxEmailRepository(db), mail.NewMemoryMailer(), mailqueue.Options{})
+	templates := mail.NewTemplates("", mail.DefaultLocale)
+	webhooks := webhook.New(repository.NewWebhookRepository(db), webhook.Options{})
+	events := pubsub.New(cfg.SSEHistory)
+	outboxRepo := repository.NewOutboxEventRepository(db)
+	authSvc := service.NewAuthService(authorRepo, evRepo, mailQueue, templates, tx, outboxRepo, cfg)
+	notificationSvc := service.NewNotificationService(repository.NewNotificationRepository(db), authorRepo, categoryRepo, postRepo, commentRepo, mailQueue, templates, tx, outboxRepo, cfg)
+	postSvc := service.NewPostService(postRepo, mediaRepo, uploadRepo, blobRepo, mediaURLSvc, usageSvc, tx, outboxRepo, cfg)
+	commentSvc := service.NewCommentService(commentRepo, postRepo, tx, outboxRepo)
+	newsletterSvc := service.NewNewsletterService(repository.NewSubscriptionRepository(db), postRepo, authorRepo, categoryRepo, mailQueue, templates, tx, cfg)
+	uploadSvc := service.NewUploadService(uploadRepo, usageSvc, tx, cfg)
+	mediaSvc := service.NewMediaService(mediaRepo, blobRepo, mediaURLSvc, usageSvc, tx, cfg)
+	r := router.New(db, postSvc, authorSvc, categorySvc, commentSvc, authSvc, uploadSvc, mediaSvc, mediaURLSvc, newsletterSvc, notificationSvc, mailQueue, webhooks, events, cfg)
 
 	// GET /health
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
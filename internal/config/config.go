@@ -5,36 +5,80 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	DefaultJWTSecret = "change-me-in-production"
-	DefaultBodyLimit = 32 << 20  // 32MB max request body (multipart posts)
-	DefaultAuthRate  = 10        // requests per minute per IP for auth
+	DefaultBodyLimit = 32 << 20 // 32MB max request body (multipart posts)
+	DefaultAuthRate  = 10       // requests per minute per IP for auth
 	DefaultListLimit = 20
 	MaxListLimit     = 100
 )
 
 type Config struct {
 	ServerPort      string
+	PublicBaseURL   string // absolute URL of this API, used for links in emails
+	DBDriver        string // postgres or sqlite
+	DBPath          string // SQLite database file
 	DBHost          string
 	DBPort          string
 	DBUser          string
 	DBPass          string
 	DBName          string
 	DBSSL           string
+	DBMigrate       bool          // apply pending migrations on startup instead of refusing to start
+	DBReplicas      []string      // DSNs of PostgreSQL read replicas
+	DBReplicaSticky time.Duration // how long a client reads from the primary after writing
+	DBReplicaCheck  time.Duration // interval of replica health checks
+	DBReplicaMaxLag time.Duration // replication lag above which a replica leaves rotation, 0 unchecked
+	DBMaxOpenConns  int           // per pool (primary and each replica); 0 is unlimited
+	DBMaxIdleConns  int
+	DBConnLifetime  time.Duration // connections are closed and reopened after this; 0 keeps them
+	DBConnIdleTime  time.Duration // idle connections are closed after this; 0 keeps them
+	DBQueryTimeout  time.Duration // per query, on top of the request's deadline; 0 disables it
 	UploadDir       string
 	MaxFileMB       int
+	UploadExpiry    time.Duration
+	QuotaMB         int
+	GCInterval      time.Duration
+	GCGrace         time.Duration
 	JWTSecret       string
+	MediaURLSecret  string
+	MediaURLTTL     time.Duration
 	JWTExpiryHours  int
 	CORSOrigins     string
 	BodyLimitBytes  int64
 	AuthRatePerMin  int
+	MailDriver      string // smtp, file, memory or log
+	MailDir         string // output dir of the file driver
+	MailTemplates   string // optional dir overriding the embedded email templates
+	MailLocale      string // default email locale
 	SMTPHost        string
 	SMTPPort        string
 	SMTPUser        string
 	SMTPPass        string
 	SMTPFrom        string
+	SMTPTLS         string // starttls, tls or none; empty picks tls for port 465, else starttls
+	SMTPTimeout     time.Duration
+	DKIMDomain      string // d= of DKIM signatures; empty disables signing
+	DKIMSelector    string // s= of DKIM signatures; the key is published at <selector>._domainkey.<domain>
+	DKIMKeyFile     string // PEM private key (RSA or Ed25519)
+	MailWorkers     int    // mail queue senders
+	MailAttempts    int    // delivery attempts before an email is dead
+	AdminAuthorIDs  []uint
+	DigestHour      int           // local hour (in each subscriber's timezone) at which digests go out
+	DigestInterval  time.Duration // how often the digest job looks for due subscribers; 0 disables it
+	SSEHeartbeat    time.Duration // interval of heartbeat events on event streams
+	SSEHistory      int           // events kept per stream for Last-Event-ID resume
+	WebhookWorkers  int           // concurrent webhook senders
+	WebhookAttempts int           // delivery attempts before a webhook delivery is dead
+	WebhookTimeout  time.Duration // HTTP timeout of one webhook delivery
+	WebhookPrivate  bool          // allow webhooks to loopback, private and link-local addresses
+	OutboxRetention time.Duration // how long relayed domain events are kept
+	OutboxLog       bool          // log every domain event
+	DevTokens       bool          // return subscription confirmation tokens in API responses; development only
 }
 
 func Load() *Config {
@@ -54,31 +98,194 @@ func Load() *Config {
 	if authRate <= 0 {
 		authRate = DefaultAuthRate
 	}
+	quotaMB, _ := strconv.Atoi(getEnv("STORAGE_QUOTA_MB", "0"))
+	if quotaMB < 0 {
+		quotaMB = 0
+	}
+	uploadExpiryHours, _ := strconv.Atoi(getEnv("UPLOAD_EXPIRY_HOURS", "24"))
+	if uploadExpiryHours <= 0 {
+		uploadExpiryHours = 24
+	}
+	gcIntervalHours, _ := strconv.Atoi(getEnv("GC_INTERVAL_HOURS", "0"))
+	if gcIntervalHours < 0 {
+		gcIntervalHours = 0
+	}
+	gcGraceHours, _ := strconv.Atoi(getEnv("GC_GRACE_HOURS", "24"))
+	if gcGraceHours < 0 {
+		gcGraceHours = 24
+	}
 	jwtSecret := getEnv("JWT_SECRET", DefaultJWTSecret)
 	if jwtSecret == DefaultJWTSecret {
 		log.Printf("warning: JWT_SECRET is default; set a strong secret in production")
 	}
+	mediaURLMinutes, _ := strconv.Atoi(getEnv("MEDIA_URL_TTL_MINUTES", "60"))
+	if mediaURLMinutes <= 0 {
+		mediaURLMinutes = 60
+	}
+	smtpHost := getEnv("SMTP_HOST", "")
+	mailDriver := "log"
+	if smtpHost != "" {
+		mailDriver = "smtp"
+	}
+	smtpTimeout, _ := strconv.Atoi(getEnv("SMTP_TIMEOUT_SECONDS", "10"))
+	if smtpTimeout <= 0 {
+		smtpTimeout = 10
+	}
+	port := getEnv("PORT", "8080")
+	digestHour, err := strconv.Atoi(getEnv("DIGEST_HOUR", "8"))
+	if err != nil || digestHour < 0 || digestHour > 23 {
+		digestHour = 8
+	}
+	digestMinutes, _ := strconv.Atoi(getEnv("DIGEST_INTERVAL_MINUTES", "15"))
+	mailWorkers, _ := strconv.Atoi(getEnv("MAIL_QUEUE_WORKERS", "2"))
+	if mailWorkers <= 0 {
+		mailWorkers = 2
+	}
+	mailAttempts, _ := strconv.Atoi(getEnv("MAIL_QUEUE_MAX_ATTEMPTS", "8"))
+	if mailAttempts <= 0 {
+		mailAttempts = 8
+	}
+	sseHeartbeat, _ := strconv.Atoi(getEnv("SSE_HEARTBEAT_SECONDS", "15"))
+	if sseHeartbeat <= 0 {
+		sseHeartbeat = 15
+	}
+	sseHistory, _ := strconv.Atoi(getEnv("SSE_HISTORY", "256"))
+	if sseHistory < 0 {
+		sseHistory = 256
+	}
+	webhookWorkers, _ := strconv.Atoi(getEnv("WEBHOOK_WORKERS", "2"))
+	if webhookWorkers <= 0 {
+		webhookWorkers = 2
+	}
+	webhookAttempts, _ := strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS", "10"))
+	if webhookAttempts <= 0 {
+		webhookAttempts = 10
+	}
+	webhookTimeout, _ := strconv.Atoi(getEnv("WEBHOOK_TIMEOUT_SECONDS", "10"))
+	if webhookTimeout <= 0 {
+		webhookTimeout = 10
+	}
+	outboxDays, _ := strconv.Atoi(getEnv("OUTBOX_RETENTION_DAYS", "7"))
+	if outboxDays <= 0 {
+		outboxDays = 7
+	}
+	webhookPrivate, _ := strconv.ParseBool(getEnv("WEBHOOK_ALLOW_PRIVATE", "false"))
+	outboxLog, _ := strconv.ParseBool(getEnv("OUTBOX_LOG_EVENTS", "false"))
+	devTokens, _ := strconv.ParseBool(getEnv("DEV_TOKENS", "false"))
+	dbMigrate, _ := strconv.ParseBool(getEnv("DB_MIGRATE_ON_START", "false"))
+	var dbReplicas []string
+	for _, dsn := range strings.Split(getEnv("DB_REPLICAS", ""), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			dbReplicas = append(dbReplicas, dsn)
+		}
+	}
+	replicaSticky, _ := strconv.Atoi(getEnv("DB_REPLICA_STICKY_SECONDS", "5"))
+	if replicaSticky < 0 {
+		replicaSticky = 5
+	}
+	replicaCheck, _ := strconv.Atoi(getEnv("DB_REPLICA_CHECK_SECONDS", "10"))
+	if replicaCheck <= 0 {
+		replicaCheck = 10
+	}
+	replicaMaxLag, err := strconv.Atoi(getEnv("DB_REPLICA_MAX_LAG_SECONDS", "5"))
+	if err != nil || replicaMaxLag < 0 {
+		replicaMaxLag = 5
+	}
+	maxOpenConns, err := strconv.Atoi(getEnv("DB_MAX_OPEN_CONNS", "25"))
+	if err != nil || maxOpenConns < 0 {
+		maxOpenConns = 25
+	}
+	maxIdleConns, err := strconv.Atoi(getEnv("DB_MAX_IDLE_CONNS", "10"))
+	if err != nil || maxIdleConns < 0 {
+		maxIdleConns = 10
+	}
+	connLifetime, err := strconv.Atoi(getEnv("DB_CONN_MAX_LIFETIME_MINUTES", "30"))
+	if err != nil || connLifetime < 0 {
+		connLifetime = 30
+	}
+	connIdleTime, err := strconv.Atoi(getEnv("DB_CONN_MAX_IDLE_MINUTES", "5"))
+	if err != nil || connIdleTime < 0 {
+		connIdleTime = 5
+	}
+	queryTimeout, err := strconv.Atoi(getEnv("DB_QUERY_TIMEOUT_SECONDS", "10"))
+	if err != nil || queryTimeout < 0 {
+		queryTimeout = 10
+	}
 	return &Config{
-		ServerPort:     getEnv("PORT", "8080"),
-		DBHost:         getEnv("DB_HOST", "localhost"),
-		DBPort:         getEnv("DB_PORT", "5432"),
-		DBUser:         getEnv("DB_USER", "postgres"),
-		DBPass:         getEnv("DB_PASSWORD", "postgres"),
-		DBName:         getEnv("DB_NAME", "go_blog"),
-		DBSSL:          getEnv("DB_SSLMODE", "disable"),
-		UploadDir:      getEnv("UPLOAD_DIR", "uploads"),
-		MaxFileMB:      maxMB,
-		JWTSecret:      jwtSecret,
-		JWTExpiryHours: jwtHours,
-		CORSOrigins:    getEnv("CORS_ORIGINS", "*"),
-		BodyLimitBytes: bodyLimit,
-		AuthRatePerMin: authRate,
-		SMTPHost:       getEnv("SMTP_HOST", ""),
-		SMTPPort:       getEnv("SMTP_PORT", "587"),
-		SMTPUser:       getEnv("SMTP_USER", ""),
-		SMTPPass:       getEnv("SMTP_PASS", ""),
-		SMTPFrom:       getEnv("SMTP_FROM", "noreply@go-blog.local"),
+		ServerPort:      port,
+		PublicBaseURL:   strings.TrimSuffix(getEnv("PUBLIC_BASE_URL", "http://localhost:"+port), "/"),
+		DBDriver:        getEnv("DB_DRIVER", "postgres"),
+		DBPath:          getEnv("DB_PATH", "go_blog.db"),
+		DBHost:          getEnv("DB_HOST", "localhost"),
+		DBPort:          getEnv("DB_PORT", "5432"),
+		DBUser:          getEnv("DB_USER", "postgres"),
+		DBPass:          getEnv("DB_PASSWORD", "postgres"),
+		DBName:          getEnv("DB_NAME", "go_blog"),
+		DBSSL:           getEnv("DB_SSLMODE", "disable"),
+		DBMigrate:       dbMigrate,
+		DBReplicas:      dbReplicas,
+		DBReplicaSticky: time.Duration(replicaSticky) * time.Second,
+		DBReplicaCheck:  time.Duration(replicaCheck) * time.Second,
+		DBReplicaMaxLag: time.Duration(replicaMaxLag) * time.Second,
+		DBMaxOpenConns:  maxOpenConns,
+		DBMaxIdleConns:  maxIdleConns,
+		DBConnLifetime:  time.Duration(connLifetime) * time.Minute,
+		DBConnIdleTime:  time.Duration(connIdleTime) * time.Minute,
+		DBQueryTimeout:  time.Duration(queryTimeout) * time.Second,
+		UploadDir:       getEnv("UPLOAD_DIR", "uploads"),
+		MaxFileMB:       maxMB,
+		UploadExpiry:    time.Duration(uploadExpiryHours) * time.Hour,
+		QuotaMB:         quotaMB,
+		GCInterval:      time.Duration(gcIntervalHours) * time.Hour,
+		GCGrace:         time.Duration(gcGraceHours) * time.Hour,
+		JWTSecret:       jwtSecret,
+		MediaURLSecret:  getEnv("MEDIA_URL_SECRET", jwtSecret),
+		MediaURLTTL:     time.Duration(mediaURLMinutes) * time.Minute,
+		JWTExpiryHours:  jwtHours,
+		CORSOrigins:     getEnv("CORS_ORIGINS", "*"),
+		BodyLimitBytes:  bodyLimit,
+		AuthRatePerMin:  authRate,
+		MailDriver:      getEnv("MAIL_DRIVER", mailDriver),
+		MailDir:         getEnv("MAIL_DIR", "mail"),
+		MailTemplates:   getEnv("MAIL_TEMPLATE_DIR", ""),
+		MailLocale:      getEnv("MAIL_DEFAULT_LOCALE", "en"),
+		SMTPHost:        smtpHost,
+		SMTPPort:        getEnv("SMTP_PORT", "587"),
+		SMTPUser:        getEnv("SMTP_USER", ""),
+		SMTPPass:        getEnv("SMTP_PASS", ""),
+		SMTPFrom:        getEnv("SMTP_FROM", "noreply@go-blog.local"),
+		SMTPTLS:         getEnv("SMTP_TLS", ""),
+		SMTPTimeout:     time.Duration(smtpTimeout) * time.Second,
+		DKIMDomain:      getEnv("DKIM_DOMAIN", ""),
+		DKIMSelector:    getEnv("DKIM_SELECTOR", "default"),
+		DKIMKeyFile:     getEnv("DKIM_PRIVATE_KEY_PATH", ""),
+		MailWorkers:     mailWorkers,
+		MailAttempts:    mailAttempts,
+		AdminAuthorIDs:  parseIDs(getEnv("ADMIN_AUTHOR_IDS", "")),
+		DigestHour:      digestHour,
+		DigestInterval:  time.Duration(digestMinutes) * time.Minute,
+		SSEHeartbeat:    time.Duration(sseHeartbeat) * time.Second,
+		SSEHistory:      sseHistory,
+		WebhookWorkers:  webhookWorkers,
+		WebhookAttempts: webhookAttempts,
+		WebhookTimeout:  time.Duration(webhookTimeout) * time.Second,
+		WebhookPrivate:  webhookPrivate,
+		OutboxRetention: time.Duration(outboxDays) * 24 * time.Hour,
+		OutboxLog:       outboxLog,
+		DevTokens:       devTokens,
+	}
+}
+
+// parseIDs parses a comma-separated list of positive IDs, skipping invalid entries.
+func parseIDs(s string) []uint {
+	var ids []uint
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err == nil && n > 0 {
+			ids = append(ids, uint(n))
+		}
 	}
+	return ids
 }
 
 func getEnv(key, fallback string) string {
@@ -1,27 +1,73 @@
-// database: PostgreSQL connection and auto-migration of models.
+// database: PostgreSQL or SQLite connection. The schema is managed by versioned migrations (internal/migrate).
 package database
 
 import (
+	"context"
 	"fmt"
-	"log"
 
 	"github.com/aliakbar-zohour/go_blog/internal/config"
-	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// Drivers selectable with DB_DRIVER.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// New opens the database selected by cfg.DBDriver, with the read replicas of cfg.DBReplicas, the pool limits
+// of cfg and cfg.DBQueryTimeout on every statement. Run the replicas' health check with ReplicasOf(db).Start.
 func New(cfg *config.Config) (*gorm.DB, error) {
-	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPass, cfg.DBName, cfg.DBSSL,
-	)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	var dialector gorm.Dialector
+	switch cfg.DBDriver {
+	case DriverPostgres, "":
+		dsn := fmt.Sprintf(
+			"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+			cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPass, cfg.DBName, cfg.DBSSL,
+		)
+		dialector = postgres.Open(dsn)
+	case DriverSQLite:
+		dialector = sqlite.Open(sqliteDSN(cfg.DBPath))
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.DBDriver)
+	}
+	// Driver errors for taken unique keys become gorm.ErrDuplicatedKey, as the in-memory repositories return.
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, fmt.Errorf("db open: %w", err)
 	}
-	if err := db.AutoMigrate(&model.Author{}, &model.Category{}, &model.Post{}, &model.Media{}, &model.Comment{}, &model.EmailVerification{}); err != nil {
-		log.Printf("warning: automigrate: %v", err)
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("db open: %w", err)
+	}
+	configurePool(sqlDB, cfg)
+	if cfg.DBQueryTimeout > 0 {
+		if err := db.Use(&QueryTimeout{timeout: cfg.DBQueryTimeout}); err != nil {
+			return nil, err
+		}
+	}
+	if len(cfg.DBReplicas) > 0 {
+		if dialector.Name() != DriverPostgres {
+			return nil, fmt.Errorf("read replicas need PostgreSQL, not %s", dialector.Name())
+		}
+		replicas, err := openReplicas(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Use(replicas); err != nil {
+			return nil, err
+		}
+		replicas.Check(context.Background())
 	}
 	return db, nil
 }
+
+// sqliteDSN opens path in WAL mode, so readers do not wait for the writer, with foreign keys enforced as in
+// PostgreSQL. Transactions take the write lock when they begin and writers wait up to 5s for each other, instead
+// of failing with "database is locked" when a read transaction later tries to write. The driver is pure Go, so
+// the binary builds without cgo.
+func sqliteDSN(path string) string {
+	return "file:" + path + "?_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+}
@@ -0,0 +1,136 @@
+// database/pool: Connection pool limits, per-query timeouts and pool statistics. Every pool (the primary and
+// each replica) gets the limits of the config, so the connections of one instance are bounded by
+// DB_MAX_OPEN_CONNS times the number of pools.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"gorm.io/gorm"
+)
+
+const deadlineKey = "go_blog:query_deadline"
+
+// configurePool applies the pool limits of cfg to db.
+func configurePool(db *sql.DB, cfg *config.Config) {
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnLifetime)
+	db.SetConnMaxIdleTime(cfg.DBConnIdleTime)
+}
+
+// QueryTimeout is a gorm plugin bounding each statement. The deadline is derived from the statement's context,
+// so a request's own deadline or cancellation still applies when it is sooner. The results of Row and Rows are
+// read after gorm returns, so their deadline cannot be cancelled when the rows close: each such call keeps a
+// timer until the timeout elapses, though its connection is released on Close.
+type QueryTimeout struct {
+	timeout time.Duration
+}
+
+func (q *QueryTimeout) Name() string {
+	return "go_blog:query_timeout"
+}
+
+// Initialize wraps every processor, including the transaction gorm opens around a create, update or delete.
+func (q *QueryTimeout) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:begin_transaction").Register("go_blog:timeout_create", q.start),
+		cb.Create().After("gorm:commit_or_rollback_transaction").Register("go_blog:timeout_create_done", q.done),
+		cb.Update().Before("gorm:begin_transaction").Register("go_blog:timeout_update", q.start),
+		cb.Update().After("gorm:commit_or_rollback_transaction").Register("go_blog:timeout_update_done", q.done),
+		cb.Delete().Before("gorm:begin_transaction").Register("go_blog:timeout_delete", q.start),
+		cb.Delete().After("gorm:commit_or_rollback_transaction").Register("go_blog:timeout_delete_done", q.done),
+		cb.Query().Before("gorm:query").Register("go_blog:timeout_query", q.start),
+		cb.Query().After("gorm:after_query").Register("go_blog:timeout_query_done", q.done),
+		cb.Raw().Before("gorm:raw").Register("go_blog:timeout_raw", q.start),
+		cb.Raw().After("gorm:raw").Register("go_blog:timeout_raw_done", q.done),
+		cb.Row().Before("gorm:row").Register("go_blog:timeout_row", q.start),
+		cb.Row().After("gorm:row").Register("go_blog:timeout_row_done", q.rowDone),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryDeadline is the context a statement had before start bounded it.
+type queryDeadline struct {
+	parent context.Context
+	cancel context.CancelFunc
+}
+
+func (q *QueryTimeout) start(db *gorm.DB) {
+	parent := db.Statement.Context
+	ctx, cancel := context.WithTimeout(parent, q.timeout)
+	db.Statement.Context = ctx
+	db.InstanceSet(deadlineKey, queryDeadline{parent: parent, cancel: cancel})
+}
+
+// done releases the deadline and restores the context, so a chain such as Count then Find gets a fresh one.
+func (q *QueryTimeout) done(db *gorm.DB) {
+	if v, ok := db.InstanceGet(deadlineKey); ok {
+		d := v.(queryDeadline)
+		d.cancel()
+		db.Statement.Context = d.parent
+	}
+}
+
+// rowDone restores the context of a Row or Rows statement, whose rows are still read under the deadline. A
+// failed statement has no rows to read, so its deadline is released at once.
+func (q *QueryTimeout) rowDone(db *gorm.DB) {
+	if v, ok := db.InstanceGet(deadlineKey); ok {
+		d := v.(queryDeadline)
+		if db.Error != nil {
+			d.cancel()
+		}
+		db.Statement.Context = d.parent
+	}
+}
+
+// PoolStats reports the connections of one pool.
+type PoolStats struct {
+	Name              string `json:"name"`
+	MaxOpen           int    `json:"max_open"`
+	Open              int    `json:"open"`
+	InUse             int    `json:"in_use"`
+	Idle              int    `json:"idle"`
+	WaitCount         int64  `json:"wait_count"`
+	WaitDurationMs    int64  `json:"wait_duration_ms"`
+	MaxIdleClosed     int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64  `json:"max_lifetime_closed"`
+}
+
+func poolStats(name string, db *sql.DB) PoolStats {
+	s := db.Stats()
+	return PoolStats{
+		Name:              name,
+		MaxOpen:           s.MaxOpenConnections,
+		Open:              s.OpenConnections,
+		InUse:             s.InUse,
+		Idle:              s.Idle,
+		WaitCount:         s.WaitCount,
+		WaitDurationMs:    s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:     s.MaxIdleClosed,
+		MaxIdleTimeClosed: s.MaxIdleTimeClosed,
+		MaxLifetimeClosed: s.MaxLifetimeClosed,
+	}
+}
+
+// Pools returns the statistics of the primary pool of db, followed by those of its replicas.
+func Pools(db *gorm.DB) []PoolStats {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil
+	}
+	list := []PoolStats{poolStats("primary", sqlDB)}
+	if r := ReplicasOf(db); r != nil {
+		list = append(list, r.pools()...)
+	}
+	return list
+}
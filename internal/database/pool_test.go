@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+)
+
+func TestQueryTimeout_BoundsEachStatement(t *testing.T) {
+	db := openNotes(t, "", "first")
+	sqlDB, _ := db.DB()
+	configurePool(sqlDB, &config.Config{DBMaxOpenConns: 3, DBMaxIdleConns: 1})
+	if err := db.Use(&QueryTimeout{timeout: 50 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// A statement outliving the timeout fails with a deadline error.
+	expired := openNotes(t, "expired", "first")
+	if err := expired.Use(&QueryTimeout{timeout: time.Nanosecond}); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	if err := expired.WithContext(ctx).Model(&note{}).Count(&n).Error; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expired query: want a deadline error, got %v", err)
+	}
+
+	// The deadline of one statement does not carry over to the next one on the same chain.
+	q := db.WithContext(ctx).Model(&note{})
+	if err := q.Count(&n).Error; err != nil || n != 1 {
+		t.Fatalf("Count = %d, %v", n, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	var notes []note
+	if err := q.Find(&notes).Error; err != nil || len(notes) != 1 {
+		t.Fatalf("Find after Count = %v, %v", notes, err)
+	}
+	if err := db.WithContext(ctx).Create(&note{Body: "second"}).Error; err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// A cancelled request cancels its queries.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := db.WithContext(cancelled).Find(&notes).Error; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled request: want context.Canceled, got %v", err)
+	}
+
+	pools := Pools(db)
+	if len(pools) != 1 || pools[0].Name != "primary" || pools[0].MaxOpen != 3 {
+		t.Errorf("Pools = %+v", pools)
+	}
+}
@@ -0,0 +1,221 @@
+// database/replicas: Read replicas. Queries marked with Read are sent to a healthy replica in turn; everything
+// else, transactions and contexts marked with UsePrimary go to the primary. A background check takes replicas
+// that stop answering or fall too far behind out of rotation and brings them back once they catch up.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	readKey     = "go_blog:read"
+	pingTimeout = 2 * time.Second
+)
+
+type primaryKey struct{}
+
+// Read marks the queries of db as servable by a replica. Without replicas they run on the primary.
+func Read(db *gorm.DB) *gorm.DB {
+	return db.Set(readKey, true)
+}
+
+// UsePrimary sends every query made with ctx to the primary, e.g. for a client that just wrote and must read
+// its own change before the replicas have it.
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func usesPrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
+
+// ReplicaStatus is the last health check of a replica.
+type ReplicaStatus struct {
+	Name       string    `json:"name"`
+	Healthy    bool      `json:"healthy"`
+	Error      string    `json:"error,omitempty"`
+	LagSeconds float64   `json:"lag_seconds"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+type replica struct {
+	db     *sql.DB
+	status ReplicaStatus
+}
+
+// Replicas is a gorm plugin routing Read queries to the replicas.
+type Replicas struct {
+	mu       sync.Mutex
+	replicas []*replica
+	next     int
+	maxLag   time.Duration // 0 skips the lag check
+	lag      func(ctx context.Context, db *sql.DB) (time.Duration, error)
+}
+
+func newReplicas(dbs []*sql.DB, maxLag time.Duration) *Replicas {
+	r := &Replicas{maxLag: maxLag, lag: replayLag}
+	for i, db := range dbs {
+		r.replicas = append(r.replicas, &replica{db: db, status: ReplicaStatus{Name: fmt.Sprintf("replica-%d", i+1)}})
+	}
+	return r
+}
+
+// openReplicas connects to the replica DSNs of cfg without waiting for them to answer; the first check does that.
+func openReplicas(cfg *config.Config) (*Replicas, error) {
+	dbs := make([]*sql.DB, 0, len(cfg.DBReplicas))
+	for i, dsn := range cfg.DBReplicas {
+		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{DisableAutomaticPing: true})
+		if err != nil {
+			return nil, fmt.Errorf("replica-%d: %w", i+1, err)
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, fmt.Errorf("replica-%d: %w", i+1, err)
+		}
+		configurePool(sqlDB, cfg)
+		dbs = append(dbs, sqlDB)
+	}
+	return newReplicas(dbs, cfg.DBReplicaMaxLag), nil
+}
+
+// ReplicasOf returns the replicas registered on db, nil without replicas.
+func ReplicasOf(db *gorm.DB) *Replicas {
+	r, _ := db.Config.Plugins[(&Replicas{}).Name()].(*Replicas)
+	return r
+}
+
+func (r *Replicas) Name() string {
+	return "go_blog:replicas"
+}
+
+// Initialize registers the routing before gorm's query callbacks.
+func (r *Replicas) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("go_blog:replicas_query", r.route); err != nil {
+		return err
+	}
+	return db.Callback().Row().Before("gorm:row").Register("go_blog:replicas_row", r.route)
+}
+
+// route swaps the connection of a Read query outside a transaction for a healthy replica.
+func (r *Replicas) route(db *gorm.DB) {
+	if read, _ := db.Get(readKey); read != true || usesPrimary(db.Statement.Context) {
+		return
+	}
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		return
+	}
+	if pool := r.pick(); pool != nil {
+		db.Statement.ConnPool = pool
+	}
+}
+
+// pick returns the next healthy replica, nil when none is.
+func (r *Replicas) pick() *sql.DB {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for range r.replicas {
+		rep := r.replicas[r.next]
+		r.next = (r.next + 1) % len(r.replicas)
+		if rep.status.Healthy {
+			return rep.db
+		}
+	}
+	return nil
+}
+
+// Check pings every replica, measures its replication lag and updates its health; a replica enters or leaves
+// rotation on the result.
+func (r *Replicas) Check(ctx context.Context) {
+	for _, rep := range r.replicas {
+		lag, err := r.check(ctx, rep.db)
+		r.mu.Lock()
+		was := rep.status.Healthy
+		rep.status.Healthy, rep.status.Error, rep.status.LagSeconds, rep.status.CheckedAt = err == nil, "", lag.Seconds(), time.Now()
+		if err != nil {
+			rep.status.Error = err.Error()
+		}
+		name := rep.status.Name
+		r.mu.Unlock()
+		switch {
+		case was && err != nil:
+			log.Printf("[replicas] %s out of rotation: %v", name, err)
+		case !was && err == nil:
+			log.Printf("[replicas] %s in rotation", name)
+		}
+	}
+}
+
+// check pings db and, with a lag threshold, fails when db replays the primary's changes more than maxLag late.
+func (r *Replicas) check(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return 0, err
+	}
+	if r.maxLag <= 0 {
+		return 0, nil
+	}
+	lag, err := r.lag(ctx, db)
+	if err != nil {
+		return 0, fmt.Errorf("replication lag: %w", err)
+	}
+	if lag > r.maxLag {
+		return lag, fmt.Errorf("replication lag %s exceeds %s", lag.Round(time.Millisecond), r.maxLag)
+	}
+	return lag, nil
+}
+
+// replayLag is how far the standby db is behind: the age of the last transaction it replayed, or zero when it has
+// replayed everything it received, so a replica of an idle primary does not look late.
+func replayLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var seconds float64
+	err := db.QueryRowContext(ctx, `SELECT CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`).Scan(&seconds)
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+// Start checks the replicas every interval until ctx is done.
+func (r *Replicas) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Check(ctx)
+		}
+	}
+}
+
+// Status returns the last check of every replica.
+func (r *Replicas) Status() []ReplicaStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]ReplicaStatus, len(r.replicas))
+	for i, rep := range r.replicas {
+		list[i] = rep.status
+	}
+	return list
+}
+
+// pools returns the pool statistics of every replica.
+func (r *Replicas) pools() []PoolStats {
+	list := make([]PoolStats, len(r.replicas))
+	for i, rep := range r.replicas {
+		list[i] = poolStats(rep.status.Name, rep.db)
+	}
+	return list
+}
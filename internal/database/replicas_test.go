@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+type note struct {
+	ID   uint
+	Body string
+}
+
+func openNotes(t *testing.T, name, body string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&note{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&note{Body: body})
+	return db
+}
+
+func TestReplicas_RoutesReadsOutsideTransactions(t *testing.T) {
+	primary := openNotes(t, "primary", "primary")
+	replicaDB, _ := openNotes(t, "replica", "replica").DB()
+	replicas := newReplicas([]*sql.DB{replicaDB}, 0)
+	if err := primary.Use(replicas); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	body := func(db *gorm.DB) string {
+		var n note
+		if err := db.First(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n.Body
+	}
+
+	// Replicas join the rotation once a check found them healthy.
+	if got := body(Read(primary.WithContext(ctx))); got != "primary" {
+		t.Fatalf("unchecked replica served %q", got)
+	}
+	replicas.Check(ctx)
+	if ReplicasOf(primary) != replicas || !replicas.Status()[0].Healthy {
+		t.Fatalf("status = %+v", replicas.Status())
+	}
+	if got := body(Read(primary.WithContext(ctx))); got != "replica" {
+		t.Errorf("Read went to %s", got)
+	}
+	var n int64
+	if Read(primary.WithContext(ctx)).Model(&note{}).Where("body = ?", "replica").Count(&n); n != 1 {
+		t.Errorf("Count not served by the replica")
+	}
+	if got := body(primary.WithContext(ctx)); got != "primary" {
+		t.Errorf("unmarked query went to %s", got)
+	}
+	if got := body(Read(primary.WithContext(UsePrimary(ctx)))); got != "primary" {
+		t.Errorf("UsePrimary query went to %s", got)
+	}
+	_ = primary.Transaction(func(tx *gorm.DB) error {
+		if got := body(Read(tx)); got != "primary" {
+			t.Errorf("read in a transaction went to %s", got)
+		}
+		return nil
+	})
+
+	// A replica that stops answering leaves the rotation.
+	replicaDB.Close()
+	replicas.Check(ctx)
+	if s := replicas.Status()[0]; s.Healthy || s.Error == "" {
+		t.Fatalf("closed replica status = %+v", s)
+	}
+	if got := body(Read(primary.WithContext(ctx))); got != "primary" {
+		t.Errorf("unhealthy replica served %q", got)
+	}
+}
+
+func TestReplicas_CheckLeavesLaggingReplicasOut(t *testing.T) {
+	replicaDB, _ := openNotes(t, "replica", "replica").DB()
+	replicas := newReplicas([]*sql.DB{replicaDB}, 5*time.Second)
+	lag, lagErr := time.Second, error(nil)
+	replicas.lag = func(context.Context, *sql.DB) (time.Duration, error) { return lag, lagErr }
+	ctx := context.Background()
+
+	replicas.Check(ctx)
+	if s := replicas.Status()[0]; !s.Healthy || s.LagSeconds != 1 {
+		t.Fatalf("status at 1s lag = %+v", s)
+	}
+	lag = 6 * time.Second
+	replicas.Check(ctx)
+	if s := replicas.Status()[0]; s.Healthy || s.LagSeconds != 6 || s.Error == "" {
+		t.Fatalf("status at 6s lag = %+v", s)
+	}
+	if replicas.pick() != nil {
+		t.Error("lagging replica picked")
+	}
+	lag, lagErr = 0, errors.New("not a standby")
+	replicas.Check(ctx)
+	if s := replicas.Status()[0]; s.Healthy {
+		t.Fatalf("status without a lag = %+v", s)
+	}
+	lagErr = nil
+	replicas.Check(ctx)
+	if s := replicas.Status()[0]; !s.Healthy || replicas.pick() != replicaDB {
+		t.Fatalf("caught up replica status = %+v", s)
+	}
+}
@@ -0,0 +1,252 @@
+// gc: Removes stored files that nothing references any more after a grace period: unused blobs by their
+// reference count, and files without a blob row by scanning the upload dir.
+package gc
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"gorm.io/gorm"
+)
+
+// Orphan is an unreferenced file, relative to the upload dir.
+type Orphan struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Report summarises one collection run. In dry-run mode Removed and BytesFreed stay zero.
+type Report struct {
+	DryRun     bool     `json:"dry_run"`
+	Scanned    int      `json:"scanned"`
+	Referenced int      `json:"referenced"`
+	Tracked    int      `json:"tracked"` // files with a blob row, collected by reference count rather than by the scan
+	InGrace    int      `json:"in_grace"`
+	Orphans    []Orphan `json:"orphans"`
+	Removed    int      `json:"removed"`
+	BytesFreed int64    `json:"bytes_freed"`
+}
+
+// blobBatch is the number of unused blobs read at a time.
+const blobBatch = 100
+
+// errReused rolls back the removal of a blob whose file an upload of the same content refreshed meanwhile.
+var errReused = errors.New("blob file reused")
+
+type Collector struct {
+	storageRepo repository.StorageStore
+	blobRepo    repository.BlobStore
+	tx          repository.TxRunner
+	uploadDir   string
+}
+
+// New returns a Collector. Each blob is removed, row and file, in its own transaction of tx.
+func New(storageRepo repository.StorageStore, blobRepo repository.BlobStore, tx repository.TxRunner, uploadDir string) *Collector {
+	return &Collector{storageRepo: storageRepo, blobRepo: blobRepo, tx: tx, uploadDir: uploadDir}
+}
+
+// Run collects in two steps. Blobs whose reference count has been zero for longer than grace are reported as
+// orphans and, unless dryRun, their row and file are deleted together. Then the upload dir is scanned for files
+// without a blob row (uploads from before blobs, files left by a crash between storing and committing): those not
+// referenced by any row and last modified more than grace ago are orphans too. The grace period protects files
+// whose row is still being written; StoreBlob refreshes the modification time of a blob it reuses, and each
+// orphan is looked up again right before it is deleted, so a file that became referenced meanwhile is kept.
+// Hash-prefix directories left empty are removed.
+func (c *Collector) Run(ctx context.Context, grace time.Duration, dryRun bool) (*Report, error) {
+	cutoff := time.Now().Add(-grace)
+	rep := &Report{DryRun: dryRun, Orphans: []Orphan{}}
+	var removed []string
+	defer func() {
+		for _, rel := range removed {
+			c.prune(rel)
+		}
+	}()
+	if err := c.collectBlobs(ctx, cutoff, dryRun, rep, &removed); err != nil {
+		return rep, err
+	}
+	if err := c.collectUntracked(ctx, cutoff, dryRun, rep, &removed); err != nil {
+		return rep, err
+	}
+	return rep, nil
+}
+
+// collectBlobs reports, and unless dryRun removes, the blobs nothing has used since cutoff.
+func (c *Collector) collectBlobs(ctx context.Context, cutoff time.Time, dryRun bool, rep *Report, removed *[]string) error {
+	var afterID uint
+	for {
+		blobs, err := c.blobRepo.ListUnreferenced(ctx, cutoff, afterID, blobBatch)
+		if err != nil {
+			return err
+		}
+		for _, b := range blobs {
+			afterID = b.ID
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			o := Orphan{Path: b.Path, Size: b.Size, ModTime: b.UpdatedAt}
+			if info, err := os.Stat(c.abs(b.Path)); err == nil {
+				if info.ModTime().After(cutoff) {
+					rep.InGrace++
+					continue
+				}
+				o.ModTime = info.ModTime()
+			}
+			if dryRun {
+				rep.Orphans = append(rep.Orphans, o)
+				continue
+			}
+			ok, err := c.removeBlob(ctx, b.Path, cutoff)
+			if err != nil {
+				log.Printf("[gc] remove blob %s: %v", b.Path, err)
+				continue
+			}
+			if !ok {
+				rep.Referenced++
+				continue
+			}
+			rep.Orphans = append(rep.Orphans, o)
+			rep.Removed++
+			rep.BytesFreed += b.Size
+			*removed = append(*removed, b.Path)
+		}
+		if len(blobs) < blobBatch {
+			return nil
+		}
+	}
+}
+
+// removeBlob deletes the row and the file of a blob nothing has used since cutoff, in one transaction, and
+// reports whether it did. Both stay when the blob gained a reference meanwhile or an upload of the same content
+// refreshed the file after cutoff.
+func (c *Collector) removeBlob(ctx context.Context, rel string, cutoff time.Time) (bool, error) {
+	referenced, err := c.storageRepo.IsReferenced(ctx, rel)
+	if err != nil || referenced {
+		return false, err
+	}
+	deleted := false
+	err = c.tx.Do(ctx, func(ctx context.Context) error {
+		ok, err := c.blobRepo.DeleteUnreferenced(ctx, rel, cutoff)
+		if err != nil || !ok {
+			return err
+		}
+		if info, err := os.Stat(c.abs(rel)); err == nil && info.ModTime().After(cutoff) {
+			return errReused
+		}
+		if err := os.Remove(c.abs(rel)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+	if errors.Is(err, errReused) {
+		return false, nil
+	}
+	return deleted && err == nil, err
+}
+
+// collectUntracked scans the upload dir for orphaned files without a blob row.
+func (c *Collector) collectUntracked(ctx context.Context, cutoff time.Time, dryRun bool, rep *Report, removed *[]string) error {
+	refs, err := c.storageRepo.ReferencedPaths(ctx)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(c.uploadDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == c.uploadDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return ctx.Err()
+		}
+		rel, err := filepath.Rel(c.uploadDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		rep.Scanned++
+		if refs[rel] {
+			rep.Referenced++
+			return nil
+		}
+		if _, err := c.blobRepo.GetByPath(ctx, rel); err == nil {
+			rep.Tracked++
+			return nil
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(cutoff) {
+			rep.InGrace++
+			return nil
+		}
+		if !dryRun {
+			referenced, err := c.storageRepo.IsReferenced(ctx, rel)
+			if err != nil {
+				return err
+			}
+			if referenced {
+				rep.Referenced++
+				return nil
+			}
+		}
+		rep.Orphans = append(rep.Orphans, Orphan{Path: rel, Size: info.Size(), ModTime: info.ModTime()})
+		if dryRun {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("[gc] remove %s: %v", rel, err)
+			return nil
+		}
+		rep.Removed++
+		rep.BytesFreed += info.Size()
+		*removed = append(*removed, rel)
+		return nil
+	})
+}
+
+// prune removes the directories of rel that are left empty, up to but not including its top-level directory
+// (e.g. blobs/ab/cd and blobs/ab of blobs/ab/cd/abcd….png).
+func (c *Collector) prune(rel string) {
+	for dir := filepath.Dir(filepath.FromSlash(rel)); filepath.Dir(dir) != "."; dir = filepath.Dir(dir) {
+		if err := os.Remove(filepath.Join(c.uploadDir, dir)); err != nil {
+			return
+		}
+	}
+}
+
+func (c *Collector) abs(rel string) string {
+	return filepath.Join(c.uploadDir, filepath.FromSlash(rel))
+}
+
+// Start runs the collector every interval until ctx is cancelled.
+func (c *Collector) Start(ctx context.Context, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rep, err := c.Run(ctx, grace, false)
+			if err != nil {
+				log.Printf("[gc] run: %v", err)
+				continue
+			}
+			if rep.Removed > 0 {
+				log.Printf("[gc] removed %d orphaned files (%d bytes)", rep.Removed, rep.BytesFreed)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package gc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"github.com/aliakbar-zohour/go_blog/internal/testdb"
+)
+
+func writeFile(t *testing.T, dir, rel string, age time.Duration) {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mt := time.Now().Add(-age)
+	if err := os.Chtimes(p, mt, mt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollector_Run(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	live := &model.Post{Title: "live", BannerPath: "blobs/aa/bb/live.png"}
+	deleted := &model.Post{Title: "deleted", BannerPath: "banners/old.png"}
+	db.Create(live)
+	db.Create(deleted)
+	db.Delete(deleted)
+	writeFile(t, dir, "blobs/aa/bb/live.png", 48*time.Hour)
+	writeFile(t, dir, "banners/old.png", 48*time.Hour)
+	writeFile(t, dir, "blobs/cc/dd/fresh.png", time.Minute)
+
+	c := New(repository.NewStorageRepository(db), repository.NewBlobRepository(db), repository.NewTransactor(db), dir)
+	rep, err := c.Run(ctx, 24*time.Hour, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if rep.Scanned != 3 || rep.Referenced != 1 || rep.InGrace != 1 || len(rep.Orphans) != 1 || rep.Removed != 0 {
+		t.Fatalf("dry run report: %+v", rep)
+	}
+	if rep.Orphans[0].Path != "banners/old.png" {
+		t.Errorf("orphan want banners/old.png, got %s", rep.Orphans[0].Path)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "banners", "old.png")); err != nil {
+		t.Errorf("dry run must not delete: %v", err)
+	}
+
+	rep, err = c.Run(ctx, 24*time.Hour, false)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if rep.Removed != 1 || rep.BytesFreed != 4 {
+		t.Errorf("run report: %+v", rep)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "banners", "old.png")); !os.IsNotExist(err) {
+		t.Errorf("orphan should be removed, stat err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blobs", "aa", "bb", "live.png")); err != nil {
+		t.Errorf("referenced file must stay: %v", err)
+	}
+}
+
+// staleRefs returns the references as they were before a file was reused.
+type staleRefs struct {
+	repository.StorageStore
+}
+
+func (staleRefs) ReferencedPaths(ctx context.Context) (map[string]bool, error) {
+	return map[string]bool{}, nil
+}
+
+func TestCollector_KeepsFileReferencedAfterScan(t *testing.T) {
+	db := testdb.Open(t)
+	dir := t.TempDir()
+	writeFile(t, dir, "blobs/aa/bb/reused.png", 48*time.Hour)
+	db.Create(&model.Post{Title: "new", BannerPath: "blobs/aa/bb/reused.png"})
+
+	c := New(staleRefs{repository.NewStorageRepository(db)}, repository.NewBlobRepository(db), repository.NewTransactor(db), dir)
+	rep, err := c.Run(context.Background(), 24*time.Hour, false)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if rep.Removed != 0 || rep.Referenced != 1 {
+		t.Errorf("run report: %+v", rep)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blobs", "aa", "bb", "reused.png")); err != nil {
+		t.Errorf("file referenced after the scan was removed: %v", err)
+	}
+}
+
+func TestCollector_CollectsUnusedBlobs(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	for _, b := range []*model.Blob{
+		{Hash: "used", Path: "blobs/aa/bb/used.png", Size: 4, RefCount: 1, UpdatedAt: old},
+		{Hash: "unused", Path: "blobs/cc/dd/unused.png", Size: 4, UpdatedAt: old},
+		{Hash: "released", Path: "blobs/ee/ff/released.png", Size: 4, UpdatedAt: time.Now()},
+		{Hash: "reused", Path: "blobs/11/22/reused.png", Size: 4, UpdatedAt: old},
+	} {
+		if err := db.Create(b).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, dir, "blobs/aa/bb/used.png", 48*time.Hour)
+	writeFile(t, dir, "blobs/cc/dd/unused.png", 48*time.Hour)
+	writeFile(t, dir, "blobs/ee/ff/released.png", 48*time.Hour)
+	// An upload of the same content refreshed the file; its Acquire has not committed yet.
+	writeFile(t, dir, "blobs/11/22/reused.png", time.Minute)
+
+	blobRepo := repository.NewBlobRepository(db)
+	c := New(repository.NewStorageRepository(db), blobRepo, repository.NewTransactor(db), dir)
+	rep, err := c.Run(ctx, 24*time.Hour, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(rep.Orphans) != 1 || rep.Orphans[0].Path != "blobs/cc/dd/unused.png" || rep.InGrace != 1 || rep.Tracked != 4 || rep.Removed != 0 {
+		t.Fatalf("dry run report: %+v", rep)
+	}
+
+	rep, err = c.Run(ctx, 24*time.Hour, false)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if rep.Removed != 1 || rep.BytesFreed != 4 || rep.Tracked != 3 {
+		t.Errorf("run report: %+v", rep)
+	}
+	if _, err := blobRepo.GetByPath(ctx, "blobs/cc/dd/unused.png"); err == nil {
+		t.Error("row of the collected blob is left")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blobs", "cc")); !os.IsNotExist(err) {
+		t.Errorf("emptied hash-prefix directories should be removed, stat err=%v", err)
+	}
+	for _, rel := range []string{"blobs/aa/bb/used.png", "blobs/ee/ff/released.png", "blobs/11/22/reused.png"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("%s must stay: %v", rel, err)
+		}
+		if _, err := blobRepo.GetByPath(ctx, rel); err != nil {
+			t.Errorf("row of %s must stay: %v", rel, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// handler/admin_email_handler: Admin endpoints to inspect the outbound mail queue and resend dead emails.
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/aliakbar-zohour/go_blog/internal/mailqueue"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/pkg/response"
+	"github.com/go-chi/chi/v5"
+)
+
+type AdminEmailHandler struct {
+	queue *mailqueue.Queue
+}
+
+func NewAdminEmailHandler(queue *mailqueue.Queue) *AdminEmailHandler {
+	return &AdminEmailHandler{queue: queue}
+}
+
+// List godoc
+//
+//	@Summary		List queued emails
+//	@Description	Returns outbound emails, newest first. Filter by status (pending, sending, sent, dead). Requires an admin token (ADMIN_AUTHOR_IDS).
+//	@Tags			admin
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			status	query		string	false	"pending, sending, sent or dead"
+//	@Param			limit	query		int		false	"Items per page (default 20, max 100)"
+//	@Param			offset	query		int		false	"Number of items to skip"
+//	@Success		200		{object}	response.Body{data=mailqueue.ListResult}
+//	@Failure		401		{object}	response.Body
+//	@Failure		403		{object}	response.Body
+//	@Failure		500		{object}	response.Body
+//	@Router			/admin/emails [get]
+func (h *AdminEmailHandler) List(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	result, err := h.queue.List(r.Context(), model.OutboxEmailStatus(r.URL.Query().Get("status")), limit, offset)
+	if err != nil {
+		response.Internal(w, "failed to list emails")
+		return
+	}
+	response.OK(w, result)
+}
+
+// GetByID godoc
+//
+//	@Summary		Get a queued email
+//	@Description	Returns one outbound email with its attempts and last error. Requires an admin token.
+//	@Tags			admin
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id	path		int	true	"Email ID"
+//	@Success		200	{object}	response.Body{data=model.OutboxEmail}
+//	@Failure		400	{object}	response.Body
+//	@Failure		403	{object}	response.Body
+//	@Failure		404	{object}	response.Body
+//	@Router			/admin/emails/{id} [get]
+func (h *AdminEmailHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	e, err := h.queue.Get(r.Context(), uint(id))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.OK(w, e)
+}
+
+// Resend godoc
+//
+//	@Summary		Resend a dead email
+//	@Description	Moves a dead email back to the queue with a fresh attempt budget. Requires an admin token.
+//	@Tags			admin
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id	path		int	true	"Email ID"
+//	@Success		200	{object}	response.Body{data=model.OutboxEmail}
+//	@Failure		400	{object}	response.Body
+//	@Failure		403	{object}	response.Body
+//	@Failure		404	{object}	response.Body
+//	@Failure		409	{object}	response.Body	"not_dead"
+//	@Router			/admin/emails/{id}/resend [post]
+func (h *AdminEmailHandler) Resend(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	e, err := h.queue.Resend(r.Context(), uint(id))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.OK(w, e)
+}
+
+func (h *AdminEmailHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, mailqueue.ErrNotFound):
+		response.NotFoundWithCode(w, "email_not_found", err.Error())
+	case errors.Is(err, mailqueue.ErrNotDead):
+		response.ErrWithCode(w, http.StatusConflict, "not_dead", err.Error())
+	default:
+		response.Internal(w, "failed to load email")
+	}
+}
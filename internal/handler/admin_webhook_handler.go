@@ -0,0 +1,268 @@
+// handler/admin_webhook_handler: Admin endpoints to manage outgoing webhooks, send test events and inspect deliveries.
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/webhook"
+	"github.com/aliakbar-zohour/go_blog/pkg/response"
+	"github.com/go-chi/chi/v5"
+)
+
+type AdminWebhookHandler struct {
+	webhooks *webhook.Dispatcher
+}
+
+func NewAdminWebhookHandler(webhooks *webhook.Dispatcher) *AdminWebhookHandler {
+	return &AdminWebhookHandler{webhooks: webhooks}
+}
+
+// List godoc
+//
+//	@Summary		List webhooks
+//	@Description	Returns all webhook subscriptions. Secrets are never returned. Requires an admin token (ADMIN_AUTHOR_IDS).
+//	@Tags			admin
+//	@Produce		json
+//	@Security		Bearer
+//	@Success		200	{object}	response.Body{data=[]model.Webhook}
+//	@Failure		401	{object}	response.Body
+//	@Failure		403	{object}	response.Body
+//	@Failure		500	{object}	response.Body
+//	@Router			/admin/webhooks [get]
+func (h *AdminWebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	items, err := h.webhooks.List(r.Context())
+	if err != nil {
+		response.Internal(w, "failed to list webhooks")
+		return
+	}
+	response.OK(w, items)
+}
+
+// Create godoc
+//
+//	@Summary		Create a webhook
+//	@Description	Subscribes a URL to events (post.created, post.updated, post.deleted, comment.created, author.registered). Each delivery is a POST of {"id","event","created_at","data"} signed in X-Blog-Signature: t=<unix>,v1=<hex HMAC-SHA256 of "<t>.<body>" with the secret>. A secret is generated when none is given; it is only returned here. Requires an admin token.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			body	body		webhook.Input	true	"url, events, optional secret, description and active"
+//	@Success		201		{object}	response.Body{data=webhook.Created}
+//	@Failure		400		{object}	response.Body
+//	@Failure		403		{object}	response.Body
+//	@Failure		500		{object}	response.Body
+//	@Router			/admin/webhooks [post]
+func (h *AdminWebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var in webhook.Input
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		response.BadRequestWithCode(w, "invalid_body", "invalid body")
+		return
+	}
+	created, err := h.webhooks.Create(r.Context(), in)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.Created(w, created)
+}
+
+// GetByID godoc
+//
+//	@Summary		Get a webhook
+//	@Description	Returns one webhook subscription. Requires an admin token.
+//	@Tags			admin
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id	path		int	true	"Webhook ID"
+//	@Success		200	{object}	response.Body{data=model.Webhook}
+//	@Failure		400	{object}	response.Body
+//	@Failure		403	{object}	response.Body
+//	@Failure		404	{object}	response.Body
+//	@Router			/admin/webhooks/{id} [get]
+func (h *AdminWebhookHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	wh, err := h.webhooks.Get(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.OK(w, wh)
+}
+
+// Update godoc
+//
+//	@Summary		Update a webhook
+//	@Description	Changes the given fields; omitted ones are kept. Set "active": false to pause deliveries; pending ones are then dropped as dead. Requires an admin token.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id		path		int				true	"Webhook ID"
+//	@Param			body	body		webhook.Input	true	"Fields to change"
+//	@Success		200		{object}	response.Body{data=model.Webhook}
+//	@Failure		400		{object}	response.Body
+//	@Failure		403		{object}	response.Body
+//	@Failure		404		{object}	response.Body
+//	@Router			/admin/webhooks/{id} [put]
+func (h *AdminWebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	var in webhook.Input
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		response.BadRequestWithCode(w, "invalid_body", "invalid body")
+		return
+	}
+	wh, err := h.webhooks.Update(r.Context(), id, in)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.OK(w, wh)
+}
+
+// Delete godoc
+//
+//	@Summary		Delete a webhook
+//	@Description	Removes the webhook and its delivery log. Requires an admin token.
+//	@Tags			admin
+//	@Security		Bearer
+//	@Param			id	path	int	true	"Webhook ID"
+//	@Success		204	"No Content"
+//	@Failure		400	{object}	response.Body
+//	@Failure		403	{object}	response.Body
+//	@Failure		404	{object}	response.Body
+//	@Router			/admin/webhooks/{id} [delete]
+func (h *AdminWebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.webhooks.Delete(r.Context(), id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.NoContent(w)
+}
+
+// SendTest godoc
+//
+//	@Summary		Send a test event
+//	@Description	Sends a signed ping event to the webhook right away and returns the logged delivery with the response status. Failed pings are not retried. Requires an admin token.
+//	@Tags			admin
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id	path		int	true	"Webhook ID"
+//	@Success		200	{object}	response.Body{data=model.WebhookDelivery}
+//	@Failure		400	{object}	response.Body
+//	@Failure		403	{object}	response.Body
+//	@Failure		404	{object}	response.Body
+//	@Router			/admin/webhooks/{id}/test [post]
+func (h *AdminWebhookHandler) SendTest(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	d, err := h.webhooks.SendTest(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.OK(w, d)
+}
+
+// Deliveries godoc
+//
+//	@Summary		List webhook deliveries
+//	@Description	Returns the delivery log of a webhook, newest first, with attempts, response status, the start of the response body and the last error. Filter by status (pending, sending, succeeded, dead). Requires an admin token.
+//	@Tags			admin
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id		path		int		true	"Webhook ID"
+//	@Param			status	query		string	false	"pending, sending, succeeded or dead"
+//	@Param			limit	query		int		false	"Items per page (default 20, max 100)"
+//	@Param			offset	query		int		false	"Number of items to skip"
+//	@Success		200		{object}	response.Body{data=webhook.DeliveryListResult}
+//	@Failure		400		{object}	response.Body
+//	@Failure		403		{object}	response.Body
+//	@Failure		404		{object}	response.Body
+//	@Router			/admin/webhooks/{id}/deliveries [get]
+func (h *AdminWebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	result, err := h.webhooks.Deliveries(r.Context(), id, model.WebhookDeliveryStatus(r.URL.Query().Get("status")), limit, offset)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.OK(w, result)
+}
+
+// Redeliver godoc
+//
+//	@Summary		Redeliver a dead delivery
+//	@Description	Moves a dead delivery back to the queue with a fresh attempt budget. Requires an admin token.
+//	@Tags			admin
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id			path		int	true	"Webhook ID"
+//	@Param			deliveryID	path		int	true	"Delivery ID"
+//	@Success		200			{object}	response.Body{data=model.WebhookDelivery}
+//	@Failure		400			{object}	response.Body
+//	@Failure		403			{object}	response.Body
+//	@Failure		404			{object}	response.Body
+//	@Failure		409			{object}	response.Body	"not_dead"
+//	@Router			/admin/webhooks/{id}/deliveries/{deliveryID}/redeliver [post]
+func (h *AdminWebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseUint(chi.URLParam(r, "deliveryID"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid delivery id")
+		return
+	}
+	d, err := h.webhooks.Redeliver(r.Context(), id, uint(deliveryID))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.OK(w, d)
+}
+
+func webhookID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *AdminWebhookHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, webhook.ErrNotFound):
+		response.NotFoundWithCode(w, "webhook_not_found", err.Error())
+	case errors.Is(err, webhook.ErrDeliveryNotFound):
+		response.NotFoundWithCode(w, "delivery_not_found", err.Error())
+	case errors.Is(err, webhook.ErrNotDead):
+		response.ErrWithCode(w, http.StatusConflict, "not_dead", err.Error())
+	case errors.Is(err, webhook.ErrInvalidURL), errors.Is(err, webhook.ErrInvalidEvents):
+		response.BadRequestWithCode(w, "validation_failed", err.Error())
+	default:
+		response.Internal(w, "webhook request failed")
+	}
+}
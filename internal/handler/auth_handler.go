@@ -3,7 +3,9 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/aliakbar-zohour/go_blog/internal/service"
 	"github.com/aliakbar-zohour/go_blog/pkg/response"
@@ -11,7 +13,8 @@ import (
 
 // AuthRegisterRequest body for POST /auth/register/request
 type AuthRegisterRequest struct {
-	Email string `json:"email" example:"writer@example.com"`
+	Email  string `json:"email" example:"writer@example.com"`
+	Locale string `json:"locale,omitempty" example:"en"` // email language; defaults to the first Accept-Language tag
 }
 
 // AuthRegisterVerifyRequest body for POST /auth/register/verify
@@ -39,13 +42,15 @@ func NewAuthHandler(svc *service.AuthService) *AuthHandler {
 // RequestVerification godoc
 //
 //	@Summary		Request verification code
-//	@Description	Sends a 6-digit code to the given email (if SMTP configured). For testing without SMTP, the code is logged on the server.
+//	@Description	Sends a 6-digit code to the given email. When mail is not delivered over SMTP (MAIL_DRIVER file, memory or log), the code is also returned as dev_code and logged on the server.
 //	@Tags			auth
 //	@Accept			json
 //	@Produce		json
-//	@Param			body	body		AuthRegisterRequest	true	"Email to send the code to"
-//	@Success		200		{object}	response.Body{data=object}
-//	@Failure		400		{object}	response.Body
+//	@Param			body			body		AuthRegisterRequest	true	"Email to send the code to"
+//	@Param			Accept-Language	header		string				false	"Email language when body.locale is empty"
+//	@Success		200				{object}	response.Body{data=object}
+//	@Failure		400				{object}	response.Body
+//	@Failure		503				{object}	response.Body	"email_not_sent"
 //	@Router			/auth/register/request [post]
 func (h *AuthHandler) RequestVerification(w http.ResponseWriter, r *http.Request) {
 	var body AuthRegisterRequest
@@ -57,7 +62,15 @@ func (h *AuthHandler) RequestVerification(w http.ResponseWriter, r *http.Request
 		response.BadRequestWithCode(w, "email_too_long", "email too long")
 		return
 	}
-	devCode, err := h.svc.RequestVerification(r.Context(), body.Email)
+	locale := body.Locale
+	if locale == "" {
+		locale = preferredLanguage(r.Header.Get("Accept-Language"))
+	}
+	devCode, err := h.svc.RequestVerification(r.Context(), body.Email, locale)
+	if errors.Is(err, service.ErrEmailNotSent) {
+		response.ErrWithCode(w, http.StatusServiceUnavailable, "email_not_sent", "could not send verification email, try again later")
+		return
+	}
 	if err != nil {
 		response.BadRequestWithCode(w, "validation_failed", err.Error())
 		return
@@ -65,7 +78,7 @@ func (h *AuthHandler) RequestVerification(w http.ResponseWriter, r *http.Request
 	res := map[string]interface{}{"sent": true}
 	if devCode != "" {
 		res["dev_code"] = devCode
-		res["message"] = "SMTP not configured; use dev_code in /auth/register/verify to complete registration."
+		res["message"] = "Mail is not delivered over SMTP; use dev_code in /auth/register/verify to complete registration."
 	}
 	response.OK(w, res)
 }
@@ -129,3 +142,14 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Authorization", "Bearer "+token)
 	response.OK(w, map[string]interface{}{"author": a, "token": token})
 }
+
+// preferredLanguage returns the first tag of an Accept-Language header ("fa-IR,fa;q=0.9,en;q=0.8" -> "fa-IR").
+func preferredLanguage(header string) string {
+	tag, _, _ := strings.Cut(header, ",")
+	tag, _, _ = strings.Cut(tag, ";")
+	tag = strings.TrimSpace(tag)
+	if tag == "*" {
+		return ""
+	}
+	return tag
+}
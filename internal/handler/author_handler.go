@@ -2,6 +2,8 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
 	"mime/multipart"
 	"net/http"
 	"strconv"
@@ -14,6 +16,11 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+// AuthorQuotaRequest sets an author's storage quota override. Null reverts to the configured default (QUOTA_MB).
+type AuthorQuotaRequest struct {
+	QuotaBytes *int64 `json:"quota_bytes" example:"1073741824"` // 0 = unlimited
+}
+
 type AuthorHandler struct {
 	svc *service.AuthorService
 	cfg *config.Config
@@ -59,6 +66,7 @@ func (h *AuthorHandler) List(w http.ResponseWriter, r *http.Request) {
 //	@Param			avatar	formData	file	false	"Avatar image"
 //	@Success		201		{object}	response.Body{data=model.Author}
 //	@Failure		400		{object}	response.Body
+//	@Failure		403		{object}	response.Body	"quota_exceeded"
 //	@Router			/authors [post]
 func (h *AuthorHandler) Create(w http.ResponseWriter, r *http.Request) {
 	maxMem := h.multipartMax()
@@ -76,6 +84,9 @@ func (h *AuthorHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 	a, err := h.svc.Create(r.Context(), name, avatar)
 	if err != nil {
+		if writeQuotaError(w, err) {
+			return
+		}
 		response.BadRequest(w, err.Error())
 		return
 	}
@@ -161,6 +172,9 @@ func (h *AuthorHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 	a, err := h.svc.Update(r.Context(), uint(id), name, avatar)
 	if err != nil {
+		if writeQuotaError(w, err) {
+			return
+		}
 		response.Internal(w, err.Error())
 		return
 	}
@@ -201,3 +215,85 @@ func (h *AuthorHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 	response.NoContent(w)
 }
+
+// Usage godoc
+//
+//	@Summary		Get an author's storage usage
+//	@Description	Returns the storage quota (0 = unlimited), the bytes reserved by unfinished resumable uploads, and bytes and file counts by media type. Requires Authorization: Bearer <token>. You can only see your own usage.
+//	@Tags			authors
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id	path		int	true	"Author ID"
+//	@Success		200	{object}	response.Body{data=service.UsageReport}
+//	@Failure		400	{object}	response.Body
+//	@Failure		401	{object}	response.Body
+//	@Failure		403	{object}	response.Body
+//	@Failure		404	{object}	response.Body
+//	@Failure		500	{object}	response.Body
+//	@Router			/authors/{id}/usage [get]
+func (h *AuthorHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	loggedID := middleware.GetAuthorID(r.Context())
+	if loggedID == 0 || loggedID != uint(id) {
+		response.Forbidden(w, "you can only see your own usage")
+		return
+	}
+	rep, err := h.svc.Usage(r.Context(), uint(id))
+	if err != nil {
+		response.Internal(w, "failed to load usage")
+		return
+	}
+	if rep == nil {
+		response.NotFound(w, "author not found")
+		return
+	}
+	response.OK(w, rep)
+}
+
+// SetQuota godoc
+//
+//	@Summary		Set an author's storage quota
+//	@Description	Sets the author's storage quota override in bytes (0 = unlimited); null reverts to the configured default. A quota below the author's usage keeps their files but refuses new uploads. Requires an admin token (ADMIN_AUTHOR_IDS).
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id		path		int					true	"Author ID"
+//	@Param			body	body		AuthorQuotaRequest	true	"quota_bytes"
+//	@Success		200		{object}	response.Body{data=service.UsageReport}
+//	@Failure		400		{object}	response.Body
+//	@Failure		401		{object}	response.Body
+//	@Failure		403		{object}	response.Body
+//	@Failure		404		{object}	response.Body
+//	@Failure		500		{object}	response.Body
+//	@Router			/admin/authors/{id}/quota [put]
+func (h *AuthorHandler) SetQuota(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	var in AuthorQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		response.BadRequestWithCode(w, "invalid_body", "invalid body")
+		return
+	}
+	rep, err := h.svc.SetQuota(r.Context(), uint(id), in.QuotaBytes)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidQuota) {
+			response.BadRequest(w, err.Error())
+			return
+		}
+		response.Internal(w, "failed to set quota")
+		return
+	}
+	if rep == nil {
+		response.NotFound(w, "author not found")
+		return
+	}
+	response.OK(w, rep)
+}
@@ -49,7 +49,7 @@ func (h *CommentHandler) ListByPostID(w http.ResponseWriter, r *http.Request) {
 // Create godoc
 //
 //	@Summary		Create a comment
-//	@Description	Creates a new comment on the given post. Requires Authorization: Bearer <token>. Comment is linked to the logged-in author.
+//	@Description	Creates a new comment on the given post, or a reply when parent_id is set. Notifies the post's author and the parent comment's author. Requires Authorization: Bearer <token>. Comment is linked to the logged-in author.
 //	@Tags			comments
 //	@Accept			application/x-www-form-urlencoded
 //	@Produce		json
@@ -57,6 +57,7 @@ func (h *CommentHandler) ListByPostID(w http.ResponseWriter, r *http.Request) {
 //	@Param			postId		path		int		true	"Post ID"
 //	@Param			body		formData	string	true	"Comment body"
 //	@Param			author_name	formData	string	false	"Optional display name override"
+//	@Param			parent_id	formData	int		false	"ID of the comment this replies to (same post)"
 //	@Success		201			{object}	response.Body{data=model.Comment}
 //	@Failure		400			{object}	response.Body
 //	@Failure		401			{object}	response.Body
@@ -76,7 +77,8 @@ func (h *CommentHandler) Create(w http.ResponseWriter, r *http.Request) {
 	_ = r.ParseForm()
 	body := r.FormValue("body")
 	authorName := r.FormValue("author_name")
-	c, err := h.svc.Create(r.Context(), uint(postID), body, authorName, &authorID)
+	parentID := parseOptionalUint(r.FormValue("parent_id"))
+	c, err := h.svc.Create(r.Context(), uint(postID), parentID, body, authorName, &authorID)
 	if err != nil {
 		response.BadRequest(w, err.Error())
 		return
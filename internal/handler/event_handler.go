@@ -0,0 +1,113 @@
+// handler/event_handler: Server-Sent Events streams of new posts and of the changes to one post.
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/pubsub"
+	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/pkg/response"
+	"github.com/go-chi/chi/v5"
+)
+
+// sseRetryMillis is the reconnect delay suggested to clients.
+const sseRetryMillis = 3000
+
+type EventHandler struct {
+	hub       *pubsub.Hub
+	posts     *service.PostService
+	heartbeat time.Duration
+}
+
+func NewEventHandler(hub *pubsub.Hub, posts *service.PostService, heartbeat time.Duration) *EventHandler {
+	return &EventHandler{hub: hub, posts: posts, heartbeat: heartbeat}
+}
+
+// Posts godoc
+//
+//	@Summary		Stream new posts
+//	@Description	Server-Sent Events stream with a post.created event (data: the post) for every new post. Sends a heartbeat event every SSE_HEARTBEAT_SECONDS. Reconnecting with Last-Event-ID replays missed events; a reset event means some were lost and the client should reload.
+//	@Tags			events
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header		string	false	"ID of the last event received"
+//	@Success		200				{string}	string	"event stream"
+//	@Router			/posts/events [get]
+func (h *EventHandler) Posts(w http.ResponseWriter, r *http.Request) {
+	h.stream(w, r, service.PostsTopic)
+}
+
+// Post godoc
+//
+//	@Summary		Stream changes to a post
+//	@Description	Server-Sent Events stream of one post: comment.created and comment.updated (data: the comment), comment.deleted (data: {"id","post_id"}), post.updated (data: the post) and post.deleted (data: {"id"}). Sends a heartbeat event every SSE_HEARTBEAT_SECONDS. Reconnecting with Last-Event-ID replays missed events; a reset event means some were lost and the client should reload.
+//	@Tags			events
+//	@Produce		text/event-stream
+//	@Param			id				path		int		true	"Post ID"
+//	@Param			Last-Event-ID	header		string	false	"ID of the last event received"
+//	@Success		200				{string}	string	"event stream"
+//	@Failure		400				{object}	response.Body
+//	@Failure		404				{object}	response.Body
+//	@Router			/posts/{id}/events [get]
+func (h *EventHandler) Post(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	if _, err := h.posts.GetByID(r.Context(), uint(id), 0); err != nil {
+		response.NotFound(w, "post not found")
+		return
+	}
+	h.stream(w, r, service.PostTopic(uint(id)))
+}
+
+// stream relays the events of topic until the client disconnects or falls too far behind.
+func (h *EventHandler) stream(w http.ResponseWriter, r *http.Request, topic string) {
+	lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	sub, replay, complete := h.hub.Subscribe(topic, lastID)
+	defer h.hub.Unsubscribe(sub)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis)
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, ev := range replay {
+		writeEvent(w, ev)
+	}
+	if err := rc.Flush(); err != nil {
+		log.Printf("[events] %s: %v", topic, err)
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			writeEvent(w, ev)
+		case t := <-heartbeat.C:
+			fmt.Fprintf(w, "event: heartbeat\ndata: {\"time\":%q}\n\n", t.UTC().Format(time.RFC3339))
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev pubsub.Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/pubsub"
+	"github.com/aliakbar-zohour/go_blog/internal/service"
+)
+
+// readEvent returns the next event block of an SSE stream, without the trailing blank line.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return strings.Join(lines, "\n")
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestEventHandler_StreamsReplaysAndHeartbeats(t *testing.T) {
+	hub := pubsub.New(16)
+	srv := httptest.NewServer(http.HandlerFunc(NewEventHandler(hub, nil, 50*time.Millisecond).Posts))
+	defer srv.Close()
+
+	hub.Publish(11, service.PostsTopic, service.EventPostCreated, map[string]int{"id": 1})
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	stream := bufio.NewReader(resp.Body)
+	if got := readEvent(t, stream); got != "retry: 3000" {
+		t.Fatalf("first block = %q", got)
+	}
+	// Events published before connecting without Last-Event-ID are not replayed.
+	hub.Publish(12, service.PostsTopic, service.EventPostCreated, map[string]int{"id": 2})
+	got := readEvent(t, stream)
+	if !strings.Contains(got, "event: post.created\ndata: {\"id\":2}") {
+		t.Fatalf("event = %q", got)
+	}
+	id, _ := strconv.ParseUint(strings.TrimPrefix(strings.SplitN(got, "\n", 2)[0], "id: "), 10, 64)
+	if got := readEvent(t, stream); !strings.HasPrefix(got, "event: heartbeat\ndata: {\"time\":") {
+		t.Fatalf("heartbeat = %q", got)
+	}
+
+	// Reconnecting with Last-Event-ID replays what was missed.
+	hub.Publish(13, service.PostsTopic, service.EventPostCreated, map[string]int{"id": 3})
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(id, 10))
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+	stream2 := bufio.NewReader(resp2.Body)
+	readEvent(t, stream2)
+	if got := readEvent(t, stream2); !strings.Contains(got, "data: {\"id\":3}") {
+		t.Fatalf("replayed event = %q", got)
+	}
+
+	// IDs from before the hub started get a reset event first.
+	req.Header.Set("Last-Event-ID", "1")
+	resp3, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp3.Body.Close()
+	stream3 := bufio.NewReader(resp3.Body)
+	readEvent(t, stream3)
+	if got := readEvent(t, stream3); got != "event: reset\ndata: {}" {
+		t.Fatalf("want reset, got %q", got)
+	}
+}
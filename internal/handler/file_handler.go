@@ -0,0 +1,63 @@
+// handler/file_handler: Serves uploaded files; files of private posts require a valid signed URL. Only stored
+// files are served: no directory listings, partial uploads or temp files. The Content-Type follows the stored
+// extension and is never sniffed; anything that is not a media file is only offered as a download.
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/internal/upload"
+	"github.com/aliakbar-zohour/go_blog/pkg/response"
+)
+
+type FileHandler struct {
+	urls      *service.MediaURLService
+	uploadDir string
+	files     http.Handler
+}
+
+// NewFileHandler serves files from uploadDir under service.UploadsPrefix.
+func NewFileHandler(urls *service.MediaURLService, uploadDir string) *FileHandler {
+	return &FileHandler{
+		urls:      urls,
+		uploadDir: uploadDir,
+		files:     http.StripPrefix(service.UploadsPrefix, http.FileServer(http.Dir(uploadDir))),
+	}
+}
+
+func (h *FileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rel := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, service.UploadsPrefix)), "/")
+	if strings.HasSuffix(r.URL.Path, "/") || !upload.Servable(rel) {
+		response.NotFound(w, "file not found")
+		return
+	}
+	if info, err := os.Stat(filepath.Join(h.uploadDir, filepath.FromSlash(rel))); err != nil || info.IsDir() {
+		response.NotFound(w, "file not found")
+		return
+	}
+	if err := h.urls.Authorize(r.Context(), rel, r.URL.Query()); err != nil {
+		if errors.Is(err, service.ErrMediaForbidden) {
+			response.ErrWithCode(w, http.StatusForbidden, "signature_required", err.Error())
+			return
+		}
+		response.Internal(w, "failed to authorize file")
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if ct, ok := upload.ServedType(rel); ok {
+		w.Header().Set("Content-Type", ct)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	if r.URL.Query().Get("sig") != "" {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	h.files.ServeHTTP(w, r)
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/memrepo"
+	"github.com/aliakbar-zohour/go_blog/internal/service"
+)
+
+func TestFileHandler_ServesOnlyStoredFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, rel := range []string{"blobs/ab/cd/abcd.png", "blobs/tmp/blob-1", "tus/0123", "banners/old.png"} {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	urls := service.NewMediaURLService(memrepo.NewStorageRepository(memrepo.New()), &config.Config{})
+	h := NewFileHandler(urls, dir)
+	for path, want := range map[string]int{
+		"/uploads/blobs/ab/cd/abcd.png": http.StatusOK,
+		"/uploads/banners/old.png":      http.StatusOK,
+		"/uploads/blobs/ab/cd/":         http.StatusNotFound,
+		"/uploads/blobs/ab/cd":          http.StatusNotFound,
+		"/uploads/blobs/":               http.StatusNotFound,
+		"/uploads/blobs/tmp/blob-1":     http.StatusNotFound,
+		"/uploads/tus/":                 http.StatusNotFound,
+		"/uploads/tus/0123":             http.StatusNotFound,
+		"/uploads/../go.mod":            http.StatusNotFound,
+	} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != want {
+			t.Errorf("GET %s: status want %d, got %d", path, want, rr.Code)
+		}
+	}
+}
+
+func TestFileHandler_NeverSniffsContentType(t *testing.T) {
+	dir := t.TempDir()
+	for _, rel := range []string{"blobs/ab/cd/abcd.png", "blobs/ab/cd/abce"} {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("<html><script>alert(1)</script>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	urls := service.NewMediaURLService(memrepo.NewStorageRepository(memrepo.New()), &config.Config{})
+	h := NewFileHandler(urls, dir)
+	for path, want := range map[string][2]string{
+		"/uploads/blobs/ab/cd/abcd.png": {"image/png", ""},
+		// Stored without an extension before uploads were checked by content: offered as a download only.
+		"/uploads/blobs/ab/cd/abce": {"application/octet-stream", "attachment"},
+	} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != want[0] || rr.Header().Get("Content-Disposition") != want[1] {
+			t.Errorf("GET %s: %d, Content-Type %q, Content-Disposition %q", path, rr.Code, rr.Header().Get("Content-Type"), rr.Header().Get("Content-Disposition"))
+		}
+		if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("GET %s: X-Content-Type-Options missing", path)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/aliakbar-zohour/go_blog/internal/database"
 	"github.com/aliakbar-zohour/go_blog/pkg/response"
 	"gorm.io/gorm"
 )
@@ -23,7 +24,7 @@ func NewHealthHandler(db *gorm.DB) *HealthHandler {
 // Health godoc
 //
 //	@Summary		Health check
-//	@Description	Returns 200 if the API is up. Checks DB connectivity when database is configured.
+//	@Description	Returns 200 if the API is up. Checks DB connectivity when a database is configured. Read replicas out of rotation do not fail the check, since reads fall back to the primary.
 //	@Tags			health
 //	@Produce		json
 //	@Success		200	{object}	response.Body{data=object}
@@ -45,3 +46,31 @@ func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 	}
 	response.OK(w, map[string]string{"status": "ok"})
 }
+
+// DatabaseStatus reports the connection pools and the read replicas of the database.
+type DatabaseStatus struct {
+	Pools    []database.PoolStats     `json:"pools"`
+	Replicas []database.ReplicaStatus `json:"replicas,omitempty"`
+}
+
+// Database godoc
+//
+//	@Summary		Database status
+//	@Description	Returns the connection pool statistics of the primary and each read replica. With read replicas, also lists each one's last health check. Requires an admin token (ADMIN_AUTHOR_IDS).
+//	@Tags			admin
+//	@Produce		json
+//	@Security		Bearer
+//	@Success		200	{object}	response.Body{data=DatabaseStatus}
+//	@Failure		401	{object}	response.Body
+//	@Failure		403	{object}	response.Body
+//	@Router			/admin/database [get]
+func (h *HealthHandler) Database(w http.ResponseWriter, r *http.Request) {
+	status := DatabaseStatus{Pools: []database.PoolStats{}}
+	if h.db != nil {
+		status.Pools = database.Pools(h.db)
+		if replicas := database.ReplicasOf(h.db); replicas != nil {
+			status.Replicas = replicas.Status()
+		}
+	}
+	response.OK(w, status)
+}
@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/aliakbar-zohour/go_blog/internal/testdb"
 )
 
 func TestHealthHandler_Health_NoDB(t *testing.T) {
@@ -22,3 +25,28 @@ func TestHealthHandler_Health_NoDB(t *testing.T) {
 		t.Error("expected JSON body with status")
 	}
 }
+
+func TestHealthHandler_Health_ReportsStatusOnly(t *testing.T) {
+	db := testdb.Open(t)
+	h := NewHealthHandler(db)
+	rr := httptest.NewRecorder()
+	h.Health(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("health: %d, %v", rr.Code, err)
+	}
+	if len(body.Data) != 1 || body.Data["status"] != "ok" {
+		t.Errorf("public health exposes %v", body.Data)
+	}
+
+	rr = httptest.NewRecorder()
+	h.Database(rr, httptest.NewRequest(http.MethodGet, "/api/admin/database", nil))
+	var status struct {
+		Data DatabaseStatus `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil || len(status.Data.Pools) != 1 || status.Data.Pools[0].Name != "primary" {
+		t.Errorf("database status = %+v, %v", status.Data, err)
+	}
+}
@@ -0,0 +1,179 @@
+// handler/media_handler: HTTP handlers for the author's media library.
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/middleware"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/pkg/response"
+	"github.com/go-chi/chi/v5"
+)
+
+type MediaHandler struct {
+	svc *service.MediaService
+	cfg *config.Config
+}
+
+func NewMediaHandler(svc *service.MediaService, cfg *config.Config) *MediaHandler {
+	return &MediaHandler{svc: svc, cfg: cfg}
+}
+
+func (h *MediaHandler) multipartMax() int64 {
+	if h.cfg != nil && h.cfg.BodyLimitBytes > 0 && h.cfg.BodyLimitBytes < defaultMultipartMax {
+		return h.cfg.BodyLimitBytes
+	}
+	return defaultMultipartMax
+}
+
+// Upload godoc
+//
+//	@Summary		Upload to the media library
+//	@Description	Stores an image or video in the logged-in author's media library without attaching it to a post. Attach it later with POST /posts/{id}/media or reference its url from a post body. Requires Authorization: Bearer <token>.
+//	@Tags			media
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			file	formData	file	true	"Image or video file"
+//	@Success		201		{object}	response.Body{data=model.Media}
+//	@Failure		400		{object}	response.Body
+//	@Failure		401		{object}	response.Body
+//	@Failure		403		{object}	response.Body	"quota_exceeded"
+//	@Router			/media [post]
+func (h *MediaHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	authorID := middleware.GetAuthorID(r.Context())
+	if authorID == 0 {
+		response.Unauthorized(w, "authorization required to upload media")
+		return
+	}
+	if err := r.ParseMultipartForm(h.multipartMax()); err != nil {
+		response.BadRequest(w, "invalid request format")
+		return
+	}
+	if r.MultipartForm == nil || len(r.MultipartForm.File["file"]) == 0 {
+		response.BadRequestWithCode(w, "validation_failed", "file is required")
+		return
+	}
+	m, err := h.svc.Upload(r.Context(), authorID, r.MultipartForm.File["file"][0])
+	if err != nil {
+		if writeQuotaError(w, err) {
+			return
+		}
+		response.BadRequestWithCode(w, "validation_failed", err.Error())
+		return
+	}
+	response.Created(w, m)
+}
+
+// List godoc
+//
+//	@Summary		List the media library
+//	@Description	Returns a page of the logged-in author's media, newest first. Requires Authorization: Bearer <token>.
+//	@Tags			media
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			type		query		string	false	"image or video"
+//	@Param			q			query		string	false	"Filename contains (case-insensitive)"
+//	@Param			post_id		query		int		false	"Only media attached to this post"
+//	@Param			unattached	query		bool	false	"Only media not attached to any post"
+//	@Param			limit		query		int		false	"Items per page (default 20, max 100)"
+//	@Param			offset		query		int		false	"Number of items to skip"
+//	@Success		200			{object}	response.Body{data=service.MediaListResult}
+//	@Failure		400			{object}	response.Body
+//	@Failure		401			{object}	response.Body
+//	@Failure		500			{object}	response.Body
+//	@Router			/media [get]
+func (h *MediaHandler) List(w http.ResponseWriter, r *http.Request) {
+	authorID := middleware.GetAuthorID(r.Context())
+	if authorID == 0 {
+		response.Unauthorized(w, "authorization required to list media")
+		return
+	}
+	q := r.URL.Query()
+	f := repository.MediaFilter{
+		Type:   model.MediaType(q.Get("type")),
+		Query:  q.Get("q"),
+		PostID: parseOptionalUint(q.Get("post_id")),
+	}
+	if f.Type != "" && f.Type != model.MediaTypeImage && f.Type != model.MediaTypeVideo {
+		response.BadRequestWithCode(w, "invalid_type", "type must be image or video")
+		return
+	}
+	if unattached := parseOptionalBool(q.Get("unattached")); unattached != nil {
+		f.Unattached = *unattached
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	result, err := h.svc.List(r.Context(), authorID, f, limit, offset)
+	if err != nil {
+		response.Internal(w, "failed to list media")
+		return
+	}
+	response.OK(w, result)
+}
+
+// GetByID godoc
+//
+//	@Summary		Get a media library item
+//	@Description	Returns one of the logged-in author's media items. Requires Authorization: Bearer <token>.
+//	@Tags			media
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id	path		int	true	"Media ID"
+//	@Success		200	{object}	response.Body{data=model.Media}
+//	@Failure		400	{object}	response.Body
+//	@Failure		401	{object}	response.Body
+//	@Failure		404	{object}	response.Body
+//	@Router			/media/{id} [get]
+func (h *MediaHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	m, err := h.svc.Get(r.Context(), middleware.GetAuthorID(r.Context()), uint(id))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.OK(w, m)
+}
+
+// Delete godoc
+//
+//	@Summary		Delete a media library item
+//	@Description	Removes the item from the library and from every post it is attached to, and frees its storage. Requires Authorization: Bearer <token>.
+//	@Tags			media
+//	@Security		Bearer
+//	@Param			id	path	int	true	"Media ID"
+//	@Success		204	"No content"
+//	@Failure		400	{object}	response.Body
+//	@Failure		401	{object}	response.Body
+//	@Failure		404	{object}	response.Body
+//	@Failure		500	{object}	response.Body
+//	@Router			/media/{id} [delete]
+func (h *MediaHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	if err := h.svc.Delete(r.Context(), middleware.GetAuthorID(r.Context()), uint(id)); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.NoContent(w)
+}
+
+func (h *MediaHandler) writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrMediaNotFound) {
+		response.NotFoundWithCode(w, "media_not_found", err.Error())
+		return
+	}
+	response.Internal(w, "failed to process media")
+}
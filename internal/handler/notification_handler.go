@@ -0,0 +1,249 @@
+// handler/notification_handler: Notification inbox, preferences and category watches of the logged-in author.
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/aliakbar-zohour/go_blog/internal/middleware"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/pkg/response"
+)
+
+type NotificationHandler struct {
+	svc *service.NotificationService
+}
+
+func NewNotificationHandler(svc *service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{svc: svc}
+}
+
+// List godoc
+//
+//	@Summary		List notifications
+//	@Description	Returns the logged-in author's notifications, newest first. Types: comment_on_post, comment_reply, mention, new_post_in_category. Requires Authorization: Bearer <token>.
+//	@Tags			notifications
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			unread	query		bool	false	"Only unread notifications"
+//	@Param			limit	query		int		false	"Items per page (default 20)"
+//	@Param			offset	query		int		false	"Number of items to skip"
+//	@Success		200		{object}	response.Body{data=service.NotificationListResult}
+//	@Failure		401		{object}	response.Body
+//	@Failure		500		{object}	response.Body
+//	@Router			/notifications [get]
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	unread := parseOptionalBool(r.URL.Query().Get("unread"))
+	result, err := h.svc.List(r.Context(), middleware.GetAuthorID(r.Context()), unread != nil && *unread, limit, offset)
+	if err != nil {
+		response.Internal(w, "failed to list notifications")
+		return
+	}
+	response.OK(w, result)
+}
+
+// UnreadCount godoc
+//
+//	@Summary		Count unread notifications
+//	@Description	Returns {"unread": n} for the logged-in author, e.g. for a badge. Requires Authorization: Bearer <token>.
+//	@Tags			notifications
+//	@Produce		json
+//	@Security		Bearer
+//	@Success		200	{object}	response.Body{data=map[string]int64}
+//	@Failure		401	{object}	response.Body
+//	@Failure		500	{object}	response.Body
+//	@Router			/notifications/unread-count [get]
+func (h *NotificationHandler) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	n, err := h.svc.UnreadCount(r.Context(), middleware.GetAuthorID(r.Context()))
+	if err != nil {
+		response.Internal(w, "failed to count notifications")
+		return
+	}
+	response.OK(w, map[string]int64{"unread": n})
+}
+
+// MarkRead godoc
+//
+//	@Summary		Mark a notification as read
+//	@Description	Marks one of the logged-in author's notifications as read. Marking it again is harmless. Requires Authorization: Bearer <token>.
+//	@Tags			notifications
+//	@Security		Bearer
+//	@Param			id	path	int	true	"Notification ID"
+//	@Success		204	"No Content"
+//	@Failure		400	{object}	response.Body
+//	@Failure		401	{object}	response.Body
+//	@Failure		404	{object}	response.Body
+//	@Failure		500	{object}	response.Body
+//	@Router			/notifications/{id}/read [post]
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	err = h.svc.MarkRead(r.Context(), middleware.GetAuthorID(r.Context()), uint(id))
+	if errors.Is(err, service.ErrNotificationNotFound) {
+		response.NotFoundWithCode(w, "notification_not_found", err.Error())
+		return
+	}
+	if err != nil {
+		response.Internal(w, "failed to mark notification as read")
+		return
+	}
+	response.NoContent(w)
+}
+
+// MarkAllRead godoc
+//
+//	@Summary		Mark all notifications as read
+//	@Description	Marks every unread notification of the logged-in author as read and returns {"updated": n}. Requires Authorization: Bearer <token>.
+//	@Tags			notifications
+//	@Produce		json
+//	@Security		Bearer
+//	@Success		200	{object}	response.Body{data=map[string]int64}
+//	@Failure		401	{object}	response.Body
+//	@Failure		500	{object}	response.Body
+//	@Router			/notifications/read-all [post]
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	n, err := h.svc.MarkAllRead(r.Context(), middleware.GetAuthorID(r.Context()))
+	if err != nil {
+		response.Internal(w, "failed to mark notifications as read")
+		return
+	}
+	response.OK(w, map[string]int64{"updated": n})
+}
+
+// GetPreferences godoc
+//
+//	@Summary		Get notification preferences
+//	@Description	Returns whether each notification type (comment_on_post, comment_reply, mention, new_post_in_category) is enabled for the logged-in author. Types are enabled by default. Requires Authorization: Bearer <token>.
+//	@Tags			notifications
+//	@Produce		json
+//	@Security		Bearer
+//	@Success		200	{object}	response.Body{data=map[string]bool}
+//	@Failure		401	{object}	response.Body
+//	@Failure		500	{object}	response.Body
+//	@Router			/notifications/preferences [get]
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs, err := h.svc.Preferences(r.Context(), middleware.GetAuthorID(r.Context()))
+	if err != nil {
+		response.Internal(w, "failed to load preferences")
+		return
+	}
+	response.OK(w, prefs)
+}
+
+// UpdatePreferences godoc
+//
+//	@Summary		Update notification preferences
+//	@Description	Switches notification types on or off, e.g. {"comment_reply": false}. A disabled type is neither stored nor emailed. Omitted types keep their setting. Requires Authorization: Bearer <token>.
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			body	body		map[string]bool	true	"Type to enabled"
+//	@Success		200		{object}	response.Body{data=map[string]bool}
+//	@Failure		400		{object}	response.Body
+//	@Failure		401		{object}	response.Body
+//	@Failure		500		{object}	response.Body
+//	@Router			/notifications/preferences [put]
+func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	var body map[model.NotificationType]bool
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.BadRequestWithCode(w, "invalid_body", "invalid body")
+		return
+	}
+	prefs, err := h.svc.UpdatePreferences(r.Context(), middleware.GetAuthorID(r.Context()), body)
+	if errors.Is(err, service.ErrUnknownNotificationType) {
+		response.BadRequestWithCode(w, "validation_failed", err.Error())
+		return
+	}
+	if err != nil {
+		response.Internal(w, "failed to save preferences")
+		return
+	}
+	response.OK(w, prefs)
+}
+
+// Watches godoc
+//
+//	@Summary		List watched categories
+//	@Description	Returns the categories the logged-in author watches; new posts in them create new_post_in_category notifications. Requires Authorization: Bearer <token>.
+//	@Tags			notifications
+//	@Produce		json
+//	@Security		Bearer
+//	@Success		200	{object}	response.Body{data=[]model.CategoryWatch}
+//	@Failure		401	{object}	response.Body
+//	@Failure		500	{object}	response.Body
+//	@Router			/notifications/watches [get]
+func (h *NotificationHandler) Watches(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.Watches(r.Context(), middleware.GetAuthorID(r.Context()))
+	if err != nil {
+		response.Internal(w, "failed to list watches")
+		return
+	}
+	response.OK(w, list)
+}
+
+// WatchCategory godoc
+//
+//	@Summary		Watch a category
+//	@Description	Notifies the logged-in author about new posts in the category. Watching twice is harmless. Requires Authorization: Bearer <token>.
+//	@Tags			notifications
+//	@Security		Bearer
+//	@Param			id	path	int	true	"Category ID"
+//	@Success		204	"No Content"
+//	@Failure		400	{object}	response.Body
+//	@Failure		401	{object}	response.Body
+//	@Failure		404	{object}	response.Body
+//	@Failure		500	{object}	response.Body
+//	@Router			/categories/{id}/watch [put]
+func (h *NotificationHandler) WatchCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	err = h.svc.WatchCategory(r.Context(), middleware.GetAuthorID(r.Context()), uint(id))
+	if errors.Is(err, service.ErrCategoryNotFound) {
+		response.NotFoundWithCode(w, "category_not_found", err.Error())
+		return
+	}
+	if err != nil {
+		response.Internal(w, "failed to watch category")
+		return
+	}
+	response.NoContent(w)
+}
+
+// UnwatchCategory godoc
+//
+//	@Summary		Stop watching a category
+//	@Description	Stops new_post_in_category notifications for the category. Requires Authorization: Bearer <token>.
+//	@Tags			notifications
+//	@Security		Bearer
+//	@Param			id	path	int	true	"Category ID"
+//	@Success		204	"No Content"
+//	@Failure		400	{object}	response.Body
+//	@Failure		401	{object}	response.Body
+//	@Failure		500	{object}	response.Body
+//	@Router			/categories/{id}/watch [delete]
+func (h *NotificationHandler) UnwatchCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	if err := h.svc.UnwatchCategory(r.Context(), middleware.GetAuthorID(r.Context()), uint(id)); err != nil {
+		response.Internal(w, "failed to unwatch category")
+		return
+	}
+	response.NoContent(w)
+}
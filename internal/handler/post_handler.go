@@ -2,6 +2,8 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
 	"mime/multipart"
 	"net/http"
 	"strconv"
@@ -11,6 +13,7 @@ import (
 	"github.com/aliakbar-zohour/go_blog/internal/middleware"
 	"github.com/aliakbar-zohour/go_blog/internal/model"
 	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/internal/upload"
 	"github.com/aliakbar-zohour/go_blog/pkg/response"
 	"github.com/go-chi/chi/v5"
 )
@@ -36,7 +39,7 @@ func (h *PostHandler) multipartMax() int64 {
 // Create godoc
 //
 //	@Summary		Create a post
-//	@Description	Creates a new post (author = logged-in user from JWT). Requires Authorization: Bearer <token>.
+//	@Description	Creates a new post (author = logged-in user from JWT) and, once saved, emails it to newsletter subscribers in the background. Requires Authorization: Bearer <token>. The post, banner and media are saved together: if any file is invalid nothing is saved and 400 invalid_files lists every rejected file.
 //	@Tags			posts
 //	@Accept			multipart/form-data
 //	@Produce		json
@@ -44,11 +47,13 @@ func (h *PostHandler) multipartMax() int64 {
 //	@Param			title		formData	string	true	"Post title"
 //	@Param			body		formData	string	false	"Post body"
 //	@Param			category_id	formData	int		false	"Category ID"
+//	@Param			private		formData	bool	false	"Serve banner and media only through signed, expiring URLs"
 //	@Param			banner		formData	file	false	"Banner image"
 //	@Param			files		formData	file	false	"Image or video files"
 //	@Success		201			{object}	response.Body{data=model.Post}
-//	@Failure		400			{object}	response.Body
+//	@Failure		400			{object}	response.Body{data=service.InvalidFilesError}	"invalid_files"
 //	@Failure		401			{object}	response.Body
+//	@Failure		403			{object}	response.Body	"quota_exceeded"
 //	@Router			/posts [post]
 func (h *PostHandler) Create(w http.ResponseWriter, r *http.Request) {
 	maxMem := h.multipartMax()
@@ -62,6 +67,7 @@ func (h *PostHandler) Create(w http.ResponseWriter, r *http.Request) {
 	title := r.FormValue("title")
 	body := r.FormValue("body")
 	categoryID := parseOptionalUint(r.FormValue("category_id"))
+	private := parseOptionalBool(r.FormValue("private"))
 	authorID := middleware.GetAuthorID(r.Context())
 	if authorID == 0 {
 		response.Unauthorized(w, "authorization required to create a post")
@@ -72,8 +78,11 @@ func (h *PostHandler) Create(w http.ResponseWriter, r *http.Request) {
 		banner = r.MultipartForm.File["banner"][0]
 	}
 	files := r.MultipartForm.File["files"]
-	post, err := h.svc.Create(r.Context(), title, body, &authorID, categoryID, banner, files)
+	post, err := h.svc.Create(r.Context(), title, body, &authorID, categoryID, private != nil && *private, banner, files)
 	if err != nil {
+		if writeQuotaError(w, err) || writeFilesError(w, err) {
+			return
+		}
 		response.BadRequest(w, err.Error())
 		return
 	}
@@ -83,9 +92,10 @@ func (h *PostHandler) Create(w http.ResponseWriter, r *http.Request) {
 // GetByID godoc
 //
 //	@Summary		Get a post by ID
-//	@Description	Returns the post with the given ID.
+//	@Description	Returns the post with the given ID. The banner and media of a private post are only returned, with signed URLs, when Authorization: Bearer <token> is the post's author's.
 //	@Tags			posts
 //	@Produce		json
+//	@Security		Bearer
 //	@Param			id	path		int	true	"Post ID"
 //	@Success		200	{object}	response.Body{data=model.Post}
 //	@Failure		400	{object}	response.Body
@@ -97,7 +107,7 @@ func (h *PostHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		response.BadRequest(w, "invalid id")
 		return
 	}
-	post, err := h.svc.GetByID(r.Context(), uint(id))
+	post, err := h.svc.GetByID(r.Context(), uint(id), middleware.GetAuthorID(r.Context()))
 	if err != nil {
 		response.NotFound(w, "post not found")
 		return
@@ -112,9 +122,10 @@ func (h *PostHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 // List godoc
 //
 //	@Summary		List posts
-//	@Description	Returns a paginated list of posts. Optionally filter by category_id.
+//	@Description	Returns a paginated list of posts. Optionally filter by category_id. Private posts are listed without banner and media, except to their author (Authorization: Bearer <token>).
 //	@Tags			posts
 //	@Produce		json
+//	@Security		Bearer
 //	@Param			limit		query		int	false	"Items per page (default 20)"
 //	@Param			offset		query		int	false	"Number of items to skip"
 //	@Param			category_id	query		int	false	"Filter by category ID"
@@ -125,7 +136,7 @@ func (h *PostHandler) List(w http.ResponseWriter, r *http.Request) {
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
 	categoryID := parseOptionalUint(r.URL.Query().Get("category_id"))
-	result, err := h.svc.List(r.Context(), limit, offset, categoryID)
+	result, err := h.svc.List(r.Context(), limit, offset, categoryID, middleware.GetAuthorID(r.Context()))
 	if err != nil {
 		response.Internal(w, "failed to list posts")
 		return
@@ -136,7 +147,7 @@ func (h *PostHandler) List(w http.ResponseWriter, r *http.Request) {
 // Update godoc
 //
 //	@Summary		Update a post
-//	@Description	Updates own post. Requires Authorization: Bearer <token>. Empty fields are left unchanged.
+//	@Description	Updates own post. Requires Authorization: Bearer <token>. Empty fields are left unchanged. The change is saved as a whole: if any file is invalid nothing is saved and 400 invalid_files lists every rejected file.
 //	@Tags			posts
 //	@Accept			multipart/form-data
 //	@Produce		json
@@ -145,10 +156,11 @@ func (h *PostHandler) List(w http.ResponseWriter, r *http.Request) {
 //	@Param			title		formData	string	false	"New title"
 //	@Param			body		formData	string	false	"New body"
 //	@Param			category_id	formData	int		false	"Category ID"
+//	@Param			private		formData	bool	false	"Serve banner and media only through signed URLs"
 //	@Param			banner		formData	file	false	"New banner image"
 //	@Param			files		formData	file	false	"New media files"
 //	@Success		200			{object}	response.Body{data=model.Post}
-//	@Failure		400			{object}	response.Body
+//	@Failure		400			{object}	response.Body{data=service.InvalidFilesError}	"invalid_files"
 //	@Failure		401			{object}	response.Body
 //	@Failure		403			{object}	response.Body
 //	@Failure		404			{object}	response.Body
@@ -167,6 +179,7 @@ func (h *PostHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 	var title, body string
 	var categoryID *uint
+	var private *bool
 	var banner *multipart.FileHeader
 	var files []*multipart.FileHeader
 	if strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
@@ -181,6 +194,7 @@ func (h *PostHandler) Update(w http.ResponseWriter, r *http.Request) {
 		title = r.FormValue("title")
 		body = r.FormValue("body")
 		categoryID = parseOptionalUint(r.FormValue("category_id"))
+		private = parseOptionalBool(r.FormValue("private"))
 		if r.MultipartForm != nil {
 			if len(r.MultipartForm.File["banner"]) > 0 {
 				banner = r.MultipartForm.File["banner"][0]
@@ -192,8 +206,9 @@ func (h *PostHandler) Update(w http.ResponseWriter, r *http.Request) {
 		title = r.FormValue("title")
 		body = r.FormValue("body")
 		categoryID = parseOptionalUint(r.FormValue("category_id"))
+		private = parseOptionalBool(r.FormValue("private"))
 	}
-	existing, err := h.svc.GetByID(r.Context(), uint(id))
+	existing, err := h.svc.GetByID(r.Context(), uint(id), loggedAuthorID)
 	if err != nil || existing == nil {
 		response.NotFound(w, "post not found")
 		return
@@ -202,8 +217,11 @@ func (h *PostHandler) Update(w http.ResponseWriter, r *http.Request) {
 		response.Forbidden(w, "you can only edit your own posts")
 		return
 	}
-	post, err := h.svc.Update(r.Context(), uint(id), title, body, nil, categoryID, banner, files)
+	post, err := h.svc.Update(r.Context(), uint(id), title, body, nil, categoryID, private, banner, files)
 	if err != nil {
+		if writeQuotaError(w, err) || writeFilesError(w, err) {
+			return
+		}
 		response.Internal(w, err.Error())
 		return
 	}
@@ -214,6 +232,138 @@ func (h *PostHandler) Update(w http.ResponseWriter, r *http.Request) {
 	response.OK(w, post)
 }
 
+// AttachMediaRequest body for POST /posts/{id}/media: either a finished upload or media library items.
+type AttachMediaRequest struct {
+	UploadID string `json:"upload_id,omitempty" example:"3f2a9c0d4b1e4f6a8c7d5e2b1a0f9e8d"`
+	MediaIDs []uint `json:"media_ids,omitempty" example:"4,9"`
+}
+
+// AttachMedia godoc
+//
+//	@Summary		Attach media to a post
+//	@Description	Attaches a completed resumable upload (upload_id, see /uploads) or items of your media library (media_ids, see /media) to the post. Requires Authorization: Bearer <token>; you can only attach your own uploads and media to your own posts.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id		path		int					true	"Post ID"
+//	@Param			body	body		AttachMediaRequest	true	"Upload or media to attach"
+//	@Success		200		{object}	response.Body{data=model.Post}
+//	@Failure		400		{object}	response.Body
+//	@Failure		401		{object}	response.Body
+//	@Failure		403		{object}	response.Body
+//	@Failure		404		{object}	response.Body
+//	@Failure		409		{object}	response.Body
+//	@Failure		415		{object}	response.Body
+//	@Failure		500		{object}	response.Body
+//	@Router			/posts/{id}/media [post]
+func (h *PostHandler) AttachMedia(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	loggedAuthorID := middleware.GetAuthorID(r.Context())
+	if loggedAuthorID == 0 {
+		response.Unauthorized(w, "authorization required to attach media")
+		return
+	}
+	var body AttachMediaRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (body.UploadID == "") == (len(body.MediaIDs) == 0) {
+		response.BadRequestWithCode(w, "invalid_body", "exactly one of upload_id or media_ids is required")
+		return
+	}
+	existing, err := h.svc.GetByID(r.Context(), uint(id), loggedAuthorID)
+	if err != nil || existing == nil {
+		response.NotFound(w, "post not found")
+		return
+	}
+	if !canEditPost(existing, loggedAuthorID) {
+		response.Forbidden(w, "you can only edit your own posts")
+		return
+	}
+	var post *model.Post
+	if body.UploadID != "" {
+		post, err = h.svc.AttachUpload(r.Context(), uint(id), body.UploadID, loggedAuthorID)
+	} else {
+		post, err = h.svc.AttachMedia(r.Context(), uint(id), loggedAuthorID, body.MediaIDs)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrMediaNotFound):
+			response.NotFoundWithCode(w, "media_not_found", err.Error())
+		case errors.Is(err, service.ErrUploadNotFound):
+			response.NotFoundWithCode(w, "upload_not_found", err.Error())
+		case errors.Is(err, service.ErrUploadIncomplete):
+			response.ErrWithCode(w, http.StatusConflict, "upload_incomplete", err.Error())
+		case errors.Is(err, upload.ErrTypeNotAllowed):
+			response.ErrWithCode(w, http.StatusUnsupportedMediaType, "type_not_allowed", "upload content is not an allowed image or video")
+		case writeQuotaError(w, err):
+		default:
+			response.Internal(w, "failed to attach media")
+		}
+		return
+	}
+	if post == nil {
+		response.NotFound(w, "post not found")
+		return
+	}
+	response.OK(w, post)
+}
+
+// DetachMedia godoc
+//
+//	@Summary		Detach media from a post
+//	@Description	Removes a media item from the post. The item stays in the author's media library. Requires Authorization: Bearer <token>.
+//	@Tags			posts
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			id		path		int	true	"Post ID"
+//	@Param			mediaId	path		int	true	"Media ID"
+//	@Success		200		{object}	response.Body{data=model.Post}
+//	@Failure		400		{object}	response.Body
+//	@Failure		401		{object}	response.Body
+//	@Failure		403		{object}	response.Body
+//	@Failure		404		{object}	response.Body
+//	@Failure		500		{object}	response.Body
+//	@Router			/posts/{id}/media/{mediaId} [delete]
+func (h *PostHandler) DetachMedia(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	mediaID, err := strconv.ParseUint(chi.URLParam(r, "mediaId"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid media id")
+		return
+	}
+	loggedAuthorID := middleware.GetAuthorID(r.Context())
+	if loggedAuthorID == 0 {
+		response.Unauthorized(w, "authorization required to detach media")
+		return
+	}
+	existing, err := h.svc.GetByID(r.Context(), uint(id), loggedAuthorID)
+	if err != nil || existing == nil {
+		response.NotFound(w, "post not found")
+		return
+	}
+	if !canEditPost(existing, loggedAuthorID) {
+		response.Forbidden(w, "you can only edit your own posts")
+		return
+	}
+	post, err := h.svc.DetachMedia(r.Context(), uint(id), uint(mediaID))
+	if err != nil {
+		response.Internal(w, "failed to detach media")
+		return
+	}
+	if post == nil {
+		response.NotFound(w, "post not found")
+		return
+	}
+	response.OK(w, post)
+}
+
 // Delete godoc
 //
 //	@Summary		Delete a post
@@ -238,7 +388,7 @@ func (h *PostHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		response.Unauthorized(w, "authorization required to delete a post")
 		return
 	}
-	existing, err := h.svc.GetByID(r.Context(), uint(id))
+	existing, err := h.svc.GetByID(r.Context(), uint(id), loggedAuthorID)
 	if err != nil || existing == nil {
 		response.NotFound(w, "post not found")
 		return
@@ -254,6 +404,25 @@ func (h *PostHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	response.NoContent(w)
 }
 
+// writeQuotaError sends 403 with code quota_exceeded when err is a quota error and reports whether it did.
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, service.ErrQuotaExceeded) {
+		return false
+	}
+	response.ErrWithCode(w, http.StatusForbidden, "quota_exceeded", err.Error())
+	return true
+}
+
+// writeFilesError answers 400 invalid_files with every rejected file when err is a *service.InvalidFilesError.
+func writeFilesError(w http.ResponseWriter, err error) bool {
+	var invalid *service.InvalidFilesError
+	if !errors.As(err, &invalid) {
+		return false
+	}
+	response.ErrWithData(w, http.StatusBadRequest, "invalid_files", err.Error(), invalid)
+	return true
+}
+
 func canEditPost(post *model.Post, authorID uint) bool {
 	if post.AuthorID == 0 {
 		return true
@@ -273,3 +442,15 @@ func parseOptionalUint(s string) *uint {
 	u := uint(n)
 	return &u
 }
+
+func parseOptionalBool(s string) *bool {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil
+	}
+	return &b
+}
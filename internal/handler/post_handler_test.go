@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/memrepo"
+	"github.com/aliakbar-zohour/go_blog/internal/middleware"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/pkg/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPostHandler_PrivateMediaOnlyForTheAuthor(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "jwt", MediaURLSecret: "media", MediaURLTTL: time.Minute, UploadDir: t.TempDir()}
+	db := memrepo.New()
+	postRepo, mediaRepo := memrepo.NewPostRepository(db), memrepo.NewMediaRepository(db)
+	urls := service.NewMediaURLService(memrepo.NewStorageRepository(db), cfg)
+	usage := service.NewUsageService(memrepo.NewUsageRepository(db), memrepo.NewAuthorRepository(db), cfg)
+	svc := service.NewPostService(postRepo, mediaRepo, memrepo.NewUploadRepository(db), memrepo.NewBlobRepository(db), urls, usage, memrepo.NewTransactor(), nil, cfg)
+	ctx := context.Background()
+	post := &model.Post{Title: "Draft", AuthorID: 7, CategoryID: 1, Private: true, BannerPath: "blobs/aa/bb/banner.png"}
+	if err := postRepo.Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+	m := &model.Media{AuthorID: 7, Type: model.MediaTypeImage, Path: "blobs/cc/dd/photo.png"}
+	if err := mediaRepo.Create(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := postRepo.AttachMedia(ctx, post.ID, m.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	ph := NewPostHandler(svc, cfg)
+	r := chi.NewRouter()
+	r.With(middleware.OptionalAuth(cfg.JWTSecret)).Get("/posts", ph.List)
+	r.With(middleware.OptionalAuth(cfg.JWTSecret)).Get("/posts/{id}", ph.GetByID)
+	get := func(path string, authorID uint) model.Post {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorID != 0 {
+			token, err := auth.NewToken(authorID, cfg.JWTSecret, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s as %d: status %d", path, authorID, rr.Code)
+		}
+		var body struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		var p model.Post
+		if path == "/posts" {
+			var list service.ListResult
+			if err := json.Unmarshal(body.Data, &list); err != nil || len(list.Items) != 1 {
+				t.Fatalf("list: %s (%v)", body.Data, err)
+			}
+			return list.Items[0]
+		}
+		if err := json.Unmarshal(body.Data, &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	byID := "/posts/" + strconv.FormatUint(uint64(post.ID), 10)
+
+	// Anonymous readers and other authors get the post without a path or URL to its files.
+	for _, viewer := range []uint{0, 8} {
+		for _, path := range []string{byID, "/posts"} {
+			p := get(path, viewer)
+			if p.BannerURL != "" || p.BannerPath != "" || len(p.Media) != 0 {
+				t.Errorf("GET %s as %d: banner %q (%q), media %+v", path, viewer, p.BannerURL, p.BannerPath, p.Media)
+			}
+		}
+	}
+
+	// The author gets signed URLs the file server accepts.
+	p := get(byID, 7)
+	if len(p.Media) != 1 {
+		t.Fatalf("author: media %+v", p.Media)
+	}
+	for _, raw := range []string{p.BannerURL, p.Media[0].URL} {
+		u, err := url.Parse(raw)
+		if err != nil || u.Query().Get("sig") == "" {
+			t.Fatalf("author: unsigned url %q", raw)
+		}
+		if err := urls.Authorize(ctx, u.Path[len(service.UploadsPrefix):], u.Query()); err != nil {
+			t.Errorf("author url %q: %v", raw, err)
+		}
+	}
+}
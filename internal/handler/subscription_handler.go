@@ -0,0 +1,161 @@
+// handler/subscription_handler: Newsletter subscribe (double opt-in), confirm and one-click unsubscribe endpoints.
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/pkg/response"
+	"github.com/go-chi/chi/v5"
+)
+
+// SubscribeRequest body for POST /subscriptions
+type SubscribeRequest struct {
+	Email     string `json:"email" example:"reader@example.com"`
+	Scope     string `json:"scope,omitempty" example:"category"`         // blog (default), category or author
+	TargetID  uint   `json:"target_id,omitempty" example:"1"`            // category or author ID
+	Frequency string `json:"frequency,omitempty" example:"weekly"`       // instant (default, one email per post), daily or weekly digest
+	Timezone  string `json:"timezone,omitempty" example:"Europe/Berlin"` // IANA timezone for digest delivery; default UTC
+	Locale    string `json:"locale,omitempty" example:"en"`              // email language; defaults to the first Accept-Language tag
+}
+
+type SubscriptionHandler struct {
+	svc *service.NewsletterService
+}
+
+func NewSubscriptionHandler(svc *service.NewsletterService) *SubscriptionHandler {
+	return &SubscriptionHandler{svc: svc}
+}
+
+// Subscribe godoc
+//
+//	@Summary		Subscribe to new posts
+//	@Description	Emails a confirmation link (double opt-in); new posts are only sent after it is opened. Subscribe to the whole blog, a category or an author, either per post or as a daily or weekly digest (sent at DIGEST_HOUR in the given timezone; weekly on Mondays). No login required. With DEV_TOKENS=true the token is also returned as dev_token.
+//	@Tags			subscriptions
+//	@Accept			json
+//	@Produce		json
+//	@Param			body			body		SubscribeRequest	true	"Email and what to subscribe to"
+//	@Param			Accept-Language	header		string				false	"Email language when body.locale is empty"
+//	@Success		202				{object}	response.Body{data=object}
+//	@Failure		400				{object}	response.Body
+//	@Failure		503				{object}	response.Body	"email_not_sent"
+//	@Router			/subscriptions [post]
+func (h *SubscriptionHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	var body SubscribeRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.BadRequestWithCode(w, "invalid_body", "invalid body")
+		return
+	}
+	if len(body.Email) > 255 {
+		response.BadRequestWithCode(w, "email_too_long", "email too long")
+		return
+	}
+	locale := body.Locale
+	if locale == "" {
+		locale = preferredLanguage(r.Header.Get("Accept-Language"))
+	}
+	devToken, err := h.svc.Subscribe(r.Context(), body.Email, model.SubscriptionScope(body.Scope), body.TargetID, model.SubscriptionFrequency(body.Frequency), body.Timezone, locale)
+	if errors.Is(err, service.ErrEmailNotSent) {
+		response.ErrWithCode(w, http.StatusServiceUnavailable, "email_not_sent", "could not send confirmation email, try again later")
+		return
+	}
+	if err != nil {
+		response.BadRequestWithCode(w, "validation_failed", err.Error())
+		return
+	}
+	res := map[string]interface{}{"message": "Check your inbox to confirm the subscription."}
+	if devToken != "" {
+		res["dev_token"] = devToken
+	}
+	response.JSON(w, http.StatusAccepted, res)
+}
+
+// Confirm godoc
+//
+//	@Summary		Confirm a subscription
+//	@Description	Opened from the confirmation email; activates the subscription.
+//	@Tags			subscriptions
+//	@Produce		json
+//	@Param			token	query		string	true	"Token from the confirmation email"
+//	@Success		200		{object}	response.Body{data=model.Subscription}
+//	@Failure		400		{object}	response.Body	"invalid_token"
+//	@Router			/subscriptions/confirm [get]
+func (h *SubscriptionHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.svc.Confirm(r.Context(), r.URL.Query().Get("token"))
+	if errors.Is(err, service.ErrInvalidConfirmToken) {
+		response.BadRequestWithCode(w, "invalid_token", err.Error())
+		return
+	}
+	if err != nil {
+		response.Internal(w, "failed to confirm subscription")
+		return
+	}
+	response.OK(w, sub)
+}
+
+// Get godoc
+//
+//	@Summary		Show the subscription of an unsubscribe link
+//	@Description	Returns the subscription so a page can ask "unsubscribe?"; it does not unsubscribe, because mail scanners prefetch links. POST the same URL to unsubscribe.
+//	@Tags			subscriptions
+//	@Produce		json
+//	@Param			id		path		int		true	"Subscription ID"
+//	@Param			expires	query		int		true	"Expiry (Unix seconds) from the link"
+//	@Param			sig		query		string	true	"Signature from the link"
+//	@Success		200		{object}	response.Body{data=model.Subscription}
+//	@Failure		403		{object}	response.Body	"invalid_signature"
+//	@Failure		404		{object}	response.Body
+//	@Router			/subscriptions/{id}/unsubscribe [get]
+func (h *SubscriptionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	sub, err := h.svc.Get(r.Context(), uint(id), r.URL.Query())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.OK(w, sub)
+}
+
+// Unsubscribe godoc
+//
+//	@Summary		Unsubscribe
+//	@Description	Deletes the subscription of a signed unsubscribe link. Also the target of the List-Unsubscribe header: mail clients POST List-Unsubscribe=One-Click here (RFC 8058). Unsubscribing twice succeeds.
+//	@Tags			subscriptions
+//	@Accept			x-www-form-urlencoded
+//	@Param			id		path	int		true	"Subscription ID"
+//	@Param			expires	query	int		true	"Expiry (Unix seconds) from the link"
+//	@Param			sig		query	string	true	"Signature from the link"
+//	@Success		204		"No content"
+//	@Failure		403		{object}	response.Body	"invalid_signature"
+//	@Router			/subscriptions/{id}/unsubscribe [post]
+func (h *SubscriptionHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		response.BadRequest(w, "invalid id")
+		return
+	}
+	if err := h.svc.Unsubscribe(r.Context(), uint(id), r.URL.Query()); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response.NoContent(w)
+}
+
+func (h *SubscriptionHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidUnsubscribe):
+		response.ErrWithCode(w, http.StatusForbidden, "invalid_signature", err.Error())
+	case errors.Is(err, service.ErrSubscriptionNotFound):
+		response.NotFoundWithCode(w, "subscription_not_found", err.Error())
+	default:
+		response.Internal(w, "failed to process subscription")
+	}
+}
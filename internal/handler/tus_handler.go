@@ -0,0 +1,247 @@
+// handler/tus_handler: tus 1.0 resumable upload endpoints (creation, HEAD resume, PATCH chunks, termination, expiration).
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aliakbar-zohour/go_blog/internal/middleware"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/pkg/response"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,expiration,termination"
+	tusContentType = "application/offset+octet-stream"
+)
+
+type TusHandler struct {
+	svc      *service.UploadService
+	basePath string
+}
+
+// NewTusHandler returns a TusHandler. basePath is the mount path used to build Location headers (e.g. "/api/uploads").
+func NewTusHandler(svc *service.UploadService, basePath string) *TusHandler {
+	return &TusHandler{svc: svc, basePath: strings.TrimSuffix(basePath, "/")}
+}
+
+// Options godoc
+//
+//	@Summary		tus server capabilities
+//	@Description	Returns the supported tus version, extensions and maximum upload size in Tus-* headers.
+//	@Tags			uploads
+//	@Success		204	"No content"
+//	@Router			/uploads [options]
+func (h *TusHandler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.svc.MaxSize(), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create godoc
+//
+//	@Summary		Create a resumable upload
+//	@Description	tus creation: registers an upload of Upload-Length bytes (0 creates a finished, empty upload). Upload-Metadata must contain a base64 "filename" with an allowed image/video extension. Returns Location of the upload. Requires Authorization: Bearer <token>.
+//	@Tags			uploads
+//	@Produce		json
+//	@Security		Bearer
+//	@Param			Tus-Resumable	header		string	true	"Protocol version (1.0.0)"
+//	@Param			Upload-Length	header		int		true	"Total size in bytes"
+//	@Param			Upload-Metadata	header		string	true	"Comma-separated key/base64 pairs, must include filename"
+//	@Success		201				{object}	response.Body{data=model.Upload}
+//	@Failure		400				{object}	response.Body
+//	@Failure		401				{object}	response.Body
+//	@Failure		403				{object}	response.Body	"quota_exceeded"
+//	@Failure		412				{object}	response.Body
+//	@Failure		413				{object}	response.Body
+//	@Router			/uploads [post]
+func (h *TusHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	authorID := middleware.GetAuthorID(r.Context())
+	if authorID == 0 {
+		response.Unauthorized(w, "authorization required to upload")
+		return
+	}
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		response.BadRequestWithCode(w, "defer_length_unsupported", "Upload-Defer-Length is not supported")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		response.BadRequestWithCode(w, "invalid_upload_length", "invalid Upload-Length")
+		return
+	}
+	metadata := r.Header.Get("Upload-Metadata")
+	meta := parseTusMetadata(metadata)
+	u, err := h.svc.Create(r.Context(), authorID, length, meta["filename"], metadata)
+	if err != nil {
+		if errors.Is(err, service.ErrUploadTooLarge) {
+			response.ErrWithCode(w, http.StatusRequestEntityTooLarge, "upload_too_large", err.Error())
+			return
+		}
+		if writeQuotaError(w, err) {
+			return
+		}
+		response.BadRequestWithCode(w, "validation_failed", err.Error())
+		return
+	}
+	w.Header().Set("Location", h.basePath+"/"+u.ID)
+	setUploadHeaders(w, u)
+	response.Created(w, u)
+}
+
+// Head godoc
+//
+//	@Summary		Get upload offset
+//	@Description	tus HEAD: returns Upload-Offset and Upload-Length so an interrupted upload can resume. Requires Authorization: Bearer <token>.
+//	@Tags			uploads
+//	@Security		Bearer
+//	@Param			id	path	string	true	"Upload ID"
+//	@Success		200	"Upload-Offset and Upload-Length headers"
+//	@Failure		404	"Unknown upload"
+//	@Failure		410	"Upload expired"
+//	@Router			/uploads/{id} [head]
+func (h *TusHandler) Head(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	u, err := h.svc.Get(r.Context(), middleware.GetAuthorID(r.Context()), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	setUploadHeaders(w, u)
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	if u.Metadata != "" {
+		w.Header().Set("Upload-Metadata", u.Metadata)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// Patch godoc
+//
+//	@Summary		Upload a chunk
+//	@Description	tus PATCH: appends the request body at Upload-Offset. Content-Type must be application/offset+octet-stream; a chunk is limited by the API body limit and must not be longer than the rest of the upload. A PATCH arriving while another one writes the same upload gets 423; retry it. Requires Authorization: Bearer <token>.
+//	@Tags			uploads
+//	@Accept			application/offset+octet-stream
+//	@Security		Bearer
+//	@Param			id				path	string	true	"Upload ID"
+//	@Param			Upload-Offset	header	int		true	"Offset the chunk starts at"
+//	@Success		204				"New Upload-Offset header"
+//	@Failure		400				{object}	response.Body
+//	@Failure		404				{object}	response.Body
+//	@Failure		409				{object}	response.Body
+//	@Failure		410				{object}	response.Body
+//	@Failure		413				{object}	response.Body
+//	@Failure		415				{object}	response.Body
+//	@Failure		423				{object}	response.Body	"upload_locked"
+//	@Router			/uploads/{id} [patch]
+func (h *TusHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != tusContentType {
+		response.ErrWithCode(w, http.StatusUnsupportedMediaType, "invalid_content_type", "Content-Type must be "+tusContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		response.BadRequestWithCode(w, "invalid_upload_offset", "invalid Upload-Offset")
+		return
+	}
+	u, err := h.svc.Append(r.Context(), middleware.GetAuthorID(r.Context()), chi.URLParam(r, "id"), offset, r.Body)
+	if err != nil {
+		if u != nil {
+			setUploadHeaders(w, u)
+		}
+		h.writeError(w, err)
+		return
+	}
+	setUploadHeaders(w, u)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Delete godoc
+//
+//	@Summary		Terminate an upload
+//	@Description	tus termination: deletes the upload and any bytes received. Requires Authorization: Bearer <token>.
+//	@Tags			uploads
+//	@Security		Bearer
+//	@Param			id	path	string	true	"Upload ID"
+//	@Success		204	"No content"
+//	@Failure		404	{object}	response.Body
+//	@Router			/uploads/{id} [delete]
+func (h *TusHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	if err := h.svc.Terminate(r.Context(), middleware.GetAuthorID(r.Context()), chi.URLParam(r, "id")); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+	response.NoContent(w)
+}
+
+func (h *TusHandler) checkVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		response.ErrWithCode(w, http.StatusPreconditionFailed, "unsupported_tus_version", "unsupported Tus-Resumable version")
+		return false
+	}
+	return true
+}
+
+func (h *TusHandler) writeError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, service.ErrUploadNotFound):
+		response.NotFoundWithCode(w, "upload_not_found", err.Error())
+	case errors.Is(err, service.ErrUploadExpired):
+		response.ErrWithCode(w, http.StatusGone, "upload_expired", err.Error())
+	case errors.Is(err, service.ErrUploadOffsetMismatch):
+		response.ErrWithCode(w, http.StatusConflict, "offset_mismatch", err.Error())
+	case errors.Is(err, service.ErrUploadLocked):
+		response.ErrWithCode(w, http.StatusLocked, "upload_locked", err.Error())
+	case errors.Is(err, service.ErrUploadChunkTooLarge):
+		response.ErrWithCode(w, http.StatusRequestEntityTooLarge, "chunk_too_large", err.Error())
+	case errors.As(err, &maxErr):
+		response.ErrWithCode(w, http.StatusRequestEntityTooLarge, "chunk_too_large", "chunk exceeds request body limit")
+	default:
+		response.Internal(w, "failed to process upload")
+	}
+}
+
+func setUploadHeaders(w http.ResponseWriter, u *model.Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+// parseTusMetadata decodes an Upload-Metadata header ("key base64,key2 base64"). Invalid pairs are skipped.
+func parseTusMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		meta[key] = string(decoded)
+	}
+	return meta
+}
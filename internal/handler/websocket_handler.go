@@ -0,0 +1,291 @@
+// handler/websocket_handler: Authenticated WebSocket pushing an author's notifications and subscribed event topics.
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/middleware"
+	"github.com/aliakbar-zohour/go_blog/internal/pubsub"
+	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsSendBuffer       = 64 // messages queued per connection before it is dropped as a slow consumer
+	wsMaxSubscriptions = 32
+	wsMaxMessageBytes  = 4096
+	wsWriteWait        = 10 * time.Second
+	wsPongWait         = 60 * time.Second
+	wsPingPeriod       = wsPongWait * 9 / 10
+)
+
+// wsNotificationsTopic is the client-side name of the logged-in author's own notification topic.
+const wsNotificationsTopic = "notifications"
+
+type WebSocketHandler struct {
+	hub      *pubsub.Hub
+	posts    *service.PostService
+	upgrader websocket.Upgrader
+}
+
+// NewWebSocketHandler accepts handshakes from the origins allowed by CORS (allowedOrigins, "*" or comma-separated).
+func NewWebSocketHandler(hub *pubsub.Hub, posts *service.PostService, allowedOrigins string) *WebSocketHandler {
+	origins := make(map[string]bool)
+	for _, o := range strings.Split(allowedOrigins, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins[o] = true
+		}
+	}
+	return &WebSocketHandler{hub: hub, posts: posts, upgrader: websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || origins["*"] || origins[origin]
+		},
+	}}
+}
+
+// wsClientMessage is what clients send: {"type":"subscribe","topic":"post:12","last_event_id":41}.
+type wsClientMessage struct {
+	Type        string `json:"type"`
+	Topic       string `json:"topic"`
+	LastEventID uint64 `json:"last_event_id"`
+}
+
+// wsMessage is what the server sends. Type is event, subscribed, unsubscribed, reset or error.
+type wsMessage struct {
+	Type  string          `json:"type"`
+	Topic string          `json:"topic,omitempty"`
+	ID    uint64          `json:"id,omitempty"`
+	Event string          `json:"event,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Code  string          `json:"code,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// Connect godoc
+//
+//	@Summary		WebSocket for notifications and live events
+//	@Description	Upgrades to a WebSocket for the logged-in author. Authenticate with Authorization: Bearer <token> or, from browsers, ?access_token=<token>. The author's notifications (topic "notifications": notification.created, notification.read) are pushed right away; send {"type":"subscribe","topic":"posts"|"post:<id>"|"notifications","last_event_id":<optional>} or {"type":"unsubscribe","topic":...} for more. Server messages: {"type":"event","topic","id","event","data"}, subscribed, unsubscribed, reset (missed events are unknown, reload) and error. Connections that fall 64 messages behind are closed with code 1013; the connection closes with 1008 when the token expires.
+//	@Tags			notifications
+//	@Security		Bearer
+//	@Param			access_token	query	string	false	"JWT, for clients that cannot set the Authorization header"
+//	@Success		101				"Switching Protocols"
+//	@Failure		401				{object}	response.Body
+//	@Router			/ws [get]
+func (h *WebSocketHandler) Connect(w http.ResponseWriter, r *http.Request) {
+	authorID := middleware.GetAuthorID(r.Context())
+	ws, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader has already replied
+	}
+	c := &wsConn{
+		ws:       ws,
+		hub:      h.hub,
+		authorID: authorID,
+		send:     make(chan wsMessage, wsSendBuffer),
+		closed:   make(chan struct{}),
+		subs:     make(map[string]*pubsub.Subscription),
+	}
+	defer c.unsubscribeAll()
+	go c.writeLoop(middleware.GetTokenExpiry(r.Context()))
+	c.subscribe(wsNotificationsTopic, 0)
+	h.readLoop(r, c)
+	c.close(websocket.CloseNormalClosure, "")
+}
+
+func (h *WebSocketHandler) readLoop(r *http.Request, c *wsConn) {
+	c.ws.SetReadLimit(wsMaxMessageBytes)
+	_ = c.ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.ws.SetPongHandler(func(string) error { return c.ws.SetReadDeadline(time.Now().Add(wsPongWait)) })
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg wsClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.enqueue(wsMessage{Type: "error", Code: "invalid_message", Error: "messages must be JSON objects"})
+			continue
+		}
+		switch msg.Type {
+		case "subscribe":
+			if code, reason := h.checkTopic(r, msg.Topic); code != "" {
+				c.enqueue(wsMessage{Type: "error", Topic: msg.Topic, Code: code, Error: reason})
+				continue
+			}
+			c.subscribe(msg.Topic, msg.LastEventID)
+		case "unsubscribe":
+			c.unsubscribe(msg.Topic)
+		default:
+			c.enqueue(wsMessage{Type: "error", Code: "invalid_message", Error: "type must be subscribe or unsubscribe"})
+		}
+	}
+}
+
+// checkTopic validates a topic a client asks for; it returns an error code and message when it is not allowed.
+func (h *WebSocketHandler) checkTopic(r *http.Request, topic string) (string, string) {
+	switch {
+	case topic == wsNotificationsTopic || topic == service.PostsTopic:
+		return "", ""
+	case strings.HasPrefix(topic, "post:"):
+		id, err := strconv.ParseUint(strings.TrimPrefix(topic, "post:"), 10, 32)
+		if err != nil {
+			return "invalid_topic", "invalid post id"
+		}
+		if _, err := h.posts.GetByID(r.Context(), uint(id), 0); err != nil {
+			return "post_not_found", "post not found"
+		}
+		return "", ""
+	}
+	return "invalid_topic", `topic must be "notifications", "posts" or "post:<id>"`
+}
+
+// wsConn is one WebSocket. Messages reach the socket only through send, written by writeLoop.
+type wsConn struct {
+	ws       *websocket.Conn
+	hub      *pubsub.Hub
+	authorID uint
+	send     chan wsMessage
+	once     sync.Once
+	closed   chan struct{}
+	mu       sync.Mutex
+	subs     map[string]*pubsub.Subscription // by client-side topic name
+}
+
+// hubTopic maps a client-side topic name to the hub topic; "notifications" is always the caller's own.
+func (c *wsConn) hubTopic(topic string) string {
+	if topic == wsNotificationsTopic {
+		return service.NotificationsTopic(c.authorID)
+	}
+	return topic
+}
+
+func (c *wsConn) subscribe(topic string, lastID uint64) {
+	c.mu.Lock()
+	if _, ok := c.subs[topic]; ok {
+		c.mu.Unlock()
+		c.enqueue(wsMessage{Type: "subscribed", Topic: topic})
+		return
+	}
+	if len(c.subs) >= wsMaxSubscriptions {
+		c.mu.Unlock()
+		c.enqueue(wsMessage{Type: "error", Topic: topic, Code: "too_many_subscriptions", Error: "too many subscriptions"})
+		return
+	}
+	sub, replay, complete := c.hub.Subscribe(c.hubTopic(topic), lastID)
+	c.subs[topic] = sub
+	c.mu.Unlock()
+
+	c.enqueue(wsMessage{Type: "subscribed", Topic: topic})
+	if !complete {
+		c.enqueue(wsMessage{Type: "reset", Topic: topic})
+	}
+	for _, ev := range replay {
+		c.enqueue(eventMessage(topic, ev))
+	}
+	go c.forward(topic, sub)
+}
+
+// forward copies the events of one subscription to the connection. If the hub drops the subscription
+// because the connection fell behind, the connection is closed.
+func (c *wsConn) forward(topic string, sub *pubsub.Subscription) {
+	for ev := range sub.C {
+		if !c.enqueue(eventMessage(topic, ev)) {
+			return
+		}
+	}
+	c.mu.Lock()
+	dropped := c.subs[topic] == sub
+	c.mu.Unlock()
+	if dropped {
+		c.close(websocket.CloseTryAgainLater, "slow consumer")
+	}
+}
+
+func (c *wsConn) unsubscribe(topic string) {
+	c.mu.Lock()
+	sub, ok := c.subs[topic]
+	delete(c.subs, topic)
+	c.mu.Unlock()
+	if ok {
+		c.hub.Unsubscribe(sub)
+	}
+	c.enqueue(wsMessage{Type: "unsubscribed", Topic: topic})
+}
+
+func (c *wsConn) unsubscribeAll() {
+	c.mu.Lock()
+	subs := c.subs
+	c.subs = make(map[string]*pubsub.Subscription)
+	c.mu.Unlock()
+	for _, sub := range subs {
+		c.hub.Unsubscribe(sub)
+	}
+}
+
+// enqueue queues msg for sending. A connection whose send buffer is full is closed instead of blocking
+// the publishers; enqueue then reports false.
+func (c *wsConn) enqueue(msg wsMessage) bool {
+	select {
+	case <-c.closed:
+		return false
+	default:
+	}
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		c.close(websocket.CloseTryAgainLater, "slow consumer")
+		return false
+	}
+}
+
+// close sends a close frame with code and reason, once, and shuts the socket so the read loop ends.
+func (c *wsConn) close(code int, reason string) {
+	c.once.Do(func() {
+		close(c.closed)
+		_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+		_ = c.ws.Close()
+	})
+}
+
+// writeLoop sends queued messages and pings, and closes the connection when the token expires.
+func (c *wsConn) writeLoop(expiry time.Time) {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	var expired <-chan time.Time
+	if !expiry.IsZero() {
+		t := time.NewTimer(time.Until(expiry))
+		defer t.Stop()
+		expired = t.C
+	}
+	for {
+		select {
+		case <-c.closed:
+			return
+		case msg := <-c.send:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.ws.WriteJSON(msg); err != nil {
+				c.close(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-ping.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				c.close(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-expired:
+			c.close(websocket.ClosePolicyViolation, "token expired")
+			return
+		}
+	}
+}
+
+func eventMessage(topic string, ev pubsub.Event) wsMessage {
+	return wsMessage{Type: "event", Topic: topic, ID: ev.ID, Event: ev.Type, Data: ev.Data}
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/middleware"
+	"github.com/aliakbar-zohour/go_blog/internal/pubsub"
+	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/pkg/auth"
+	"github.com/gorilla/websocket"
+)
+
+func readWS(t *testing.T, ws *websocket.Conn) wsMessage {
+	t.Helper()
+	_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg wsMessage
+	if err := ws.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+func TestWebSocketHandler_AuthenticatedAndScopedToAuthor(t *testing.T) {
+	hub := pubsub.New(16)
+	// The logging and gzip wrappers of the router must let the upgrade hijack the connection.
+	h := middleware.Gzip(middleware.Log(middleware.RequireAuth("secret")(http.HandlerFunc(NewWebSocketHandler(hub, nil, "https://blog.example.com").Connect))))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("dial without token: want 401, got %v", err)
+	}
+	token, _ := auth.NewToken(7, "secret", 1)
+	if _, resp, err := websocket.DefaultDialer.Dial(url+"?access_token="+token, http.Header{"Origin": {"https://evil.example.com"}}); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("dial from another origin: want 403, got %v", err)
+	}
+	ws, _, err := websocket.DefaultDialer.Dial(url+"?access_token="+token, http.Header{"Origin": {"https://blog.example.com"}})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	if msg := readWS(t, ws); msg.Type != "subscribed" || msg.Topic != "notifications" {
+		t.Fatalf("first message = %+v", msg)
+	}
+
+	hub.Publish(1, service.NotificationsTopic(8), service.EventNotificationCreated, map[string]int{"id": 99})
+	hub.Publish(2, service.NotificationsTopic(7), service.EventNotificationCreated, map[string]int{"id": 1})
+	if msg := readWS(t, ws); msg.Type != "event" || msg.Topic != "notifications" || msg.Event != service.EventNotificationCreated || string(msg.Data) != `{"id":1}` {
+		t.Fatalf("notification = %+v (another author's notifications must not arrive)", msg)
+	}
+
+	_ = ws.WriteJSON(wsClientMessage{Type: "subscribe", Topic: "author:8:notifications"})
+	if msg := readWS(t, ws); msg.Type != "error" || msg.Code != "invalid_topic" {
+		t.Fatalf("subscribing to another author's topic: %+v", msg)
+	}
+	_ = ws.WriteJSON(wsClientMessage{Type: "subscribe", Topic: service.PostsTopic})
+	if msg := readWS(t, ws); msg.Type != "subscribed" || msg.Topic != service.PostsTopic {
+		t.Fatalf("subscribe posts: %+v", msg)
+	}
+	hub.Publish(3, service.PostsTopic, service.EventPostCreated, map[string]string{"title": "Hi"})
+	if msg := readWS(t, ws); msg.Event != service.EventPostCreated || msg.Topic != service.PostsTopic {
+		t.Fatalf("post event: %+v", msg)
+	}
+	_ = ws.WriteJSON(wsClientMessage{Type: "unsubscribe", Topic: service.PostsTopic})
+	if msg := readWS(t, ws); msg.Type != "unsubscribed" {
+		t.Fatalf("unsubscribe: %+v", msg)
+	}
+}
+
+func TestWebSocketConn_DropsSlowConsumer(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	enqueued := make(chan int, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		// No write loop runs, so nothing drains the send buffer.
+		c := &wsConn{ws: ws, send: make(chan wsMessage, wsSendBuffer), closed: make(chan struct{})}
+		n := 0
+		for c.enqueue(wsMessage{Type: "event"}) {
+			n++
+		}
+		enqueued <- n
+	}))
+	defer srv.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if n := <-enqueued; n != wsSendBuffer {
+		t.Errorf("enqueued %d messages before dropping, want %d", n, wsSendBuffer)
+	}
+	_, _, err = ws.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != websocket.CloseTryAgainLater {
+		t.Errorf("want close 1013, got %v", err)
+	}
+}
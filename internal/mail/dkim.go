@@ -0,0 +1,221 @@
+// mail/dkim: DKIM signing (RFC 6376) with RSA-SHA256 or Ed25519-SHA256 (RFC 8463) and relaxed/relaxed canonicalization.
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dkimHeaders are signed when present. Content headers are included so a relay cannot swap the body type.
+var dkimHeaders = []string{
+	"From", "To", "Cc", "Reply-To", "Subject", "Date", "Message-ID", "MIME-Version",
+	"Content-Type", "Content-Transfer-Encoding", "Content-Language", "List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// DKIMSigner adds a DKIM-Signature header to encoded messages.
+type DKIMSigner struct {
+	domain    string
+	selector  string
+	key       crypto.Signer
+	algorithm string
+	now       func() time.Time
+}
+
+// NewDKIMSigner parses a PEM private key: PKCS#1 RSA, or PKCS#8 RSA or Ed25519.
+// The public key must be published at <selector>._domainkey.<domain>.
+func NewDKIMSigner(domain, selector string, keyPEM []byte) (*DKIMSigner, error) {
+	if domain == "" || selector == "" {
+		return nil, errors.New("dkim: domain and selector are required")
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("dkim: no PEM private key found")
+	}
+	var parsed any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("dkim: unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim: parse key: %w", err)
+	}
+	s := &DKIMSigner{domain: domain, selector: selector, now: time.Now}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 1024 {
+			return nil, errors.New("dkim: RSA keys must be at least 1024 bits")
+		}
+		s.key, s.algorithm = k, "rsa-sha256"
+	case ed25519.PrivateKey:
+		s.key, s.algorithm = k, "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("dkim: unsupported key type %T", parsed)
+	}
+	return s, nil
+}
+
+// LoadDKIMSigner reads the key from keyFile. It returns nil without error when domain is empty (signing disabled).
+func LoadDKIMSigner(domain, selector, keyFile string) (*DKIMSigner, error) {
+	if domain == "" {
+		return nil, nil
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("dkim: read key: %w", err)
+	}
+	return NewDKIMSigner(domain, selector, keyPEM)
+}
+
+// Algorithm is "rsa-sha256" or "ed25519-sha256".
+func (s *DKIMSigner) Algorithm() string {
+	return s.algorithm
+}
+
+// Sign returns raw (an RFC 5322 message with CRLF line endings) with a DKIM-Signature header prepended.
+func (s *DKIMSigner) Sign(raw []byte) ([]byte, error) {
+	head, body, ok := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !ok {
+		head, body = bytes.TrimSuffix(raw, []byte("\r\n")), nil
+	}
+	fields := parseHeaderFields(string(head))
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	var names []string
+	h := sha256.New()
+	for _, name := range dkimHeaders {
+		if f, ok := lastField(fields, name); ok {
+			names = append(names, strings.ToLower(name))
+			h.Write([]byte(relaxedHeader(f)))
+		}
+	}
+	if len(names) == 0 || names[0] != "from" {
+		return nil, errors.New("dkim: message has no From header")
+	}
+	sig := "v=1; a=" + s.algorithm + "; c=relaxed/relaxed; d=" + s.domain + "; s=" + s.selector +
+		"; t=" + strconv.FormatInt(s.now().Unix(), 10) + "; h=" + strings.Join(names, ":") +
+		"; bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + "; b="
+	// The signature covers its own header with an empty b= and without the trailing CRLF.
+	h.Write([]byte(strings.TrimSuffix(relaxedHeader("DKIM-Signature: "+sig), "\r\n")))
+	digest := h.Sum(nil)
+
+	var signature []byte
+	var err error
+	switch k := s.key.(type) {
+	case ed25519.PrivateKey:
+		// RFC 8463: Ed25519 signs the SHA-256 digest, not the data itself.
+		signature = ed25519.Sign(k, digest)
+	default:
+		signature, err = s.key.Sign(rand.Reader, digest, crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim: sign: %w", err)
+	}
+	var out bytes.Buffer
+	out.WriteString("DKIM-Signature: " + sig + foldBase64(base64.StdEncoding.EncodeToString(signature)) + "\r\n")
+	out.Write(raw)
+	return out.Bytes(), nil
+}
+
+// foldBase64 breaks a long tag value into folded lines; relaxed canonicalization and base64 decoding ignore the whitespace.
+func foldBase64(v string) string {
+	var b strings.Builder
+	for len(v) > 72 {
+		b.WriteString(v[:72] + "\r\n\t")
+		v = v[72:]
+	}
+	b.WriteString(v)
+	return b.String()
+}
+
+// parseHeaderFields splits a header block into fields, keeping continuation lines with their field.
+func parseHeaderFields(head string) []string {
+	var fields []string
+	for _, line := range strings.Split(head, "\r\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(fields) > 0 {
+			fields[len(fields)-1] += "\r\n" + line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+// lastField returns the bottom-most field called name, as RFC 6376 selects instances from the bottom up.
+func lastField(fields []string, name string) (string, bool) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		k, _, ok := strings.Cut(fields[i], ":")
+		if ok && strings.EqualFold(strings.TrimSpace(k), name) {
+			return fields[i], true
+		}
+	}
+	return "", false
+}
+
+// relaxedHeader canonicalizes one field: lowercase name, unfolded value with whitespace runs collapsed and trimmed.
+func relaxedHeader(field string) string {
+	k, v, _ := strings.Cut(field, ":")
+	v = strings.NewReplacer("\r\n", "").Replace(v)
+	return strings.ToLower(strings.TrimSpace(k)) + ":" + strings.TrimSpace(collapseWSP(v)) + "\r\n"
+}
+
+// relaxedBody canonicalizes the body: whitespace runs collapsed, trailing whitespace and empty lines removed.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(collapseWSP(l), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func collapseWSP(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// encode returns the wire form of msg, DKIM-signed when dkim is set.
+func encode(msg *Message, dkim *DKIMSigner) ([]byte, error) {
+	data, err := msg.Bytes()
+	if err != nil || dkim == nil {
+		return data, err
+	}
+	return dkim.Sign(data)
+}
@@ -0,0 +1,135 @@
+package mail
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelaxedCanonicalization(t *testing.T) {
+	// Examples from RFC 6376 section 3.4.5.
+	fields := parseHeaderFields("A: X\r\nB : Y\t\r\n\tZ  ")
+	if got := relaxedHeader(fields[0]) + relaxedHeader(fields[1]); got != "a:X\r\nb:Y Z\r\n" {
+		t.Errorf("relaxed header = %q", got)
+	}
+	if got := string(relaxedBody([]byte(" C \r\nD \t E\r\n\r\n\r\n"))); got != " C\r\nD E\r\n" {
+		t.Errorf("relaxed body = %q", got)
+	}
+	if got := relaxedBody([]byte("\r\n\r\n")); len(got) != 0 {
+		t.Errorf("empty body = %q", got)
+	}
+}
+
+// verifyDKIM checks sig the way a receiving server would, given the signer's public key.
+func verifyDKIM(t *testing.T, signed []byte, pub crypto.PublicKey) bool {
+	t.Helper()
+	head, body, _ := strings.Cut(string(signed), "\r\n\r\n")
+	fields := parseHeaderFields(head)
+	sigField, ok := lastField(fields, "DKIM-Signature")
+	if !ok {
+		t.Fatal("no DKIM-Signature header")
+	}
+	tags := map[string]string{}
+	for _, tag := range strings.Split(strings.NewReplacer("\r\n", "", "\t", "", " ", "").Replace(sigField[len("DKIM-Signature:"):]), ";") {
+		k, v, _ := strings.Cut(tag, "=")
+		tags[k] = v
+	}
+	bh := sha256.Sum256(relaxedBody([]byte(body)))
+	if tags["bh"] != base64.StdEncoding.EncodeToString(bh[:]) {
+		return false
+	}
+	h := sha256.New()
+	for _, name := range strings.Split(tags["h"], ":") {
+		f, _ := lastField(fields, name)
+		h.Write([]byte(relaxedHeader(f)))
+	}
+	unsigned := regexp.MustCompile(`b=[A-Za-z0-9+/=\r\n\t ]+$`).ReplaceAllString(sigField, "b=")
+	h.Write([]byte(strings.TrimSuffix(relaxedHeader(unsigned), "\r\n")))
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		t.Fatalf("b= is not base64: %v", err)
+	}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, h.Sum(nil), sig) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, h.Sum(nil), sig)
+	}
+	return false
+}
+
+func TestDKIMSigner_RSAAndEd25519(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	cases := []struct {
+		name, alg string
+		pem       []byte
+		pub       crypto.PublicKey
+	}{
+		{"rsa", "rsa-sha256", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), &rsaKey.PublicKey},
+		{"ed25519", "ed25519-sha256", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}), edPub},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := NewDKIMSigner("example.com", "mail", tc.pem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Algorithm() != tc.alg {
+				t.Fatalf("algorithm = %s, want %s", s.Algorithm(), tc.alg)
+			}
+			s.now = func() time.Time { return time.Unix(1700000000, 0) }
+			msg := &Message{From: "Blog <noreply@example.com>", To: []string{"a@example.org"}, Subject: "Your code", Text: "code 123456", HTML: "<p>code 123456</p>"}
+			data, err := msg.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed, err := s.Sign(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{"a=" + tc.alg, "d=example.com", "s=mail", "t=1700000000", "h=from:to:subject:date:message-id:mime-version:content-type"} {
+				if !strings.Contains(string(signed), want) {
+					t.Errorf("signature missing %q:\n%s", want, signed)
+				}
+			}
+			if !verifyDKIM(t, signed, tc.pub) {
+				t.Fatal("signature does not verify")
+			}
+			// Whitespace changes by relays are tolerated; content changes are not.
+			relayed := strings.Replace(string(signed), "Subject: Your code", "Subject:  Your\tcode ", 1)
+			if !verifyDKIM(t, []byte(relayed), tc.pub) {
+				t.Error("relaxed canonicalization should tolerate whitespace changes")
+			}
+			tampered := strings.Replace(string(signed), "123456", "654321", 1)
+			if verifyDKIM(t, []byte(tampered), tc.pub) {
+				t.Error("tampered body verified")
+			}
+		})
+	}
+}
+
+func TestNewDKIMSigner_Errors(t *testing.T) {
+	if _, err := NewDKIMSigner("", "mail", nil); err == nil {
+		t.Error("want error without domain")
+	}
+	if _, err := NewDKIMSigner("example.com", "mail", []byte("not a key")); err == nil {
+		t.Error("want error for invalid PEM")
+	}
+	if s, err := LoadDKIMSigner("", "", ""); s != nil || err != nil {
+		t.Errorf("empty domain should disable signing, got %v %v", s, err)
+	}
+}
@@ -0,0 +1,37 @@
+// mail/file: Driver that writes each message as an .eml file, for local development.
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type FileMailer struct {
+	dir  string
+	DKIM *DKIMSigner // optional; signs the written messages so signatures can be checked locally
+}
+
+// NewFileMailer creates dir if needed. Open the written files with any mail client.
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := encode(msg, m.DKIM)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(suffix) + ".eml"
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0644)
+}
@@ -1,46 +1,240 @@
-// mail: Sends verification code email with an HTML template.
+// mail: Mailer interface, driver selection and message encoding.
 package mail
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"net/smtp"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"net/textproto"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+)
+
+// Drivers selectable with MAIL_DRIVER.
+const (
+	DriverSMTP   = "smtp"
+	DriverFile   = "file"
+	DriverMemory = "memory"
+	DriverLog    = "log"
 )
 
-// SendVerificationCode sends a beautiful HTML email with the code. If SMTP is not configured, returns nil (no error) and no email is sent.
-func SendVerificationCode(toEmail, code, smtpHost, smtpPort, smtpUser, smtpPass, from string) error {
-	if smtpHost == "" {
-		return nil
+// Message is one email. With both Text and HTML it is sent as multipart/alternative.
+// Headers are added as-is (e.g. List-Unsubscribe). Date and MessageID are filled when empty.
+type Message struct {
+	From      string
+	To        []string
+	Subject   string
+	Text      string
+	HTML      string
+	Locale    string // sent as Content-Language
+	Date      time.Time
+	MessageID string
+	Headers   map[string]string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New returns the mailer selected by cfg.MailDriver. SMTP and file messages are DKIM-signed when cfg.DKIMDomain is set.
+func New(cfg *config.Config) (Mailer, error) {
+	dkim, err := LoadDKIMSigner(cfg.DKIMDomain, cfg.DKIMSelector, cfg.DKIMKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.MailDriver {
+	case DriverSMTP:
+		return NewSMTPMailer(SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUser,
+			Password: cfg.SMTPPass,
+			TLS:      cfg.SMTPTLS,
+			Timeout:  cfg.SMTPTimeout,
+			DKIM:     dkim,
+		})
+	case DriverFile:
+		m, err := NewFileMailer(cfg.MailDir)
+		if err != nil {
+			return nil, err
+		}
+		m.DKIM = dkim
+		return m, nil
+	case DriverMemory:
+		return NewMemoryMailer(), nil
+	case DriverLog, "":
+		return LogMailer{}, nil
 	}
-	subject := "Your verification code – Go Blog"
-	htmlBody := buildVerificationHTML(code)
-	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s", from, toEmail, subject, htmlBody)
-	addr := smtpHost + ":" + smtpPort
-	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
-	return smtp.SendMail(addr, auth, from, []string{toEmail}, []byte(msg))
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.MailDriver)
 }
 
-func buildVerificationHTML(code string) string {
+// Bytes encodes the message as RFC 5322. Bodies are quoted-printable, so long lines stay within SMTP limits.
+func (m *Message) Bytes() ([]byte, error) {
+	if m.From == "" || len(m.To) == 0 {
+		return nil, fmt.Errorf("message needs a sender and at least one recipient")
+	}
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		id, err := newMessageID(m.From)
+		if err != nil {
+			return nil, err
+		}
+		m.MessageID = id
+	}
 	var b bytes.Buffer
-	b.WriteString(`<!DOCTYPE html><html><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width,initial-scale=1"></head><body style="margin:0;font-family:'Segoe UI',system-ui,sans-serif;background:linear-gradient(135deg,#1a1a2e 0%,#16213e 50%,#0f3460 100%);min-height:100vh;display:flex;align-items:center;justify-content:center;padding:20px;box-sizing:border-box">`)
-	b.WriteString(`<div style="background:rgba(255,255,255,0.08);backdrop-filter:blur(12px);border:1px solid rgba(255,255,255,0.12);border-radius:20px;padding:48px 40px;max-width:420px;width:100%;text-align:center;box-shadow:0 25px 50px -12px rgba(0,0,0,0.4)">`)
-	b.WriteString(`<div style="font-size:28px;font-weight:700;color:#e94560;margin-bottom:8px;letter-spacing:-0.5px">Go Blog</div>`)
-	b.WriteString(`<div style="color:rgba(255,255,255,0.7);font-size:14px;margin-bottom:32px">Writer verification</div>`)
-	b.WriteString(`<p style="color:rgba(255,255,255,0.9);font-size:15px;line-height:1.6;margin:0 0 24px">Use this code to complete your registration:</p>`)
-	b.WriteString(`<div style="background:rgba(233,69,96,0.2);border:2px solid #e94560;border-radius:12px;padding:20px 28px;margin:0 0 32px">`)
-	b.WriteString(`<span style="font-size:32px;font-weight:700;letter-spacing:8px;color:#fff">`)
-	b.WriteString(escapeHTML(code))
-	b.WriteString(`</span></div>`)
-	b.WriteString(`<p style="color:rgba(255,255,255,0.5);font-size:12px;margin:0">This code expires in 15 minutes. If you didn't request it, ignore this email.</p>`)
-	b.WriteString(`</div></body></html>`)
-	return b.String()
-}
-
-func escapeHTML(s string) string {
-	s = strings.ReplaceAll(s, "&", "&amp;")
-	s = strings.ReplaceAll(s, "<", "&lt;")
-	s = strings.ReplaceAll(s, ">", "&gt;")
-	s = strings.ReplaceAll(s, "\"", "&quot;")
-	return s
+	writeHeader(&b, "From", m.From)
+	writeHeader(&b, "To", strings.Join(m.To, ", "))
+	writeHeader(&b, "Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader(&b, "Date", m.Date.Format(time.RFC1123Z))
+	writeHeader(&b, "Message-ID", m.MessageID)
+	writeHeader(&b, "MIME-Version", "1.0")
+	if m.Locale != "" {
+		writeHeader(&b, "Content-Language", m.Locale)
+	}
+	keys := make([]string, 0, len(m.Headers))
+	for k := range m.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeHeader(&b, k, m.Headers[k])
+	}
+	switch {
+	case m.Text != "" && m.HTML != "":
+		mw := multipart.NewWriter(&b)
+		writeHeader(&b, "Content-Type", `multipart/alternative; boundary="`+mw.Boundary()+`"`)
+		b.WriteString("\r\n")
+		// Least preferred first: clients show the last part they can render.
+		for _, part := range []struct{ typ, body string }{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+			pw, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {part.typ + "; charset=UTF-8"},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := writeQP(pw, part.body); err != nil {
+				return nil, err
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+	case m.HTML != "":
+		writeSinglePart(&b, "text/html")
+		if err := writeQP(&b, m.HTML); err != nil {
+			return nil, err
+		}
+	default:
+		writeSinglePart(&b, "text/plain")
+		if err := writeQP(&b, m.Text); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+func writeSinglePart(b *bytes.Buffer, typ string) {
+	writeHeader(b, "Content-Type", typ+"; charset=UTF-8")
+	writeHeader(b, "Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+}
+
+func writeQP(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func writeHeader(b *bytes.Buffer, key, value string) {
+	// Header injection guard: values never span lines.
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	b.WriteString(key + ": " + value + "\r\n")
+}
+
+// newMessageID returns a unique Message-ID in the sender's domain.
+func newMessageID(from string) (string, error) {
+	domain := "localhost"
+	if addr, err := netmail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok && d != "" {
+			domain = d
+		}
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "<" + hex.EncodeToString(buf) + "@" + domain + ">", nil
+}
+
+// VerificationData is the data of the "verification" template.
+type VerificationData struct {
+	AppName        string
+	Code           string
+	ExpiresMinutes int
+}
+
+// SubscriptionConfirmData is the data of the "subscription_confirm" template.
+type SubscriptionConfirmData struct {
+	AppName      string
+	Scope        string // blog, category or author
+	Topic        string // blog, category or author name
+	Frequency    string // instant, daily or weekly
+	ConfirmURL   string
+	ExpiresHours int
+}
+
+// NewPostData is the data of the "new_post" template.
+type NewPostData struct {
+	AppName        string
+	Scope          string // scope of the subscription that matched the post
+	Topic          string
+	Title          string
+	AuthorName     string
+	Excerpt        string
+	PostURL        string
+	UnsubscribeURL string
+}
+
+// DigestData is the data of the "digest" template.
+type DigestData struct {
+	AppName        string
+	Scope          string
+	Topic          string
+	Frequency      string // daily or weekly
+	Posts          []DigestPost
+	UnsubscribeURL string
+}
+
+// DigestPost is one post in a digest.
+type DigestPost struct {
+	Title      string
+	AuthorName string
+	Excerpt    string
+	URL        string
+}
+
+// NotificationData is the data of the "notification" template.
+type NotificationData struct {
+	AppName   string
+	Type      string // comment_on_post, comment_reply, mention or new_post_in_category
+	ActorName string // empty when unknown
+	PostTitle string
+	Excerpt   string
+	PostURL   string
 }
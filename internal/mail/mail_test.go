@@ -0,0 +1,193 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessage_Bytes(t *testing.T) {
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "Hi\r\nBcc: evil@example.com", HTML: strings.Repeat("x", 2000)}
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	head, body, _ := strings.Cut(string(data), "\r\n\r\n")
+	if strings.Contains(head, "\r\nBcc:") {
+		t.Errorf("header injection not stripped:\n%s", head)
+	}
+	for _, line := range strings.Split(body, "\r\n") {
+		if len(line) > 76 {
+			t.Fatalf("body line of %d bytes exceeds quoted-printable limit", len(line))
+		}
+	}
+	for _, h := range []string{"\r\nDate: ", "\r\nMessage-ID: <", "@example.com>", "Content-Type: text/html"} {
+		if !strings.Contains(head, h) {
+			t.Errorf("header %q missing:\n%s", h, head)
+		}
+	}
+}
+
+func TestMessage_MultipartAlternative(t *testing.T) {
+	msg := &Message{From: "Blog <a@example.com>", To: []string{"b@example.com"}, Subject: "Hi", Text: "plain body", HTML: "<p>html body</p>"}
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	m, err := netmail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type %q: %v", m.Header.Get("Content-Type"), err)
+	}
+	r := multipart.NewReader(m.Body, params["boundary"])
+	var types []string
+	for {
+		p, err := r.NextPart()
+		if err != nil {
+			break
+		}
+		body, _ := io.ReadAll(p) // NextPart decodes quoted-printable
+		types = append(types, p.Header.Get("Content-Type")+"="+string(body))
+	}
+	want := []string{"text/plain; charset=UTF-8=plain body", "text/html; charset=UTF-8=<p>html body</p>"}
+	if strings.Join(types, "|") != strings.Join(want, "|") {
+		t.Errorf("parts want %v, got %v", want, types)
+	}
+}
+
+func TestFileMailer_WritesEML(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFileMailer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(context.Background(), &Message{From: "a@example.com", To: []string{"b@example.com"}, Text: "code 123456"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("want 1 .eml file, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: b@example.com") || !strings.Contains(string(data), "123456") {
+		t.Errorf("unexpected message:\n%s", data)
+	}
+}
+
+// fakeSMTP accepts one session on a local port and returns the DATA it received.
+func fakeSMTP(t *testing.T, ext string) (port string, data <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		write := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		write("220 fake ESMTP")
+		var body strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				write("250-fake" + ext)
+				write("250 8BITMIME")
+			case strings.HasPrefix(cmd, "DATA"):
+				write("354 go ahead")
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					body.WriteString(l)
+				}
+				ch <- body.String()
+				write("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				write("221 bye")
+				return
+			default:
+				write("250 ok")
+			}
+		}
+	}()
+	_, port, _ = net.SplitHostPort(ln.Addr().String())
+	return port, ch
+}
+
+func TestSMTPMailer_Plain(t *testing.T) {
+	port, data := fakeSMTP(t, "")
+	m, err := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: port, TLS: TLSNone, Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(context.Background(), &Message{From: "a@example.com", To: []string{"b@example.com"}, Text: "code 654321"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := <-data; !strings.Contains(got, "654321") {
+		t.Errorf("code missing from DATA:\n%s", got)
+	}
+}
+
+func TestSMTPMailer_StartTLSRequired(t *testing.T) {
+	port, _ := fakeSMTP(t, "")
+	m, err := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: port, TLS: TLSStartTLS, Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Send(context.Background(), &Message{From: "a@example.com", To: []string{"b@example.com"}, Text: "1"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("want STARTTLS error, got %v", err)
+	}
+}
+
+func TestSMTPMailer_Timeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second) // never greets
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	m, _ := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: port, TLS: TLSNone, Timeout: 100 * time.Millisecond})
+	start := time.Now()
+	if err := m.Send(context.Background(), &Message{From: "a@example.com", To: []string{"b@example.com"}, Text: "1"}); err == nil {
+		t.Fatal("want timeout error")
+	}
+	if time.Since(start) > 900*time.Millisecond {
+		t.Errorf("timeout not applied, took %v", time.Since(start))
+	}
+}
@@ -0,0 +1,51 @@
+// mail/memory: In-memory driver for tests, and a log driver used when no mail transport is configured.
+package mail
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// MemoryMailer keeps sent messages in memory. Err, when set, is returned by Send instead of recording.
+type MemoryMailer struct {
+	mu   sync.Mutex
+	msgs []Message
+	Err  error
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.msgs = append(m.msgs, *msg)
+	return nil
+}
+
+// Messages returns a copy of the messages sent so far.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.msgs...)
+}
+
+// Reset forgets all sent messages.
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.msgs = nil
+}
+
+// LogMailer only logs recipients and subject; nothing is delivered.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg *Message) error {
+	log.Printf("[mail] not delivered (no mail driver configured): to=%v subject=%q", msg.To, msg.Subject)
+	return nil
+}
@@ -0,0 +1,125 @@
+// mail/smtp: SMTP driver with STARTTLS, implicit TLS (SMTPS) or plain connections and a per-send timeout.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// TLS modes for SMTPConfig.TLS.
+const (
+	TLSStartTLS = "starttls" // plain connect, then STARTTLS (required), usually port 587
+	TLSImplicit = "tls"      // TLS from the first byte, usually port 465
+	TLSNone     = "none"     // no encryption; only for local relays and tests
+)
+
+const defaultSMTPTimeout = 10 * time.Second
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	TLS      string
+	Timeout  time.Duration // covers dialing and the whole conversation
+	DKIM     *DKIMSigner   // optional; signs every message
+}
+
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("smtp: host is required")
+	}
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = TLSStartTLS
+		if cfg.Port == "465" {
+			cfg.TLS = TLSImplicit
+		}
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, fmt.Errorf("smtp: unknown TLS mode %q", cfg.TLS)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultSMTPTimeout
+	}
+	return &SMTPMailer{cfg: cfg}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := encode(msg, m.cfg.DKIM)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	defer cancel()
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("smtp: dial: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp: greeting: %w", err)
+	}
+	defer c.Close()
+	if m.cfg.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp: server does not support STARTTLS")
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return fmt.Errorf("smtp: starttls: %w", err)
+		}
+	}
+	if m.cfg.Username != "" {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+				return fmt.Errorf("smtp: auth: %w", err)
+			}
+		}
+	}
+	if err := c.Mail(msg.From); err != nil {
+		return fmt.Errorf("smtp: mail from: %w", err)
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp: rcpt %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: data: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("smtp: write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: data: %w", err)
+	}
+	return c.Quit()
+}
+
+func (m *SMTPMailer) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(m.cfg.Host, m.cfg.Port)
+	if m.cfg.TLS == TLSImplicit {
+		d := &tls.Dialer{Config: &tls.Config{ServerName: m.cfg.Host}}
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
@@ -0,0 +1,132 @@
+// mail/template: Localized email templates (subject, text and HTML) with an optional override directory.
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+// DefaultLocale is used when no template exists for the recipient's locale.
+const DefaultLocale = "en"
+
+// Templates renders emails from <locale>/<name>.subject.tmpl, <name>.txt.tmpl and <name>.html.tmpl.
+// Files in the override dir take precedence over the embedded ones, file by file, so a deployment can
+// restyle one email or add a locale without copying the rest. Templates are read on every render, so
+// edits in the override dir apply without a restart.
+type Templates struct {
+	sources       []fs.FS
+	defaultLocale string
+}
+
+// NewTemplates returns templates backed by overrideDir (may be empty) and the embedded defaults.
+func NewTemplates(overrideDir, defaultLocale string) *Templates {
+	sub, _ := fs.Sub(embedded, "templates")
+	t := &Templates{defaultLocale: NormalizeLocale(defaultLocale)}
+	if t.defaultLocale == "" {
+		t.defaultLocale = DefaultLocale
+	}
+	if overrideDir != "" {
+		t.sources = append(t.sources, os.DirFS(overrideDir))
+	}
+	t.sources = append(t.sources, sub)
+	return t
+}
+
+// Message renders template name for locale (e.g. "fa-IR" falls back to "fa", then the default locale)
+// and returns a message with Subject, Text, HTML and Locale set; the caller fills From and To.
+func (t *Templates) Message(name, locale string, data any) (*Message, error) {
+	subject, loc, err := t.read(name+".subject.tmpl", locale)
+	if err != nil {
+		return nil, err
+	}
+	text, _, err := t.read(name+".txt.tmpl", loc)
+	if err != nil {
+		return nil, err
+	}
+	html, _, err := t.read(name+".html.tmpl", loc)
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{Locale: loc}
+	if msg.Subject, err = renderText(name+".subject", subject, data); err != nil {
+		return nil, err
+	}
+	msg.Subject = strings.TrimSpace(msg.Subject)
+	if msg.Text, err = renderText(name+".txt", text, data); err != nil {
+		return nil, err
+	}
+	tmpl, err := htmltemplate.New(name + ".html").Parse(html)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	msg.HTML = b.String()
+	return msg, nil
+}
+
+// read returns the first file found for the locale candidates and the locale it was found for.
+func (t *Templates) read(file, locale string) (string, string, error) {
+	for _, loc := range t.candidates(locale) {
+		for _, src := range t.sources {
+			data, err := fs.ReadFile(src, path.Join(loc, file))
+			if err == nil {
+				return string(data), loc, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", "", err
+			}
+		}
+	}
+	return "", "", errors.New("mail template not found: " + file)
+}
+
+func (t *Templates) candidates(locale string) []string {
+	var out []string
+	if loc := NormalizeLocale(locale); loc != "" {
+		out = append(out, loc)
+		if base, _, ok := strings.Cut(loc, "-"); ok {
+			out = append(out, base)
+		}
+	}
+	return append(out, t.defaultLocale)
+}
+
+// NormalizeLocale lowercases a BCP 47 tag ("fa_IR" -> "fa-ir") and drops anything that is not a plain tag,
+// so a locale can never escape the template directory.
+func NormalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if locale == "" || len(locale) > 16 {
+		return ""
+	}
+	for _, c := range locale {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return ""
+		}
+	}
+	return locale
+}
+
+func renderText(name, src string, data any) (string, error) {
+	tmpl, err := texttemplate.New(name).Parse(src)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplates_LocaleFallbackAndOverride(t *testing.T) {
+	data := VerificationData{AppName: "Go Blog", Code: "<123456>", ExpiresMinutes: 15}
+	tmpl := NewTemplates("", DefaultLocale)
+
+	msg, err := tmpl.Message("verification", "de-AT", data)
+	if err != nil {
+		t.Fatalf("Message: %v", err)
+	}
+	if msg.Locale != "en" || msg.Subject != "Your verification code – Go Blog" {
+		t.Errorf("unknown locale should fall back to en, got %q %q", msg.Locale, msg.Subject)
+	}
+	if !strings.Contains(msg.HTML, "&lt;123456&gt;") || !strings.Contains(msg.Text, "<123456>") {
+		t.Errorf("html must be escaped and text must not:\n%s\n%s", msg.HTML, msg.Text)
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "de"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "de", "verification.subject.tmpl"), []byte("Ihr Code – {{.AppName}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = NewTemplates(dir, DefaultLocale).Message("verification", "de-AT", data)
+	if err != nil {
+		t.Fatalf("Message: %v", err)
+	}
+	if msg.Subject != "Ihr Code – Go Blog" || msg.Locale != "de" {
+		t.Errorf("override subject not used: %q (%s)", msg.Subject, msg.Locale)
+	}
+	if !strings.Contains(msg.Text, "complete your registration") {
+		t.Errorf("missing override files should fall back to the default locale, got %q", msg.Text)
+	}
+
+	if _, err := tmpl.Message("verification", "../../etc", data); err != nil {
+		t.Errorf("invalid locale should be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+// mailqueue: DB-backed outbound mail queue. Queue implements mail.Mailer by storing the message; a worker pool
+// delivers it through the real transport with exponential-backoff retries and a dead-letter state.
+package mailqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/mail"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned for unknown message ids.
+var ErrNotFound = errors.New("queued email not found")
+
+// ErrNotDead is returned when resending a message that is not in the dead state.
+var ErrNotDead = errors.New("only dead emails can be resent")
+
+// Options tune the workers. Zero values use the defaults below.
+type Options struct {
+	Workers      int           // concurrent senders (default 2)
+	MaxAttempts  int           // attempts before a message is dead (default 8)
+	PollInterval time.Duration // how often idle workers look for due messages (default 5s)
+	BaseBackoff  time.Duration // delay after the first failure, doubled per attempt (default 30s)
+	MaxBackoff   time.Duration // cap of the delay (default 1h)
+	Lease        time.Duration // how long a claimed message is reserved for one send, which must end within 90% of it (default 2m)
+}
+
+func (o *Options) defaults() {
+	if o.Workers <= 0 {
+		o.Workers = 2
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 8
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 5 * time.Second
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 30 * time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Hour
+	}
+	if o.Lease <= 0 {
+		o.Lease = 2 * time.Minute
+	}
+}
+
+type Queue struct {
+	repo      repository.OutboxEmailStore
+	transport mail.Mailer
+	opts      Options
+	wake      chan struct{}
+	now       func() time.Time
+}
+
+// New returns a queue that delivers through transport. Call Start to run the workers.
+func New(repo repository.OutboxEmailStore, transport mail.Mailer, opts Options) *Queue {
+	opts.defaults()
+	return &Queue{repo: repo, transport: transport, opts: opts, wake: make(chan struct{}, 1), now: time.Now}
+}
+
+// Send stores msg for delivery and returns without contacting the mail server.
+func (q *Queue) Send(ctx context.Context, msg *mail.Message) error {
+	if msg.From == "" || len(msg.To) == 0 {
+		return errors.New("message needs a sender and at least one recipient")
+	}
+	headers := ""
+	if len(msg.Headers) > 0 {
+		b, err := json.Marshal(msg.Headers)
+		if err != nil {
+			return err
+		}
+		headers = string(b)
+	}
+	if msg.MessageID == "" {
+		// Encoding assigns the Message-ID; do it now so every retry reuses it.
+		if _, err := msg.Bytes(); err != nil {
+			return err
+		}
+	}
+	now := q.now()
+	e := &model.OutboxEmail{
+		MessageID:     msg.MessageID,
+		From:          msg.From,
+		To:            strings.Join(msg.To, ","),
+		Subject:       msg.Subject,
+		Text:          msg.Text,
+		HTML:          msg.HTML,
+		Locale:        msg.Locale,
+		Headers:       headers,
+		Status:        model.OutboxEmailPending,
+		NextAttemptAt: now,
+	}
+	if err := q.repo.Create(ctx, e); err != nil {
+		return err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start runs the worker pool until ctx is cancelled.
+func (q *Queue) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		// Drain everything that is due before waiting again.
+		for {
+			worked, err := q.ProcessOnce(ctx)
+			if err != nil {
+				log.Printf("[mailqueue] %v", err)
+			}
+			if !worked || ctx.Err() != nil {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// ProcessOnce claims one due message and tries to deliver it. Reports whether a message was claimed. The send
+// must end before the lease does, or another worker could claim the message and send it again; the outcome is
+// only recorded while the claim is still held.
+func (q *Queue) ProcessOnce(ctx context.Context) (bool, error) {
+	e, err := q.repo.ClaimDue(ctx, q.now(), q.opts.Lease)
+	if err != nil || e == nil {
+		return false, err
+	}
+	msg, err := toMessage(e)
+	if err == nil {
+		sendCtx, cancel := context.WithTimeout(ctx, q.opts.Lease-q.opts.Lease/10)
+		err = q.transport.Send(sendCtx, msg)
+		cancel()
+	}
+	attempts := e.Attempts + 1
+	now := q.now()
+	var held bool
+	if err == nil {
+		held, err = q.repo.MarkSent(ctx, e, attempts, now)
+	} else {
+		dead := attempts >= q.opts.MaxAttempts
+		if dead {
+			log.Printf("[mailqueue] email %d to %s is dead after %d attempts: %v", e.ID, e.To, attempts, err)
+		}
+		held, err = q.repo.MarkFailed(ctx, e, attempts, now.Add(q.backoff(attempts)), dead, err.Error())
+	}
+	if err == nil && !held {
+		log.Printf("[mailqueue] email %d: lease expired during the attempt, outcome left to the worker that claimed it again", e.ID)
+	}
+	return true, err
+}
+
+// backoff is BaseBackoff*2^(attempts-1), capped at MaxBackoff, with up to 10% jitter so retries of a
+// burst of failures do not hit the server at the same moment.
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := q.opts.BaseBackoff
+	for i := 1; i < attempts && d < q.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.opts.MaxBackoff {
+		d = q.opts.MaxBackoff
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/10+1))
+}
+
+func toMessage(e *model.OutboxEmail) (*mail.Message, error) {
+	msg := &mail.Message{
+		From:      e.From,
+		To:        strings.Split(e.To, ","),
+		Subject:   e.Subject,
+		Text:      e.Text,
+		HTML:      e.HTML,
+		Locale:    e.Locale,
+		Date:      e.CreatedAt,
+		MessageID: e.MessageID,
+	}
+	if e.Headers != "" {
+		if err := json.Unmarshal([]byte(e.Headers), &msg.Headers); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// ListResult holds a page of queued emails and the total for the filter.
+type ListResult struct {
+	Items []model.OutboxEmail `json:"items"`
+	Total int64               `json:"total"`
+}
+
+// List returns queued emails, newest first, optionally filtered by status.
+func (q *Queue) List(ctx context.Context, status model.OutboxEmailStatus, limit, offset int) (*ListResult, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	total, err := q.repo.Count(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+	items, err := q.repo.List(ctx, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &ListResult{Items: items, Total: total}, nil
+}
+
+// Get returns one queued email.
+func (q *Queue) Get(ctx context.Context, id uint) (*model.OutboxEmail, error) {
+	e, err := q.repo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	return e, err
+}
+
+// Resend moves a dead email back to pending with a fresh attempt budget and wakes a worker.
+func (q *Queue) Resend(ctx context.Context, id uint) (*model.OutboxEmail, error) {
+	if _, err := q.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	ok, err := q.repo.Requeue(ctx, id, q.now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotDead
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return q.Get(ctx, id)
+}
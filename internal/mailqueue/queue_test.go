@@ -0,0 +1,175 @@
+package mailqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/mail"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"github.com/aliakbar-zohour/go_blog/internal/testdb"
+)
+
+func setupQueue(t *testing.T, transport mail.Mailer, opts Options) (*Queue, *time.Time) {
+	t.Helper()
+	db := testdb.Open(t)
+	q := New(repository.NewOutboxEmailRepository(db), transport, opts)
+	clock := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return clock }
+	return q, &clock
+}
+
+func testMessage() *mail.Message {
+	return &mail.Message{From: "blog@example.com", To: []string{"a@example.com"}, Subject: "Hi", Text: "hello", HTML: "<p>hello</p>"}
+}
+
+func TestQueue_SendDelivers(t *testing.T) {
+	transport := mail.NewMemoryMailer()
+	q, _ := setupQueue(t, transport, Options{})
+	ctx := context.Background()
+	if err := q.Send(ctx, testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(transport.Messages()); n != 0 {
+		t.Fatalf("Send must not deliver synchronously, got %d messages", n)
+	}
+	worked, err := q.ProcessOnce(ctx)
+	if err != nil || !worked {
+		t.Fatalf("ProcessOnce: worked=%v err=%v", worked, err)
+	}
+	msgs := transport.Messages()
+	if len(msgs) != 1 || msgs[0].Subject != "Hi" || msgs[0].HTML != "<p>hello</p>" || msgs[0].MessageID == "" {
+		t.Fatalf("unexpected delivery: %+v", msgs)
+	}
+	res, _ := q.List(ctx, model.OutboxEmailSent, 0, 0)
+	if res.Total != 1 || res.Items[0].Attempts != 1 || res.Items[0].SentAt == nil {
+		t.Fatalf("email not marked sent: %+v", res)
+	}
+	if worked, _ := q.ProcessOnce(ctx); worked {
+		t.Fatal("sent email claimed again")
+	}
+}
+
+func TestQueue_RetriesThenDeadThenResend(t *testing.T) {
+	transport := mail.NewMemoryMailer()
+	transport.Err = errors.New("421 try later")
+	q, clock := setupQueue(t, transport, Options{MaxAttempts: 3, BaseBackoff: time.Minute, MaxBackoff: time.Hour})
+	ctx := context.Background()
+	if err := q.Send(ctx, testMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	if worked, err := q.ProcessOnce(ctx); err != nil || !worked {
+		t.Fatalf("first attempt: worked=%v err=%v", worked, err)
+	}
+	e, _ := q.Get(ctx, 1)
+	if e.Status != model.OutboxEmailPending || e.Attempts != 1 || e.LastError != "421 try later" {
+		t.Fatalf("after first failure: %+v", e)
+	}
+	if !e.NextAttemptAt.After(clock.Add(time.Minute - time.Second)) {
+		t.Fatalf("retry not delayed: next=%v", e.NextAttemptAt)
+	}
+	if worked, _ := q.ProcessOnce(ctx); worked {
+		t.Fatal("email retried before its backoff elapsed")
+	}
+
+	for i := 0; i < 2; i++ {
+		*clock = clock.Add(2 * time.Hour)
+		if worked, err := q.ProcessOnce(ctx); err != nil || !worked {
+			t.Fatalf("attempt %d: worked=%v err=%v", i+2, worked, err)
+		}
+	}
+	e, _ = q.Get(ctx, 1)
+	if e.Status != model.OutboxEmailDead || e.Attempts != 3 {
+		t.Fatalf("want dead after 3 attempts, got %+v", e)
+	}
+	*clock = clock.Add(24 * time.Hour)
+	if worked, _ := q.ProcessOnce(ctx); worked {
+		t.Fatal("dead email retried")
+	}
+
+	transport.Err = nil
+	e, err := q.Resend(ctx, 1)
+	if err != nil || e.Status != model.OutboxEmailPending || e.Attempts != 0 {
+		t.Fatalf("Resend: %+v err=%v", e, err)
+	}
+	if _, err := q.Resend(ctx, 1); !errors.Is(err, ErrNotDead) {
+		t.Fatalf("resending a pending email: want ErrNotDead, got %v", err)
+	}
+	if _, err := q.Resend(ctx, 99); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	if worked, err := q.ProcessOnce(ctx); err != nil || !worked {
+		t.Fatalf("after resend: worked=%v err=%v", worked, err)
+	}
+	if len(transport.Messages()) != 1 {
+		t.Fatal("resent email not delivered")
+	}
+}
+
+func TestQueue_ExpiredLeaseIsReclaimed(t *testing.T) {
+	q, clock := setupQueue(t, mail.NewMemoryMailer(), Options{Lease: time.Minute})
+	ctx := context.Background()
+	if err := q.Send(ctx, testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a worker that claimed the email and died.
+	if e, err := q.repo.ClaimDue(ctx, *clock, time.Minute); err != nil || e == nil {
+		t.Fatalf("claim: %v %v", e, err)
+	}
+	if worked, _ := q.ProcessOnce(ctx); worked {
+		t.Fatal("email claimed while leased")
+	}
+	*clock = clock.Add(2 * time.Minute)
+	if worked, err := q.ProcessOnce(ctx); err != nil || !worked {
+		t.Fatalf("expired lease not reclaimed: worked=%v err=%v", worked, err)
+	}
+}
+
+// mailerFunc adapts a function to mail.Mailer.
+type mailerFunc func(ctx context.Context, msg *mail.Message) error
+
+func (f mailerFunc) Send(ctx context.Context, msg *mail.Message) error { return f(ctx, msg) }
+
+func TestQueue_SendOutlivingItsLeaseIsNotRecorded(t *testing.T) {
+	var q *Queue
+	var clock *time.Time
+	var deadline time.Time
+	transport := mailerFunc(func(ctx context.Context, msg *mail.Message) error {
+		deadline, _ = ctx.Deadline()
+		// The send takes longer than the lease, and another worker claims the email meanwhile.
+		*clock = clock.Add(2 * time.Minute)
+		if e, err := q.repo.ClaimDue(ctx, *clock, time.Minute); err != nil || e == nil {
+			t.Fatalf("reclaim: %v %v", e, err)
+		}
+		return nil
+	})
+	q, clock = setupQueue(t, transport, Options{Lease: time.Minute})
+	ctx := context.Background()
+	if err := q.Send(ctx, testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if worked, err := q.ProcessOnce(ctx); err != nil || !worked {
+		t.Fatalf("ProcessOnce: worked=%v err=%v", worked, err)
+	}
+	if d := deadline.Sub(start); d < 50*time.Second || d > 55*time.Second {
+		t.Errorf("send deadline %v after start, want within 90%% of the lease", d)
+	}
+	e, _ := q.Get(ctx, 1)
+	if e.Status != model.OutboxEmailSending || e.Attempts != 0 || e.SentAt != nil {
+		t.Fatalf("stale worker recorded its outcome: %+v", e)
+	}
+}
+
+func TestQueue_Backoff(t *testing.T) {
+	q := New(nil, nil, Options{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second})
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 10 * time.Second} {
+		got := q.backoff(attempts)
+		if got < want || got > want+want/10 {
+			t.Errorf("backoff(%d) = %v, want %v..%v", attempts, got, want, want+want/10)
+		}
+	}
+}
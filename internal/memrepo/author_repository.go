@@ -0,0 +1,164 @@
+// memrepo/author_repository: Authors, with their email unique when set.
+package memrepo
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type AuthorRepository struct {
+	db *DB
+}
+
+func NewAuthorRepository(db *DB) *AuthorRepository {
+	return &AuthorRepository{db: db}
+}
+
+func (r *AuthorRepository) Create(ctx context.Context, a *model.Author) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if r.emailTaken(a) {
+		return gorm.ErrDuplicatedKey
+	}
+	id, err := insertID(r.db, "authors", r.db.authors, a.ID)
+	if err != nil {
+		return err
+	}
+	a.ID = id
+	stamp(r.db.now(), &a.CreatedAt, &a.UpdatedAt)
+	stored := *a
+	r.db.authors[id] = &stored
+	return nil
+}
+
+func (r *AuthorRepository) GetByID(ctx context.Context, id uint) (*model.Author, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	a := r.db.authors[id]
+	if a == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	author := *a
+	return &author, nil
+}
+
+func (r *AuthorRepository) GetByEmail(ctx context.Context, email string) (*model.Author, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, id := range sortedIDs(r.db.authors) {
+		if a := r.db.authors[id]; a.Email != nil && *a.Email == email {
+			author := *a
+			return &author, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// List returns every author by name.
+func (r *AuthorRepository) List(ctx context.Context) ([]model.Author, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	list := make([]model.Author, 0, len(r.db.authors))
+	for _, a := range r.db.authors {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+// Update saves every column of a, creating it when its ID is zero or unknown.
+func (r *AuthorRepository) Update(ctx context.Context, a *model.Author) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if r.emailTaken(a) {
+		return gorm.ErrDuplicatedKey
+	}
+	now := r.db.now()
+	if a.ID == 0 || r.db.authors[a.ID] == nil {
+		id, err := insertID(r.db, "authors", r.db.authors, a.ID)
+		if err != nil {
+			return err
+		}
+		a.ID = id
+		stamp(now, &a.CreatedAt, nil)
+	}
+	a.UpdatedAt = now
+	stored := *a
+	r.db.authors[a.ID] = &stored
+	return nil
+}
+
+// SetQuota sets the author's storage quota override in bytes; nil reverts to the configured default.
+func (r *AuthorRepository) SetQuota(ctx context.Context, id uint, quota *int64) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	a := r.db.authors[id]
+	if a == nil {
+		return gorm.ErrRecordNotFound
+	}
+	if quota != nil {
+		q := *quota
+		quota = &q
+	}
+	a.QuotaBytes = quota
+	a.UpdatedAt = r.db.now()
+	return nil
+}
+
+func (r *AuthorRepository) Delete(ctx context.Context, id uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	delete(r.db.authors, id)
+	return nil
+}
+
+// ListByHandles returns the authors whose handle (the lower-case name without spaces and underscores) is in
+// handles, by ID.
+func (r *AuthorRepository) ListByHandles(ctx context.Context, handles []string) ([]model.Author, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	want := make(map[string]bool, len(handles))
+	for _, h := range handles {
+		want[h] = true
+	}
+	var list []model.Author
+	for _, id := range sortedIDs(r.db.authors) {
+		a := r.db.authors[id]
+		if want[strings.ToLower(strings.NewReplacer(" ", "", "_", "").Replace(a.Name))] {
+			list = append(list, *a)
+		}
+	}
+	return list, nil
+}
+
+// emailTaken reports whether another author has the email of a.
+func (r *AuthorRepository) emailTaken(a *model.Author) bool {
+	if a.Email == nil {
+		return false
+	}
+	for id, other := range r.db.authors {
+		if id != a.ID && other.Email != nil && *other.Email == *a.Email {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedIDs returns the keys of rows in ascending order, the order rows without ORDER BY come back in.
+func sortedIDs[T any](rows map[uint]*T) []uint {
+	ids := make([]uint, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,95 @@
+// memrepo/blob_repository: Reference counts of stored files, one row per path.
+package memrepo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type BlobRepository struct {
+	db *DB
+}
+
+func NewBlobRepository(db *DB) *BlobRepository {
+	return &BlobRepository{db: db}
+}
+
+// Acquire records one more reference to the blob at path, creating the row on first use.
+func (r *BlobRepository) Acquire(ctx context.Context, hash, path string, size int64) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := r.db.now()
+	if b := r.db.blobByPath(path); b != nil {
+		b.RefCount++
+		b.UpdatedAt = now
+		return nil
+	}
+	id, err := insertID(r.db, "blobs", r.db.blobs, 0)
+	if err != nil {
+		return err
+	}
+	r.db.blobs[id] = &model.Blob{ID: id, Hash: hash, Path: path, Size: size, RefCount: 1, CreatedAt: now, UpdatedAt: now}
+	return nil
+}
+
+// Release drops one reference to the blob at path. Paths that are not blobs are ignored.
+func (r *BlobRepository) Release(ctx context.Context, path string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if b := r.db.blobByPath(path); b != nil && b.RefCount > 0 {
+		b.RefCount--
+		b.UpdatedAt = r.db.now()
+	}
+	return nil
+}
+
+func (r *BlobRepository) GetByPath(ctx context.Context, path string) (*model.Blob, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	b := r.db.blobByPath(path)
+	if b == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *b
+	return &found, nil
+}
+
+// ListUnreferenced returns up to limit blobs with an ID above afterID that nothing has used since before, by ID.
+func (r *BlobRepository) ListUnreferenced(ctx context.Context, before time.Time, afterID uint, limit int) ([]model.Blob, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var list []model.Blob
+	for _, b := range r.db.blobs {
+		if b.RefCount == 0 && b.UpdatedAt.Before(before) && b.ID > afterID {
+			list = append(list, *b)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return page(list, limit, 0), nil
+}
+
+// DeleteUnreferenced deletes the row of the blob at path if nothing has used it since before, and reports
+// whether it did.
+func (r *BlobRepository) DeleteUnreferenced(ctx context.Context, path string, before time.Time) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	b := r.db.blobByPath(path)
+	if b == nil || b.RefCount != 0 || !b.UpdatedAt.Before(before) {
+		return false, nil
+	}
+	delete(r.db.blobs, b.ID)
+	return true, nil
+}
+
+func (db *DB) blobByPath(path string) *model.Blob {
+	for _, b := range db.blobs {
+		if b.Path == path {
+			return b
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// memrepo/category_repository: Categories, with unique names.
+package memrepo
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type CategoryRepository struct {
+	db *DB
+}
+
+func NewCategoryRepository(db *DB) *CategoryRepository {
+	return &CategoryRepository{db: db}
+}
+
+func (r *CategoryRepository) Create(ctx context.Context, c *model.Category) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if r.nameTaken(c) {
+		return gorm.ErrDuplicatedKey
+	}
+	id, err := insertID(r.db, "categories", r.db.categories, c.ID)
+	if err != nil {
+		return err
+	}
+	c.ID = id
+	stamp(r.db.now(), &c.CreatedAt, &c.UpdatedAt)
+	stored := *c
+	r.db.categories[id] = &stored
+	return nil
+}
+
+func (r *CategoryRepository) GetByID(ctx context.Context, id uint) (*model.Category, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	c := r.db.categories[id]
+	if c == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	category := *c
+	return &category, nil
+}
+
+// List returns every category by name.
+func (r *CategoryRepository) List(ctx context.Context) ([]model.Category, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	list := make([]model.Category, 0, len(r.db.categories))
+	for _, c := range r.db.categories {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Update saves every column of c, creating it when its ID is zero or unknown.
+func (r *CategoryRepository) Update(ctx context.Context, c *model.Category) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if r.nameTaken(c) {
+		return gorm.ErrDuplicatedKey
+	}
+	now := r.db.now()
+	if c.ID == 0 || r.db.categories[c.ID] == nil {
+		id, err := insertID(r.db, "categories", r.db.categories, c.ID)
+		if err != nil {
+			return err
+		}
+		c.ID = id
+		stamp(now, &c.CreatedAt, nil)
+	}
+	c.UpdatedAt = now
+	stored := *c
+	r.db.categories[c.ID] = &stored
+	return nil
+}
+
+func (r *CategoryRepository) Delete(ctx context.Context, id uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	delete(r.db.categories, id)
+	return nil
+}
+
+// nameTaken reports whether another category has the name of c.
+func (r *CategoryRepository) nameTaken(c *model.Category) bool {
+	for id, other := range r.db.categories {
+		if id != c.ID && other.Name == c.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+// memrepo/comment_repository: Comments on posts.
+package memrepo
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type CommentRepository struct {
+	db *DB
+}
+
+func NewCommentRepository(db *DB) *CommentRepository {
+	return &CommentRepository{db: db}
+}
+
+func (r *CommentRepository) Create(ctx context.Context, c *model.Comment) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	id, err := insertID(r.db, "comments", r.db.comments, c.ID)
+	if err != nil {
+		return err
+	}
+	c.ID = id
+	stamp(r.db.now(), &c.CreatedAt, &c.UpdatedAt)
+	stored := *c
+	r.db.comments[id] = &stored
+	return nil
+}
+
+func (r *CommentRepository) GetByID(ctx context.Context, id uint) (*model.Comment, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	c := r.db.comments[id]
+	if c == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	comment := *c
+	return &comment, nil
+}
+
+// ListByPostID returns the comments of postID, oldest first.
+func (r *CommentRepository) ListByPostID(ctx context.Context, postID uint) ([]model.Comment, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var list []model.Comment
+	for _, c := range r.db.comments {
+		if c.PostID == postID {
+			list = append(list, *c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return oldestFirst(list[i].CreatedAt, list[j].CreatedAt, list[i].ID, list[j].ID)
+	})
+	return list, nil
+}
+
+// Update saves every column of c, creating it when its ID is zero or unknown.
+func (r *CommentRepository) Update(ctx context.Context, c *model.Comment) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := r.db.now()
+	if c.ID == 0 || r.db.comments[c.ID] == nil {
+		id, err := insertID(r.db, "comments", r.db.comments, c.ID)
+		if err != nil {
+			return err
+		}
+		c.ID = id
+		stamp(now, &c.CreatedAt, nil)
+	}
+	c.UpdatedAt = now
+	stored := *c
+	r.db.comments[c.ID] = &stored
+	return nil
+}
+
+func (r *CommentRepository) Delete(ctx context.Context, id uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	delete(r.db.comments, id)
+	return nil
+}
@@ -0,0 +1,177 @@
+// memrepo: In-memory implementations of the repository interfaces, for service tests that need no database.
+// They keep the semantics of the gorm repositories: IDs count up per table, CreatedAt/UpdatedAt are set on
+// write, posts, media and email verifications are soft-deleted, lists are ordered as in SQL (ties broken by
+// ID), missing rows return gorm.ErrRecordNotFound and taken unique keys gorm.ErrDuplicatedKey. There are no
+// transactions: give the services a Transactor, whose Do runs the function directly.
+package memrepo
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"gorm.io/gorm"
+)
+
+var (
+	_ repository.PostStore              = (*PostRepository)(nil)
+	_ repository.MediaStore             = (*MediaRepository)(nil)
+	_ repository.AuthorStore            = (*AuthorRepository)(nil)
+	_ repository.CategoryStore          = (*CategoryRepository)(nil)
+	_ repository.CommentStore           = (*CommentRepository)(nil)
+	_ repository.EmailVerificationStore = (*EmailVerificationRepository)(nil)
+	_ repository.UploadStore            = (*UploadRepository)(nil)
+	_ repository.BlobStore              = (*BlobRepository)(nil)
+	_ repository.StorageStore           = (*StorageRepository)(nil)
+	_ repository.UsageStore             = (*UsageRepository)(nil)
+	_ repository.SubscriptionStore      = (*SubscriptionRepository)(nil)
+	_ repository.NotificationStore      = (*NotificationRepository)(nil)
+	_ repository.EventStore             = (*EventRepository)(nil)
+	_ repository.OutboxEventStore       = (*EventRepository)(nil)
+	_ repository.OutboxEmailStore       = (*OutboxEmailRepository)(nil)
+	_ repository.WebhookStore           = (*WebhookRepository)(nil)
+	_ repository.TxRunner               = (*Transactor)(nil)
+)
+
+// DB holds the tables shared by the repositories created from it, like one database.
+type DB struct {
+	mu  sync.Mutex
+	now func() time.Time
+	seq map[string]uint
+
+	posts          map[uint]*model.Post
+	postMedia      map[postMediaKey]time.Time
+	media          map[uint]*model.Media
+	authors        map[uint]*model.Author
+	categories     map[uint]*model.Category
+	comments       map[uint]*model.Comment
+	verifications  map[uint]*model.EmailVerification
+	uploads        map[string]*model.Upload
+	blobs          map[uint]*model.Blob
+	usage          map[usageKey]*model.StorageUsage
+	accounts       map[uint]*model.StorageAccount
+	subscriptions  map[uint]*model.Subscription
+	confirmations  map[uint]*model.SubscriptionConfirmation
+	digests        map[uint]*model.DigestDelivery
+	postDeliveries map[uint]*model.PostDelivery
+	notifications  map[uint]*model.Notification
+	preferences    map[preferenceKey]bool
+	watches        map[watchKey]time.Time
+	events         []model.OutboxEvent
+	offsets        map[string]*model.OutboxOffset
+	emails         map[uint]*model.OutboxEmail
+	webhooks       map[uint]*model.Webhook
+	deliveries     map[uint]*model.WebhookDelivery
+}
+
+type postMediaKey struct{ postID, mediaID uint }
+
+type usageKey struct {
+	authorID uint
+	t        model.MediaType
+}
+
+type preferenceKey struct {
+	authorID uint
+	t        model.NotificationType
+}
+
+type watchKey struct{ authorID, categoryID uint }
+
+// New returns an empty database.
+func New() *DB {
+	return &DB{
+		now:            time.Now,
+		seq:            map[string]uint{},
+		posts:          map[uint]*model.Post{},
+		postMedia:      map[postMediaKey]time.Time{},
+		media:          map[uint]*model.Media{},
+		authors:        map[uint]*model.Author{},
+		categories:     map[uint]*model.Category{},
+		comments:       map[uint]*model.Comment{},
+		verifications:  map[uint]*model.EmailVerification{},
+		uploads:        map[string]*model.Upload{},
+		blobs:          map[uint]*model.Blob{},
+		usage:          map[usageKey]*model.StorageUsage{},
+		accounts:       map[uint]*model.StorageAccount{},
+		subscriptions:  map[uint]*model.Subscription{},
+		confirmations:  map[uint]*model.SubscriptionConfirmation{},
+		digests:        map[uint]*model.DigestDelivery{},
+		postDeliveries: map[uint]*model.PostDelivery{},
+		notifications:  map[uint]*model.Notification{},
+		preferences:    map[preferenceKey]bool{},
+		watches:        map[watchKey]time.Time{},
+		offsets:        map[string]*model.OutboxOffset{},
+		emails:         map[uint]*model.OutboxEmail{},
+		webhooks:       map[uint]*model.Webhook{},
+		deliveries:     map[uint]*model.WebhookDelivery{},
+	}
+}
+
+// SetClock makes the repositories read the time from now, e.g. to test expiry.
+func (db *DB) SetClock(now func() time.Time) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.now = now
+}
+
+// insertID returns the ID of a new row of table: id when set and free, the next one of the table otherwise.
+func insertID[T any](db *DB, table string, rows map[uint]*T, id uint) (uint, error) {
+	if id == 0 {
+		id = db.seq[table] + 1
+		for rows[id] != nil {
+			id++
+		}
+	} else if rows[id] != nil {
+		return 0, gorm.ErrDuplicatedKey
+	}
+	if id > db.seq[table] {
+		db.seq[table] = id
+	}
+	return id, nil
+}
+
+// stamp sets *created and *updated (if given) to now when zero, as gorm does on create.
+func stamp(now time.Time, created, updated *time.Time) {
+	if created.IsZero() {
+		*created = now
+	}
+	if updated != nil && updated.IsZero() {
+		*updated = now
+	}
+}
+
+// page applies LIMIT and OFFSET as gorm does: a negative limit and a non-positive offset do not apply.
+func page[T any](list []T, limit, offset int) []T {
+	if offset > 0 {
+		if offset >= len(list) {
+			return list[:0]
+		}
+		list = list[offset:]
+	}
+	if limit >= 0 && limit < len(list) {
+		list = list[:limit]
+	}
+	return list
+}
+
+// newestFirst orders by created_at DESC, id DESC.
+func newestFirst(ai, bi time.Time, aid, bid uint) bool {
+	if !ai.Equal(bi) {
+		return ai.After(bi)
+	}
+	return aid > bid
+}
+
+// oldestFirst orders by created_at, id.
+func oldestFirst(ai, bi time.Time, aid, bid uint) bool {
+	if !ai.Equal(bi) {
+		return ai.Before(bi)
+	}
+	return aid < bid
+}
+
+func softDelete(now time.Time) gorm.DeletedAt {
+	return gorm.DeletedAt{Time: now, Valid: true}
+}
@@ -0,0 +1,64 @@
+// memrepo/email_verification_repository: Sign-up codes, soft-deleted. The email stays unique among deleted
+// rows too, as the unique index of the table covers them.
+package memrepo
+
+import (
+	"context"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type EmailVerificationRepository struct {
+	db *DB
+}
+
+func NewEmailVerificationRepository(db *DB) *EmailVerificationRepository {
+	return &EmailVerificationRepository{db: db}
+}
+
+func (r *EmailVerificationRepository) Create(ctx context.Context, ev *model.EmailVerification) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, other := range r.db.verifications {
+		if other.Email == ev.Email {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	id, err := insertID(r.db, "email_verifications", r.db.verifications, ev.ID)
+	if err != nil {
+		return err
+	}
+	ev.ID = id
+	stamp(r.db.now(), &ev.CreatedAt, nil)
+	stored := *ev
+	r.db.verifications[id] = &stored
+	return nil
+}
+
+// FindValid returns the live, unexpired verification of email with code.
+func (r *EmailVerificationRepository) FindValid(ctx context.Context, email, code string) (*model.EmailVerification, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := r.db.now()
+	for _, id := range sortedIDs(r.db.verifications) {
+		ev := r.db.verifications[id]
+		if !ev.DeletedAt.Valid && ev.Email == email && ev.Code == code && ev.ExpiresAt.After(now) {
+			found := *ev
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// DeleteByEmail permanently removes verification records for this email, deleted ones included.
+func (r *EmailVerificationRepository) DeleteByEmail(ctx context.Context, email string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for id, ev := range r.db.verifications {
+		if ev.Email == email {
+			delete(r.db.verifications, id)
+		}
+	}
+	return nil
+}
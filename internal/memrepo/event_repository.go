@@ -0,0 +1,121 @@
+// memrepo/event_repository: Outbox events appended by the services and read by the relay, and the offsets of
+// the relay's shared consumers. Tests can inspect the events.
+package memrepo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+)
+
+type EventRepository struct {
+	db *DB
+}
+
+func NewEventRepository(db *DB) *EventRepository {
+	return &EventRepository{db: db}
+}
+
+// Append stores e with the next ID.
+func (r *EventRepository) Append(ctx context.Context, e *model.OutboxEvent) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.seq["outbox_events"]++
+	e.ID = uint64(r.db.seq["outbox_events"])
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = r.db.now()
+	}
+	r.db.events = append(r.db.events, *e)
+	return nil
+}
+
+// Events returns the appended events, oldest first.
+func (r *EventRepository) Events() []model.OutboxEvent {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return append([]model.OutboxEvent(nil), r.db.events...)
+}
+
+// After returns up to limit events with an ID above id, oldest first.
+func (r *EventRepository) After(ctx context.Context, id uint64, limit int) ([]model.OutboxEvent, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var list []model.OutboxEvent
+	for _, e := range r.db.events {
+		if e.ID > id {
+			list = append(list, e)
+		}
+	}
+	return page(list, limit, 0), nil
+}
+
+// LastID returns the ID of the newest event, 0 when there is none.
+func (r *EventRepository) LastID(ctx context.Context) (uint64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if len(r.db.events) == 0 {
+		return 0, nil
+	}
+	return r.db.events[len(r.db.events)-1].ID, nil
+}
+
+// ClaimOffset locks the offset of consumer for owner until now+lease and returns it. A consumer seen for the
+// first time starts at start. ok is false while another owner holds an unexpired lock.
+func (r *EventRepository) ClaimOffset(ctx context.Context, consumer, owner string, start uint64, now time.Time, lease time.Duration) (offset uint64, ok bool, err error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	o := r.db.offsets[consumer]
+	if o == nil {
+		o = &model.OutboxOffset{Consumer: consumer, LastID: start, UpdatedAt: r.db.now()}
+		r.db.offsets[consumer] = o
+	}
+	if o.Owner != owner && o.LockedUntil != nil && !o.LockedUntil.Before(now) {
+		return 0, false, nil
+	}
+	until := now.Add(lease)
+	o.Owner, o.LockedUntil, o.UpdatedAt = owner, &until, r.db.now()
+	return o.LastID, true, nil
+}
+
+// CommitOffset moves the offset of consumer to lastID and releases owner's lock. Returns an error when the lock
+// was lost to another owner, whose progress is then kept.
+func (r *EventRepository) CommitOffset(ctx context.Context, consumer, owner string, lastID uint64) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	o := r.db.offsets[consumer]
+	if o == nil || o.Owner != owner {
+		return errors.New("outbox offset of " + consumer + " was taken over by another instance")
+	}
+	o.LastID, o.Owner, o.LockedUntil, o.UpdatedAt = lastID, "", nil, r.db.now()
+	return nil
+}
+
+// Offsets returns the offsets of all shared consumers, by consumer.
+func (r *EventRepository) Offsets(ctx context.Context) ([]model.OutboxOffset, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var list []model.OutboxOffset
+	for _, o := range r.db.offsets {
+		list = append(list, *o)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Consumer < list[j].Consumer })
+	return list, nil
+}
+
+// Prune deletes events created before cutoff up to ID maxID and returns how many were deleted.
+func (r *EventRepository) Prune(ctx context.Context, cutoff time.Time, maxID uint64) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	kept := r.db.events[:0]
+	for _, e := range r.db.events {
+		if !e.CreatedAt.Before(cutoff) || e.ID > maxID {
+			kept = append(kept, e)
+		}
+	}
+	n := int64(len(r.db.events) - len(kept))
+	r.db.events = kept
+	return n, nil
+}
@@ -0,0 +1,128 @@
+// memrepo/media_repository: Media library items, soft-deleted, filtered like the gorm repository.
+package memrepo
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"gorm.io/gorm"
+)
+
+type MediaRepository struct {
+	db *DB
+}
+
+func NewMediaRepository(db *DB) *MediaRepository {
+	return &MediaRepository{db: db}
+}
+
+func (r *MediaRepository) Create(ctx context.Context, m *model.Media) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	id, err := insertID(r.db, "media", r.db.media, m.ID)
+	if err != nil {
+		return err
+	}
+	m.ID = id
+	stamp(r.db.now(), &m.CreatedAt, nil)
+	stored := *m
+	stored.URL = ""
+	r.db.media[id] = &stored
+	return nil
+}
+
+// DeleteByID soft-deletes the media item and removes its links to posts.
+func (r *MediaRepository) DeleteByID(ctx context.Context, id uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for key := range r.db.postMedia {
+		if key.mediaID == id {
+			delete(r.db.postMedia, key)
+		}
+	}
+	if m := r.db.media[id]; m != nil && !m.DeletedAt.Valid {
+		m.DeletedAt = softDelete(r.db.now())
+	}
+	return nil
+}
+
+func (r *MediaRepository) GetByID(ctx context.Context, id uint) (*model.Media, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	m := r.db.media[id]
+	if m == nil || m.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	item := *m
+	return &item, nil
+}
+
+// GetByIDs returns the media items with the given ids; missing ids are left out.
+func (r *MediaRepository) GetByIDs(ctx context.Context, ids []uint) ([]model.Media, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var items []model.Media
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if m := r.db.media[id]; m != nil && !m.DeletedAt.Valid && !seen[id] {
+			seen[id] = true
+			items = append(items, *m)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+// List returns media matching f, newest first.
+func (r *MediaRepository) List(ctx context.Context, f repository.MediaFilter, limit, offset int) ([]model.Media, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	items := r.filter(f)
+	sort.Slice(items, func(i, j int) bool {
+		return newestFirst(items[i].CreatedAt, items[j].CreatedAt, items[i].ID, items[j].ID)
+	})
+	return page(items, limit, offset), nil
+}
+
+func (r *MediaRepository) Count(ctx context.Context, f repository.MediaFilter) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return int64(len(r.filter(f))), nil
+}
+
+func (r *MediaRepository) filter(f repository.MediaFilter) []model.Media {
+	q := strings.ToLower(strings.TrimSpace(f.Query))
+	var items []model.Media
+	for _, m := range r.db.media {
+		switch {
+		case m.DeletedAt.Valid,
+			f.AuthorID != 0 && m.AuthorID != f.AuthorID,
+			f.Type != "" && m.Type != f.Type,
+			q != "" && !strings.Contains(strings.ToLower(m.Filename), q):
+			continue
+		}
+		if f.PostID != nil {
+			if _, ok := r.db.postMedia[postMediaKey{*f.PostID, m.ID}]; !ok {
+				continue
+			}
+		}
+		if f.Unattached && r.db.attached(m.ID) {
+			continue
+		}
+		items = append(items, *m)
+	}
+	return items
+}
+
+// attached reports whether mediaID is attached to a live post.
+func (db *DB) attached(mediaID uint) bool {
+	for key := range db.postMedia {
+		if p := db.posts[key.postID]; key.mediaID == mediaID && p != nil && !p.DeletedAt.Valid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,382 @@
+package memrepo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"github.com/aliakbar-zohour/go_blog/internal/testdb"
+	"gorm.io/gorm"
+)
+
+// stores is one implementation of the repository interfaces under test.
+type stores struct {
+	posts         repository.PostStore
+	media         repository.MediaStore
+	authors       repository.AuthorStore
+	categories    repository.CategoryStore
+	subscriptions repository.SubscriptionStore
+	notifications repository.NotificationStore
+	emails        repository.OutboxEmailStore
+	webhooks      repository.WebhookStore
+	events        repository.OutboxEventStore
+}
+
+// implementations returns the in-memory repositories and the gorm repositories on SQLite, so every test checks
+// that both behave the same.
+func implementations(t *testing.T) map[string]stores {
+	t.Helper()
+	mem := New()
+	impls := map[string]stores{"memory": {
+		posts:         NewPostRepository(mem),
+		media:         NewMediaRepository(mem),
+		authors:       NewAuthorRepository(mem),
+		categories:    NewCategoryRepository(mem),
+		subscriptions: NewSubscriptionRepository(mem),
+		notifications: NewNotificationRepository(mem),
+		emails:        NewOutboxEmailRepository(mem),
+		webhooks:      NewWebhookRepository(mem),
+		events:        NewEventRepository(mem),
+	}}
+	db := testdb.Open(t)
+	impls["sqlite"] = stores{
+		posts:         repository.NewPostRepository(db),
+		media:         repository.NewMediaRepository(db),
+		authors:       repository.NewAuthorRepository(db),
+		categories:    repository.NewCategoryRepository(db),
+		subscriptions: repository.NewSubscriptionRepository(db),
+		notifications: repository.NewNotificationRepository(db),
+		emails:        repository.NewOutboxEmailRepository(db),
+		webhooks:      repository.NewWebhookRepository(db),
+		events:        repository.NewOutboxEventRepository(db),
+	}
+	return impls
+}
+
+func TestPosts_SoftDeleteOrderingAndMedia(t *testing.T) {
+	for name, s := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			author := &model.Author{Name: "Alice"}
+			travel := &model.Category{Name: "Travel"}
+			if err := s.authors.Create(ctx, author); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.categories.Create(ctx, travel); err != nil {
+				t.Fatal(err)
+			}
+			base := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+			var ids []uint
+			for i, title := range []string{"Lisbon", "Porto", "Faro"} {
+				p := &model.Post{Title: title, AuthorID: author.ID, CreatedAt: base.Add(time.Duration(i) * time.Hour)}
+				if i > 0 {
+					p.CategoryID = travel.ID
+				}
+				if err := s.posts.Create(ctx, p); err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, p.ID)
+			}
+			photo := &model.Media{AuthorID: author.ID, Type: model.MediaTypeImage, Path: "a.jpg", Filename: "Tram.JPG"}
+			if err := s.media.Create(ctx, photo); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.posts.AttachMedia(ctx, ids[0], photo.ID, photo.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			list, err := s.posts.List(ctx, 10, 0, nil)
+			if err != nil || len(list) != 3 || list[0].Title != "Faro" || list[2].Title != "Lisbon" {
+				t.Fatalf("List = %+v, %v", list, err)
+			}
+			if list[2].Author == nil || list[2].Author.Name != "Alice" || len(list[2].Media) != 1 || list[1].Category == nil {
+				t.Fatalf("associations not loaded: %+v", list[2])
+			}
+			if list, _ := s.posts.List(ctx, 1, 1, &travel.ID); len(list) != 1 || list[0].Title != "Porto" {
+				t.Fatalf("List page in category = %+v", list)
+			}
+			// Posts created at the same instant come newest ID first, so pages do not overlap.
+			same := base.Add(5 * time.Hour)
+			braga, evora := &model.Post{Title: "Braga", AuthorID: author.ID, CreatedAt: same}, &model.Post{Title: "Evora", AuthorID: author.ID, CreatedAt: same}
+			_ = s.posts.Create(ctx, braga)
+			_ = s.posts.Create(ctx, evora)
+			if list, _ := s.posts.List(ctx, 2, 0, nil); len(list) != 2 || list[0].ID != evora.ID || list[1].ID != braga.ID {
+				t.Fatalf("List with equal created_at = %+v", list)
+			}
+
+			if err := s.posts.Delete(ctx, ids[0]); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.posts.GetByID(ctx, ids[0]); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatalf("deleted post: want ErrRecordNotFound, got %v", err)
+			}
+			if n, _ := s.posts.Count(ctx, nil); n != 4 {
+				t.Fatalf("Count after delete = %d", n)
+			}
+			// The photo's only post is gone, so it counts as unattached again.
+			if items, _ := s.media.List(ctx, repository.MediaFilter{Unattached: true, Query: "tram"}, 10, 0); len(items) != 1 {
+				t.Fatalf("unattached media = %+v", items)
+			}
+			if err := s.media.DeleteByID(ctx, photo.ID); err != nil {
+				t.Fatal(err)
+			}
+			if n, _ := s.media.Count(ctx, repository.MediaFilter{}); n != 0 {
+				t.Fatalf("deleted media still counted: %d", n)
+			}
+		})
+	}
+}
+
+func TestUniqueKeys(t *testing.T) {
+	for name, s := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := s.categories.Create(ctx, &model.Category{Name: "Travel"}); err != nil {
+				t.Fatal(err)
+			}
+			food := &model.Category{Name: "Food"}
+			if err := s.categories.Create(ctx, food); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.categories.Create(ctx, &model.Category{Name: "Travel"}); !errors.Is(err, gorm.ErrDuplicatedKey) {
+				t.Fatalf("duplicate name: want ErrDuplicatedKey, got %v", err)
+			}
+			food.Name = "Travel"
+			if err := s.categories.Update(ctx, food); !errors.Is(err, gorm.ErrDuplicatedKey) {
+				t.Fatalf("rename to a taken name: want ErrDuplicatedKey, got %v", err)
+			}
+			if list, _ := s.categories.List(ctx); len(list) != 2 || list[0].Name != "Food" {
+				t.Fatalf("List = %+v", list)
+			}
+
+			// Authors without an email do not collide.
+			email := "a@example.com"
+			for _, a := range []*model.Author{{Name: "Bob"}, {Name: "Carol"}, {Name: "Alice", Email: &email}} {
+				if err := s.authors.Create(ctx, a); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.authors.Create(ctx, &model.Author{Name: "Mallory", Email: &email}); !errors.Is(err, gorm.ErrDuplicatedKey) {
+				t.Fatalf("duplicate email: want ErrDuplicatedKey, got %v", err)
+			}
+			if _, err := s.authors.GetByEmail(ctx, "nobody@example.com"); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatalf("unknown email: want ErrRecordNotFound, got %v", err)
+			}
+			if list, _ := s.authors.List(ctx); len(list) != 3 || list[0].Name != "Alice" {
+				t.Fatalf("List = %+v", list)
+			}
+
+			sub := &model.Subscription{Email: "r@example.com", Scope: model.SubscriptionBlog, Frequency: model.FrequencyDaily, Timezone: "UTC"}
+			if err := s.subscriptions.Create(ctx, sub); err != nil {
+				t.Fatal(err)
+			}
+			dup := &model.Subscription{Email: "r@example.com", Scope: model.SubscriptionBlog, Frequency: model.FrequencyInstant, Timezone: "UTC"}
+			if err := s.subscriptions.Create(ctx, dup); !errors.Is(err, gorm.ErrDuplicatedKey) {
+				t.Fatalf("duplicate subscription: want ErrDuplicatedKey, got %v", err)
+			}
+			if found, err := s.subscriptions.Find(ctx, "r@example.com", model.SubscriptionAuthor, 1); found != nil || err != nil {
+				t.Fatalf("Find missing = %+v, %v", found, err)
+			}
+			d := &model.DigestDelivery{SubscriptionID: sub.ID, PeriodKey: "daily:2025-03-14"}
+			if ok, err := s.subscriptions.ClaimDigest(ctx, d); !ok || err != nil {
+				t.Fatalf("first claim: %v %v", ok, err)
+			}
+			if ok, err := s.subscriptions.ClaimDigest(ctx, &model.DigestDelivery{SubscriptionID: sub.ID, PeriodKey: d.PeriodKey}); ok || err != nil {
+				t.Fatalf("second claim: %v %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestNotifications_InboxOrderAndReadState(t *testing.T) {
+	for name, s := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			at := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+			for i := 0; i < 3; i++ {
+				n := &model.Notification{AuthorID: 1, Type: model.NotificationMention, CreatedAt: at}
+				if err := s.notifications.Create(ctx, n); err != nil {
+					t.Fatal(err)
+				}
+			}
+			list, _ := s.notifications.List(ctx, 1, false, 10, 0)
+			if len(list) != 3 || list[0].ID < list[1].ID {
+				t.Fatalf("same created_at must order by id desc: %+v", list)
+			}
+			if ok, _ := s.notifications.MarkRead(ctx, 2, list[0].ID, at); ok {
+				t.Fatal("marked another author's notification")
+			}
+			if ok, _ := s.notifications.MarkRead(ctx, 1, list[0].ID, at); !ok {
+				t.Fatal("MarkRead failed")
+			}
+			if n, _ := s.notifications.MarkAllRead(ctx, 1, at.Add(time.Minute)); n != 2 {
+				t.Fatalf("MarkAllRead = %d", n)
+			}
+			if n, _ := s.notifications.Count(ctx, 1, true); n != 0 {
+				t.Fatalf("unread after MarkAllRead = %d", n)
+			}
+		})
+	}
+}
+
+func TestOutboxEmails_ClaimsAndOutcomes(t *testing.T) {
+	for name, s := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Microsecond)
+			for _, next := range []time.Time{now.Add(-time.Minute), now.Add(-2 * time.Minute), now.Add(time.Hour)} {
+				e := &model.OutboxEmail{From: "blog@example.com", To: "r@example.com", Status: model.OutboxEmailPending, NextAttemptAt: next}
+				if err := s.emails.Create(ctx, e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			first, err := s.emails.ClaimDue(ctx, now, time.Minute)
+			if err != nil || first == nil || first.ID != 2 || first.Status != model.OutboxEmailSending {
+				t.Fatalf("first claim = %+v, %v; want the oldest due message", first, err)
+			}
+			second, _ := s.emails.ClaimDue(ctx, now, time.Minute)
+			if second == nil || second.ID != 1 {
+				t.Fatalf("second claim = %+v", second)
+			}
+			if none, err := s.emails.ClaimDue(ctx, now, time.Minute); none != nil || err != nil {
+				t.Fatalf("nothing due: %+v, %v", none, err)
+			}
+			if ok, err := s.emails.MarkFailed(ctx, first, 1, now, true, "rejected"); !ok || err != nil {
+				t.Fatalf("MarkFailed: %v %v", ok, err)
+			}
+			if n, _ := s.emails.Count(ctx, model.OutboxEmailDead); n != 1 {
+				t.Fatalf("dead count = %d", n)
+			}
+			if ok, _ := s.emails.Requeue(ctx, first.ID, now); !ok {
+				t.Fatal("Requeue of a dead message")
+			}
+			if ok, _ := s.emails.Requeue(ctx, first.ID, now); ok {
+				t.Fatal("Requeue of a pending message")
+			}
+
+			// Once the lease of the second claim expires, another worker takes the message over and the first
+			// worker's outcome no longer applies.
+			later := now.Add(2 * time.Minute)
+			again, _ := s.emails.ClaimDue(ctx, later, time.Minute)
+			if again == nil || again.ID != second.ID {
+				t.Fatalf("claim after the lease expired = %+v", again)
+			}
+			if ok, _ := s.emails.MarkSent(ctx, second, 1, later); ok {
+				t.Fatal("MarkSent with a lost claim applied")
+			}
+			if ok, _ := s.emails.MarkSent(ctx, again, 1, later); !ok {
+				t.Fatal("MarkSent with the current claim")
+			}
+			list, _ := s.emails.List(ctx, "", 2, 0)
+			if len(list) != 2 || list[0].ID != 3 || list[1].ID != 2 {
+				t.Fatalf("List = %+v", list)
+			}
+			if got, _ := s.emails.GetByID(ctx, second.ID); got.Status != model.OutboxEmailSent || got.SentAt == nil {
+				t.Fatalf("sent message = %+v", got)
+			}
+		})
+	}
+}
+
+func TestWebhooks_DeliveriesOncePerEvent(t *testing.T) {
+	for name, s := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Microsecond)
+			hook := &model.Webhook{URL: "https://example.com/hook", Secret: "s", Events: []string{model.WebhookEventPostCreated}, Active: true}
+			paused := &model.Webhook{URL: "https://example.com/paused", Secret: "s", Events: []string{model.WebhookEventPostCreated}, Active: true}
+			for _, w := range []*model.Webhook{hook, paused} {
+				if err := s.webhooks.Create(ctx, w); err != nil {
+					t.Fatal(err)
+				}
+			}
+			paused.Active = false
+			if err := s.webhooks.Update(ctx, paused); err != nil {
+				t.Fatal(err)
+			}
+			if active, _ := s.webhooks.ListActive(ctx); len(active) != 1 || active[0].ID != hook.ID || len(active[0].Events) != 1 {
+				t.Fatalf("ListActive = %+v", active)
+			}
+
+			for i := 0; i < 2; i++ {
+				ds := []model.WebhookDelivery{{WebhookID: hook.ID, EventID: "ev-1", Event: model.WebhookEventPostCreated, Payload: "{}", Status: model.WebhookDeliveryPending, NextAttemptAt: now}}
+				if err := s.webhooks.CreateDeliveries(ctx, ds); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n, _ := s.webhooks.CountDeliveries(ctx, hook.ID, ""); n != 1 {
+				t.Fatalf("deliveries of one event handed over twice = %d", n)
+			}
+			d, err := s.webhooks.ClaimDue(ctx, now, time.Minute)
+			if err != nil || d == nil || d.Status != model.WebhookDeliverySending {
+				t.Fatalf("ClaimDue = %+v, %v", d, err)
+			}
+			d.Status, d.Attempts, d.LastError = model.WebhookDeliveryDead, 1, "gone"
+			if err := s.webhooks.SaveAttempt(ctx, d); err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := s.webhooks.Requeue(ctx, d.ID, now); !ok {
+				t.Fatal("Requeue of a dead delivery")
+			}
+			if list, _ := s.webhooks.ListDeliveries(ctx, hook.ID, model.WebhookDeliveryPending, 10, 0); len(list) != 1 || list[0].Attempts != 0 || list[0].LastError != "gone" {
+				t.Fatalf("pending deliveries = %+v", list)
+			}
+
+			if err := s.webhooks.Delete(ctx, hook.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.webhooks.GetDelivery(ctx, d.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Fatalf("delivery of a deleted webhook: want ErrRecordNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOutboxEvents_OffsetsAndPrune(t *testing.T) {
+	for name, s := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+			for _, typ := range []string{"post.created", "post.updated", "post.deleted"} {
+				if err := s.events.Append(ctx, &model.OutboxEvent{Type: typ, Payload: "{}"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if after, _ := s.events.After(ctx, 1, 10); len(after) != 2 || after[0].ID != 2 || after[1].Type != "post.deleted" {
+				t.Fatalf("After(1) = %+v", after)
+			}
+
+			if offset, ok, err := s.events.ClaimOffset(ctx, "mail", "a", 1, now, time.Minute); offset != 1 || !ok || err != nil {
+				t.Fatalf("first claim = %d %v %v", offset, ok, err)
+			}
+			if _, ok, _ := s.events.ClaimOffset(ctx, "mail", "b", 0, now, time.Minute); ok {
+				t.Fatal("claim of an offset another owner holds")
+			}
+			if err := s.events.CommitOffset(ctx, "mail", "b", 3); err == nil {
+				t.Fatal("commit by an owner without the claim")
+			}
+			if err := s.events.CommitOffset(ctx, "mail", "a", 2); err != nil {
+				t.Fatal(err)
+			}
+			if offset, ok, _ := s.events.ClaimOffset(ctx, "mail", "b", 0, now, time.Minute); offset != 2 || !ok {
+				t.Fatalf("claim after commit = %d %v", offset, ok)
+			}
+			if offsets, _ := s.events.Offsets(ctx); len(offsets) != 1 || offsets[0].LastID != 2 {
+				t.Fatalf("Offsets = %+v", offsets)
+			}
+
+			if n, err := s.events.Prune(ctx, now.Add(time.Hour), 2); n != 2 || err != nil {
+				t.Fatalf("Prune = %d, %v", n, err)
+			}
+			if after, _ := s.events.After(ctx, 0, 10); len(after) != 1 || after[0].ID != 3 {
+				t.Fatalf("events after Prune = %+v", after)
+			}
+			if last, _ := s.events.LastID(ctx); last != 3 {
+				t.Fatalf("LastID = %d", last)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// memrepo/notification_repository: Notification inbox, per-author preferences and category watches.
+package memrepo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+)
+
+type NotificationRepository struct {
+	db *DB
+}
+
+func NewNotificationRepository(db *DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+func (r *NotificationRepository) Create(ctx context.Context, n *model.Notification) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	id, err := insertID(r.db, "notifications", r.db.notifications, n.ID)
+	if err != nil {
+		return err
+	}
+	n.ID = id
+	stamp(r.db.now(), &n.CreatedAt, nil)
+	stored := *n
+	r.db.notifications[id] = &stored
+	return nil
+}
+
+// CreateOnce stores n unless its recipient already has a notification of the same event (n.EventID), and
+// reports whether it did.
+func (r *NotificationRepository) CreateOnce(ctx context.Context, n *model.Notification) (bool, error) {
+	r.db.mu.Lock()
+	if n.EventID != nil {
+		for _, stored := range r.db.notifications {
+			if stored.AuthorID == n.AuthorID && stored.EventID != nil && *stored.EventID == *n.EventID {
+				r.db.mu.Unlock()
+				return false, nil
+			}
+		}
+	}
+	r.db.mu.Unlock()
+	return true, r.Create(ctx, n)
+}
+
+// List returns the notifications of authorID, newest first.
+func (r *NotificationRepository) List(ctx context.Context, authorID uint, unreadOnly bool, limit, offset int) ([]model.Notification, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var list []model.Notification
+	for _, n := range r.inbox(authorID, unreadOnly) {
+		list = append(list, *n)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return newestFirst(list[i].CreatedAt, list[j].CreatedAt, list[i].ID, list[j].ID)
+	})
+	return page(list, limit, offset), nil
+}
+
+func (r *NotificationRepository) Count(ctx context.Context, authorID uint, unreadOnly bool) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return int64(len(r.inbox(authorID, unreadOnly))), nil
+}
+
+// MarkRead marks notification id of authorID as read. It reports false when authorID has no such notification;
+// marking an already read notification again succeeds and keeps the first read time.
+func (r *NotificationRepository) MarkRead(ctx context.Context, authorID, id uint, at time.Time) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	n := r.db.notifications[id]
+	if n == nil || n.AuthorID != authorID {
+		return false, nil
+	}
+	if n.ReadAt == nil {
+		n.ReadAt = &at
+	}
+	return true, nil
+}
+
+// MarkAllRead marks every unread notification of authorID as read and returns how many there were.
+func (r *NotificationRepository) MarkAllRead(ctx context.Context, authorID uint, at time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	unread := r.inbox(authorID, true)
+	for _, n := range unread {
+		n.ReadAt = &at
+	}
+	return int64(len(unread)), nil
+}
+
+// Preferences returns the stored preferences of authorID, keyed by type. Missing types are enabled.
+func (r *NotificationRepository) Preferences(ctx context.Context, authorID uint) (map[model.NotificationType]bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	prefs := make(map[model.NotificationType]bool)
+	for key, enabled := range r.db.preferences {
+		if key.authorID == authorID {
+			prefs[key.t] = enabled
+		}
+	}
+	return prefs, nil
+}
+
+// SetPreferences upserts the given types for authorID.
+func (r *NotificationRepository) SetPreferences(ctx context.Context, authorID uint, prefs map[model.NotificationType]bool) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for t, enabled := range prefs {
+		r.db.preferences[preferenceKey{authorID, t}] = enabled
+	}
+	return nil
+}
+
+// Watch adds a category watch; watching twice is a no-op.
+func (r *NotificationRepository) Watch(ctx context.Context, authorID, categoryID uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	key := watchKey{authorID, categoryID}
+	if _, ok := r.db.watches[key]; !ok {
+		r.db.watches[key] = r.db.now()
+	}
+	return nil
+}
+
+func (r *NotificationRepository) Unwatch(ctx context.Context, authorID, categoryID uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	delete(r.db.watches, watchKey{authorID, categoryID})
+	return nil
+}
+
+// Watches returns the watches of authorID by category.
+func (r *NotificationRepository) Watches(ctx context.Context, authorID uint) ([]model.CategoryWatch, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var list []model.CategoryWatch
+	for key, at := range r.db.watches {
+		if key.authorID == authorID {
+			list = append(list, model.CategoryWatch{AuthorID: key.authorID, CategoryID: key.categoryID, CreatedAt: at})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CategoryID < list[j].CategoryID })
+	return list, nil
+}
+
+// CategoryWatchers returns the IDs of the authors watching categoryID, in ascending order.
+func (r *NotificationRepository) CategoryWatchers(ctx context.Context, categoryID uint) ([]uint, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var ids []uint
+	for key := range r.db.watches {
+		if key.categoryID == categoryID {
+			ids = append(ids, key.authorID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (r *NotificationRepository) inbox(authorID uint, unreadOnly bool) []*model.Notification {
+	var list []*model.Notification
+	for _, n := range r.db.notifications {
+		if n.AuthorID == authorID && (!unreadOnly || n.ReadAt == nil) {
+			list = append(list, n)
+		}
+	}
+	return list
+}
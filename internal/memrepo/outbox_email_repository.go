@@ -0,0 +1,150 @@
+// memrepo/outbox_email_repository: Mail queue messages, claimed under a lease like the gorm repository's.
+package memrepo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type OutboxEmailRepository struct {
+	db *DB
+}
+
+func NewOutboxEmailRepository(db *DB) *OutboxEmailRepository {
+	return &OutboxEmailRepository{db: db}
+}
+
+func (r *OutboxEmailRepository) Create(ctx context.Context, e *model.OutboxEmail) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	id, err := insertID(r.db, "outbox_emails", r.db.emails, e.ID)
+	if err != nil {
+		return err
+	}
+	e.ID = id
+	stamp(r.db.now(), &e.CreatedAt, &e.UpdatedAt)
+	stored := *e
+	r.db.emails[id] = &stored
+	return nil
+}
+
+func (r *OutboxEmailRepository) GetByID(ctx context.Context, id uint) (*model.OutboxEmail, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	e := r.db.emails[id]
+	if e == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *e
+	return &found, nil
+}
+
+// ClaimDue marks the oldest due message as sending until now+lease and returns it, or nil when none is due.
+// Messages whose lease expired are due again.
+func (r *OutboxEmailRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.OutboxEmail, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var due *model.OutboxEmail
+	for _, e := range r.db.emails {
+		pending := e.Status == model.OutboxEmailPending && !e.NextAttemptAt.After(now)
+		expired := e.Status == model.OutboxEmailSending && e.LockedUntil != nil && e.LockedUntil.Before(now)
+		if !pending && !expired {
+			continue
+		}
+		if due == nil || e.NextAttemptAt.Before(due.NextAttemptAt) || (e.NextAttemptAt.Equal(due.NextAttemptAt) && e.ID < due.ID) {
+			due = e
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+	until := now.Add(lease).UTC().Truncate(time.Microsecond)
+	due.Status, due.LockedUntil, due.UpdatedAt = model.OutboxEmailSending, &until, r.db.now()
+	claimed := *due
+	return &claimed, nil
+}
+
+// MarkSent records a successful delivery while claim is still held, and reports whether it did.
+func (r *OutboxEmailRepository) MarkSent(ctx context.Context, claim *model.OutboxEmail, attempts int, at time.Time) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	e := r.claimed(claim)
+	if e == nil {
+		return false, nil
+	}
+	e.Status, e.Attempts, e.SentAt, e.LockedUntil, e.LastError = model.OutboxEmailSent, attempts, &at, nil, ""
+	e.UpdatedAt = r.db.now()
+	return true, nil
+}
+
+// MarkFailed records a failed attempt while claim is still held: the message is retried at next, or moved to
+// dead when dead is true.
+func (r *OutboxEmailRepository) MarkFailed(ctx context.Context, claim *model.OutboxEmail, attempts int, next time.Time, dead bool, lastErr string) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	e := r.claimed(claim)
+	if e == nil {
+		return false, nil
+	}
+	e.Status = model.OutboxEmailPending
+	if dead {
+		e.Status = model.OutboxEmailDead
+	}
+	e.Attempts, e.NextAttemptAt, e.LockedUntil, e.LastError = attempts, next, nil, lastErr
+	e.UpdatedAt = r.db.now()
+	return true, nil
+}
+
+// claimed returns the stored message of claim while it is still sending under the same lease. Call it with the
+// lock held.
+func (r *OutboxEmailRepository) claimed(claim *model.OutboxEmail) *model.OutboxEmail {
+	e := r.db.emails[claim.ID]
+	if e == nil || e.Status != model.OutboxEmailSending || e.LockedUntil == nil || claim.LockedUntil == nil ||
+		!e.LockedUntil.Equal(*claim.LockedUntil) {
+		return nil
+	}
+	return e
+}
+
+// Requeue makes a dead message pending again with a fresh attempt budget. Returns false when it is not dead.
+func (r *OutboxEmailRepository) Requeue(ctx context.Context, id uint, now time.Time) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	e := r.db.emails[id]
+	if e == nil || e.Status != model.OutboxEmailDead {
+		return false, nil
+	}
+	e.Status, e.Attempts, e.NextAttemptAt, e.UpdatedAt = model.OutboxEmailPending, 0, now, r.db.now()
+	return true, nil
+}
+
+// List returns messages, newest first, optionally filtered by status.
+func (r *OutboxEmailRepository) List(ctx context.Context, status model.OutboxEmailStatus, limit, offset int) ([]model.OutboxEmail, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var list []model.OutboxEmail
+	for _, e := range r.db.emails {
+		if status == "" || e.Status == status {
+			list = append(list, *e)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return page(list, limit, offset), nil
+}
+
+// Count returns the number of messages, optionally filtered by status.
+func (r *OutboxEmailRepository) Count(ctx context.Context, status model.OutboxEmailStatus) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var n int64
+	for _, e := range r.db.emails {
+		if status == "" || e.Status == status {
+			n++
+		}
+	}
+	return n, nil
+}
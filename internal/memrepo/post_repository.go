@@ -0,0 +1,189 @@
+// memrepo/post_repository: Posts, soft-deleted, with their author, category and media loaded as the gorm
+// repository preloads them.
+package memrepo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type PostRepository struct {
+	db *DB
+}
+
+func NewPostRepository(db *DB) *PostRepository {
+	return &PostRepository{db: db}
+}
+
+// Create stores post. Like the gorm repository fed a post without associations, Author, Category and Media
+// are not written.
+func (r *PostRepository) Create(ctx context.Context, post *model.Post) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	id, err := insertID(r.db, "posts", r.db.posts, post.ID)
+	if err != nil {
+		return err
+	}
+	post.ID = id
+	stamp(r.db.now(), &post.CreatedAt, &post.UpdatedAt)
+	r.db.posts[id] = storedPost(post)
+	return nil
+}
+
+func (r *PostRepository) GetByID(ctx context.Context, id uint) (*model.Post, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	p := r.db.posts[id]
+	if p == nil || p.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	post := r.db.loadPost(p, true)
+	return &post, nil
+}
+
+// List returns live posts newest first, optionally only in categoryID.
+func (r *PostRepository) List(ctx context.Context, limit, offset int, categoryID *uint) ([]model.Post, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	list := r.db.livePosts(func(p *model.Post) bool {
+		return categoryID == nil || *categoryID == 0 || p.CategoryID == *categoryID
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return newestFirst(list[i].CreatedAt, list[j].CreatedAt, list[i].ID, list[j].ID)
+	})
+	list = page(list, limit, offset)
+	posts := make([]model.Post, len(list))
+	for i, p := range list {
+		posts[i] = r.db.loadPost(p, true)
+	}
+	return posts, nil
+}
+
+// ListPublicCreatedBetween returns up to limit posts that are not private created in [from, to), oldest first,
+// without their media.
+func (r *PostRepository) ListPublicCreatedBetween(ctx context.Context, from, to time.Time, authorID, categoryID uint, limit int) ([]model.Post, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	list := r.db.livePosts(func(p *model.Post) bool {
+		return !p.CreatedAt.Before(from) && p.CreatedAt.Before(to) && !p.Private &&
+			(authorID == 0 || p.AuthorID == authorID) && (categoryID == 0 || p.CategoryID == categoryID)
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return oldestFirst(list[i].CreatedAt, list[j].CreatedAt, list[i].ID, list[j].ID)
+	})
+	list = page(list, limit, 0)
+	posts := make([]model.Post, len(list))
+	for i, p := range list {
+		posts[i] = r.db.loadPost(p, false)
+	}
+	return posts, nil
+}
+
+func (r *PostRepository) Count(ctx context.Context, categoryID *uint) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	list := r.db.livePosts(func(p *model.Post) bool {
+		return categoryID == nil || *categoryID == 0 || p.CategoryID == *categoryID
+	})
+	return int64(len(list)), nil
+}
+
+// Update saves every column of post, creating it when its ID is zero or unknown, as gorm's Save does.
+func (r *PostRepository) Update(ctx context.Context, post *model.Post) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := r.db.now()
+	if post.ID == 0 || r.db.posts[post.ID] == nil {
+		id, err := insertID(r.db, "posts", r.db.posts, post.ID)
+		if err != nil {
+			return err
+		}
+		post.ID = id
+		stamp(now, &post.CreatedAt, nil)
+	}
+	post.UpdatedAt = now
+	r.db.posts[post.ID] = storedPost(post)
+	return nil
+}
+
+// AttachMedia links media library items to a post. Items already attached are left as they are.
+func (r *PostRepository) AttachMedia(ctx context.Context, postID uint, mediaIDs ...uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := r.db.now()
+	for _, id := range mediaIDs {
+		key := postMediaKey{postID, id}
+		if _, ok := r.db.postMedia[key]; !ok {
+			r.db.postMedia[key] = now
+		}
+	}
+	return nil
+}
+
+func (r *PostRepository) DetachMedia(ctx context.Context, postID, mediaID uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	delete(r.db.postMedia, postMediaKey{postID, mediaID})
+	return nil
+}
+
+// Delete soft-deletes the post; its media links stay, as in the database.
+func (r *PostRepository) Delete(ctx context.Context, id uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if p := r.db.posts[id]; p != nil && !p.DeletedAt.Valid {
+		p.DeletedAt = softDelete(r.db.now())
+	}
+	return nil
+}
+
+// storedPost copies post without the associations and the URL filled when serving it.
+func storedPost(post *model.Post) *model.Post {
+	p := *post
+	p.Author, p.Category, p.Media, p.BannerURL = nil, nil, nil, ""
+	return &p
+}
+
+// livePosts returns the posts that are not deleted and match keep.
+func (db *DB) livePosts(keep func(p *model.Post) bool) []*model.Post {
+	var list []*model.Post
+	for _, p := range db.posts {
+		if !p.DeletedAt.Valid && keep(p) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// loadPost returns a copy of p with its author and category, and its live media when withMedia is set.
+func (db *DB) loadPost(p *model.Post, withMedia bool) model.Post {
+	post := *p
+	if a := db.authors[p.AuthorID]; a != nil {
+		author := *a
+		post.Author = &author
+	}
+	if c := db.categories[p.CategoryID]; c != nil {
+		category := *c
+		post.Category = &category
+	}
+	if withMedia {
+		post.Media = db.postMediaOf(p.ID)
+	}
+	return post
+}
+
+// postMediaOf returns the live media attached to postID, by ID.
+func (db *DB) postMediaOf(postID uint) []model.Media {
+	var items []model.Media
+	for key := range db.postMedia {
+		if m := db.media[key.mediaID]; key.postID == postID && m != nil && !m.DeletedAt.Valid {
+			items = append(items, *m)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items
+}
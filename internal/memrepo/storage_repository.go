@@ -0,0 +1,100 @@
+// memrepo/storage_repository: Stored file paths still referenced by live rows, read from the other tables.
+package memrepo
+
+import (
+	"context"
+)
+
+type StorageRepository struct {
+	db *DB
+}
+
+func NewStorageRepository(db *DB) *StorageRepository {
+	return &StorageRepository{db: db}
+}
+
+// ReferencedPaths returns every upload-relative path used by a live row: media library items (attached or not),
+// banners of live posts, author avatars and resumable uploads in progress.
+func (r *StorageRepository) ReferencedPaths(ctx context.Context) (map[string]bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	refs := make(map[string]bool)
+	for _, m := range r.db.media {
+		if !m.DeletedAt.Valid {
+			refs[m.Path] = true
+		}
+	}
+	for _, p := range r.db.posts {
+		if !p.DeletedAt.Valid && p.BannerPath != "" {
+			refs[p.BannerPath] = true
+		}
+	}
+	for _, a := range r.db.authors {
+		if a.AvatarPath != "" {
+			refs[a.AvatarPath] = true
+		}
+	}
+	for _, u := range r.db.uploads {
+		refs[u.Path] = true
+	}
+	return refs, nil
+}
+
+// IsReferenced reports whether a live row uses path, as ReferencedPaths would list it.
+func (r *StorageRepository) IsReferenced(ctx context.Context, path string) (bool, error) {
+	refs, err := r.ReferencedPaths(ctx)
+	return refs[path], err
+}
+
+// IsPrivate reports whether serving path needs a signature: its blob is used by a live private post. Files
+// stored before blobs have no row and are looked up in the posts instead.
+func (r *StorageRepository) IsPrivate(ctx context.Context, path string) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if b := r.db.blobByPath(path); b != nil {
+		return b.Private, nil
+	}
+	return r.usedPrivately(path), nil
+}
+
+// PrivatePaths returns which of paths are blobs used by a live private post.
+func (r *StorageRepository) PrivatePaths(ctx context.Context, paths []string) (map[string]bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	private := make(map[string]bool)
+	for _, p := range paths {
+		if b := r.db.blobByPath(p); b != nil && b.Private {
+			private[p] = true
+		}
+	}
+	return private, nil
+}
+
+// RefreshPrivacy recomputes the private flag of the blobs at paths from the posts using them.
+func (r *StorageRepository) RefreshPrivacy(ctx context.Context, paths []string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, p := range paths {
+		if b := r.db.blobByPath(p); b != nil {
+			b.Private = r.usedPrivately(p)
+		}
+	}
+	return nil
+}
+
+// usedPrivately reports whether a live private post uses path as its banner or attached media. Call it with
+// the lock held.
+func (r *StorageRepository) usedPrivately(path string) bool {
+	for _, p := range r.db.posts {
+		if !p.DeletedAt.Valid && p.Private && p.BannerPath == path {
+			return true
+		}
+	}
+	for key := range r.db.postMedia {
+		m, p := r.db.media[key.mediaID], r.db.posts[key.postID]
+		if m != nil && p != nil && !m.DeletedAt.Valid && !p.DeletedAt.Valid && p.Private && m.Path == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+// memrepo/subscription_repository: Newsletter subscriptions, their confirmation tokens and digest deliveries,
+// with the unique keys of their tables.
+package memrepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type SubscriptionRepository struct {
+	db *DB
+}
+
+func NewSubscriptionRepository(db *DB) *SubscriptionRepository {
+	return &SubscriptionRepository{db: db}
+}
+
+func (r *SubscriptionRepository) Create(ctx context.Context, s *model.Subscription) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if r.targetTaken(s) {
+		return gorm.ErrDuplicatedKey
+	}
+	id, err := insertID(r.db, "subscriptions", r.db.subscriptions, s.ID)
+	if err != nil {
+		return err
+	}
+	s.ID = id
+	stamp(r.db.now(), &s.CreatedAt, &s.UpdatedAt)
+	stored := *s
+	r.db.subscriptions[id] = &stored
+	return nil
+}
+
+// Update saves every column of s, creating it when its ID is zero or unknown.
+func (r *SubscriptionRepository) Update(ctx context.Context, s *model.Subscription) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if r.targetTaken(s) {
+		return gorm.ErrDuplicatedKey
+	}
+	now := r.db.now()
+	if s.ID == 0 || r.db.subscriptions[s.ID] == nil {
+		id, err := insertID(r.db, "subscriptions", r.db.subscriptions, s.ID)
+		if err != nil {
+			return err
+		}
+		s.ID = id
+		stamp(now, &s.CreatedAt, nil)
+	}
+	s.UpdatedAt = now
+	stored := *s
+	r.db.subscriptions[s.ID] = &stored
+	return nil
+}
+
+func (r *SubscriptionRepository) GetByID(ctx context.Context, id uint) (*model.Subscription, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	s := r.db.subscriptions[id]
+	if s == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *s
+	return &found, nil
+}
+
+// Find returns the subscription of email to scope/targetID, or nil when there is none.
+func (r *SubscriptionRepository) Find(ctx context.Context, email string, scope model.SubscriptionScope, targetID uint) (*model.Subscription, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, s := range r.db.subscriptions {
+		if s.Email == email && s.Scope == scope && s.TargetID == targetID {
+			found := *s
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListConfirmedForPost returns confirmed instant subscriptions to the whole blog, the category or the author.
+func (r *SubscriptionRepository) ListConfirmedForPost(ctx context.Context, authorID, categoryID uint) ([]model.Subscription, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return r.list(func(s *model.Subscription) bool {
+		if s.ConfirmedAt == nil || s.Frequency != model.FrequencyInstant {
+			return false
+		}
+		return s.Scope == model.SubscriptionBlog ||
+			s.Scope == model.SubscriptionCategory && s.TargetID == categoryID ||
+			s.Scope == model.SubscriptionAuthor && s.TargetID == authorID
+	}), nil
+}
+
+// Delete removes the subscription, its pending confirmation and digest history.
+func (r *SubscriptionRepository) Delete(ctx context.Context, id uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.deleteConfirmations(id)
+	for did, d := range r.db.digests {
+		if d.SubscriptionID == id {
+			delete(r.db.digests, did)
+		}
+	}
+	for did, d := range r.db.postDeliveries {
+		if d.SubscriptionID == id {
+			delete(r.db.postDeliveries, did)
+		}
+	}
+	delete(r.db.subscriptions, id)
+	return nil
+}
+
+// ReplaceConfirmation stores c as the only confirmation of its subscription, so older links stop working.
+func (r *SubscriptionRepository) ReplaceConfirmation(ctx context.Context, c *model.SubscriptionConfirmation) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, other := range r.db.confirmations {
+		if other.Token == c.Token && other.SubscriptionID != c.SubscriptionID {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	r.deleteConfirmations(c.SubscriptionID)
+	id, err := insertID(r.db, "subscription_confirmations", r.db.confirmations, c.ID)
+	if err != nil {
+		return err
+	}
+	c.ID = id
+	stamp(r.db.now(), &c.CreatedAt, nil)
+	stored := *c
+	r.db.confirmations[id] = &stored
+	return nil
+}
+
+// FindValidConfirmation returns the unexpired confirmation with token.
+func (r *SubscriptionRepository) FindValidConfirmation(ctx context.Context, token string) (*model.SubscriptionConfirmation, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := r.db.now()
+	for _, c := range r.db.confirmations {
+		if c.Token == token && c.ExpiresAt.After(now) {
+			found := *c
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// Confirm marks the subscription confirmed at and removes its confirmation token.
+func (r *SubscriptionRepository) Confirm(ctx context.Context, id uint, at time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if s := r.db.subscriptions[id]; s != nil {
+		s.ConfirmedAt = &at
+		s.UpdatedAt = r.db.now()
+	}
+	r.deleteConfirmations(id)
+	return nil
+}
+
+// ListConfirmedDigests returns confirmed daily and weekly subscriptions.
+func (r *SubscriptionRepository) ListConfirmedDigests(ctx context.Context) ([]model.Subscription, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return r.list(func(s *model.Subscription) bool {
+		return s.ConfirmedAt != nil && (s.Frequency == model.FrequencyDaily || s.Frequency == model.FrequencyWeekly)
+	}), nil
+}
+
+// ClaimDigest inserts d unless a delivery for the same subscription and period exists. Reports whether d was inserted.
+func (r *SubscriptionRepository) ClaimDigest(ctx context.Context, d *model.DigestDelivery) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, other := range r.db.digests {
+		if other.SubscriptionID == d.SubscriptionID && other.PeriodKey == d.PeriodKey {
+			return false, nil
+		}
+	}
+	id, err := insertID(r.db, "digest_deliveries", r.db.digests, d.ID)
+	if err != nil {
+		return false, err
+	}
+	d.ID = id
+	stamp(r.db.now(), &d.CreatedAt, nil)
+	stored := *d
+	r.db.digests[id] = &stored
+	return true, nil
+}
+
+// ClaimPostDelivery inserts d unless the post was already mailed to the subscription, and reports whether it did.
+func (r *SubscriptionRepository) ClaimPostDelivery(ctx context.Context, d *model.PostDelivery) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, other := range r.db.postDeliveries {
+		if other.SubscriptionID == d.SubscriptionID && other.PostID == d.PostID {
+			return false, nil
+		}
+	}
+	id, err := insertID(r.db, "post_deliveries", r.db.postDeliveries, d.ID)
+	if err != nil {
+		return false, err
+	}
+	d.ID = id
+	stamp(r.db.now(), &d.CreatedAt, nil)
+	stored := *d
+	r.db.postDeliveries[id] = &stored
+	return true, nil
+}
+
+// ReleaseDigest deletes a claimed delivery whose email could not be queued, so the next run retries it.
+func (r *SubscriptionRepository) ReleaseDigest(ctx context.Context, id uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	delete(r.db.digests, id)
+	return nil
+}
+
+// FinishDigest records the outcome of a claimed delivery and moves the subscription's digest window to periodEnd.
+func (r *SubscriptionRepository) FinishDigest(ctx context.Context, d *model.DigestDelivery, periodEnd time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if stored := r.db.digests[d.ID]; stored != nil {
+		stored.PostCount, stored.SentAt = d.PostCount, d.SentAt
+	}
+	if s := r.db.subscriptions[d.SubscriptionID]; s != nil {
+		s.LastDigestAt = &periodEnd
+		s.UpdatedAt = r.db.now()
+	}
+	return nil
+}
+
+// list returns the subscriptions matching keep, by ID.
+func (r *SubscriptionRepository) list(keep func(s *model.Subscription) bool) []model.Subscription {
+	var list []model.Subscription
+	for _, id := range sortedIDs(r.db.subscriptions) {
+		if s := r.db.subscriptions[id]; keep(s) {
+			list = append(list, *s)
+		}
+	}
+	return list
+}
+
+// targetTaken reports whether another subscription has the email, scope and target of s.
+func (r *SubscriptionRepository) targetTaken(s *model.Subscription) bool {
+	for id, other := range r.db.subscriptions {
+		if id != s.ID && other.Email == s.Email && other.Scope == s.Scope && other.TargetID == s.TargetID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *SubscriptionRepository) deleteConfirmations(subscriptionID uint) {
+	for id, c := range r.db.confirmations {
+		if c.SubscriptionID == subscriptionID {
+			delete(r.db.confirmations, id)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+// memrepo/transactor: Stand-in for repository.Transactor; the in-memory repositories have no transactions.
+package memrepo
+
+import "context"
+
+// Transactor runs functions directly, as a nil *repository.Transactor does: what they changed stays when they
+// fail, AfterCommit functions run at once and OnRollback ones are dropped.
+type Transactor struct{}
+
+func NewTransactor() *Transactor {
+	return &Transactor{}
+}
+
+func (*Transactor) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
@@ -0,0 +1,129 @@
+// memrepo/upload_repository: Resumable upload state, keyed by the upload's string ID.
+package memrepo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type UploadRepository struct {
+	db *DB
+}
+
+func NewUploadRepository(db *DB) *UploadRepository {
+	return &UploadRepository{db: db}
+}
+
+func (r *UploadRepository) Create(ctx context.Context, u *model.Upload) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if r.db.uploads[u.ID] != nil {
+		return gorm.ErrDuplicatedKey
+	}
+	stamp(r.db.now(), &u.CreatedAt, &u.UpdatedAt)
+	stored := *u
+	r.db.uploads[u.ID] = &stored
+	return nil
+}
+
+func (r *UploadRepository) GetByID(ctx context.Context, id string) (*model.Upload, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	u := r.db.uploads[id]
+	if u == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *u
+	return &found, nil
+}
+
+// Update saves every column of u, creating it when its ID is unknown.
+func (r *UploadRepository) Update(ctx context.Context, u *model.Upload) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := r.db.now()
+	if r.db.uploads[u.ID] == nil {
+		stamp(now, &u.CreatedAt, nil)
+	}
+	u.UpdatedAt = now
+	stored := *u
+	r.db.uploads[u.ID] = &stored
+	return nil
+}
+
+// Claim gives the upload to the request holding token until until, provided it is still at offset and no other
+// request holds an unexpired claim on it. It reports whether the claim was made.
+func (r *UploadRepository) Claim(ctx context.Context, id string, offset int64, token string, until, now time.Time) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	u := r.db.uploads[id]
+	if u == nil || u.Offset != offset || (u.ClaimedUntil != nil && !u.ClaimedUntil.Before(now)) {
+		return false, nil
+	}
+	u.ClaimToken, u.ClaimedUntil = token, &until
+	return true, nil
+}
+
+// RenewClaim extends the claim of token until until; a claim that was lost stays lost.
+func (r *UploadRepository) RenewClaim(ctx context.Context, id, token string, until time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if u := r.db.uploads[id]; u != nil && u.ClaimToken == token {
+		u.ClaimedUntil = &until
+	}
+	return nil
+}
+
+// Advance saves the offset, completion and expiry of u, claimed by token at offset from, and ends the claim. It
+// reports false, saving nothing, when the claim was lost.
+func (r *UploadRepository) Advance(ctx context.Context, u *model.Upload, from int64, token string) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	stored := r.db.uploads[u.ID]
+	if stored == nil || stored.Offset != from || stored.ClaimToken != token {
+		return false, nil
+	}
+	stored.Offset, stored.CompletedAt, stored.ExpiresAt = u.Offset, u.CompletedAt, u.ExpiresAt
+	stored.ClaimToken, stored.ClaimedUntil = "", nil
+	stored.UpdatedAt = r.db.now()
+	return true, nil
+}
+
+// ReleaseClaim ends the claim of token without progress.
+func (r *UploadRepository) ReleaseClaim(ctx context.Context, id, token string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if u := r.db.uploads[id]; u != nil && u.ClaimToken == token {
+		u.ClaimToken, u.ClaimedUntil = "", nil
+	}
+	return nil
+}
+
+// Delete removes the upload, or returns gorm.ErrRecordNotFound when it is unknown.
+func (r *UploadRepository) Delete(ctx context.Context, id string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if r.db.uploads[id] == nil {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.db.uploads, id)
+	return nil
+}
+
+// ListExpired returns uploads whose expiry is before now, finished or not, that no request is writing, by ID.
+func (r *UploadRepository) ListExpired(ctx context.Context, now time.Time) ([]model.Upload, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var list []model.Upload
+	for _, u := range r.db.uploads {
+		if u.ExpiresAt.Before(now) && (u.ClaimedUntil == nil || u.ClaimedUntil.Before(now)) {
+			list = append(list, *u)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
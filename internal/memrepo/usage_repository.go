@@ -0,0 +1,102 @@
+// memrepo/usage_repository: Per-author upload accounting, one row per author and media type.
+package memrepo
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+)
+
+type UsageRepository struct {
+	db *DB
+}
+
+func NewUsageRepository(db *DB) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// Charge adds one file of bytes and type t to the author's usage and frees reserved bytes of their
+// reservations, unless that takes their stored and reserved bytes over quota (0 = unlimited). It reports
+// whether the charge was made.
+func (r *UsageRepository) Charge(ctx context.Context, authorID uint, t model.MediaType, bytes, reserved, quota int64) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if !r.adjust(authorID, bytes, -reserved, quota) {
+		return false, nil
+	}
+	r.add(authorID, t, bytes, 1)
+	return true, nil
+}
+
+// Add adjusts the author's usage for a media type without a quota check; negative values release usage.
+func (r *UsageRepository) Add(ctx context.Context, authorID uint, t model.MediaType, bytes, files int64) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.adjust(authorID, bytes, 0, 0)
+	r.add(authorID, t, bytes, files)
+	return nil
+}
+
+// Reserve holds bytes for an upload that has not been stored yet, unless that takes the author's stored and
+// reserved bytes over quota (0 = unlimited), and reports whether it did. Negative bytes free a reservation.
+func (r *UsageRepository) Reserve(ctx context.Context, authorID uint, bytes, quota int64) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return r.adjust(authorID, 0, bytes, quota), nil
+}
+
+// ListByAuthor returns the usage of authorID by media type.
+func (r *UsageRepository) ListByAuthor(ctx context.Context, authorID uint) ([]model.StorageUsage, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var list []model.StorageUsage
+	for key, u := range r.db.usage {
+		if key.authorID == authorID {
+			list = append(list, *u)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Type < list[j].Type })
+	return list, nil
+}
+
+// Account returns the author's stored and reserved bytes; zero for an author who never stored anything.
+func (r *UsageRepository) Account(ctx context.Context, authorID uint) (*model.StorageAccount, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if a := r.db.accounts[authorID]; a != nil {
+		found := *a
+		return &found, nil
+	}
+	return &model.StorageAccount{AuthorID: authorID}, nil
+}
+
+// adjust adds used and reserved bytes to the author's account when the new total stays within quota
+// (0 = unlimited) or does not grow. Call it with db.mu held.
+func (r *UsageRepository) adjust(authorID uint, used, reserved, quota int64) bool {
+	a := r.db.accounts[authorID]
+	if a == nil {
+		a = &model.StorageAccount{AuthorID: authorID}
+	}
+	if quota > 0 && used+reserved > 0 && a.UsedBytes+a.ReservedBytes+used+reserved > quota {
+		return false
+	}
+	a.UsedBytes += used
+	a.ReservedBytes += reserved
+	a.UpdatedAt = r.db.now()
+	r.db.accounts[authorID] = a
+	return true
+}
+
+// add adjusts the author's usage for a media type. Call it with db.mu held.
+func (r *UsageRepository) add(authorID uint, t model.MediaType, bytes, files int64) {
+	key := usageKey{authorID, t}
+	u := r.db.usage[key]
+	if u == nil {
+		u = &model.StorageUsage{AuthorID: authorID, Type: t}
+		r.db.usage[key] = u
+	}
+	u.Bytes += bytes
+	u.Files += files
+	u.UpdatedAt = r.db.now()
+}
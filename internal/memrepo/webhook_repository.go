@@ -0,0 +1,223 @@
+// memrepo/webhook_repository: Webhook subscriptions and their delivery log, one delivery per webhook and event.
+package memrepo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type WebhookRepository struct {
+	db *DB
+}
+
+func NewWebhookRepository(db *DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, w *model.Webhook) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	id, err := insertID(r.db, "webhooks", r.db.webhooks, w.ID)
+	if err != nil {
+		return err
+	}
+	w.ID = id
+	stamp(r.db.now(), &w.CreatedAt, &w.UpdatedAt)
+	r.db.webhooks[id] = storedWebhook(w)
+	return nil
+}
+
+func (r *WebhookRepository) GetByID(ctx context.Context, id uint) (*model.Webhook, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	w := r.db.webhooks[id]
+	if w == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return storedWebhook(w), nil
+}
+
+// List returns all webhooks by ID.
+func (r *WebhookRepository) List(ctx context.Context) ([]model.Webhook, error) {
+	return r.list(false), nil
+}
+
+// ListActive returns the webhooks that receive events, by ID.
+func (r *WebhookRepository) ListActive(ctx context.Context) ([]model.Webhook, error) {
+	return r.list(true), nil
+}
+
+func (r *WebhookRepository) list(activeOnly bool) []model.Webhook {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var list []model.Webhook
+	for _, w := range r.db.webhooks {
+		if !activeOnly || w.Active {
+			list = append(list, *storedWebhook(w))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Update saves every column of w, creating it when its ID is unknown.
+func (r *WebhookRepository) Update(ctx context.Context, w *model.Webhook) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := r.db.now()
+	if w.ID == 0 || r.db.webhooks[w.ID] == nil {
+		id, err := insertID(r.db, "webhooks", r.db.webhooks, w.ID)
+		if err != nil {
+			return err
+		}
+		w.ID = id
+		stamp(now, &w.CreatedAt, nil)
+	}
+	w.UpdatedAt = now
+	r.db.webhooks[w.ID] = storedWebhook(w)
+	return nil
+}
+
+// Delete removes the webhook and its delivery log.
+func (r *WebhookRepository) Delete(ctx context.Context, id uint) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for did, d := range r.db.deliveries {
+		if d.WebhookID == id {
+			delete(r.db.deliveries, did)
+		}
+	}
+	delete(r.db.webhooks, id)
+	return nil
+}
+
+// CreateDeliveries stores deliveries, skipping those whose webhook already has the event.
+func (r *WebhookRepository) CreateDeliveries(ctx context.Context, ds []model.WebhookDelivery) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	now := r.db.now()
+	for i := range ds {
+		if r.hasEvent(ds[i].WebhookID, ds[i].EventID) {
+			continue
+		}
+		id, err := insertID(r.db, "webhook_deliveries", r.db.deliveries, ds[i].ID)
+		if err != nil {
+			return err
+		}
+		ds[i].ID = id
+		stamp(now, &ds[i].CreatedAt, &ds[i].UpdatedAt)
+		stored := ds[i]
+		r.db.deliveries[id] = &stored
+	}
+	return nil
+}
+
+// hasEvent reports whether webhookID has a delivery of eventID. Call it with the lock held.
+func (r *WebhookRepository) hasEvent(webhookID uint, eventID string) bool {
+	for _, d := range r.db.deliveries {
+		if d.WebhookID == webhookID && d.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *WebhookRepository) GetDelivery(ctx context.Context, id uint) (*model.WebhookDelivery, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	d := r.db.deliveries[id]
+	if d == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *d
+	return &found, nil
+}
+
+// ClaimDue marks the oldest due delivery as sending until now+lease and returns it, or nil when none is due.
+// Deliveries whose lease expired are due again.
+func (r *WebhookRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.WebhookDelivery, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	var due *model.WebhookDelivery
+	for _, d := range r.db.deliveries {
+		pending := d.Status == model.WebhookDeliveryPending && !d.NextAttemptAt.After(now)
+		expired := d.Status == model.WebhookDeliverySending && d.LockedUntil != nil && d.LockedUntil.Before(now)
+		if !pending && !expired {
+			continue
+		}
+		if due == nil || d.NextAttemptAt.Before(due.NextAttemptAt) || (d.NextAttemptAt.Equal(due.NextAttemptAt) && d.ID < due.ID) {
+			due = d
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+	until := now.Add(lease)
+	due.Status, due.LockedUntil, due.UpdatedAt = model.WebhookDeliverySending, &until, r.db.now()
+	claimed := *due
+	return &claimed, nil
+}
+
+// SaveAttempt records the outcome of an attempt stored in d: status, attempts, response, error and next attempt.
+func (r *WebhookRepository) SaveAttempt(ctx context.Context, d *model.WebhookDelivery) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	stored := r.db.deliveries[d.ID]
+	if stored == nil {
+		return nil
+	}
+	stored.Status, stored.Attempts, stored.NextAttemptAt, stored.LockedUntil = d.Status, d.Attempts, d.NextAttemptAt, nil
+	stored.ResponseStatus, stored.ResponseBody, stored.DurationMs = d.ResponseStatus, d.ResponseBody, d.DurationMs
+	stored.LastError, stored.DeliveredAt, stored.UpdatedAt = d.LastError, d.DeliveredAt, r.db.now()
+	return nil
+}
+
+// Requeue makes a dead delivery pending again with a fresh attempt budget. Returns false when it is not dead.
+func (r *WebhookRepository) Requeue(ctx context.Context, id uint, now time.Time) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	d := r.db.deliveries[id]
+	if d == nil || d.Status != model.WebhookDeliveryDead {
+		return false, nil
+	}
+	d.Status, d.Attempts, d.NextAttemptAt, d.UpdatedAt = model.WebhookDeliveryPending, 0, now, r.db.now()
+	return true, nil
+}
+
+// ListDeliveries returns the deliveries of a webhook, newest first, optionally filtered by status.
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, webhookID uint, status model.WebhookDeliveryStatus, limit, offset int) ([]model.WebhookDelivery, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	list := r.deliveriesOf(webhookID, status)
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return page(list, limit, offset), nil
+}
+
+// CountDeliveries returns the number of deliveries of a webhook, optionally filtered by status.
+func (r *WebhookRepository) CountDeliveries(ctx context.Context, webhookID uint, status model.WebhookDeliveryStatus) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	return int64(len(r.deliveriesOf(webhookID, status))), nil
+}
+
+// deliveriesOf returns the deliveries of webhookID with status, any status when empty. Call it with the lock held.
+func (r *WebhookRepository) deliveriesOf(webhookID uint, status model.WebhookDeliveryStatus) []model.WebhookDelivery {
+	var list []model.WebhookDelivery
+	for _, d := range r.db.deliveries {
+		if d.WebhookID == webhookID && (status == "" || d.Status == status) {
+			list = append(list, *d)
+		}
+	}
+	return list
+}
+
+// storedWebhook copies w, including its event list.
+func storedWebhook(w *model.Webhook) *model.Webhook {
+	c := *w
+	c.Events = append([]string(nil), w.Events...)
+	return &c
+}
@@ -0,0 +1,25 @@
+// middleware/admin: Restricts routes to the authors listed in ADMIN_AUTHOR_IDS. Use after RequireAuth.
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/aliakbar-zohour/go_blog/pkg/response"
+)
+
+// RequireAdmin returns 403 unless the authenticated author is one of ids. With no ids every request is refused.
+func RequireAdmin(ids []uint) func(http.Handler) http.Handler {
+	admins := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		admins[id] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !admins[GetAuthorID(r.Context())] {
+				response.ErrWithCode(w, http.StatusForbidden, "admin_required", "admin access required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/aliakbar-zohour/go_blog/pkg/auth"
 	"github.com/aliakbar-zohour/go_blog/pkg/response"
@@ -12,14 +13,35 @@ import (
 
 type contextKey string
 
-const AuthorIDKey contextKey = "author_id"
+const (
+	AuthorIDKey    contextKey = "author_id"
+	TokenExpiryKey contextKey = "token_expiry"
+)
 
 // RequireAuth validates the Bearer token and sets author_id in context. Returns 401 if missing or invalid.
+// Browsers cannot set headers on WebSocket handshakes, so those may pass the token as ?access_token= instead.
 func RequireAuth(secret string) func(http.Handler) http.Handler {
+	return authenticate(secret, true)
+}
+
+// OptionalAuth sets author_id in context when the request has a Bearer token, for routes anyone may call but
+// that show more to some authors. Requests without one go on anonymously; an invalid token still gets 401.
+func OptionalAuth(secret string) func(http.Handler) http.Handler {
+	return authenticate(secret, false)
+}
+
+func authenticate(secret string, required bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			header := r.Header.Get("Authorization")
+			if header == "" && isWebSocketHandshake(r) && r.URL.Query().Get("access_token") != "" {
+				header = "Bearer " + r.URL.Query().Get("access_token")
+			}
 			if header == "" {
+				if !required {
+					next.ServeHTTP(w, r)
+					return
+				}
 				response.UnauthorizedWithCode(w, "auth_required", "authorization required")
 				return
 			}
@@ -34,11 +56,18 @@ func RequireAuth(secret string) func(http.Handler) http.Handler {
 				return
 			}
 			ctx := context.WithValue(r.Context(), AuthorIDKey, claims.AuthorID)
+			if claims.ExpiresAt != nil {
+				ctx = context.WithValue(ctx, TokenExpiryKey, claims.ExpiresAt.Time)
+			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+func isWebSocketHandshake(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
 // GetAuthorID returns the author ID from context, or 0 if not set.
 func GetAuthorID(ctx context.Context) uint {
 	v := ctx.Value(AuthorIDKey)
@@ -48,3 +77,9 @@ func GetAuthorID(ctx context.Context) uint {
 	id, _ := v.(uint)
 	return id
 }
+
+// GetTokenExpiry returns when the token of the request expires, or the zero time if it does not.
+func GetTokenExpiry(ctx context.Context) time.Time {
+	t, _ := ctx.Value(TokenExpiryKey).(time.Time)
+	return t
+}
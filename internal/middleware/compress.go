@@ -16,10 +16,15 @@ func (g *gzipResponseWriter) Write(b []byte) (int, error) {
 	return g.w.Write(b)
 }
 
-// Gzip compresses response with gzip when client accepts it.
+func (g *gzipResponseWriter) Flush() {
+	_ = g.w.Flush()
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Gzip compresses response with gzip when client accepts it. Event streams and WebSocket handshakes are left alone.
 func Gzip(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || strings.Contains(r.Header.Get("Accept"), "text/event-stream") || r.Header.Get("Upgrade") != "" {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -0,0 +1,79 @@
+// middleware/replica: Read-your-writes with read replicas. Requests that may write use the primary, and so do a
+// client's reads for a short window after it wrote, until the replicas have caught up.
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/database"
+)
+
+const (
+	// ReadPrimaryHeader tells a client until when (Unix milliseconds) its reads go to the primary; clients that do
+	// not keep cookies send it back on their reads.
+	ReadPrimaryHeader = "X-Read-Primary-Until"
+	readPrimaryCookie = "read_primary_until"
+)
+
+// StickyPrimary sends a client's reads to the primary for a window after each write. The window travels with the
+// client, as a cookie and a response header, so it holds whichever instance serves the next request.
+type StickyPrimary struct {
+	window time.Duration
+}
+
+// NewStickyPrimary returns a middleware sending a client's reads to the primary for window after each write.
+func NewStickyPrimary(window time.Duration) *StickyPrimary {
+	return &StickyPrimary{window: window}
+}
+
+func (s *StickyPrimary) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if s.sticky(r) {
+				r = r.WithContext(database.UsePrimary(r.Context()))
+			}
+			next.ServeHTTP(w, r)
+		default:
+			// Set before the handler writes the response; reads of a write request (e.g. the post an update
+			// changes) must see the latest row too.
+			s.stick(w, r)
+			next.ServeHTTP(w, r.WithContext(database.UsePrimary(r.Context())))
+		}
+	})
+}
+
+// sticky reports whether r carries a window that is still open. Windows further ahead than one window from now
+// are not issued by stick and are ignored, so a client cannot pin itself to the primary.
+func (s *StickyPrimary) sticky(r *http.Request) bool {
+	value := r.Header.Get(ReadPrimaryHeader)
+	if c, err := r.Cookie(readPrimaryCookie); value == "" && err == nil {
+		value = c.Value
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	until := time.UnixMilli(ms)
+	return now.Before(until) && !until.After(now.Add(s.window))
+}
+
+func (s *StickyPrimary) stick(w http.ResponseWriter, r *http.Request) {
+	if s.window <= 0 {
+		return
+	}
+	until := strconv.FormatInt(time.Now().Add(s.window).UnixMilli(), 10)
+	w.Header().Set(ReadPrimaryHeader, until)
+	http.SetCookie(w, &http.Cookie{
+		Name:     readPrimaryCookie,
+		Value:    until,
+		Path:     "/",
+		MaxAge:   int((s.window + time.Second - 1) / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,355 @@
+// migrate: Versioned SQL migrations embedded in the binary. Each applied version is recorded with the checksum
+// of its SQL in schema_migrations; runs are serialised by a database lock, so replicas starting together do not
+// race.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations
+var embedded embed.FS
+
+var (
+	ErrBehind         = errors.New("database schema is behind")
+	ErrModified       = errors.New("applied migration differs from this binary's")
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+// lockKey identifies the migration lock among PostgreSQL advisory locks.
+const lockKey = 7_204_517_011
+
+// Migration is one version: Up applies it, Down reverts it.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of Up
+}
+
+// Status is a migration known to this binary or recorded in the database.
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Modified  bool       `json:"modified,omitempty"` // applied with another checksum than this binary's
+	Unknown   bool       `json:"unknown,omitempty"`  // applied by a newer release
+}
+
+type record struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New returns a migrator running the embedded migrations of db's dialect.
+func New(db *gorm.DB) (*Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	dialect := db.Dialector.Name()
+	migrations, err := load(embedded, "migrations/"+dialect)
+	if err != nil {
+		return nil, fmt.Errorf("migrations for %s: %w", dialect, err)
+	}
+	return &Migrator{db: sqlDB, dialect: dialect, migrations: migrations}, nil
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// load reads the NNNN_name.up.sql and NNNN_name.down.sql files of dir, sorted by version.
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("version %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(b)
+			sum := sha256.Sum256(b)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(b)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("version %d (%s) needs both an up and a down file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest returns the highest version this binary knows, 0 without migrations.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status lists the migrations of this binary and the versions applied by newer releases, by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var list []Status
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]record) error {
+		list = status(m.migrations, applied)
+		return nil
+	})
+	return list, err
+}
+
+func status(migrations []Migration, applied map[int64]record) []Status {
+	list := make([]Status, 0, len(migrations))
+	known := make(map[int64]bool, len(migrations))
+	for _, mig := range migrations {
+		known[mig.Version] = true
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if r, ok := applied[mig.Version]; ok {
+			at := r.appliedAt
+			s.Applied, s.AppliedAt, s.Modified = true, &at, r.checksum != mig.Checksum
+		}
+		list = append(list, s)
+	}
+	for version, r := range applied {
+		if !known[version] {
+			at := r.appliedAt
+			list = append(list, Status{Version: version, Name: r.name, Applied: true, AppliedAt: &at, Unknown: true})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list
+}
+
+// Check returns ErrBehind when migrations of this binary are not applied and ErrModified when an applied one was
+// changed since. Versions applied by a newer release are accepted, so older replicas keep running during a rollout.
+func (m *Migrator) Check(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn, applied map[int64]record) error {
+		if err := verify(m.migrations, applied); err != nil {
+			return err
+		}
+		var pending []string
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; !ok {
+				pending = append(pending, fmt.Sprintf("%d_%s", mig.Version, mig.Name))
+			}
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%w: %d pending migrations %v", ErrBehind, len(pending), pending)
+		}
+		return nil
+	})
+}
+
+// verify returns ErrModified when an applied migration's checksum differs from this binary's.
+func verify(migrations []Migration, applied map[int64]record) error {
+	for _, mig := range migrations {
+		if r, ok := applied[mig.Version]; ok && r.checksum != mig.Checksum {
+			return fmt.Errorf("%w: %d_%s", ErrModified, mig.Version, mig.Name)
+		}
+	}
+	return nil
+}
+
+// Up applies every pending migration and returns them. Versions applied by a newer release are left alone.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.migrate(ctx, m.Latest(), false)
+}
+
+// Down reverts the n most recently applied migrations and returns them.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]record) error {
+		versions := make([]int64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+		if n < len(versions) {
+			versions = versions[:n]
+		}
+		var err error
+		done, err = m.revert(ctx, conn, applied, versions)
+		return err
+	})
+	return done, err
+}
+
+// To migrates up or down to version: migrations up to it that are pending are applied in order, applied ones
+// above it are reverted newest first. Returns the migrations run.
+func (m *Migrator) To(ctx context.Context, version int64) ([]Migration, error) {
+	return m.migrate(ctx, version, true)
+}
+
+func (m *Migrator) migrate(ctx context.Context, version int64, down bool) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]record) error {
+		if err := verify(m.migrations, applied); err != nil {
+			return err
+		}
+		var above []int64
+		for v := range applied {
+			if down && v > version {
+				above = append(above, v)
+			}
+		}
+		sort.Slice(above, func(i, j int) bool { return above[i] > above[j] })
+		reverted, err := m.revert(ctx, conn, applied, above)
+		done = append(done, reverted...)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok || mig.Version > version {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// revert runs the down migrations of versions in the given order.
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, applied map[int64]record, versions []int64) ([]Migration, error) {
+	var done []Migration
+	for _, v := range versions {
+		mig, ok := m.find(v)
+		if !ok {
+			return done, fmt.Errorf("%w: %d_%s was applied by a newer release", ErrUnknownVersion, v, applied[v].name)
+		}
+		if err := m.run(ctx, conn, mig, false); err != nil {
+			return done, err
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+// run applies or reverts one migration and records it in the same transaction.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	script := mig.Down
+	if up {
+		script = mig.Up
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("%d_%s: %w", mig.Version, mig.Name, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)`,
+			mig.Version, mig.Name, mig.Checksum, time.Now().UTC())
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// locked runs fn holding the migration lock on a dedicated connection, with the applied versions.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, applied map[int64]record) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Without session locks (SQLite) the version's primary key still keeps a migration from being recorded twice.
+	if m.dialect == "postgres" {
+		// Blocks until other instances are done; released with the session should this one crash.
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+			return fmt.Errorf("migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+	}
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return err
+	}
+	applied, err := readApplied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+func readApplied(ctx context.Context, conn *sql.Conn) (map[int64]record, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int64]record{}
+	for rows.Next() {
+		var v int64
+		var r record
+		if err := rows.Scan(&v, &r.name, &r.checksum, &r.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[v] = r
+	}
+	return applied, rows.Err()
+}
@@ -0,0 +1,296 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupMigrator(t *testing.T, files fstest.MapFS) (*Migrator, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := load(files, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	return &Migrator{db: sqlDB, dialect: "sqlite", migrations: migrations}, db
+}
+
+func testFiles() fstest.MapFS {
+	return fstest.MapFS{
+		"m/0001_authors.up.sql":      {Data: []byte("CREATE TABLE authors (id INTEGER PRIMARY KEY, name TEXT);")},
+		"m/0001_authors.down.sql":    {Data: []byte("DROP TABLE authors;")},
+		"m/0002_posts.up.sql":        {Data: []byte("CREATE TABLE posts (id INTEGER PRIMARY KEY);\nCREATE INDEX idx_posts_id ON posts (id);")},
+		"m/0002_posts.down.sql":      {Data: []byte("DROP TABLE posts;")},
+		"m/0003_post_title.up.sql":   {Data: []byte("ALTER TABLE posts ADD COLUMN title TEXT;")},
+		"m/0003_post_title.down.sql": {Data: []byte("ALTER TABLE posts DROP COLUMN title;")},
+	}
+}
+
+func TestLoad_EmbeddedPostgresMigrations(t *testing.T) {
+	migrations, err := load(embedded, "migrations/postgres")
+	if err != nil || len(migrations) == 0 || migrations[0].Version != 1 {
+		t.Fatalf("load = %v, %v", migrations, err)
+	}
+	if _, err := load(fstest.MapFS{"m/0001_a.up.sql": {Data: []byte("SELECT 1;")}}, "m"); err == nil {
+		t.Error("migration without a down file accepted")
+	}
+}
+
+func TestEmbedded_DialectsMatchModels(t *testing.T) {
+	pg, err := load(embedded, "migrations/postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lite, err := load(embedded, "migrations/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pg) != len(lite) {
+		t.Fatalf("postgres has %d migrations, sqlite %d", len(pg), len(lite))
+	}
+	for i := range pg {
+		if pg[i].Version != lite[i].Version || pg[i].Name != lite[i].Name {
+			t.Errorf("migration %d: postgres %d_%s, sqlite %d_%s", i, pg[i].Version, pg[i].Name, lite[i].Version, lite[i].Name)
+		}
+	}
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	models := []interface{}{&model.Author{}, &model.Category{}, &model.Post{}, &model.Media{}, &model.PostMedia{}, &model.Comment{}, &model.EmailVerification{}, &model.Upload{}, &model.Blob{}, &model.StorageUsage{}, &model.StorageAccount{}, &model.OutboxEmail{}, &model.Subscription{}, &model.SubscriptionConfirmation{}, &model.DigestDelivery{}, &model.PostDelivery{}, &model.Notification{}, &model.NotificationPreference{}, &model.CategoryWatch{}, &model.Webhook{}, &model.WebhookDelivery{}, &model.OutboxEvent{}, &model.OutboxOffset{}}
+	for _, v := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(v); err != nil {
+			t.Fatal(err)
+		}
+		var columns []string
+		db.Raw("SELECT name FROM pragma_table_info(?)", stmt.Schema.Table).Scan(&columns)
+		have := map[string]bool{}
+		for _, c := range columns {
+			have[c] = true
+		}
+		for _, f := range stmt.Schema.Fields {
+			if f.DBName != "" && !have[f.DBName] {
+				t.Errorf("%s.%s is missing from the migrations", stmt.Schema.Table, f.DBName)
+			}
+		}
+		for _, idx := range stmt.Schema.ParseIndexes() {
+			if !db.Migrator().HasIndex(v, idx.Name) {
+				t.Errorf("index %s is missing from the migrations", idx.Name)
+			}
+		}
+	}
+}
+
+func TestMigrator_UpDownAndTo(t *testing.T) {
+	m, db := setupMigrator(t, testFiles())
+	ctx := context.Background()
+	if err := m.Check(ctx); !errors.Is(err, ErrBehind) {
+		t.Fatalf("empty database: want ErrBehind, got %v", err)
+	}
+	done, err := m.To(ctx, 2)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("To(2) = %v, %v", done, err)
+	}
+	if !db.Migrator().HasTable("posts") || db.Migrator().HasColumn("posts", "title") {
+		t.Fatal("schema does not match version 2")
+	}
+	if done, err = m.Up(ctx); err != nil || len(done) != 1 || done[0].Version != 3 {
+		t.Fatalf("Up = %v, %v", done, err)
+	}
+	if done, _ = m.Up(ctx); len(done) != 0 {
+		t.Errorf("second Up ran %v", done)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	if done, err = m.Down(ctx, 2); err != nil || len(done) != 2 || done[0].Version != 3 || done[1].Version != 2 {
+		t.Fatalf("Down(2) = %v, %v", done, err)
+	}
+	if db.Migrator().HasTable("posts") {
+		t.Error("posts kept after reverting its migration")
+	}
+	list, err := m.Status(ctx)
+	if err != nil || len(list) != 3 || !list[0].Applied || list[1].Applied || list[2].Applied {
+		t.Fatalf("Status = %+v, %v", list, err)
+	}
+}
+
+func TestMigrator_RefusesModifiedAndToleratesNewer(t *testing.T) {
+	files := testFiles()
+	m, _ := setupMigrator(t, files)
+	ctx := context.Background()
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A release that knows only the first two versions keeps running against the newer schema.
+	older := &Migrator{db: m.db, dialect: m.dialect, migrations: m.migrations[:2]}
+	if err := older.Check(ctx); err != nil {
+		t.Errorf("older binary: %v", err)
+	}
+	if done, err := older.Up(ctx); err != nil || len(done) != 0 {
+		t.Errorf("older binary Up = %v, %v", done, err)
+	}
+	if list, _ := older.Status(ctx); len(list) != 3 || !list[2].Unknown || list[2].Name != "post_title" {
+		t.Errorf("older binary status = %+v", list)
+	}
+	if _, err := older.Down(ctx, 1); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("reverting an unknown version: want ErrUnknownVersion, got %v", err)
+	}
+
+	// Editing an applied migration is caught.
+	files["m/0002_posts.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE posts (id INTEGER PRIMARY KEY, body TEXT);")}
+	edited, _ := load(files, "m")
+	changed := &Migrator{db: m.db, dialect: m.dialect, migrations: edited}
+	if err := changed.Check(ctx); !errors.Is(err, ErrModified) {
+		t.Errorf("want ErrModified, got %v", err)
+	}
+	if list, _ := changed.Status(ctx); !list[1].Modified {
+		t.Errorf("status of the edited migration = %+v", list[1])
+	}
+}
+
+// The models of the first release, whose schema GORM's AutoMigrate created.
+type (
+	baselineAuthor struct {
+		ID              uint    `gorm:"primaryKey"`
+		Name            string  `gorm:"size:255;not null"`
+		AvatarPath      string  `gorm:"size:512"`
+		Email           *string `gorm:"size:255;uniqueIndex"`
+		PasswordHash    string  `gorm:"size:255"`
+		EmailVerifiedAt *time.Time
+		CreatedAt       time.Time
+		UpdatedAt       time.Time
+	}
+	baselineCategory struct {
+		ID        uint   `gorm:"primaryKey"`
+		Name      string `gorm:"size:255;not null;uniqueIndex"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+	baselinePost struct {
+		ID         uint              `gorm:"primaryKey"`
+		Title      string            `gorm:"size:255;not null"`
+		Body       string            `gorm:"type:text"`
+		BannerPath string            `gorm:"size:512"`
+		AuthorID   uint              `gorm:"index"`
+		Author     *baselineAuthor   `gorm:"foreignKey:AuthorID"`
+		CategoryID uint              `gorm:"index"`
+		Category   *baselineCategory `gorm:"foreignKey:CategoryID"`
+		Media      []baselineMedia   `gorm:"foreignKey:PostID"`
+		CreatedAt  time.Time
+		UpdatedAt  time.Time
+		DeletedAt  gorm.DeletedAt `gorm:"index"`
+	}
+	baselineMedia struct {
+		ID        uint   `gorm:"primaryKey"`
+		PostID    uint   `gorm:"not null;index"`
+		Type      string `gorm:"size:20;not null"`
+		Path      string `gorm:"size:512;not null"`
+		Filename  string `gorm:"size:255"`
+		CreatedAt time.Time
+		DeletedAt gorm.DeletedAt `gorm:"index"`
+	}
+	baselineComment struct {
+		ID         uint   `gorm:"primaryKey"`
+		PostID     uint   `gorm:"not null;index"`
+		Body       string `gorm:"type:text;not null"`
+		AuthorID   *uint  `gorm:"index"`
+		AuthorName string `gorm:"size:255;not null"`
+		CreatedAt  time.Time
+		UpdatedAt  time.Time
+	}
+	baselineEmailVerification struct {
+		ID        uint      `gorm:"primaryKey"`
+		Email     string    `gorm:"size:255;uniqueIndex;not null"`
+		Code      string    `gorm:"size:10;not null"`
+		ExpiresAt time.Time `gorm:"not null"`
+		CreatedAt time.Time
+		DeletedAt gorm.DeletedAt `gorm:"index"`
+	}
+)
+
+func (baselineAuthor) TableName() string            { return "authors" }
+func (baselineCategory) TableName() string          { return "categories" }
+func (baselinePost) TableName() string              { return "posts" }
+func (baselineMedia) TableName() string             { return "media" }
+func (baselineComment) TableName() string           { return "comments" }
+func (baselineEmailVerification) TableName() string { return "email_verifications" }
+
+func TestEmbedded_UpgradesAutoMigratedBaseline(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared&_foreign_keys=1"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&baselineAuthor{}, &baselineCategory{}, &baselinePost{}, &baselineMedia{}, &baselineComment{}, &baselineEmailVerification{}); err != nil {
+		t.Fatal(err)
+	}
+	author, category := &baselineAuthor{Name: "Ada"}, &baselineCategory{Name: "Travel"}
+	db.Create(author)
+	db.Create(category)
+	post := &baselinePost{Title: "Lisbon", AuthorID: author.ID, CategoryID: category.ID,
+		Media: []baselineMedia{{Type: "image", Path: "posts/1/a.jpg"}, {Type: "video", Path: "posts/1/b.mp4"}}}
+	if err := db.Create(post).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up on a baseline database: %v", err)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if db.Migrator().HasColumn("media", "post_id") {
+		t.Error("media.post_id kept")
+	}
+	var links []model.PostMedia
+	db.Order("media_id").Find(&links)
+	if len(links) != 2 || links[0].PostID != post.ID || links[1].MediaID != post.Media[1].ID {
+		t.Errorf("post_media = %+v", links)
+	}
+	var media []model.Media
+	db.Order("id").Find(&media)
+	if len(media) != 2 || media[0].AuthorID != author.ID || media[1].Path != "posts/1/b.mp4" {
+		t.Errorf("media = %+v", media)
+	}
+	var got model.Post
+	if err := db.Preload("Author").First(&got, post.ID).Error; err != nil || got.Author == nil || got.Private {
+		t.Errorf("post after upgrade = %+v, %v", got, err)
+	}
+
+	// And back down to the first release's schema.
+	if _, err := m.To(ctx, 1); err != nil {
+		t.Fatalf("To(1): %v", err)
+	}
+	var postIDs []uint
+	db.Raw("SELECT post_id FROM media ORDER BY id").Scan(&postIDs)
+	if len(postIDs) != 2 || postIDs[0] != post.ID || db.Migrator().HasTable("post_media") {
+		t.Errorf("media after reverting = %v", postIDs)
+	}
+}
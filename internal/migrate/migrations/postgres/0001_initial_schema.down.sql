@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS email_verifications;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS media;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS authors;
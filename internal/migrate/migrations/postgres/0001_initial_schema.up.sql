@@ -0,0 +1,75 @@
+-- Schema of the first release, as GORM's AutoMigrate created it. IF NOT EXISTS lets databases created by
+-- AutoMigrate adopt it unchanged; the later migrations bring them up to date.
+
+CREATE TABLE IF NOT EXISTS authors (
+    id                bigserial PRIMARY KEY,
+    name              varchar(255) NOT NULL,
+    avatar_path       varchar(512),
+    email             varchar(255),
+    password_hash     varchar(255),
+    email_verified_at timestamptz,
+    created_at        timestamptz,
+    updated_at        timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_authors_email ON authors (email);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id         bigserial PRIMARY KEY,
+    name       varchar(255) NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_name ON categories (name);
+
+CREATE TABLE IF NOT EXISTS posts (
+    id          bigserial PRIMARY KEY,
+    title       varchar(255) NOT NULL,
+    body        text,
+    banner_path varchar(512),
+    author_id   bigint,
+    category_id bigint,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    deleted_at  timestamptz,
+    CONSTRAINT fk_posts_author FOREIGN KEY (author_id) REFERENCES authors (id),
+    CONSTRAINT fk_posts_category FOREIGN KEY (category_id) REFERENCES categories (id)
+);
+CREATE INDEX IF NOT EXISTS idx_posts_author_id ON posts (author_id);
+CREATE INDEX IF NOT EXISTS idx_posts_category_id ON posts (category_id);
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at);
+
+CREATE TABLE IF NOT EXISTS media (
+    id         bigserial PRIMARY KEY,
+    post_id    bigint NOT NULL,
+    type       varchar(20) NOT NULL,
+    path       varchar(512) NOT NULL,
+    filename   varchar(255),
+    created_at timestamptz,
+    deleted_at timestamptz,
+    CONSTRAINT fk_posts_media FOREIGN KEY (post_id) REFERENCES posts (id)
+);
+CREATE INDEX IF NOT EXISTS idx_media_post_id ON media (post_id);
+CREATE INDEX IF NOT EXISTS idx_media_deleted_at ON media (deleted_at);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id          bigserial PRIMARY KEY,
+    post_id     bigint NOT NULL,
+    body        text NOT NULL,
+    author_id   bigint,
+    author_name varchar(255) NOT NULL,
+    created_at  timestamptz,
+    updated_at  timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments (post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_author_id ON comments (author_id);
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+    id         bigserial PRIMARY KEY,
+    email      varchar(255) NOT NULL,
+    code       varchar(10) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_verifications_email ON email_verifications (email);
+CREATE INDEX IF NOT EXISTS idx_email_verifications_deleted_at ON email_verifications (deleted_at);
@@ -0,0 +1,7 @@
+-- Each media row gets back the first post it is attached to; library items attached to none keep a NULL post_id.
+ALTER TABLE media ADD COLUMN post_id bigint;
+UPDATE media SET post_id = (SELECT MIN(post_id) FROM post_media WHERE post_media.media_id = media.id);
+CREATE INDEX idx_media_post_id ON media (post_id);
+DROP TABLE post_media;
+DROP INDEX IF EXISTS idx_media_author_id;
+ALTER TABLE media DROP COLUMN author_id;
@@ -0,0 +1,28 @@
+-- Media become items of their author's library that can be attached to several posts (post_media). The post of
+-- each existing media row moves to post_media and its author becomes the media's; post_id is dropped. Databases
+-- whose AutoMigrate already did this have no post_id left and only get what they miss.
+
+ALTER TABLE media ADD COLUMN IF NOT EXISTS author_id bigint;
+CREATE INDEX IF NOT EXISTS idx_media_author_id ON media (author_id);
+
+CREATE TABLE IF NOT EXISTS post_media (
+    post_id    bigint,
+    media_id   bigint,
+    created_at timestamptz,
+    PRIMARY KEY (post_id, media_id)
+);
+CREATE INDEX IF NOT EXISTS idx_post_media_media_id ON post_media (media_id);
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'media' AND column_name = 'post_id') THEN
+        INSERT INTO post_media (post_id, media_id, created_at)
+            SELECT post_id, id, created_at FROM media WHERE post_id IS NOT NULL
+            ON CONFLICT DO NOTHING;
+        UPDATE media SET author_id = (SELECT author_id FROM posts WHERE posts.id = media.post_id)
+            WHERE author_id IS NULL OR author_id = 0;
+        -- Takes idx_media_post_id and fk_posts_media with it.
+        ALTER TABLE media DROP COLUMN post_id;
+    END IF;
+END $$;
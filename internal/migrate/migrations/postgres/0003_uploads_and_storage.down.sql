@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS storage_usages;
+DROP TABLE IF EXISTS blobs;
+DROP TABLE IF EXISTS uploads;
+ALTER TABLE media DROP COLUMN IF EXISTS dominant_color;
+ALTER TABLE media DROP COLUMN IF EXISTS blur_hash;
+DROP INDEX IF EXISTS idx_media_blob_hash;
+ALTER TABLE media DROP COLUMN IF EXISTS blob_hash;
+ALTER TABLE posts DROP COLUMN IF EXISTS private;
+ALTER TABLE posts DROP COLUMN IF EXISTS banner_color;
+ALTER TABLE posts DROP COLUMN IF EXISTS banner_blur_hash;
+ALTER TABLE authors DROP COLUMN IF EXISTS quota_bytes;
+ALTER TABLE authors DROP COLUMN IF EXISTS avatar_color;
+ALTER TABLE authors DROP COLUMN IF EXISTS avatar_blur_hash;
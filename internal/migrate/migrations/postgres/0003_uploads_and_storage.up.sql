@@ -0,0 +1,50 @@
+-- Resumable uploads, content-addressed blobs with placeholders, private posts and per-author storage quotas.
+
+ALTER TABLE authors ADD COLUMN IF NOT EXISTS avatar_blur_hash varchar(64);
+ALTER TABLE authors ADD COLUMN IF NOT EXISTS avatar_color varchar(7);
+ALTER TABLE authors ADD COLUMN IF NOT EXISTS quota_bytes bigint;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS banner_blur_hash varchar(64);
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS banner_color varchar(7);
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS private boolean NOT NULL DEFAULT false;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS blob_hash varchar(64);
+ALTER TABLE media ADD COLUMN IF NOT EXISTS blur_hash varchar(64);
+ALTER TABLE media ADD COLUMN IF NOT EXISTS dominant_color varchar(7);
+CREATE INDEX IF NOT EXISTS idx_media_blob_hash ON media (blob_hash);
+
+CREATE TABLE IF NOT EXISTS uploads (
+    id           varchar(64) PRIMARY KEY,
+    author_id    bigint NOT NULL,
+    type         varchar(20) NOT NULL,
+    filename     varchar(255),
+    metadata     text,
+    path         varchar(512) NOT NULL,
+    length       bigint NOT NULL,
+    "offset"     bigint NOT NULL DEFAULT 0,
+    expires_at   timestamptz NOT NULL,
+    completed_at timestamptz,
+    created_at   timestamptz,
+    updated_at   timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_uploads_author_id ON uploads (author_id);
+CREATE INDEX IF NOT EXISTS idx_uploads_expires_at ON uploads (expires_at);
+
+CREATE TABLE IF NOT EXISTS blobs (
+    id         bigserial PRIMARY KEY,
+    hash       varchar(64) NOT NULL,
+    path       varchar(512) NOT NULL,
+    size       bigint NOT NULL,
+    ref_count  bigint NOT NULL DEFAULT 0,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_blobs_hash ON blobs (hash);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_blobs_path ON blobs (path);
+
+CREATE TABLE IF NOT EXISTS storage_usages (
+    author_id  bigint,
+    type       varchar(20),
+    bytes      bigint NOT NULL DEFAULT 0,
+    files      bigint NOT NULL DEFAULT 0,
+    updated_at timestamptz,
+    PRIMARY KEY (author_id, type)
+);
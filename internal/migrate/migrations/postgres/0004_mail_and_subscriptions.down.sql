@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS digest_deliveries;
+DROP TABLE IF EXISTS subscription_confirmations;
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS outbox_emails;
+ALTER TABLE email_verifications DROP COLUMN IF EXISTS locale;
+ALTER TABLE authors DROP COLUMN IF EXISTS locale;
@@ -0,0 +1,60 @@
+-- Queued outbound email, the locale of authors and sign-ups, and newsletter subscriptions with their digests.
+
+ALTER TABLE authors ADD COLUMN IF NOT EXISTS locale varchar(16);
+ALTER TABLE email_verifications ADD COLUMN IF NOT EXISTS locale varchar(16);
+
+CREATE TABLE IF NOT EXISTS outbox_emails (
+    id              bigserial PRIMARY KEY,
+    message_id      varchar(255),
+    "from"          varchar(255) NOT NULL,
+    "to"            text NOT NULL,
+    subject         varchar(998),
+    text            text,
+    html            text,
+    locale          varchar(16),
+    headers         text,
+    status          varchar(20) NOT NULL,
+    attempts        bigint NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL,
+    locked_until    timestamptz,
+    last_error      text,
+    sent_at         timestamptz,
+    created_at      timestamptz,
+    updated_at      timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_emails_due ON outbox_emails (status, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id             bigserial PRIMARY KEY,
+    email          varchar(255) NOT NULL,
+    scope          varchar(16) NOT NULL,
+    target_id      bigint NOT NULL DEFAULT 0,
+    locale         varchar(16),
+    frequency      varchar(16) NOT NULL DEFAULT 'instant',
+    timezone       varchar(64) NOT NULL DEFAULT 'UTC',
+    confirmed_at   timestamptz,
+    last_digest_at timestamptz,
+    created_at     timestamptz,
+    updated_at     timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_target ON subscriptions (email, scope, target_id);
+
+CREATE TABLE IF NOT EXISTS subscription_confirmations (
+    id              bigserial PRIMARY KEY,
+    subscription_id bigint NOT NULL,
+    token           varchar(64) NOT NULL,
+    expires_at      timestamptz NOT NULL,
+    created_at      timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscription_confirmations_subscription_id ON subscription_confirmations (subscription_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscription_confirmations_token ON subscription_confirmations (token);
+
+CREATE TABLE IF NOT EXISTS digest_deliveries (
+    id              bigserial PRIMARY KEY,
+    subscription_id bigint NOT NULL,
+    period_key      varchar(32) NOT NULL,
+    post_count      bigint,
+    sent_at         timestamptz,
+    created_at      timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_digest_deliveries_period ON digest_deliveries (subscription_id, period_key);
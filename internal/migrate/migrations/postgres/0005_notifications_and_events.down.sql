@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS outbox_offsets;
+DROP TABLE IF EXISTS outbox_events;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS category_watches;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notifications;
+DROP INDEX IF EXISTS idx_comments_parent_id;
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,85 @@
+-- Comment replies, the notification inbox with preferences and category watches, webhooks and the outbox of
+-- domain events.
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS parent_id bigint;
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id         bigserial PRIMARY KEY,
+    author_id  bigint NOT NULL,
+    type       varchar(32) NOT NULL,
+    actor_id   bigint,
+    actor_name varchar(255),
+    post_id    bigint,
+    post_title varchar(500),
+    comment_id bigint,
+    excerpt    varchar(512),
+    read_at    timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_inbox ON notifications (author_id, read_at);
+CREATE INDEX IF NOT EXISTS idx_notifications_post_id ON notifications (post_id);
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    author_id bigint,
+    type      varchar(32),
+    enabled   boolean NOT NULL,
+    PRIMARY KEY (author_id, type)
+);
+
+CREATE TABLE IF NOT EXISTS category_watches (
+    author_id   bigint,
+    category_id bigint,
+    created_at  timestamptz,
+    PRIMARY KEY (author_id, category_id)
+);
+CREATE INDEX IF NOT EXISTS idx_category_watches_category_id ON category_watches (category_id);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id          bigserial PRIMARY KEY,
+    url         varchar(2048) NOT NULL,
+    secret      varchar(255) NOT NULL,
+    events      text,
+    description varchar(255),
+    active      boolean NOT NULL DEFAULT true,
+    created_at  timestamptz,
+    updated_at  timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              bigserial PRIMARY KEY,
+    webhook_id      bigint NOT NULL,
+    event_id        varchar(64) NOT NULL,
+    event           varchar(64) NOT NULL,
+    payload         text NOT NULL,
+    status          varchar(20) NOT NULL,
+    attempts        bigint NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL,
+    locked_until    timestamptz,
+    response_status bigint,
+    response_body   text,
+    duration_ms     bigint,
+    last_error      text,
+    delivered_at    timestamptz,
+    created_at      timestamptz,
+    updated_at      timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries (webhook_id, event_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id         bigserial PRIMARY KEY,
+    topic      varchar(128),
+    type       varchar(64) NOT NULL,
+    payload    text NOT NULL,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_created_at ON outbox_events (created_at);
+
+CREATE TABLE IF NOT EXISTS outbox_offsets (
+    consumer     varchar(64) PRIMARY KEY,
+    last_id      bigint NOT NULL,
+    owner        varchar(64),
+    locked_until timestamptz,
+    updated_at   timestamptz
+);
@@ -0,0 +1,17 @@
+-- Per-author storage totals that quota checks update conditionally, with the bytes reserved by unfinished
+-- resumable uploads.
+
+CREATE TABLE IF NOT EXISTS storage_accounts (
+    author_id      bigint PRIMARY KEY,
+    used_bytes     bigint NOT NULL DEFAULT 0,
+    reserved_bytes bigint NOT NULL DEFAULT 0,
+    updated_at     timestamptz
+);
+
+INSERT INTO storage_accounts (author_id, used_bytes, reserved_bytes, updated_at)
+SELECT author_id, SUM(used), SUM(reserved), CURRENT_TIMESTAMP FROM (
+    SELECT author_id, bytes AS used, 0 AS reserved FROM storage_usages
+    UNION ALL
+    SELECT author_id, 0, length FROM uploads
+) AS totals GROUP BY author_id
+ON CONFLICT (author_id) DO NOTHING;
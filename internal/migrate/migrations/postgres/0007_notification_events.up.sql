@@ -0,0 +1,5 @@
+-- Notifications remember the outbox event that caused them, so a recipient gets one per event even when the
+-- relay hands the event over again.
+
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS event_id bigint;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_event ON notifications (event_id, author_id);
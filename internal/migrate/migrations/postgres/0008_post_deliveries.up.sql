@@ -0,0 +1,10 @@
+-- New posts mailed to instant subscriptions, one row per subscription and post, so a post.created event handled
+-- again mails nobody twice.
+
+CREATE TABLE IF NOT EXISTS post_deliveries (
+    id              bigserial PRIMARY KEY,
+    subscription_id bigint NOT NULL,
+    post_id         bigint NOT NULL,
+    created_at      timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_post_deliveries_post ON post_deliveries (subscription_id, post_id);
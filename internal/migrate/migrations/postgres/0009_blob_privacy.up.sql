@@ -0,0 +1,12 @@
+-- Blobs remember whether a live private post uses them (as its banner or attached media), so serving a file is
+-- one indexed lookup. Files of such a blob need a signed URL, whoever else shares the content.
+
+ALTER TABLE blobs ADD COLUMN IF NOT EXISTS private boolean NOT NULL DEFAULT false;
+UPDATE blobs SET private = EXISTS (
+        SELECT 1 FROM posts WHERE posts.deleted_at IS NULL AND posts.private AND posts.banner_path = blobs.path
+    ) OR EXISTS (
+        SELECT 1 FROM media
+        JOIN post_media ON post_media.media_id = media.id
+        JOIN posts ON posts.id = post_media.post_id
+        WHERE media.deleted_at IS NULL AND posts.deleted_at IS NULL AND posts.private AND media.path = blobs.path
+    );
@@ -0,0 +1,2 @@
+ALTER TABLE uploads DROP COLUMN IF EXISTS claimed_until;
+ALTER TABLE uploads DROP COLUMN IF EXISTS claim_token;
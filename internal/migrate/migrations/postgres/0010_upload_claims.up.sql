@@ -0,0 +1,5 @@
+-- A PATCH claims its upload with a conditional update before writing, so two requests on any instances never
+-- append to the same partial file at once. The claim expires if its request dies.
+
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS claim_token varchar(32) NOT NULL DEFAULT '';
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS claimed_until timestamptz;
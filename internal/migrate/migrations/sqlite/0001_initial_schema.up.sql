@@ -0,0 +1,75 @@
+-- Same schema as the PostgreSQL version of this migration, in SQLite's types. IF NOT EXISTS lets databases
+-- created by AutoMigrate adopt it too.
+
+CREATE TABLE IF NOT EXISTS authors (
+    id                integer PRIMARY KEY AUTOINCREMENT,
+    name              text NOT NULL,
+    avatar_path       text,
+    email             text,
+    password_hash     text,
+    email_verified_at datetime,
+    created_at        datetime,
+    updated_at        datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_authors_email ON authors (email);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    name       text NOT NULL,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_name ON categories (name);
+
+CREATE TABLE IF NOT EXISTS posts (
+    id          integer PRIMARY KEY AUTOINCREMENT,
+    title       text NOT NULL,
+    body        text,
+    banner_path text,
+    author_id   integer,
+    category_id integer,
+    created_at  datetime,
+    updated_at  datetime,
+    deleted_at  datetime,
+    CONSTRAINT fk_posts_author FOREIGN KEY (author_id) REFERENCES authors(id),
+    CONSTRAINT fk_posts_category FOREIGN KEY (category_id) REFERENCES categories(id)
+);
+CREATE INDEX IF NOT EXISTS idx_posts_author_id ON posts (author_id);
+CREATE INDEX IF NOT EXISTS idx_posts_category_id ON posts (category_id);
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at);
+
+CREATE TABLE IF NOT EXISTS media (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    post_id    integer NOT NULL,
+    type       text NOT NULL,
+    path       text NOT NULL,
+    filename   text,
+    created_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_posts_media FOREIGN KEY (post_id) REFERENCES posts(id)
+);
+CREATE INDEX IF NOT EXISTS idx_media_post_id ON media (post_id);
+CREATE INDEX IF NOT EXISTS idx_media_deleted_at ON media (deleted_at);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id          integer PRIMARY KEY AUTOINCREMENT,
+    post_id     integer NOT NULL,
+    body        text NOT NULL,
+    author_id   integer,
+    author_name text NOT NULL,
+    created_at  datetime,
+    updated_at  datetime
+);
+CREATE INDEX IF NOT EXISTS idx_comments_author_id ON comments (author_id);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments (post_id);
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    email      text NOT NULL,
+    code       text NOT NULL,
+    expires_at datetime NOT NULL,
+    created_at datetime,
+    deleted_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_email_verifications_deleted_at ON email_verifications (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_verifications_email ON email_verifications (email);
@@ -0,0 +1,19 @@
+-- Each media row gets back the first post it is attached to; library items attached to none keep a NULL post_id.
+CREATE TABLE media_by_post (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    post_id    integer,
+    type       text NOT NULL,
+    path       text NOT NULL,
+    filename   text,
+    created_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_posts_media FOREIGN KEY (post_id) REFERENCES posts(id)
+);
+INSERT INTO media_by_post (id, post_id, type, path, filename, created_at, deleted_at)
+    SELECT id, (SELECT MIN(post_id) FROM post_media WHERE post_media.media_id = media.id), type, path, filename, created_at, deleted_at
+    FROM media;
+DROP TABLE media;
+ALTER TABLE media_by_post RENAME TO media;
+CREATE INDEX idx_media_post_id ON media (post_id);
+CREATE INDEX idx_media_deleted_at ON media (deleted_at);
+DROP TABLE post_media;
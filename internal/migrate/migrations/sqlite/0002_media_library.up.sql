@@ -0,0 +1,30 @@
+-- Same as the PostgreSQL version. SQLite cannot drop a column under a foreign key, so media is rebuilt without
+-- post_id.
+
+CREATE TABLE post_media (
+    post_id    integer,
+    media_id   integer,
+    created_at datetime,
+    PRIMARY KEY (post_id, media_id)
+);
+CREATE INDEX idx_post_media_media_id ON post_media (media_id);
+
+INSERT INTO post_media (post_id, media_id, created_at)
+    SELECT post_id, id, created_at FROM media WHERE post_id IS NOT NULL;
+
+CREATE TABLE media_library (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    author_id  integer,
+    type       text NOT NULL,
+    path       text NOT NULL,
+    filename   text,
+    created_at datetime,
+    deleted_at datetime
+);
+INSERT INTO media_library (id, author_id, type, path, filename, created_at, deleted_at)
+    SELECT id, (SELECT author_id FROM posts WHERE posts.id = media.post_id), type, path, filename, created_at, deleted_at
+    FROM media;
+DROP TABLE media;
+ALTER TABLE media_library RENAME TO media;
+CREATE INDEX idx_media_author_id ON media (author_id);
+CREATE INDEX idx_media_deleted_at ON media (deleted_at);
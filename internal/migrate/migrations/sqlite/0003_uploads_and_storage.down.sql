@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS storage_usages;
+DROP TABLE IF EXISTS blobs;
+DROP TABLE IF EXISTS uploads;
+ALTER TABLE media DROP COLUMN dominant_color;
+ALTER TABLE media DROP COLUMN blur_hash;
+DROP INDEX IF EXISTS idx_media_blob_hash;
+ALTER TABLE media DROP COLUMN blob_hash;
+ALTER TABLE posts DROP COLUMN private;
+ALTER TABLE posts DROP COLUMN banner_color;
+ALTER TABLE posts DROP COLUMN banner_blur_hash;
+ALTER TABLE authors DROP COLUMN quota_bytes;
+ALTER TABLE authors DROP COLUMN avatar_color;
+ALTER TABLE authors DROP COLUMN avatar_blur_hash;
@@ -0,0 +1,51 @@
+-- Same as the PostgreSQL version of this migration, in SQLite's types.
+
+ALTER TABLE authors ADD COLUMN avatar_blur_hash text;
+ALTER TABLE authors ADD COLUMN avatar_color text;
+ALTER TABLE authors ADD COLUMN quota_bytes integer;
+ALTER TABLE posts ADD COLUMN banner_blur_hash text;
+ALTER TABLE posts ADD COLUMN banner_color text;
+ALTER TABLE posts ADD COLUMN private numeric NOT NULL DEFAULT false;
+ALTER TABLE media ADD COLUMN blob_hash text;
+ALTER TABLE media ADD COLUMN blur_hash text;
+ALTER TABLE media ADD COLUMN dominant_color text;
+CREATE INDEX idx_media_blob_hash ON media (blob_hash);
+
+CREATE TABLE uploads (
+    id           text,
+    author_id    integer NOT NULL,
+    type         text NOT NULL,
+    filename     text,
+    metadata     text,
+    path         text NOT NULL,
+    length       integer NOT NULL,
+    "offset"     integer NOT NULL DEFAULT 0,
+    expires_at   datetime NOT NULL,
+    completed_at datetime,
+    created_at   datetime,
+    updated_at   datetime,
+    PRIMARY KEY (id)
+);
+CREATE INDEX idx_uploads_author_id ON uploads (author_id);
+CREATE INDEX idx_uploads_expires_at ON uploads (expires_at);
+
+CREATE TABLE blobs (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    hash       text NOT NULL,
+    path       text NOT NULL,
+    size       integer NOT NULL,
+    ref_count  integer NOT NULL DEFAULT 0,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE INDEX idx_blobs_hash ON blobs (hash);
+CREATE UNIQUE INDEX idx_blobs_path ON blobs (path);
+
+CREATE TABLE storage_usages (
+    author_id  integer,
+    type       text,
+    bytes      integer NOT NULL DEFAULT 0,
+    files      integer NOT NULL DEFAULT 0,
+    updated_at datetime,
+    PRIMARY KEY (author_id, type)
+);
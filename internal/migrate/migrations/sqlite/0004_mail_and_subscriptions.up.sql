@@ -0,0 +1,60 @@
+-- Same as the PostgreSQL version of this migration, in SQLite's types.
+
+ALTER TABLE authors ADD COLUMN locale text;
+ALTER TABLE email_verifications ADD COLUMN locale text;
+
+CREATE TABLE outbox_emails (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    message_id      text,
+    "from"          text NOT NULL,
+    "to"            text NOT NULL,
+    subject         text,
+    text            text,
+    html            text,
+    locale          text,
+    headers         text,
+    status          text NOT NULL,
+    attempts        integer NOT NULL DEFAULT 0,
+    next_attempt_at datetime NOT NULL,
+    locked_until    datetime,
+    last_error      text,
+    sent_at         datetime,
+    created_at      datetime,
+    updated_at      datetime
+);
+CREATE INDEX idx_outbox_emails_due ON outbox_emails (status, next_attempt_at);
+
+CREATE TABLE subscriptions (
+    id             integer PRIMARY KEY AUTOINCREMENT,
+    email          text NOT NULL,
+    scope          text NOT NULL,
+    target_id      integer NOT NULL DEFAULT 0,
+    locale         text,
+    frequency      text NOT NULL DEFAULT 'instant',
+    timezone       text NOT NULL DEFAULT 'UTC',
+    confirmed_at   datetime,
+    last_digest_at datetime,
+    created_at     datetime,
+    updated_at     datetime
+);
+CREATE UNIQUE INDEX idx_subscriptions_target ON subscriptions (email, scope, target_id);
+
+CREATE TABLE subscription_confirmations (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    subscription_id integer NOT NULL,
+    token           text NOT NULL,
+    expires_at      datetime NOT NULL,
+    created_at      datetime
+);
+CREATE UNIQUE INDEX idx_subscription_confirmations_subscription_id ON subscription_confirmations (subscription_id);
+CREATE UNIQUE INDEX idx_subscription_confirmations_token ON subscription_confirmations (token);
+
+CREATE TABLE digest_deliveries (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    subscription_id integer NOT NULL,
+    period_key      text NOT NULL,
+    post_count      integer,
+    sent_at         datetime,
+    created_at      datetime
+);
+CREATE UNIQUE INDEX idx_digest_deliveries_period ON digest_deliveries (subscription_id, period_key);
@@ -0,0 +1,85 @@
+-- Same as the PostgreSQL version of this migration, in SQLite's types.
+
+ALTER TABLE comments ADD COLUMN parent_id integer;
+CREATE INDEX idx_comments_parent_id ON comments (parent_id);
+
+CREATE TABLE notifications (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    author_id  integer NOT NULL,
+    type       text NOT NULL,
+    actor_id   integer,
+    actor_name text,
+    post_id    integer,
+    post_title text,
+    comment_id integer,
+    excerpt    text,
+    read_at    datetime,
+    created_at datetime
+);
+CREATE INDEX idx_notifications_inbox ON notifications (author_id, read_at);
+CREATE INDEX idx_notifications_post_id ON notifications (post_id);
+
+CREATE TABLE notification_preferences (
+    author_id integer,
+    type      text,
+    enabled   numeric NOT NULL,
+    PRIMARY KEY (author_id, type)
+);
+
+CREATE TABLE category_watches (
+    author_id   integer,
+    category_id integer,
+    created_at  datetime,
+    PRIMARY KEY (author_id, category_id)
+);
+CREATE INDEX idx_category_watches_category_id ON category_watches (category_id);
+
+CREATE TABLE webhooks (
+    id          integer PRIMARY KEY AUTOINCREMENT,
+    url         text NOT NULL,
+    secret      text NOT NULL,
+    events      text,
+    description text,
+    active      numeric NOT NULL DEFAULT true,
+    created_at  datetime,
+    updated_at  datetime
+);
+
+CREATE TABLE webhook_deliveries (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    webhook_id      integer NOT NULL,
+    event_id        text NOT NULL,
+    event           text NOT NULL,
+    payload         text NOT NULL,
+    status          text NOT NULL,
+    attempts        integer NOT NULL DEFAULT 0,
+    next_attempt_at datetime NOT NULL,
+    locked_until    datetime,
+    response_status integer,
+    response_body   text,
+    duration_ms     integer,
+    last_error      text,
+    delivered_at    datetime,
+    created_at      datetime,
+    updated_at      datetime
+);
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+CREATE UNIQUE INDEX idx_webhook_deliveries_event ON webhook_deliveries (webhook_id, event_id);
+
+CREATE TABLE outbox_events (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    topic      text,
+    type       text NOT NULL,
+    payload    text NOT NULL,
+    created_at datetime
+);
+CREATE INDEX idx_outbox_events_created_at ON outbox_events (created_at);
+
+CREATE TABLE outbox_offsets (
+    consumer     text,
+    last_id      integer NOT NULL,
+    owner        text,
+    locked_until datetime,
+    updated_at   datetime,
+    PRIMARY KEY (consumer)
+);
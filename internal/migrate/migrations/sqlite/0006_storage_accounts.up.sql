@@ -0,0 +1,15 @@
+-- Same as the PostgreSQL version of this migration, in SQLite's types.
+
+CREATE TABLE storage_accounts (
+    author_id      integer PRIMARY KEY,
+    used_bytes     integer NOT NULL DEFAULT 0,
+    reserved_bytes integer NOT NULL DEFAULT 0,
+    updated_at     datetime
+);
+
+INSERT INTO storage_accounts (author_id, used_bytes, reserved_bytes, updated_at)
+SELECT author_id, SUM(used), SUM(reserved), CURRENT_TIMESTAMP FROM (
+    SELECT author_id, bytes AS used, 0 AS reserved FROM storage_usages
+    UNION ALL
+    SELECT author_id, 0, length FROM uploads
+) AS totals GROUP BY author_id;
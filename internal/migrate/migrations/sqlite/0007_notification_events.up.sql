@@ -0,0 +1,4 @@
+-- Same as the PostgreSQL version of this migration, in SQLite's types.
+
+ALTER TABLE notifications ADD COLUMN event_id integer;
+CREATE UNIQUE INDEX idx_notifications_event ON notifications (event_id, author_id);
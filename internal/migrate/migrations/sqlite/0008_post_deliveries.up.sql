@@ -0,0 +1,9 @@
+-- Same as the PostgreSQL version of this migration, in SQLite's types.
+
+CREATE TABLE post_deliveries (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    subscription_id integer NOT NULL,
+    post_id         integer NOT NULL,
+    created_at      datetime
+);
+CREATE UNIQUE INDEX idx_post_deliveries_post ON post_deliveries (subscription_id, post_id);
@@ -0,0 +1,11 @@
+-- Same as the PostgreSQL version of this migration, in SQLite's types.
+
+ALTER TABLE blobs ADD COLUMN private numeric NOT NULL DEFAULT false;
+UPDATE blobs SET private = EXISTS (
+        SELECT 1 FROM posts WHERE posts.deleted_at IS NULL AND posts.private AND posts.banner_path = blobs.path
+    ) OR EXISTS (
+        SELECT 1 FROM media
+        JOIN post_media ON post_media.media_id = media.id
+        JOIN posts ON posts.id = post_media.post_id
+        WHERE media.deleted_at IS NULL AND posts.deleted_at IS NULL AND posts.private AND media.path = blobs.path
+    );
@@ -0,0 +1,2 @@
+ALTER TABLE uploads DROP COLUMN claimed_until;
+ALTER TABLE uploads DROP COLUMN claim_token;
@@ -0,0 +1,4 @@
+-- Same as the PostgreSQL version of this migration, in SQLite's types.
+
+ALTER TABLE uploads ADD COLUMN claim_token text NOT NULL DEFAULT '';
+ALTER TABLE uploads ADD COLUMN claimed_until datetime;
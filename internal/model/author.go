@@ -7,9 +7,13 @@ type Author struct {
 	ID              uint       `gorm:"primaryKey" json:"id"`
 	Name            string     `gorm:"size:255;not null" json:"name"`
 	AvatarPath      string     `gorm:"size:512" json:"avatar_path"`
+	AvatarBlurHash  string     `gorm:"size:64" json:"avatar_blurhash,omitempty"`
+	AvatarColor     string     `gorm:"size:7" json:"avatar_color,omitempty"`
 	Email           *string    `gorm:"size:255;uniqueIndex" json:"email,omitempty"`
 	PasswordHash    string     `gorm:"size:255" json:"-"`
 	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	Locale          string     `gorm:"size:16" json:"locale,omitempty"` // language of emails sent to the author
+	QuotaBytes      *int64     `json:"quota_bytes,omitempty"`           // storage quota override; nil uses the configured default
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
 }
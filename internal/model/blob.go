@@ -0,0 +1,15 @@
+// model/blob: Content-addressed stored file, shared by media rows, post banners and author avatars.
+package model
+
+import "time"
+
+type Blob struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Hash      string    `gorm:"size:64;not null;index" json:"hash"`
+	Path      string    `gorm:"size:512;not null;uniqueIndex" json:"path"`
+	Size      int64     `gorm:"not null" json:"size"`
+	RefCount  int       `gorm:"not null;default:0" json:"ref_count"`
+	Private   bool      `gorm:"not null;default:false" json:"private"` // used by a live private post: served only with a signed URL
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
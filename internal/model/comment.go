@@ -6,6 +6,7 @@ import "time"
 type Comment struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
 	PostID     uint      `gorm:"not null;index" json:"post_id"`
+	ParentID   *uint     `gorm:"index" json:"parent_id,omitempty"` // comment this one replies to
 	Body       string    `gorm:"type:text;not null" json:"body"`
 	AuthorID   *uint     `gorm:"index" json:"author_id,omitempty"`
 	AuthorName string    `gorm:"size:255;not null" json:"author_name"`
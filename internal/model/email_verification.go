@@ -11,6 +11,7 @@ type EmailVerification struct {
 	ID        uint           `gorm:"primaryKey" json:"-"`
 	Email     string         `gorm:"size:255;uniqueIndex;not null" json:"-"`
 	Code      string         `gorm:"size:10;not null" json:"-"`
+	Locale    string         `gorm:"size:16" json:"-"` // carried over to the author on registration
 	ExpiresAt time.Time      `gorm:"not null" json:"-"`
 	CreatedAt time.Time      `json:"-"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
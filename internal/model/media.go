@@ -1,4 +1,4 @@
-// model/media: Uploaded file (image/video) model for each post.
+// model/media: Uploaded file (image/video) in an author's media library, attachable to posts.
 package model
 
 import (
@@ -15,11 +15,24 @@ const (
 )
 
 type Media struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	PostID    uint           `gorm:"not null;index" json:"post_id"`
-	Type      MediaType      `gorm:"size:20;not null" json:"type"`
-	Path      string         `gorm:"size:512;not null" json:"path"`
-	Filename  string         `gorm:"size:255" json:"filename"`
-	CreatedAt time.Time      `json:"created_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	AuthorID      uint           `gorm:"index" json:"author_id"`
+	Type          MediaType      `gorm:"size:20;not null" json:"type"`
+	Path          string         `gorm:"size:512;not null" json:"path"`
+	URL           string         `gorm:"-" json:"url,omitempty"` // public or signed URL, filled when served
+	Filename      string         `gorm:"size:255" json:"filename"`
+	BlobHash      string         `gorm:"size:64;index" json:"hash,omitempty"`
+	BlurHash      string         `gorm:"size:64" json:"blurhash,omitempty"`
+	DominantColor string         `gorm:"size:7" json:"dominant_color,omitempty"` // "#rrggbb"; with BlurHash, a placeholder shown while the image loads
+	CreatedAt     time.Time      `json:"created_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 }
+
+// PostMedia links a media library item to a post (join table post_media).
+type PostMedia struct {
+	PostID    uint      `gorm:"primaryKey" json:"post_id"`
+	MediaID   uint      `gorm:"primaryKey;index" json:"media_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (PostMedia) TableName() string { return "post_media" }
@@ -0,0 +1,49 @@
+// model/notification: Notification inbox of authors, per-type preferences and category watches.
+package model
+
+import "time"
+
+// NotificationType identifies what happened; each type can be switched off per author.
+type NotificationType string
+
+const (
+	NotificationCommentOnPost NotificationType = "comment_on_post"      // someone commented on your post
+	NotificationCommentReply  NotificationType = "comment_reply"        // someone replied to your comment
+	NotificationMention       NotificationType = "mention"              // someone @mentioned you in a post or comment
+	NotificationCategoryPost  NotificationType = "new_post_in_category" // a post was published in a category you watch
+)
+
+// NotificationTypes lists every type, in the order preferences are shown.
+var NotificationTypes = []NotificationType{NotificationCommentOnPost, NotificationCommentReply, NotificationMention, NotificationCategoryPost}
+
+// Notification is one event in the inbox of AuthorID (the recipient). ActorID/ActorName describe who caused it;
+// PostTitle is copied so the inbox reads well even after the post is renamed or deleted. EventID makes a recipient
+// get one notification per event however often the event is handled.
+type Notification struct {
+	ID        uint             `gorm:"primaryKey" json:"id"`
+	AuthorID  uint             `gorm:"not null;index:idx_notifications_inbox,priority:1;uniqueIndex:idx_notifications_event,priority:2" json:"author_id"`
+	Type      NotificationType `gorm:"size:32;not null" json:"type"`
+	ActorID   *uint            `json:"actor_id,omitempty"`
+	ActorName string           `gorm:"size:255" json:"actor_name"`
+	PostID    uint             `gorm:"index" json:"post_id,omitempty"`
+	PostTitle string           `gorm:"size:500" json:"post_title,omitempty"`
+	CommentID *uint            `json:"comment_id,omitempty"`
+	Excerpt   string           `gorm:"size:512" json:"excerpt,omitempty"`
+	ReadAt    *time.Time       `gorm:"index:idx_notifications_inbox,priority:2" json:"read_at,omitempty"`
+	EventID   *uint64          `gorm:"uniqueIndex:idx_notifications_event,priority:1" json:"-"` // outbox event that caused it
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// NotificationPreference switches one notification type on or off for an author. Without a row the type is on.
+type NotificationPreference struct {
+	AuthorID uint             `gorm:"primaryKey" json:"-"`
+	Type     NotificationType `gorm:"primaryKey;size:32" json:"type"`
+	Enabled  bool             `gorm:"not null" json:"enabled"`
+}
+
+// CategoryWatch subscribes an author to new_post_in_category notifications for a category.
+type CategoryWatch struct {
+	AuthorID   uint      `gorm:"primaryKey" json:"-"`
+	CategoryID uint      `gorm:"primaryKey;index" json:"category_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
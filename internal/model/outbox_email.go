@@ -0,0 +1,33 @@
+// model/outbox_email: Outbound email waiting in the mail queue, with its delivery state.
+package model
+
+import "time"
+
+type OutboxEmailStatus string
+
+const (
+	OutboxEmailPending OutboxEmailStatus = "pending" // waiting for its next attempt
+	OutboxEmailSending OutboxEmailStatus = "sending" // claimed by a worker until LockedUntil
+	OutboxEmailSent    OutboxEmailStatus = "sent"
+	OutboxEmailDead    OutboxEmailStatus = "dead" // gave up after MaxAttempts; resend from the admin API
+)
+
+type OutboxEmail struct {
+	ID            uint              `gorm:"primaryKey" json:"id"`
+	MessageID     string            `gorm:"size:255" json:"message_id"` // kept across retries so receivers can deduplicate
+	From          string            `gorm:"size:255;not null" json:"from"`
+	To            string            `gorm:"type:text;not null" json:"to"` // comma-separated addresses
+	Subject       string            `gorm:"size:998" json:"subject"`
+	Text          string            `gorm:"type:text" json:"-"`
+	HTML          string            `gorm:"type:text" json:"-"`
+	Locale        string            `gorm:"size:16" json:"locale,omitempty"`
+	Headers       string            `gorm:"type:text" json:"-"` // JSON object of extra headers
+	Status        OutboxEmailStatus `gorm:"size:20;not null;index:idx_outbox_emails_due,priority:1" json:"status"`
+	Attempts      int               `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time         `gorm:"not null;index:idx_outbox_emails_due,priority:2" json:"next_attempt_at"`
+	LockedUntil   *time.Time        `json:"-"`
+	LastError     string            `gorm:"type:text" json:"last_error,omitempty"`
+	SentAt        *time.Time        `json:"sent_at,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
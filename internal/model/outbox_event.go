@@ -0,0 +1,24 @@
+// model/outbox_event: Domain events recorded in the transaction of the change they describe, and the read
+// positions of the consumers relaying them.
+package model
+
+import "time"
+
+// OutboxEvent is one domain event (post.created, comment.deleted, ...). IDs increase in insertion order.
+type OutboxEvent struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Topic     string    `gorm:"size:128" json:"topic,omitempty"` // real-time topic, e.g. "post:12"; empty for events not streamed
+	Type      string    `gorm:"size:64;not null" json:"type"`
+	Payload   string    `gorm:"type:text;not null" json:"payload"` // JSON
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// OutboxOffset is the last event a shared consumer has handled. The consumer holds it while handling a batch
+// (Owner, LockedUntil), so only one instance relays to it at a time.
+type OutboxOffset struct {
+	Consumer    string     `gorm:"primaryKey;size:64" json:"consumer"`
+	LastID      uint64     `gorm:"not null" json:"last_id"`
+	Owner       string     `gorm:"size:64" json:"-"`
+	LockedUntil *time.Time `json:"-"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
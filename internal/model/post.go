@@ -8,16 +8,20 @@ import (
 )
 
 type Post struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	Title       string         `gorm:"size:255;not null" json:"title"`
-	Body        string         `gorm:"type:text" json:"body"`
-	BannerPath  string         `gorm:"size:512" json:"banner_path"`
-	AuthorID    uint           `gorm:"index" json:"author_id"`
-	Author      *Author        `gorm:"foreignKey:AuthorID" json:"author,omitempty"`
-	CategoryID  uint           `gorm:"index" json:"category_id"`
-	Category    *Category      `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
-	Media       []Media        `gorm:"foreignKey:PostID" json:"media,omitempty"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Title          string         `gorm:"size:255;not null" json:"title"`
+	Body           string         `gorm:"type:text" json:"body"`
+	BannerPath     string         `gorm:"size:512" json:"banner_path"`
+	BannerURL      string         `gorm:"-" json:"banner_url,omitempty"`
+	BannerBlurHash string         `gorm:"size:64" json:"banner_blurhash,omitempty"`
+	BannerColor    string         `gorm:"size:7" json:"banner_color,omitempty"`
+	Private        bool           `gorm:"not null;default:false" json:"private"` // media only reachable through signed URLs
+	AuthorID       uint           `gorm:"index" json:"author_id"`
+	Author         *Author        `gorm:"foreignKey:AuthorID" json:"author,omitempty"`
+	CategoryID     uint           `gorm:"index" json:"category_id"`
+	Category       *Category      `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	Media          []Media        `gorm:"many2many:post_media" json:"media,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 }
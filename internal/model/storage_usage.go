@@ -0,0 +1,21 @@
+// model/storage_usage: Bytes and file count an author currently stores, per media type, and their totals.
+package model
+
+import "time"
+
+type StorageUsage struct {
+	AuthorID  uint      `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	Type      MediaType `gorm:"primaryKey;size:20" json:"type"`
+	Bytes     int64     `gorm:"not null;default:0" json:"bytes"`
+	Files     int64     `gorm:"not null;default:0" json:"files"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// StorageAccount is the row quota checks lock: the author's stored bytes across all media types, and the bytes
+// held by resumable uploads that have not been attached yet.
+type StorageAccount struct {
+	AuthorID      uint      `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	UsedBytes     int64     `gorm:"not null;default:0" json:"used_bytes"`
+	ReservedBytes int64     `gorm:"not null;default:0" json:"reserved_bytes"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -0,0 +1,67 @@
+// model/subscription: Reader email subscriptions to the blog, a category or an author, with double opt-in.
+package model
+
+import "time"
+
+// SubscriptionScope selects which new posts a subscription receives.
+type SubscriptionScope string
+
+const (
+	SubscriptionBlog     SubscriptionScope = "blog"     // every post
+	SubscriptionCategory SubscriptionScope = "category" // posts in TargetID
+	SubscriptionAuthor   SubscriptionScope = "author"   // posts by TargetID
+)
+
+// SubscriptionFrequency selects between one email per post and a digest.
+type SubscriptionFrequency string
+
+const (
+	FrequencyInstant SubscriptionFrequency = "instant" // one email per new post
+	FrequencyDaily   SubscriptionFrequency = "daily"
+	FrequencyWeekly  SubscriptionFrequency = "weekly" // sent on Mondays
+)
+
+// Subscription receives new-post emails once ConfirmedAt is set. TargetID is 0 for the whole blog.
+// Digest subscriptions are sent at the configured hour in Timezone.
+type Subscription struct {
+	ID           uint                  `gorm:"primaryKey" json:"id"`
+	Email        string                `gorm:"size:255;not null;uniqueIndex:idx_subscriptions_target" json:"email"`
+	Scope        SubscriptionScope     `gorm:"size:16;not null;uniqueIndex:idx_subscriptions_target" json:"scope"`
+	TargetID     uint                  `gorm:"not null;default:0;uniqueIndex:idx_subscriptions_target" json:"target_id,omitempty"`
+	Locale       string                `gorm:"size:16" json:"locale,omitempty"`
+	Frequency    SubscriptionFrequency `gorm:"size:16;not null;default:instant" json:"frequency"`
+	Timezone     string                `gorm:"size:64;not null;default:UTC" json:"timezone"`
+	ConfirmedAt  *time.Time            `json:"confirmed_at,omitempty"`
+	LastDigestAt *time.Time            `json:"last_digest_at,omitempty"` // end of the period covered by the last digest
+	CreatedAt    time.Time             `json:"created_at"`
+	UpdatedAt    time.Time             `json:"updated_at"`
+}
+
+// SubscriptionConfirmation is the double-opt-in token mailed to the subscriber; one per subscription.
+type SubscriptionConfirmation struct {
+	ID             uint      `gorm:"primaryKey" json:"-"`
+	SubscriptionID uint      `gorm:"uniqueIndex;not null" json:"-"`
+	Token          string    `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt      time.Time `gorm:"not null" json:"-"`
+	CreatedAt      time.Time `json:"-"`
+}
+
+// DigestDelivery records the digest of one subscription for one period. The unique key is claimed before
+// the email is queued, so a restart or a second instance never sends the same period twice.
+type DigestDelivery struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint       `gorm:"not null;uniqueIndex:idx_digest_deliveries_period" json:"subscription_id"`
+	PeriodKey      string     `gorm:"size:32;not null;uniqueIndex:idx_digest_deliveries_period" json:"period_key"` // e.g. daily:2025-03-14
+	PostCount      int        `json:"post_count"`
+	SentAt         *time.Time `json:"sent_at,omitempty"` // nil when there was nothing to send or the send was interrupted
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// PostDelivery records that a new post was emailed to one instant subscription. It is claimed in the transaction
+// that queues the email, so a post.created event handled again never mails the subscriber twice.
+type PostDelivery struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint      `gorm:"not null;uniqueIndex:idx_post_deliveries_post" json:"subscription_id"`
+	PostID         uint      `gorm:"not null;uniqueIndex:idx_post_deliveries_post" json:"post_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+// model/upload: Resumable (tus) upload owned by an author, in progress or finished.
+package model
+
+import "time"
+
+type Upload struct {
+	ID          string     `gorm:"primaryKey;size:64" json:"id"`
+	AuthorID    uint       `gorm:"not null;index" json:"author_id"`
+	Type        MediaType  `gorm:"size:20;not null" json:"type"`
+	Filename    string     `gorm:"size:255" json:"filename"`
+	Metadata    string     `gorm:"type:text" json:"-"` // raw Upload-Metadata header, echoed back on HEAD
+	Path        string     `gorm:"size:512;not null" json:"-"`
+	Length      int64      `gorm:"not null" json:"length"`
+	Offset      int64      `gorm:"not null;default:0" json:"offset"`
+	ExpiresAt   time.Time  `gorm:"not null;index" json:"expires_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// The PATCH appending to the upload holds a claim: its token, valid until ClaimedUntil.
+	ClaimToken   string     `gorm:"size:32;not null;default:''" json:"-"`
+	ClaimedUntil *time.Time `json:"-"`
+}
+
+// Completed reports whether all bytes of the upload have been received.
+func (u *Upload) Completed() bool {
+	return u.Offset >= u.Length
+}
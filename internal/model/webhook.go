@@ -0,0 +1,67 @@
+// model/webhook: Outgoing webhook subscriptions and the log of their deliveries.
+package model
+
+import "time"
+
+// Events webhooks can subscribe to. WebhookEventPing is only sent by the "send test event" endpoint.
+const (
+	WebhookEventPostCreated      = "post.created"
+	WebhookEventPostUpdated      = "post.updated"
+	WebhookEventPostDeleted      = "post.deleted"
+	WebhookEventCommentCreated   = "comment.created"
+	WebhookEventAuthorRegistered = "author.registered"
+	WebhookEventPing             = "ping"
+)
+
+// WebhookEvents lists the events a webhook can subscribe to.
+var WebhookEvents = []string{WebhookEventPostCreated, WebhookEventPostUpdated, WebhookEventPostDeleted, WebhookEventCommentCreated, WebhookEventAuthorRegistered}
+
+type Webhook struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	URL         string    `gorm:"size:2048;not null" json:"url"`
+	Secret      string    `gorm:"size:255;not null" json:"-"` // HMAC-SHA256 key of the X-Blog-Signature header
+	Events      []string  `gorm:"serializer:json;type:text" json:"events"`
+	Description string    `gorm:"size:255" json:"description,omitempty"`
+	Active      bool      `gorm:"not null;default:true" json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Subscribed reports whether the webhook wants event.
+func (w *Webhook) Subscribed(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"   // waiting for its next attempt
+	WebhookDeliverySending   WebhookDeliveryStatus = "sending"   // claimed by a worker until LockedUntil
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded" // the endpoint answered 2xx
+	WebhookDeliveryDead      WebhookDeliveryStatus = "dead"      // gave up; redeliver from the admin API
+)
+
+// WebhookDelivery is one event sent to one webhook. Retries update the row, so it shows the latest attempt.
+type WebhookDelivery struct {
+	ID             uint                  `gorm:"primaryKey" json:"id"`
+	WebhookID      uint                  `gorm:"not null;uniqueIndex:idx_webhook_deliveries_event,priority:1" json:"webhook_id"`
+	EventID        string                `gorm:"size:64;not null;uniqueIndex:idx_webhook_deliveries_event,priority:2" json:"event_id"` // same for every webhook receiving the event
+	Event          string                `gorm:"size:64;not null" json:"event"`
+	Payload        string                `gorm:"type:text;not null" json:"payload"`
+	Status         WebhookDeliveryStatus `gorm:"size:20;not null;index:idx_webhook_deliveries_due,priority:1" json:"status"`
+	Attempts       int                   `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time             `gorm:"not null;index:idx_webhook_deliveries_due,priority:2" json:"next_attempt_at"`
+	LockedUntil    *time.Time            `json:"-"`
+	ResponseStatus int                   `json:"response_status,omitempty"`
+	ResponseBody   string                `gorm:"type:text" json:"response_body,omitempty"` // first KiB of the last response
+	DurationMs     int64                 `json:"duration_ms,omitempty"`
+	LastError      string                `gorm:"type:text" json:"last_error,omitempty"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+}
@@ -0,0 +1,298 @@
+// outbox: Relays the domain events of the outbox table to sinks (the in-process pub/sub hub, webhooks, the
+// event log). Delivery is at-least-once: a sink's offset only moves past events it handled without error.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/pubsub"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+)
+
+// Sink receives events in ID order. Handle may see an event again after a failure or a crash, so it must be
+// idempotent or tolerate duplicates; returning an error makes the relay retry the batch.
+type Sink interface {
+	Name() string
+	Handle(ctx context.Context, events []model.OutboxEvent) error
+}
+
+// Mode says where a sink's offset is kept.
+type Mode int
+
+const (
+	// Local sinks keep their offset in memory and start at the newest event when the process starts: every
+	// instance hands every later event to its own copy of the sink. For in-process subscribers.
+	Local Mode = iota
+	// Shared sinks keep their offset in outbox_offsets: each event is handled by one instance, across restarts.
+	// A shared sink seen for the first time starts at the newest event.
+	Shared
+)
+
+// Options tune the relay. Zero values use the defaults below.
+type Options struct {
+	BatchSize    int           // events handed to a sink at once (default 100)
+	PollInterval time.Duration // how often idle sinks look for events appended by other instances (default 1s)
+	Settle       time.Duration // how long a gap in IDs is waited for before it is taken for a rollback (default 5s)
+	Lease        time.Duration // how long a shared offset is held while handling one batch (default 1m)
+	RetryDelay   time.Duration // wait after a failed batch (default 5s)
+	Retention    time.Duration // events older than this that all shared sinks handled are deleted (default 7 days)
+}
+
+func (o *Options) defaults() {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	if o.Settle <= 0 {
+		o.Settle = 5 * time.Second
+	}
+	if o.Lease <= 0 {
+		o.Lease = time.Minute
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = 5 * time.Second
+	}
+	if o.Retention <= 0 {
+		o.Retention = 7 * 24 * time.Hour
+	}
+}
+
+type consumer struct {
+	sink   Sink
+	mode   Mode
+	offset uint64 // Local: last handled event; Shared: where a new offset row starts
+	wake   chan struct{}
+}
+
+type Relay struct {
+	repo      repository.OutboxEventStore
+	opts      Options
+	owner     string // identifies this instance on shared offsets
+	consumers []*consumer
+	now       func() time.Time
+}
+
+// New returns a relay without sinks. Add the sinks, then call Start.
+func New(repo repository.OutboxEventStore, opts Options) *Relay {
+	opts.defaults()
+	host, _ := os.Hostname()
+	owner := host + ":" + strconv.Itoa(os.Getpid()) + ":" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	return &Relay{repo: repo, opts: opts, owner: owner, now: time.Now}
+}
+
+// Add registers sink with the given offset mode. Call it before Start.
+func (r *Relay) Add(sink Sink, mode Mode) {
+	r.consumers = append(r.consumers, &consumer{sink: sink, mode: mode, wake: make(chan struct{}, 1)})
+}
+
+// Notify wakes the sinks after events were appended.
+func (r *Relay) Notify() {
+	for _, c := range r.consumers {
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Start relays events to every sink until ctx is cancelled. Each sink has its own loop, so a failing sink
+// does not hold up the others.
+func (r *Relay) Start(ctx context.Context) {
+	start, err := r.repo.LastID(ctx)
+	if err != nil {
+		log.Printf("[outbox] %v", err)
+	}
+	var wg sync.WaitGroup
+	for _, c := range r.consumers {
+		c.offset = start
+		wg.Add(1)
+		go func(c *consumer) {
+			defer wg.Done()
+			r.run(ctx, c)
+		}(c)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.pruneLoop(ctx)
+	}()
+	wg.Wait()
+}
+
+func (r *Relay) run(ctx context.Context, c *consumer) {
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		n, err := r.process(ctx, c)
+		if err != nil {
+			log.Printf("[outbox] %s: %v", c.sink.Name(), err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(r.opts.RetryDelay):
+			}
+			continue
+		}
+		if n == r.opts.BatchSize {
+			continue // more may be waiting
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.wake:
+		}
+	}
+}
+
+// ProcessOnce hands every sink its next batch and returns how many events were handled in total.
+func (r *Relay) ProcessOnce(ctx context.Context) (int, error) {
+	total := 0
+	for _, c := range r.consumers {
+		n, err := r.process(ctx, c)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// process hands the next batch after the sink's offset to it and moves the offset past the batch.
+func (r *Relay) process(ctx context.Context, c *consumer) (int, error) {
+	if c.mode == Local {
+		events, err := r.batch(ctx, c.offset)
+		if err != nil || len(events) == 0 {
+			return 0, err
+		}
+		if err := c.sink.Handle(ctx, events); err != nil {
+			return 0, err
+		}
+		c.offset = events[len(events)-1].ID
+		return len(events), nil
+	}
+
+	name := c.sink.Name()
+	offset, ok, err := r.repo.ClaimOffset(ctx, name, r.owner, c.offset, r.now(), r.opts.Lease)
+	if err != nil || !ok {
+		return 0, err // !ok: another instance is handling this sink
+	}
+	events, err := r.batch(ctx, offset)
+	if err == nil && len(events) > 0 {
+		err = c.sink.Handle(ctx, events)
+	}
+	if err != nil || len(events) == 0 {
+		// Release the offset unchanged.
+		if cerr := r.repo.CommitOffset(ctx, name, r.owner, offset); err == nil {
+			err = cerr
+		}
+		return 0, err
+	}
+	if err := r.repo.CommitOffset(ctx, name, r.owner, events[len(events)-1].ID); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+// batch returns the events after offset that may be handed out. IDs are assigned in insertion order but
+// transactions can commit in another order, so a gap may be an event not committed yet: the events after a
+// gap wait until they are Settle old, after which the gap is taken for a rolled-back transaction.
+func (r *Relay) batch(ctx context.Context, offset uint64) ([]model.OutboxEvent, error) {
+	events, err := r.repo.After(ctx, offset, r.opts.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	next := offset + 1
+	for i, ev := range events {
+		if ev.ID != next && r.now().Sub(ev.CreatedAt) < r.opts.Settle {
+			return events[:i], nil
+		}
+		next = ev.ID + 1
+	}
+	return events, nil
+}
+
+// pruneLoop deletes old events once an hour.
+func (r *Relay) pruneLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if n, err := r.Prune(ctx); err != nil {
+			log.Printf("[outbox] prune: %v", err)
+		} else if n > 0 {
+			log.Printf("[outbox] pruned %d events", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune deletes the events older than Retention that every shared sink has handled.
+func (r *Relay) Prune(ctx context.Context) (int64, error) {
+	offsets, err := r.repo.Offsets(ctx)
+	if err != nil {
+		return 0, err
+	}
+	handled := make(map[string]uint64, len(offsets))
+	for _, o := range offsets {
+		handled[o.Consumer] = o.LastID
+	}
+	maxID, err := r.repo.LastID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range r.consumers {
+		if c.mode != Shared {
+			continue
+		}
+		id, ok := handled[c.sink.Name()]
+		if !ok {
+			return 0, nil // the sink has not started yet
+		}
+		if id < maxID {
+			maxID = id
+		}
+	}
+	return r.repo.Prune(ctx, r.now().Add(-r.opts.Retention), maxID)
+}
+
+// HubSink publishes the events that have a topic to the in-process hub, which feeds the Server-Sent Events
+// streams and WebSockets of this instance, under their outbox event IDs. Add it as a Local sink.
+type HubSink struct {
+	Hub *pubsub.Hub
+}
+
+func (HubSink) Name() string { return "hub" }
+
+func (s HubSink) Handle(ctx context.Context, events []model.OutboxEvent) error {
+	for _, ev := range events {
+		if ev.Topic != "" {
+			s.Hub.Publish(ev.ID, ev.Topic, ev.Type, json.RawMessage(ev.Payload))
+		}
+	}
+	return nil
+}
+
+// LogSink writes one line per event to the standard logger, an audit trail of changes. Add it as a Shared sink.
+type LogSink struct{}
+
+func (LogSink) Name() string { return "log" }
+
+func (LogSink) Handle(ctx context.Context, events []model.OutboxEvent) error {
+	for _, ev := range events {
+		log.Printf("[outbox] event %d %s topic=%q %s", ev.ID, ev.Type, ev.Topic, ev.Payload)
+	}
+	return nil
+}
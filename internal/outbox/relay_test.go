@@ -0,0 +1,180 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"github.com/aliakbar-zohour/go_blog/internal/testdb"
+	"gorm.io/gorm"
+)
+
+func setupRelay(t *testing.T) (*gorm.DB, *repository.OutboxEventRepository, *time.Time) {
+	t.Helper()
+	db := testdb.Open(t)
+	clock := time.Now()
+	return db, repository.NewOutboxEventRepository(db), &clock
+}
+
+func newRelay(repo *repository.OutboxEventRepository, clock *time.Time, owner string) *Relay {
+	r := New(repo, Options{BatchSize: 10, Settle: time.Minute, Retention: time.Hour})
+	r.owner = owner
+	r.now = func() time.Time { return *clock }
+	return r
+}
+
+// recorder is a sink remembering the IDs it handled; it fails while err is set.
+type recorder struct {
+	name string
+	ids  []uint64
+	err  error
+}
+
+func (s *recorder) Name() string { return s.name }
+
+func (s *recorder) Handle(ctx context.Context, events []model.OutboxEvent) error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, ev := range events {
+		s.ids = append(s.ids, ev.ID)
+	}
+	return nil
+}
+
+func TestTransactor_EventsCommitWithTheChange(t *testing.T) {
+	db, repo, _ := setupRelay(t)
+	tx := repository.NewTransactor(db)
+	notified := 0
+	repo.OnAppend(func() { notified++ })
+	ctx := context.Background()
+	categories := repository.NewCategoryRepository(db)
+
+	failed := errors.New("validation failed")
+	err := tx.Do(ctx, func(ctx context.Context) error {
+		if err := categories.Create(ctx, &model.Category{Name: "Travel"}); err != nil {
+			return err
+		}
+		if err := repo.Append(ctx, &model.OutboxEvent{Type: "category.created", Payload: "{}"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Do = %v", err)
+	}
+	if id, _ := repo.LastID(ctx); id != 0 || notified != 0 {
+		t.Fatalf("rolled back event kept: last id %d, notified %d", id, notified)
+	}
+	if list, _ := categories.List(ctx); len(list) != 0 {
+		t.Fatalf("rolled back change kept: %+v", list)
+	}
+
+	err = tx.Do(ctx, func(ctx context.Context) error {
+		if err := categories.Create(ctx, &model.Category{Name: "Travel"}); err != nil {
+			return err
+		}
+		return repo.Append(ctx, &model.OutboxEvent{Type: "category.created", Payload: "{}"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := repo.LastID(ctx); id != 1 || notified != 1 {
+		t.Fatalf("committed event: last id %d, notified %d", id, notified)
+	}
+}
+
+func TestRelay_SharedOffsetsAreAtLeastOnce(t *testing.T) {
+	_, repo, clock := setupRelay(t)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_ = repo.Append(ctx, &model.OutboxEvent{Type: "post.created", Payload: "{}"})
+	}
+	a, b := newRelay(repo, clock, "a"), newRelay(repo, clock, "b")
+	sinkA, sinkB := &recorder{name: "webhooks", err: errors.New("down")}, &recorder{name: "webhooks"}
+	a.Add(sinkA, Shared)
+	b.Add(sinkB, Shared)
+
+	if _, err := a.ProcessOnce(ctx); err == nil {
+		t.Fatal("failing sink reported no error")
+	}
+	sinkA.err = nil
+	if n, err := a.ProcessOnce(ctx); err != nil || n != 3 {
+		t.Fatalf("retry: n=%d err=%v", n, err)
+	}
+	if n, _ := b.ProcessOnce(ctx); n != 0 {
+		t.Fatalf("another instance got %d handled events again", n)
+	}
+	_ = repo.Append(ctx, &model.OutboxEvent{Type: "post.updated", Payload: "{}"})
+	if n, _ := b.ProcessOnce(ctx); n != 1 || len(sinkB.ids) != 1 || sinkB.ids[0] != 4 {
+		t.Fatalf("instance b: n=%d ids=%v", n, sinkB.ids)
+	}
+	if len(sinkA.ids) != 3 {
+		t.Fatalf("instance a: ids=%v", sinkA.ids)
+	}
+
+	// An instance holding the offset keeps others out until its lease expires.
+	if _, ok, _ := repo.ClaimOffset(ctx, "webhooks", "a", 0, *clock, time.Minute); !ok {
+		t.Fatal("claim failed")
+	}
+	_ = repo.Append(ctx, &model.OutboxEvent{Type: "post.deleted", Payload: "{}"})
+	if n, _ := b.ProcessOnce(ctx); n != 0 {
+		t.Fatal("offset handled by two instances at once")
+	}
+	*clock = clock.Add(2 * time.Minute)
+	if n, _ := b.ProcessOnce(ctx); n != 1 {
+		t.Fatal("expired lease not taken over")
+	}
+}
+
+func TestRelay_WaitsForGapsToSettle(t *testing.T) {
+	db, repo, clock := setupRelay(t)
+	ctx := context.Background()
+	r := newRelay(repo, clock, "a")
+	sink := &recorder{name: "hub"}
+	r.Add(sink, Local)
+	// Event 2 is missing: it may belong to a transaction that has not committed yet.
+	db.Create(&model.OutboxEvent{ID: 1, Type: "post.created", Payload: "{}", CreatedAt: *clock})
+	db.Create(&model.OutboxEvent{ID: 3, Type: "post.created", Payload: "{}", CreatedAt: *clock})
+
+	if n, _ := r.ProcessOnce(ctx); n != 1 {
+		t.Fatalf("handed out %d events past the gap", n)
+	}
+	db.Create(&model.OutboxEvent{ID: 2, Type: "post.created", Payload: "{}", CreatedAt: *clock})
+	if n, _ := r.ProcessOnce(ctx); n != 2 || len(sink.ids) != 3 || sink.ids[1] != 2 {
+		t.Fatalf("after the gap filled: n=%d ids=%v", n, sink.ids)
+	}
+
+	// A gap that never fills (a rollback) is skipped once it is older than Settle.
+	db.Create(&model.OutboxEvent{ID: 5, Type: "post.created", Payload: "{}", CreatedAt: *clock})
+	if n, _ := r.ProcessOnce(ctx); n != 0 {
+		t.Fatal("unsettled gap skipped")
+	}
+	*clock = clock.Add(2 * time.Minute)
+	if n, _ := r.ProcessOnce(ctx); n != 1 || sink.ids[3] != 5 {
+		t.Fatalf("settled gap: n=%d ids=%v", n, sink.ids)
+	}
+}
+
+func TestRelay_PruneKeepsUnhandledEvents(t *testing.T) {
+	_, repo, clock := setupRelay(t)
+	ctx := context.Background()
+	r := newRelay(repo, clock, "a")
+	sink := &recorder{name: "webhooks"}
+	r.Add(sink, Shared)
+	for i := 0; i < 2; i++ {
+		_ = repo.Append(ctx, &model.OutboxEvent{Type: "post.created", Payload: "{}"})
+	}
+	*clock = clock.Add(2 * time.Hour)
+	if n, _ := r.Prune(ctx); n != 0 {
+		t.Fatalf("pruned %d events before the shared sink started", n)
+	}
+	_, _ = r.ProcessOnce(ctx)
+	_ = repo.Append(ctx, &model.OutboxEvent{Type: "post.created", Payload: "{}", CreatedAt: clock.Add(-2 * time.Hour)})
+	if n, err := r.Prune(ctx); err != nil || n != 2 {
+		t.Fatalf("Prune: n=%d err=%v", n, err)
+	}
+}
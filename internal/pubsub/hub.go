@@ -0,0 +1,188 @@
+// pubsub: In-process publish/subscribe hub with per-topic history, feeding the event streams.
+package pubsub
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// subscriberBuffer is how many events a subscriber may lag behind before it is dropped.
+	subscriberBuffer = 64
+	// idleTopicTTL is how long the history of a topic without subscribers is kept after its last event.
+	idleTopicTTL = 10 * time.Minute
+	// unknownFloor is the floor until the first event: the hub does not know yet which events it missed.
+	unknownFloor = math.MaxUint64
+)
+
+// Event is one published message. Its ID is the ID of the outbox event it comes from, so IDs increase across
+// all topics and are the same on every instance: a client can resume on another instance than the one it
+// was connected to.
+type Event struct {
+	ID    uint64          `json:"id"`
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Subscription receives the events of one topic on C. C is closed when the subscriber falls
+// more than subscriberBuffer events behind; it should reconnect and resume from its last event ID.
+type Subscription struct {
+	C     <-chan Event
+	c     chan Event
+	topic string
+}
+
+type topic struct {
+	recent  []Event // oldest first, at most Hub.history
+	floor   uint64  // events with an ID up to floor may be missing from recent
+	subs    map[*Subscription]struct{}
+	updated time.Time
+}
+
+// Hub fans published events out to the subscribers of their topic and keeps the last events of each
+// topic so reconnecting subscribers can catch up. A nil *Hub discards everything published to it.
+type Hub struct {
+	mu        sync.Mutex
+	history   int
+	lastID    uint64 // the newest event published, 0 before the first
+	floor     uint64 // floor of new topics: the newest event that may have been forgotten
+	topics    map[string]*topic
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// New returns a hub keeping up to history events per topic. Until the first event is published, no resume is
+// complete: the events before it were handled by the instances that were running then.
+func New(history int) *Hub {
+	return &Hub{history: history, floor: unknownFloor, topics: make(map[string]*topic), lastPrune: time.Now(), now: time.Now}
+}
+
+// open sets the floor once the first event, id, arrives: the events before it are unknown to this hub.
+func (h *Hub) open(id uint64) {
+	h.floor = id - 1
+	for _, t := range h.topics {
+		if t.floor > h.floor {
+			t.floor = h.floor
+		}
+	}
+}
+
+func (h *Hub) topic(name string) *topic {
+	t, ok := h.topics[name]
+	if !ok {
+		t = &topic{floor: h.floor, subs: make(map[*Subscription]struct{})}
+		h.topics[name] = t
+	}
+	return t
+}
+
+// drop forgets a topic. Its floor is raised into the hub's, so a subscriber resuming from before the
+// forgotten events is told its replay is incomplete.
+func (h *Hub) drop(name string, t *topic) {
+	if n := len(t.recent); n > 0 {
+		t.floor = t.recent[n-1].ID
+	}
+	if t.floor > h.floor {
+		h.floor = t.floor
+	}
+	delete(h.topics, name)
+}
+
+// prune drops topics nobody listens to whose last event is older than idleTopicTTL.
+func (h *Hub) prune(now time.Time) {
+	if now.Sub(h.lastPrune) < idleTopicTTL {
+		return
+	}
+	h.lastPrune = now
+	for name, t := range h.topics {
+		if len(t.subs) == 0 && now.Sub(t.updated) > idleTopicTTL {
+			h.drop(name, t)
+		}
+	}
+}
+
+// Publish sends v, encoded as JSON, to the subscribers of topicName as event id of type typ. Events must be
+// published in ID order; an ID not above the last one is a repeat and is ignored.
+func (h *Hub) Publish(id uint64, topicName, typ string, v any) {
+	if h == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("[pubsub] encode %s on %s: %v", typ, topicName, err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if id <= h.lastID {
+		return
+	}
+	if h.lastID == 0 {
+		h.open(id)
+	}
+	h.lastID = id
+	now := h.now()
+	h.prune(now)
+	ev := Event{ID: id, Topic: topicName, Type: typ, Data: data}
+	t := h.topic(topicName)
+	t.updated = now
+	if h.history > 0 {
+		if len(t.recent) == h.history {
+			t.floor = t.recent[0].ID
+			t.recent = append(t.recent[:0], t.recent[1:]...)
+		}
+		t.recent = append(t.recent, ev)
+	} else {
+		t.floor = ev.ID
+	}
+	for sub := range t.subs {
+		select {
+		case sub.c <- ev:
+		default:
+			delete(t.subs, sub)
+			close(sub.c)
+		}
+	}
+}
+
+// Subscribe starts receiving the events of topicName. With lastID > 0 the events after lastID are
+// returned for replay; complete is false when some of them are no longer known (too old, or from
+// before this instance started), in which case the subscriber should reload its state.
+func (h *Hub) Subscribe(topicName string, lastID uint64) (sub *Subscription, replay []Event, complete bool) {
+	c := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: c, c: c, topic: topicName}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t := h.topic(topicName)
+	t.subs[sub] = struct{}{}
+	if lastID == 0 {
+		return sub, nil, true
+	}
+	for _, ev := range t.recent {
+		if ev.ID > lastID {
+			replay = append(replay, ev)
+		}
+	}
+	return sub, replay, lastID >= t.floor
+}
+
+// Unsubscribe stops sub; it is safe to call after the hub dropped it.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.topics[sub.topic]
+	if !ok {
+		return
+	}
+	if _, ok := t.subs[sub]; ok {
+		delete(t.subs, sub)
+		close(sub.c)
+	}
+	if len(t.subs) == 0 && len(t.recent) == 0 {
+		h.drop(sub.topic, t)
+	}
+}
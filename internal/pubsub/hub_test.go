@@ -0,0 +1,98 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHub_PublishAndResume(t *testing.T) {
+	h := New(2)
+	sub, replay, complete := h.Subscribe("post:1", 0)
+	if len(replay) != 0 || !complete {
+		t.Fatalf("fresh subscription: replay=%v complete=%v", replay, complete)
+	}
+	h.Publish(10, "post:1", "comment.created", map[string]int{"id": 1})
+	h.Publish(11, "post:2", "comment.created", map[string]int{"id": 2})
+	ev := <-sub.C
+	if ev.Type != "comment.created" || string(ev.Data) != `{"id":1}` {
+		t.Fatalf("got %+v", ev)
+	}
+	select {
+	case ev := <-sub.C:
+		t.Fatalf("received event of another topic: %+v", ev)
+	default:
+	}
+	h.Unsubscribe(sub)
+	if _, ok := <-sub.C; ok {
+		t.Error("channel open after Unsubscribe")
+	}
+	h.Unsubscribe(sub)
+
+	// Resuming from the last seen event replays what came after it.
+	h.Publish(12, "post:1", "comment.updated", nil)
+	sub, replay, complete = h.Subscribe("post:1", ev.ID)
+	defer h.Unsubscribe(sub)
+	if len(replay) != 1 || replay[0].Type != "comment.updated" || !complete {
+		t.Fatalf("resume: replay=%+v complete=%v", replay, complete)
+	}
+	// Once the history is exceeded, IDs before the evicted event can no longer be resumed completely.
+	h.Publish(13, "post:1", "comment.deleted", nil)
+	h.Publish(13, "post:1", "comment.deleted", nil)
+	if _, replay, complete := h.Subscribe("post:1", ev.ID); !complete || len(replay) != 2 {
+		t.Errorf("resume after evicted event: replay=%d complete=%v", len(replay), complete)
+	}
+	if _, _, complete := h.Subscribe("post:1", ev.ID-1); complete {
+		t.Error("resume before evicted event reported complete")
+	}
+	// IDs from before a restart are older than the hub.
+	if _, _, complete := New(2).Subscribe("post:1", ev.ID); complete {
+		t.Error("resume across restart reported complete")
+	}
+	// Another instance that started later relays the same events under the same IDs, so a client can
+	// resume there from what it last saw here.
+	other := New(2)
+	other.Publish(12, "post:1", "comment.updated", nil)
+	other.Publish(13, "post:1", "comment.deleted", nil)
+	if _, replay, complete := other.Subscribe("post:1", 12); !complete || len(replay) != 1 || replay[0].ID != 13 {
+		t.Errorf("resume on another instance: replay=%+v complete=%v", replay, complete)
+	}
+	if _, _, complete := other.Subscribe("post:1", ev.ID); complete {
+		t.Error("resume from before another instance started reported complete")
+	}
+}
+
+func TestHub_DropsSlowSubscribersAndIdleTopics(t *testing.T) {
+	h := New(1)
+	now := time.Now()
+	h.now = func() time.Time { return now }
+	slow, _, _ := h.Subscribe("posts", 0)
+	for i := 0; i < subscriberBuffer+1; i++ {
+		h.Publish(uint64(i+1), "posts", "post.created", i)
+	}
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("slow subscriber got %d events before being dropped, want %d", n, subscriberBuffer)
+	}
+	h.Unsubscribe(slow)
+
+	last := h.lastID
+	now = now.Add(2 * idleTopicTTL)
+	h.Publish(1000, "other", "post.created", 0)
+	if _, ok := h.topics["posts"]; ok {
+		t.Fatal("idle topic not pruned")
+	}
+	if _, _, complete := h.Subscribe("posts", last-1); complete {
+		t.Error("resume of a pruned topic reported complete")
+	}
+	if _, _, complete := h.Subscribe("posts", last); !complete {
+		t.Error("resume after the last pruned event should be complete")
+	}
+}
+
+func TestHub_NilDiscards(t *testing.T) {
+	var h *Hub
+	h.Publish(1, "posts", "post.created", 1)
+}
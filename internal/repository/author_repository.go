@@ -17,12 +17,12 @@ func NewAuthorRepository(db *gorm.DB) *AuthorRepository {
 }
 
 func (r *AuthorRepository) Create(ctx context.Context, a *model.Author) error {
-	return r.db.WithContext(ctx).Create(a).Error
+	return conn(ctx, r.db).Create(a).Error
 }
 
 func (r *AuthorRepository) GetByID(ctx context.Context, id uint) (*model.Author, error) {
 	var a model.Author
-	err := r.db.WithContext(ctx).First(&a, id).Error
+	err := read(ctx, r.db).First(&a, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +31,7 @@ func (r *AuthorRepository) GetByID(ctx context.Context, id uint) (*model.Author,
 
 func (r *AuthorRepository) GetByEmail(ctx context.Context, email string) (*model.Author, error) {
 	var a model.Author
-	err := r.db.WithContext(ctx).Where("email = ?", email).First(&a).Error
+	err := conn(ctx, r.db).Where("email = ?", email).First(&a).Error
 	if err != nil {
 		return nil, err
 	}
@@ -40,14 +40,37 @@ func (r *AuthorRepository) GetByEmail(ctx context.Context, email string) (*model
 
 func (r *AuthorRepository) List(ctx context.Context) ([]model.Author, error) {
 	var list []model.Author
-	err := r.db.WithContext(ctx).Order("name").Find(&list).Error
+	err := read(ctx, r.db).Order("name").Find(&list).Error
 	return list, err
 }
 
 func (r *AuthorRepository) Update(ctx context.Context, a *model.Author) error {
-	return r.db.WithContext(ctx).Save(a).Error
+	return conn(ctx, r.db).Save(a).Error
+}
+
+// SetQuota sets the author's storage quota override in bytes; nil reverts to the configured default.
+func (r *AuthorRepository) SetQuota(ctx context.Context, id uint, quota *int64) error {
+	res := conn(ctx, r.db).Model(&model.Author{}).Where("id = ?", id).Update("quota_bytes", quota)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
 }
 
 func (r *AuthorRepository) Delete(ctx context.Context, id uint) error {
-	return r.db.WithContext(ctx).Delete(&model.Author{}, id).Error
+	return conn(ctx, r.db).Delete(&model.Author{}, id).Error
+}
+
+// ListByHandles returns the authors whose handle is in handles. A handle is the lower-case name without
+// spaces and underscores, so "Jane Doe" is @janedoe or @jane_doe.
+func (r *AuthorRepository) ListByHandles(ctx context.Context, handles []string) ([]model.Author, error) {
+	var list []model.Author
+	if len(handles) == 0 {
+		return list, nil
+	}
+	err := conn(ctx, r.db).Where("LOWER(REPLACE(REPLACE(name, ' ', ''), '_', '')) IN ?", handles).Find(&list).Error
+	return list, err
 }
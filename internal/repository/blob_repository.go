@@ -0,0 +1,62 @@
+// repository/blob_repository: Reference counting for content-addressed blobs.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BlobRepository struct {
+	db *gorm.DB
+}
+
+func NewBlobRepository(db *gorm.DB) *BlobRepository {
+	return &BlobRepository{db: db}
+}
+
+// Acquire records one more reference to the blob at path, creating the row on first use.
+func (r *BlobRepository) Acquire(ctx context.Context, hash, path string, size int64) error {
+	b := &model.Blob{Hash: hash, Path: path, Size: size, RefCount: 1}
+	return conn(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "path"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"ref_count": gorm.Expr("blobs.ref_count + 1")}),
+	}).Create(b).Error
+}
+
+// Release drops one reference to the blob at path. Paths that are not blobs (legacy uploads) are ignored.
+func (r *BlobRepository) Release(ctx context.Context, path string) error {
+	if path == "" {
+		return nil
+	}
+	return conn(ctx, r.db).Model(&model.Blob{}).
+		Where("path = ? AND ref_count > 0", path).
+		Update("ref_count", gorm.Expr("ref_count - 1")).Error
+}
+
+func (r *BlobRepository) GetByPath(ctx context.Context, path string) (*model.Blob, error) {
+	var b model.Blob
+	err := conn(ctx, r.db).Where("path = ?", path).First(&b).Error
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListUnreferenced returns up to limit blobs with an ID above afterID that nothing has used since before, by ID.
+func (r *BlobRepository) ListUnreferenced(ctx context.Context, before time.Time, afterID uint, limit int) ([]model.Blob, error) {
+	var list []model.Blob
+	err := conn(ctx, r.db).Where("ref_count = 0 AND updated_at < ? AND id > ?", before, afterID).
+		Order("id").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+// DeleteUnreferenced deletes the row of the blob at path if nothing has used it since before, and reports
+// whether it did. Within a transaction the row stays locked until commit, so a concurrent Acquire waits.
+func (r *BlobRepository) DeleteUnreferenced(ctx context.Context, path string, before time.Time) (bool, error) {
+	res := conn(ctx, r.db).Where("path = ? AND ref_count = 0 AND updated_at < ?", path, before).Delete(&model.Blob{})
+	return res.RowsAffected == 1, res.Error
+}
@@ -17,12 +17,12 @@ func NewCategoryRepository(db *gorm.DB) *CategoryRepository {
 }
 
 func (r *CategoryRepository) Create(ctx context.Context, c *model.Category) error {
-	return r.db.WithContext(ctx).Create(c).Error
+	return conn(ctx, r.db).Create(c).Error
 }
 
 func (r *CategoryRepository) GetByID(ctx context.Context, id uint) (*model.Category, error) {
 	var c model.Category
-	err := r.db.WithContext(ctx).First(&c, id).Error
+	err := read(ctx, r.db).First(&c, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -31,14 +31,14 @@ func (r *CategoryRepository) GetByID(ctx context.Context, id uint) (*model.Categ
 
 func (r *CategoryRepository) List(ctx context.Context) ([]model.Category, error) {
 	var list []model.Category
-	err := r.db.WithContext(ctx).Order("name").Find(&list).Error
+	err := read(ctx, r.db).Order("name").Find(&list).Error
 	return list, err
 }
 
 func (r *CategoryRepository) Update(ctx context.Context, c *model.Category) error {
-	return r.db.WithContext(ctx).Save(c).Error
+	return conn(ctx, r.db).Save(c).Error
 }
 
 func (r *CategoryRepository) Delete(ctx context.Context, id uint) error {
-	return r.db.WithContext(ctx).Delete(&model.Category{}, id).Error
+	return conn(ctx, r.db).Delete(&model.Category{}, id).Error
 }
@@ -17,12 +17,12 @@ func NewCommentRepository(db *gorm.DB) *CommentRepository {
 }
 
 func (r *CommentRepository) Create(ctx context.Context, c *model.Comment) error {
-	return r.db.WithContext(ctx).Create(c).Error
+	return conn(ctx, r.db).Create(c).Error
 }
 
 func (r *CommentRepository) GetByID(ctx context.Context, id uint) (*model.Comment, error) {
 	var c model.Comment
-	err := r.db.WithContext(ctx).First(&c, id).Error
+	err := read(ctx, r.db).First(&c, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -31,14 +31,14 @@ func (r *CommentRepository) GetByID(ctx context.Context, id uint) (*model.Commen
 
 func (r *CommentRepository) ListByPostID(ctx context.Context, postID uint) ([]model.Comment, error) {
 	var list []model.Comment
-	err := r.db.WithContext(ctx).Where("post_id = ?", postID).Order("created_at ASC").Find(&list).Error
+	err := read(ctx, r.db).Where("post_id = ?", postID).Order("created_at ASC").Find(&list).Error
 	return list, err
 }
 
 func (r *CommentRepository) Update(ctx context.Context, c *model.Comment) error {
-	return r.db.WithContext(ctx).Save(c).Error
+	return conn(ctx, r.db).Save(c).Error
 }
 
 func (r *CommentRepository) Delete(ctx context.Context, id uint) error {
-	return r.db.WithContext(ctx).Delete(&model.Comment{}, id).Error
+	return conn(ctx, r.db).Delete(&model.Comment{}, id).Error
 }
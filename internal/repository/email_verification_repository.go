@@ -18,12 +18,12 @@ func NewEmailVerificationRepository(db *gorm.DB) *EmailVerificationRepository {
 }
 
 func (r *EmailVerificationRepository) Create(ctx context.Context, ev *model.EmailVerification) error {
-	return r.db.WithContext(ctx).Create(ev).Error
+	return conn(ctx, r.db).Create(ev).Error
 }
 
 func (r *EmailVerificationRepository) FindValid(ctx context.Context, email, code string) (*model.EmailVerification, error) {
 	var ev model.EmailVerification
-	err := r.db.WithContext(ctx).Where("email = ? AND code = ? AND expires_at > ?", email, code, time.Now()).First(&ev).Error
+	err := conn(ctx, r.db).Where("email = ? AND code = ? AND expires_at > ?", email, code, time.Now()).First(&ev).Error
 	if err != nil {
 		return nil, err
 	}
@@ -32,5 +32,5 @@ func (r *EmailVerificationRepository) FindValid(ctx context.Context, email, code
 
 // DeleteByEmail permanently removes verification records for this email so a new code can be requested.
 func (r *EmailVerificationRepository) DeleteByEmail(ctx context.Context, email string) error {
-	return r.db.WithContext(ctx).Unscoped().Where("email = ?", email).Delete(&model.EmailVerification{}).Error
+	return conn(ctx, r.db).Unscoped().Where("email = ?", email).Delete(&model.EmailVerification{}).Error
 }
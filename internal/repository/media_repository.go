@@ -1,13 +1,23 @@
-// repository/media_repository: Create and delete media records in the database.
+// repository/media_repository: Media library records and their links to posts.
 package repository
 
 import (
 	"context"
+	"strings"
 
 	"github.com/aliakbar-zohour/go_blog/internal/model"
 	"gorm.io/gorm"
 )
 
+// MediaFilter narrows a media library listing. Zero values do not filter.
+type MediaFilter struct {
+	AuthorID   uint
+	Type       model.MediaType
+	Query      string // case-insensitive substring of the filename
+	PostID     *uint  // only items attached to this post
+	Unattached bool   // only items not attached to any live post
+}
+
 type MediaRepository struct {
 	db *gorm.DB
 }
@@ -17,18 +27,65 @@ func NewMediaRepository(db *gorm.DB) *MediaRepository {
 }
 
 func (r *MediaRepository) Create(ctx context.Context, m *model.Media) error {
-	return r.db.WithContext(ctx).Create(m).Error
+	return conn(ctx, r.db).Create(m).Error
 }
 
+// DeleteByID soft-deletes the media item and removes its links to posts.
 func (r *MediaRepository) DeleteByID(ctx context.Context, id uint) error {
-	return r.db.WithContext(ctx).Delete(&model.Media{}, id).Error
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("media_id = ?", id).Delete(&model.PostMedia{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Media{}, id).Error
+	})
 }
 
 func (r *MediaRepository) GetByID(ctx context.Context, id uint) (*model.Media, error) {
 	var m model.Media
-	err := r.db.WithContext(ctx).First(&m, id).Error
+	err := read(ctx, r.db).First(&m, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &m, nil
 }
+
+// GetByIDs returns the media items with the given ids; missing ids are left out.
+func (r *MediaRepository) GetByIDs(ctx context.Context, ids []uint) ([]model.Media, error) {
+	var items []model.Media
+	err := conn(ctx, r.db).Where("id IN ?", ids).Find(&items).Error
+	return items, err
+}
+
+// List returns media matching f, newest first.
+func (r *MediaRepository) List(ctx context.Context, f MediaFilter, limit, offset int) ([]model.Media, error) {
+	var items []model.Media
+	err := r.filter(ctx, f).Order("media.created_at DESC, media.id DESC").Limit(limit).Offset(offset).Find(&items).Error
+	return items, err
+}
+
+// Count returns the number of media matching f.
+func (r *MediaRepository) Count(ctx context.Context, f MediaFilter) (int64, error) {
+	var n int64
+	err := r.filter(ctx, f).Count(&n).Error
+	return n, err
+}
+
+func (r *MediaRepository) filter(ctx context.Context, f MediaFilter) *gorm.DB {
+	q := read(ctx, r.db).Model(&model.Media{})
+	if f.AuthorID != 0 {
+		q = q.Where("media.author_id = ?", f.AuthorID)
+	}
+	if f.Type != "" {
+		q = q.Where("media.type = ?", f.Type)
+	}
+	if s := strings.TrimSpace(f.Query); s != "" {
+		q = q.Where("LOWER(media.filename) LIKE ?", "%"+strings.ToLower(s)+"%")
+	}
+	if f.PostID != nil {
+		q = q.Where("EXISTS (SELECT 1 FROM post_media WHERE post_media.media_id = media.id AND post_media.post_id = ?)", *f.PostID)
+	}
+	if f.Unattached {
+		q = q.Where("NOT EXISTS (SELECT 1 FROM post_media JOIN posts ON posts.id = post_media.post_id WHERE post_media.media_id = media.id AND posts.deleted_at IS NULL)")
+	}
+	return q
+}
@@ -0,0 +1,117 @@
+// repository/notification_repository: Notification inbox, per-author preferences and category watches.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type NotificationRepository struct {
+	db *gorm.DB
+}
+
+func NewNotificationRepository(db *gorm.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+func (r *NotificationRepository) Create(ctx context.Context, n *model.Notification) error {
+	return conn(ctx, r.db).Create(n).Error
+}
+
+// CreateOnce stores n unless its recipient already has a notification of the same event (n.EventID), and
+// reports whether it did.
+func (r *NotificationRepository) CreateOnce(ctx context.Context, n *model.Notification) (bool, error) {
+	res := conn(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).Create(n)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *NotificationRepository) inbox(ctx context.Context, authorID uint, unreadOnly bool) *gorm.DB {
+	q := conn(ctx, r.db).Model(&model.Notification{}).Where("author_id = ?", authorID)
+	if unreadOnly {
+		q = q.Where("read_at IS NULL")
+	}
+	return q
+}
+
+// List returns the notifications of authorID, newest first.
+func (r *NotificationRepository) List(ctx context.Context, authorID uint, unreadOnly bool, limit, offset int) ([]model.Notification, error) {
+	var list []model.Notification
+	err := r.inbox(ctx, authorID, unreadOnly).Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&list).Error
+	return list, err
+}
+
+func (r *NotificationRepository) Count(ctx context.Context, authorID uint, unreadOnly bool) (int64, error) {
+	var n int64
+	err := r.inbox(ctx, authorID, unreadOnly).Count(&n).Error
+	return n, err
+}
+
+// MarkRead marks notification id of authorID as read. It reports false when authorID has no such notification;
+// marking an already read notification again succeeds and keeps the first read time.
+func (r *NotificationRepository) MarkRead(ctx context.Context, authorID, id uint, at time.Time) (bool, error) {
+	res := conn(ctx, r.db).Model(&model.Notification{}).
+		Where("id = ? AND author_id = ?", id, authorID).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", at))
+	return res.RowsAffected > 0, res.Error
+}
+
+// MarkAllRead marks every unread notification of authorID as read and returns how many there were.
+func (r *NotificationRepository) MarkAllRead(ctx context.Context, authorID uint, at time.Time) (int64, error) {
+	res := r.inbox(ctx, authorID, true).Update("read_at", at)
+	return res.RowsAffected, res.Error
+}
+
+// Preferences returns the stored preferences of authorID, keyed by type. Missing types are enabled.
+func (r *NotificationRepository) Preferences(ctx context.Context, authorID uint) (map[model.NotificationType]bool, error) {
+	var list []model.NotificationPreference
+	if err := conn(ctx, r.db).Where("author_id = ?", authorID).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	prefs := make(map[model.NotificationType]bool, len(list))
+	for _, p := range list {
+		prefs[p.Type] = p.Enabled
+	}
+	return prefs, nil
+}
+
+// SetPreferences upserts the given types for authorID.
+func (r *NotificationRepository) SetPreferences(ctx context.Context, authorID uint, prefs map[model.NotificationType]bool) error {
+	if len(prefs) == 0 {
+		return nil
+	}
+	rows := make([]model.NotificationPreference, 0, len(prefs))
+	for t, enabled := range prefs {
+		rows = append(rows, model.NotificationPreference{AuthorID: authorID, Type: t, Enabled: enabled})
+	}
+	return conn(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "author_id"}, {Name: "type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled"}),
+	}).Create(&rows).Error
+}
+
+// Watch adds a category watch; watching twice is a no-op.
+func (r *NotificationRepository) Watch(ctx context.Context, authorID, categoryID uint) error {
+	return conn(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.CategoryWatch{AuthorID: authorID, CategoryID: categoryID}).Error
+}
+
+func (r *NotificationRepository) Unwatch(ctx context.Context, authorID, categoryID uint) error {
+	return conn(ctx, r.db).Where("author_id = ? AND category_id = ?", authorID, categoryID).Delete(&model.CategoryWatch{}).Error
+}
+
+func (r *NotificationRepository) Watches(ctx context.Context, authorID uint) ([]model.CategoryWatch, error) {
+	var list []model.CategoryWatch
+	err := conn(ctx, r.db).Where("author_id = ?", authorID).Order("category_id").Find(&list).Error
+	return list, err
+}
+
+// CategoryWatchers returns the IDs of the authors watching categoryID.
+func (r *NotificationRepository) CategoryWatchers(ctx context.Context, categoryID uint) ([]uint, error) {
+	var ids []uint
+	err := conn(ctx, r.db).Model(&model.CategoryWatch{}).Where("category_id = ?", categoryID).Order("author_id").Pluck("author_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,123 @@
+// repository/outbox_email_repository: Mail queue storage: enqueue, claim due messages and record outcomes.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type OutboxEmailRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxEmailRepository(db *gorm.DB) *OutboxEmailRepository {
+	return &OutboxEmailRepository{db: db}
+}
+
+func (r *OutboxEmailRepository) Create(ctx context.Context, e *model.OutboxEmail) error {
+	return conn(ctx, r.db).Create(e).Error
+}
+
+func (r *OutboxEmailRepository) GetByID(ctx context.Context, id uint) (*model.OutboxEmail, error) {
+	var e model.OutboxEmail
+	if err := conn(ctx, r.db).First(&e, id).Error; err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ClaimDue marks the oldest due message as sending until now+lease and returns it, or nil when none is due.
+// Messages whose lease expired (a worker died mid-send) are due again. The conditional update makes the claim
+// safe with several workers or instances: only one of them changes the row. The returned LockedUntil
+// identifies the claim for MarkSent and MarkFailed.
+func (r *OutboxEmailRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.OutboxEmail, error) {
+	db := conn(ctx, r.db)
+	due := func(q *gorm.DB) *gorm.DB {
+		return q.Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_until < ?)",
+			model.OutboxEmailPending, now, model.OutboxEmailSending, now)
+	}
+	for i := 0; i < 3; i++ {
+		var e model.OutboxEmail
+		err := due(db.Model(&model.OutboxEmail{})).Order("next_attempt_at, id").Limit(1).Take(&e).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Kept to the microsecond, as PostgreSQL stores it, so the claim's LockedUntil compares equal to the row's.
+		until := now.Add(lease).UTC().Truncate(time.Microsecond)
+		res := due(db.Model(&model.OutboxEmail{}).Where("id = ?", e.ID)).
+			Updates(map[string]interface{}{"status": model.OutboxEmailSending, "locked_until": until})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			e.Status, e.LockedUntil = model.OutboxEmailSending, &until
+			return &e, nil
+		}
+		// Another worker claimed it first; try the next one.
+	}
+	return nil, nil
+}
+
+// MarkSent records a successful delivery. It only applies while claim is still held, and reports whether it
+// did: a message whose lease expired may have been claimed by another worker, whose outcome wins.
+func (r *OutboxEmailRepository) MarkSent(ctx context.Context, claim *model.OutboxEmail, attempts int, at time.Time) (bool, error) {
+	res := claimed(conn(ctx, r.db), claim).Updates(map[string]interface{}{
+		"status": model.OutboxEmailSent, "attempts": attempts, "sent_at": at, "locked_until": nil, "last_error": "",
+	})
+	return res.RowsAffected == 1, res.Error
+}
+
+// MarkFailed records a failed attempt: the message is retried at next, or moved to dead when dead is true. Like
+// MarkSent, it only applies while claim is still held.
+func (r *OutboxEmailRepository) MarkFailed(ctx context.Context, claim *model.OutboxEmail, attempts int, next time.Time, dead bool, lastErr string) (bool, error) {
+	status := model.OutboxEmailPending
+	if dead {
+		status = model.OutboxEmailDead
+	}
+	res := claimed(conn(ctx, r.db), claim).Updates(map[string]interface{}{
+		"status": status, "attempts": attempts, "next_attempt_at": next, "locked_until": nil, "last_error": lastErr,
+	})
+	return res.RowsAffected == 1, res.Error
+}
+
+// claimed scopes an update to the message of claim while it is still sending under the same lease.
+func claimed(db *gorm.DB, claim *model.OutboxEmail) *gorm.DB {
+	return db.Model(&model.OutboxEmail{}).Where("id = ? AND status = ? AND locked_until = ?",
+		claim.ID, model.OutboxEmailSending, claim.LockedUntil)
+}
+
+// Requeue makes a dead message pending again with a fresh attempt budget. Returns false when it is not dead.
+func (r *OutboxEmailRepository) Requeue(ctx context.Context, id uint, now time.Time) (bool, error) {
+	res := conn(ctx, r.db).Model(&model.OutboxEmail{}).Where("id = ? AND status = ?", id, model.OutboxEmailDead).
+		Updates(map[string]interface{}{"status": model.OutboxEmailPending, "attempts": 0, "next_attempt_at": now})
+	return res.RowsAffected == 1, res.Error
+}
+
+// List returns messages, newest first, optionally filtered by status.
+func (r *OutboxEmailRepository) List(ctx context.Context, status model.OutboxEmailStatus, limit, offset int) ([]model.OutboxEmail, error) {
+	var items []model.OutboxEmail
+	q := conn(ctx, r.db).Order("id DESC").Limit(limit).Offset(offset)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	err := q.Find(&items).Error
+	return items, err
+}
+
+// Count returns the number of messages, optionally filtered by status.
+func (r *OutboxEmailRepository) Count(ctx context.Context, status model.OutboxEmailStatus) (int64, error) {
+	var n int64
+	q := conn(ctx, r.db).Model(&model.OutboxEmail{})
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	err := q.Count(&n).Error
+	return n, err
+}
@@ -0,0 +1,105 @@
+// repository/outbox_event_repository: Outbox of domain events: append inside a change's transaction, read in
+// order and keep the offsets of the consumers.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxEventRepository struct {
+	db       *gorm.DB
+	onAppend func()
+}
+
+func NewOutboxEventRepository(db *gorm.DB) *OutboxEventRepository {
+	return &OutboxEventRepository{db: db}
+}
+
+// OnAppend sets fn to be called after the transaction of an appended event commits, to wake the relay.
+// Call it before serving requests.
+func (r *OutboxEventRepository) OnAppend(fn func()) {
+	r.onAppend = fn
+}
+
+// Append stores e in the transaction of ctx.
+func (r *OutboxEventRepository) Append(ctx context.Context, e *model.OutboxEvent) error {
+	if err := conn(ctx, r.db).Create(e).Error; err != nil {
+		return err
+	}
+	if r.onAppend != nil {
+		AfterCommit(ctx, r.onAppend)
+	}
+	return nil
+}
+
+// After returns up to limit events with an ID above id, oldest first.
+func (r *OutboxEventRepository) After(ctx context.Context, id uint64, limit int) ([]model.OutboxEvent, error) {
+	var items []model.OutboxEvent
+	err := conn(ctx, r.db).Where("id > ?", id).Order("id").Limit(limit).Find(&items).Error
+	return items, err
+}
+
+// LastID returns the ID of the newest event, 0 when there is none.
+func (r *OutboxEventRepository) LastID(ctx context.Context) (uint64, error) {
+	var id *uint64
+	err := conn(ctx, r.db).Model(&model.OutboxEvent{}).Select("MAX(id)").Scan(&id).Error
+	if err != nil || id == nil {
+		return 0, err
+	}
+	return *id, nil
+}
+
+// ClaimOffset locks the offset of consumer for owner until now+lease and returns it. A consumer seen for the
+// first time starts at start. ok is false while another owner holds an unexpired lock.
+func (r *OutboxEventRepository) ClaimOffset(ctx context.Context, consumer, owner string, start uint64, now time.Time, lease time.Duration) (offset uint64, ok bool, err error) {
+	db := conn(ctx, r.db)
+	err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.OutboxOffset{Consumer: consumer, LastID: start}).Error
+	if err != nil {
+		return 0, false, err
+	}
+	until := now.Add(lease)
+	res := db.Model(&model.OutboxOffset{}).
+		Where("consumer = ? AND (owner = ? OR locked_until IS NULL OR locked_until < ?)", consumer, owner, now).
+		Updates(map[string]interface{}{"owner": owner, "locked_until": until})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return 0, false, res.Error
+	}
+	var o model.OutboxOffset
+	if err := db.First(&o, "consumer = ?", consumer).Error; err != nil {
+		return 0, false, err
+	}
+	return o.LastID, true, nil
+}
+
+// CommitOffset moves the offset of consumer to lastID and releases owner's lock. Returns an error when the lock
+// was lost to another owner, whose progress is then kept.
+func (r *OutboxEventRepository) CommitOffset(ctx context.Context, consumer, owner string, lastID uint64) error {
+	res := conn(ctx, r.db).Model(&model.OutboxOffset{}).Where("consumer = ? AND owner = ?", consumer, owner).
+		Updates(map[string]interface{}{"last_id": lastID, "owner": "", "locked_until": nil})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("outbox offset of " + consumer + " was taken over by another instance")
+	}
+	return nil
+}
+
+// Offsets returns the offsets of all shared consumers.
+func (r *OutboxEventRepository) Offsets(ctx context.Context) ([]model.OutboxOffset, error) {
+	var items []model.OutboxOffset
+	err := conn(ctx, r.db).Order("consumer").Find(&items).Error
+	return items, err
+}
+
+// Prune deletes events created before cutoff up to ID maxID and returns how many were deleted.
+func (r *OutboxEventRepository) Prune(ctx context.Context, cutoff time.Time, maxID uint64) (int64, error) {
+	res := conn(ctx, r.db).Where("created_at < ? AND id <= ?", cutoff, maxID).Delete(&model.OutboxEvent{})
+	return res.RowsAffected, res.Error
+}
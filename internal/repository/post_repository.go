@@ -3,9 +3,11 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/aliakbar-zohour/go_blog/internal/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PostRepository struct {
@@ -17,12 +19,12 @@ func NewPostRepository(db *gorm.DB) *PostRepository {
 }
 
 func (r *PostRepository) Create(ctx context.Context, post *model.Post) error {
-	return r.db.WithContext(ctx).Create(post).Error
+	return conn(ctx, r.db).Create(post).Error
 }
 
 func (r *PostRepository) GetByID(ctx context.Context, id uint) (*model.Post, error) {
 	var post model.Post
-	err := r.db.WithContext(ctx).Preload("Media").Preload("Author").Preload("Category").First(&post, id).Error
+	err := read(ctx, r.db).Preload("Media").Preload("Author").Preload("Category").First(&post, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +33,7 @@ func (r *PostRepository) GetByID(ctx context.Context, id uint) (*model.Post, err
 
 func (r *PostRepository) List(ctx context.Context, limit, offset int, categoryID *uint) ([]model.Post, error) {
 	var posts []model.Post
-	q := r.db.WithContext(ctx).Preload("Media").Preload("Author").Preload("Category").Limit(limit).Offset(offset).Order("created_at DESC")
+	q := read(ctx, r.db).Preload("Media").Preload("Author").Preload("Category").Limit(limit).Offset(offset).Order("created_at DESC, id DESC")
 	if categoryID != nil && *categoryID > 0 {
 		q = q.Where("category_id = ?", *categoryID)
 	}
@@ -39,10 +41,26 @@ func (r *PostRepository) List(ctx context.Context, limit, offset int, categoryID
 	return posts, err
 }
 
+// ListPublicCreatedBetween returns up to limit posts that are not private created in [from, to), oldest first,
+// optionally only by authorID or in categoryID (0 means any).
+func (r *PostRepository) ListPublicCreatedBetween(ctx context.Context, from, to time.Time, authorID, categoryID uint, limit int) ([]model.Post, error) {
+	var posts []model.Post
+	q := conn(ctx, r.db).Preload("Author").Preload("Category").
+		Where("created_at >= ? AND created_at < ? AND NOT private", from, to).Order("created_at, id").Limit(limit)
+	if authorID > 0 {
+		q = q.Where("author_id = ?", authorID)
+	}
+	if categoryID > 0 {
+		q = q.Where("category_id = ?", categoryID)
+	}
+	err := q.Find(&posts).Error
+	return posts, err
+}
+
 // Count returns total number of posts, optionally filtered by category_id.
 func (r *PostRepository) Count(ctx context.Context, categoryID *uint) (int64, error) {
 	var n int64
-	q := r.db.WithContext(ctx).Model(&model.Post{})
+	q := read(ctx, r.db).Model(&model.Post{})
 	if categoryID != nil && *categoryID > 0 {
 		q = q.Where("category_id = ?", *categoryID)
 	}
@@ -51,9 +69,26 @@ func (r *PostRepository) Count(ctx context.Context, categoryID *uint) (int64, er
 }
 
 func (r *PostRepository) Update(ctx context.Context, post *model.Post) error {
-	return r.db.WithContext(ctx).Save(post).Error
+	return conn(ctx, r.db).Save(post).Error
+}
+
+// AttachMedia links media library items to a post. Items already attached are left as they are.
+func (r *PostRepository) AttachMedia(ctx context.Context, postID uint, mediaIDs ...uint) error {
+	if len(mediaIDs) == 0 {
+		return nil
+	}
+	links := make([]model.PostMedia, len(mediaIDs))
+	for i, id := range mediaIDs {
+		links[i] = model.PostMedia{PostID: postID, MediaID: id}
+	}
+	return conn(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error
+}
+
+// DetachMedia removes the link between a post and a media item; the item stays in the library.
+func (r *PostRepository) DetachMedia(ctx context.Context, postID, mediaID uint) error {
+	return conn(ctx, r.db).Where("post_id = ? AND media_id = ?", postID, mediaID).Delete(&model.PostMedia{}).Error
 }
 
 func (r *PostRepository) Delete(ctx context.Context, id uint) error {
-	return r.db.WithContext(ctx).Delete(&model.Post{}, id).Error
+	return conn(ctx, r.db).Delete(&model.Post{}, id).Error
 }
@@ -0,0 +1,98 @@
+// repository/storage_repository: Lookups of stored file paths still referenced by live rows.
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type StorageRepository struct {
+	db *gorm.DB
+}
+
+func NewStorageRepository(db *gorm.DB) *StorageRepository {
+	return &StorageRepository{db: db}
+}
+
+// ReferencedPaths returns every upload-relative path used by a live row: media library items (attached or not),
+// banners of live posts, author avatars and resumable uploads in progress.
+func (r *StorageRepository) ReferencedPaths(ctx context.Context) (map[string]bool, error) {
+	queries := []string{
+		"SELECT path FROM media WHERE deleted_at IS NULL",
+		"SELECT banner_path FROM posts WHERE deleted_at IS NULL AND banner_path <> ''",
+		"SELECT avatar_path FROM authors WHERE avatar_path <> ''",
+		"SELECT path FROM uploads",
+	}
+	refs := make(map[string]bool)
+	for _, q := range queries {
+		var paths []string
+		if err := conn(ctx, r.db).Raw(q).Scan(&paths).Error; err != nil {
+			return nil, err
+		}
+		for _, p := range paths {
+			refs[p] = true
+		}
+	}
+	return refs, nil
+}
+
+// IsReferenced reports whether a live row uses path, as ReferencedPaths would list it.
+func (r *StorageRepository) IsReferenced(ctx context.Context, path string) (bool, error) {
+	var n int64
+	err := conn(ctx, r.db).Raw(`SELECT
+		(SELECT COUNT(*) FROM media WHERE deleted_at IS NULL AND path = ?) +
+		(SELECT COUNT(*) FROM posts WHERE deleted_at IS NULL AND banner_path = ?) +
+		(SELECT COUNT(*) FROM authors WHERE avatar_path = ?) +
+		(SELECT COUNT(*) FROM uploads WHERE path = ?)`,
+		path, path, path, path).Scan(&n).Error
+	return n > 0, err
+}
+
+// usedPrivately is the condition, on a column holding a path, that a live private post uses the file as its
+// banner or attached media.
+const usedPrivately = `(EXISTS (SELECT 1 FROM posts WHERE posts.deleted_at IS NULL AND posts.private AND posts.banner_path = %[1]s)
+	OR EXISTS (SELECT 1 FROM media JOIN post_media ON post_media.media_id = media.id JOIN posts ON posts.id = post_media.post_id
+		WHERE media.deleted_at IS NULL AND posts.deleted_at IS NULL AND posts.private AND media.path = %[1]s))`
+
+// IsPrivate reports whether serving path needs a signature: its blob is used by a live private post. Files
+// stored before blobs have no row and are looked up in the posts instead.
+func (r *StorageRepository) IsPrivate(ctx context.Context, path string) (bool, error) {
+	var blobs []model.Blob
+	if err := conn(ctx, r.db).Select("private").Where("path = ?", path).Limit(1).Find(&blobs).Error; err != nil {
+		return false, err
+	}
+	if len(blobs) > 0 {
+		return blobs[0].Private, nil
+	}
+	var private bool
+	err := conn(ctx, r.db).Raw("SELECT "+fmt.Sprintf(usedPrivately, "?"), path, path).Scan(&private).Error
+	return private, err
+}
+
+// PrivatePaths returns which of paths are blobs used by a live private post.
+func (r *StorageRepository) PrivatePaths(ctx context.Context, paths []string) (map[string]bool, error) {
+	private := make(map[string]bool)
+	if len(paths) == 0 {
+		return private, nil
+	}
+	var list []string
+	if err := conn(ctx, r.db).Model(&model.Blob{}).Where("path IN ? AND private", paths).Pluck("path", &list).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		private[p] = true
+	}
+	return private, nil
+}
+
+// RefreshPrivacy recomputes the private flag of the blobs at paths from the posts using them. Call it in the
+// transaction of every change to a post's files or privacy, with the paths the post used before and after.
+func (r *StorageRepository) RefreshPrivacy(ctx context.Context, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	return conn(ctx, r.db).Exec("UPDATE blobs SET private = "+fmt.Sprintf(usedPrivately, "blobs.path")+" WHERE path IN ?", paths).Error
+}
@@ -0,0 +1,202 @@
+// repository/store: Interfaces of the repositories the services, queues and relay depend on. The gorm
+// repositories of this package implement them against the database and internal/memrepo in memory, for fast
+// service tests. Both return gorm.ErrRecordNotFound for missing rows and gorm.ErrDuplicatedKey when a unique key
+// is taken.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+)
+
+type PostStore interface {
+	Create(ctx context.Context, post *model.Post) error
+	GetByID(ctx context.Context, id uint) (*model.Post, error)
+	List(ctx context.Context, limit, offset int, categoryID *uint) ([]model.Post, error)
+	ListPublicCreatedBetween(ctx context.Context, from, to time.Time, authorID, categoryID uint, limit int) ([]model.Post, error)
+	Count(ctx context.Context, categoryID *uint) (int64, error)
+	Update(ctx context.Context, post *model.Post) error
+	AttachMedia(ctx context.Context, postID uint, mediaIDs ...uint) error
+	DetachMedia(ctx context.Context, postID, mediaID uint) error
+	Delete(ctx context.Context, id uint) error
+}
+
+type MediaStore interface {
+	Create(ctx context.Context, m *model.Media) error
+	DeleteByID(ctx context.Context, id uint) error
+	GetByID(ctx context.Context, id uint) (*model.Media, error)
+	GetByIDs(ctx context.Context, ids []uint) ([]model.Media, error)
+	List(ctx context.Context, f MediaFilter, limit, offset int) ([]model.Media, error)
+	Count(ctx context.Context, f MediaFilter) (int64, error)
+}
+
+type AuthorStore interface {
+	Create(ctx context.Context, a *model.Author) error
+	GetByID(ctx context.Context, id uint) (*model.Author, error)
+	GetByEmail(ctx context.Context, email string) (*model.Author, error)
+	List(ctx context.Context) ([]model.Author, error)
+	Update(ctx context.Context, a *model.Author) error
+	SetQuota(ctx context.Context, id uint, quota *int64) error
+	Delete(ctx context.Context, id uint) error
+	ListByHandles(ctx context.Context, handles []string) ([]model.Author, error)
+}
+
+type CategoryStore interface {
+	Create(ctx context.Context, c *model.Category) error
+	GetByID(ctx context.Context, id uint) (*model.Category, error)
+	List(ctx context.Context) ([]model.Category, error)
+	Update(ctx context.Context, c *model.Category) error
+	Delete(ctx context.Context, id uint) error
+}
+
+type CommentStore interface {
+	Create(ctx context.Context, c *model.Comment) error
+	GetByID(ctx context.Context, id uint) (*model.Comment, error)
+	ListByPostID(ctx context.Context, postID uint) ([]model.Comment, error)
+	Update(ctx context.Context, c *model.Comment) error
+	Delete(ctx context.Context, id uint) error
+}
+
+type EmailVerificationStore interface {
+	Create(ctx context.Context, ev *model.EmailVerification) error
+	FindValid(ctx context.Context, email, code string) (*model.EmailVerification, error)
+	DeleteByEmail(ctx context.Context, email string) error
+}
+
+type UploadStore interface {
+	Create(ctx context.Context, u *model.Upload) error
+	GetByID(ctx context.Context, id string) (*model.Upload, error)
+	Update(ctx context.Context, u *model.Upload) error
+	Claim(ctx context.Context, id string, offset int64, token string, until, now time.Time) (bool, error)
+	RenewClaim(ctx context.Context, id, token string, until time.Time) error
+	Advance(ctx context.Context, u *model.Upload, from int64, token string) (bool, error)
+	ReleaseClaim(ctx context.Context, id, token string) error
+	Delete(ctx context.Context, id string) error
+	ListExpired(ctx context.Context, now time.Time) ([]model.Upload, error)
+}
+
+type BlobStore interface {
+	Acquire(ctx context.Context, hash, path string, size int64) error
+	Release(ctx context.Context, path string) error
+	GetByPath(ctx context.Context, path string) (*model.Blob, error)
+	ListUnreferenced(ctx context.Context, before time.Time, afterID uint, limit int) ([]model.Blob, error)
+	DeleteUnreferenced(ctx context.Context, path string, before time.Time) (bool, error)
+}
+
+type StorageStore interface {
+	ReferencedPaths(ctx context.Context) (map[string]bool, error)
+	IsReferenced(ctx context.Context, path string) (bool, error)
+	IsPrivate(ctx context.Context, path string) (bool, error)
+	PrivatePaths(ctx context.Context, paths []string) (map[string]bool, error)
+	RefreshPrivacy(ctx context.Context, paths []string) error
+}
+
+type UsageStore interface {
+	Charge(ctx context.Context, authorID uint, t model.MediaType, bytes, reserved, quota int64) (bool, error)
+	Add(ctx context.Context, authorID uint, t model.MediaType, bytes, files int64) error
+	Reserve(ctx context.Context, authorID uint, bytes, quota int64) (bool, error)
+	ListByAuthor(ctx context.Context, authorID uint) ([]model.StorageUsage, error)
+	Account(ctx context.Context, authorID uint) (*model.StorageAccount, error)
+}
+
+type SubscriptionStore interface {
+	Create(ctx context.Context, s *model.Subscription) error
+	Update(ctx context.Context, s *model.Subscription) error
+	GetByID(ctx context.Context, id uint) (*model.Subscription, error)
+	Find(ctx context.Context, email string, scope model.SubscriptionScope, targetID uint) (*model.Subscription, error)
+	ListConfirmedForPost(ctx context.Context, authorID, categoryID uint) ([]model.Subscription, error)
+	Delete(ctx context.Context, id uint) error
+	ReplaceConfirmation(ctx context.Context, c *model.SubscriptionConfirmation) error
+	FindValidConfirmation(ctx context.Context, token string) (*model.SubscriptionConfirmation, error)
+	Confirm(ctx context.Context, id uint, at time.Time) error
+	ListConfirmedDigests(ctx context.Context) ([]model.Subscription, error)
+	ClaimDigest(ctx context.Context, d *model.DigestDelivery) (bool, error)
+	ClaimPostDelivery(ctx context.Context, d *model.PostDelivery) (bool, error)
+	ReleaseDigest(ctx context.Context, id uint) error
+	FinishDigest(ctx context.Context, d *model.DigestDelivery, periodEnd time.Time) error
+}
+
+type NotificationStore interface {
+	Create(ctx context.Context, n *model.Notification) error
+	CreateOnce(ctx context.Context, n *model.Notification) (bool, error)
+	List(ctx context.Context, authorID uint, unreadOnly bool, limit, offset int) ([]model.Notification, error)
+	Count(ctx context.Context, authorID uint, unreadOnly bool) (int64, error)
+	MarkRead(ctx context.Context, authorID, id uint, at time.Time) (bool, error)
+	MarkAllRead(ctx context.Context, authorID uint, at time.Time) (int64, error)
+	Preferences(ctx context.Context, authorID uint) (map[model.NotificationType]bool, error)
+	SetPreferences(ctx context.Context, authorID uint, prefs map[model.NotificationType]bool) error
+	Watch(ctx context.Context, authorID, categoryID uint) error
+	Unwatch(ctx context.Context, authorID, categoryID uint) error
+	Watches(ctx context.Context, authorID uint) ([]model.CategoryWatch, error)
+	CategoryWatchers(ctx context.Context, categoryID uint) ([]uint, error)
+}
+
+// EventStore is the write side of the outbox used by the services; the relay reads it through OutboxEventStore.
+type EventStore interface {
+	Append(ctx context.Context, e *model.OutboxEvent) error
+}
+
+// OutboxEventStore is the outbox as the relay sees it: events in order and the offsets of shared consumers.
+type OutboxEventStore interface {
+	EventStore
+	After(ctx context.Context, id uint64, limit int) ([]model.OutboxEvent, error)
+	LastID(ctx context.Context) (uint64, error)
+	ClaimOffset(ctx context.Context, consumer, owner string, start uint64, now time.Time, lease time.Duration) (offset uint64, ok bool, err error)
+	CommitOffset(ctx context.Context, consumer, owner string, lastID uint64) error
+	Offsets(ctx context.Context) ([]model.OutboxOffset, error)
+	Prune(ctx context.Context, cutoff time.Time, maxID uint64) (int64, error)
+}
+
+type OutboxEmailStore interface {
+	Create(ctx context.Context, e *model.OutboxEmail) error
+	GetByID(ctx context.Context, id uint) (*model.OutboxEmail, error)
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.OutboxEmail, error)
+	MarkSent(ctx context.Context, claim *model.OutboxEmail, attempts int, at time.Time) (bool, error)
+	MarkFailed(ctx context.Context, claim *model.OutboxEmail, attempts int, next time.Time, dead bool, lastErr string) (bool, error)
+	Requeue(ctx context.Context, id uint, now time.Time) (bool, error)
+	List(ctx context.Context, status model.OutboxEmailStatus, limit, offset int) ([]model.OutboxEmail, error)
+	Count(ctx context.Context, status model.OutboxEmailStatus) (int64, error)
+}
+
+type WebhookStore interface {
+	Create(ctx context.Context, w *model.Webhook) error
+	GetByID(ctx context.Context, id uint) (*model.Webhook, error)
+	List(ctx context.Context) ([]model.Webhook, error)
+	ListActive(ctx context.Context) ([]model.Webhook, error)
+	Update(ctx context.Context, w *model.Webhook) error
+	Delete(ctx context.Context, id uint) error
+	CreateDeliveries(ctx context.Context, ds []model.WebhookDelivery) error
+	GetDelivery(ctx context.Context, id uint) (*model.WebhookDelivery, error)
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.WebhookDelivery, error)
+	SaveAttempt(ctx context.Context, d *model.WebhookDelivery) error
+	Requeue(ctx context.Context, id uint, now time.Time) (bool, error)
+	ListDeliveries(ctx context.Context, webhookID uint, status model.WebhookDeliveryStatus, limit, offset int) ([]model.WebhookDelivery, error)
+	CountDeliveries(ctx context.Context, webhookID uint, status model.WebhookDeliveryStatus) (int64, error)
+}
+
+// TxRunner runs the repository calls of one function in a transaction; *Transactor is the one on the database.
+type TxRunner interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+var (
+	_ PostStore              = (*PostRepository)(nil)
+	_ MediaStore             = (*MediaRepository)(nil)
+	_ AuthorStore            = (*AuthorRepository)(nil)
+	_ CategoryStore          = (*CategoryRepository)(nil)
+	_ CommentStore           = (*CommentRepository)(nil)
+	_ EmailVerificationStore = (*EmailVerificationRepository)(nil)
+	_ UploadStore            = (*UploadRepository)(nil)
+	_ BlobStore              = (*BlobRepository)(nil)
+	_ StorageStore           = (*StorageRepository)(nil)
+	_ UsageStore             = (*UsageRepository)(nil)
+	_ SubscriptionStore      = (*SubscriptionRepository)(nil)
+	_ NotificationStore      = (*NotificationRepository)(nil)
+	_ EventStore             = (*OutboxEventRepository)(nil)
+	_ OutboxEventStore       = (*OutboxEventRepository)(nil)
+	_ OutboxEmailStore       = (*OutboxEmailRepository)(nil)
+	_ WebhookStore           = (*WebhookRepository)(nil)
+	_ TxRunner               = (*Transactor)(nil)
+)
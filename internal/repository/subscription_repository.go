@@ -0,0 +1,141 @@
+// repository/subscription_repository: Newsletter subscriptions and their double-opt-in tokens.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SubscriptionRepository struct {
+	db *gorm.DB
+}
+
+func NewSubscriptionRepository(db *gorm.DB) *SubscriptionRepository {
+	return &SubscriptionRepository{db: db}
+}
+
+func (r *SubscriptionRepository) Create(ctx context.Context, s *model.Subscription) error {
+	return conn(ctx, r.db).Create(s).Error
+}
+
+func (r *SubscriptionRepository) Update(ctx context.Context, s *model.Subscription) error {
+	return conn(ctx, r.db).Save(s).Error
+}
+
+func (r *SubscriptionRepository) GetByID(ctx context.Context, id uint) (*model.Subscription, error) {
+	var s model.Subscription
+	if err := conn(ctx, r.db).First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Find returns the subscription of email to scope/targetID, or nil when there is none.
+func (r *SubscriptionRepository) Find(ctx context.Context, email string, scope model.SubscriptionScope, targetID uint) (*model.Subscription, error) {
+	var s model.Subscription
+	err := conn(ctx, r.db).Where("email = ? AND scope = ? AND target_id = ?", email, scope, targetID).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListConfirmedForPost returns confirmed instant subscriptions to the whole blog, the category or the author.
+func (r *SubscriptionRepository) ListConfirmedForPost(ctx context.Context, authorID, categoryID uint) ([]model.Subscription, error) {
+	var list []model.Subscription
+	err := conn(ctx, r.db).
+		Where("confirmed_at IS NOT NULL AND frequency = ?", model.FrequencyInstant).
+		Where("scope = ? OR (scope = ? AND target_id = ?) OR (scope = ? AND target_id = ?)",
+			model.SubscriptionBlog, model.SubscriptionCategory, categoryID, model.SubscriptionAuthor, authorID).
+		Order("id").Find(&list).Error
+	return list, err
+}
+
+// Delete removes the subscription, its pending confirmation and digest and new-post history.
+func (r *SubscriptionRepository) Delete(ctx context.Context, id uint) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", id).Delete(&model.SubscriptionConfirmation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subscription_id = ?", id).Delete(&model.DigestDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subscription_id = ?", id).Delete(&model.PostDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Subscription{}, id).Error
+	})
+}
+
+// ReplaceConfirmation stores c as the only confirmation of its subscription, so older links stop working.
+func (r *SubscriptionRepository) ReplaceConfirmation(ctx context.Context, c *model.SubscriptionConfirmation) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", c.SubscriptionID).Delete(&model.SubscriptionConfirmation{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(c).Error
+	})
+}
+
+// FindValidConfirmation returns the unexpired confirmation with token.
+func (r *SubscriptionRepository) FindValidConfirmation(ctx context.Context, token string) (*model.SubscriptionConfirmation, error) {
+	var c model.SubscriptionConfirmation
+	err := conn(ctx, r.db).Where("token = ? AND expires_at > ?", token, time.Now()).First(&c).Error
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Confirm marks the subscription confirmed at and removes its confirmation token.
+func (r *SubscriptionRepository) Confirm(ctx context.Context, id uint, at time.Time) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Subscription{}).Where("id = ?", id).Update("confirmed_at", at).Error; err != nil {
+			return err
+		}
+		return tx.Where("subscription_id = ?", id).Delete(&model.SubscriptionConfirmation{}).Error
+	})
+}
+
+// ListConfirmedDigests returns confirmed daily and weekly subscriptions.
+func (r *SubscriptionRepository) ListConfirmedDigests(ctx context.Context) ([]model.Subscription, error) {
+	var list []model.Subscription
+	err := conn(ctx, r.db).Where("confirmed_at IS NOT NULL AND frequency IN ?",
+		[]model.SubscriptionFrequency{model.FrequencyDaily, model.FrequencyWeekly}).Order("id").Find(&list).Error
+	return list, err
+}
+
+// ClaimDigest inserts d unless a delivery for the same subscription and period exists. Reports whether d was inserted.
+func (r *SubscriptionRepository) ClaimDigest(ctx context.Context, d *model.DigestDelivery) (bool, error) {
+	res := conn(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).Create(d)
+	return res.RowsAffected == 1, res.Error
+}
+
+// ClaimPostDelivery inserts d unless the post was already mailed to the subscription, and reports whether it did.
+func (r *SubscriptionRepository) ClaimPostDelivery(ctx context.Context, d *model.PostDelivery) (bool, error) {
+	res := conn(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).Create(d)
+	return res.RowsAffected == 1, res.Error
+}
+
+// ReleaseDigest deletes a claimed delivery whose email could not be queued, so the next run retries it.
+func (r *SubscriptionRepository) ReleaseDigest(ctx context.Context, id uint) error {
+	return conn(ctx, r.db).Delete(&model.DigestDelivery{}, id).Error
+}
+
+// FinishDigest records the outcome of a claimed delivery and moves the subscription's digest window to periodEnd.
+func (r *SubscriptionRepository) FinishDigest(ctx context.Context, d *model.DigestDelivery, periodEnd time.Time) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(d).Updates(map[string]interface{}{"post_count": d.PostCount, "sent_at": d.SentAt}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Subscription{}).Where("id = ?", d.SubscriptionID).Update("last_digest_at", periodEnd).Error
+	})
+}
@@ -0,0 +1,89 @@
+// repository/tx: Transactions spanning several repositories. The transaction travels in the context, so every
+// repository call made with that context joins it. Work outside the database, such as stored files, registers
+// compensations that run on rollback.
+package repository
+
+import (
+	"context"
+
+	"github.com/aliakbar-zohour/go_blog/internal/database"
+	"gorm.io/gorm"
+)
+
+type txKey struct{}
+
+// txState is the transaction of a context and the functions to run once it commits or rolls back.
+type txState struct {
+	db       *gorm.DB
+	after    []func()
+	rollback []func(ctx context.Context)
+}
+
+// Transactor is the unit of work of the services: the repository calls of one Do commit or roll back together.
+type Transactor struct {
+	db *gorm.DB
+}
+
+func NewTransactor(db *gorm.DB) *Transactor {
+	return &Transactor{db: db}
+}
+
+// Do runs fn in a transaction, committed when fn returns nil and rolled back otherwise. Repository calls made
+// with the ctx passed to fn join the transaction; a nested Do joins the outer one. A nil *Transactor runs fn
+// without a transaction.
+func (t *Transactor) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if t == nil || ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+	state := &txState{}
+	err := t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		state.db = tx
+		return fn(context.WithValue(ctx, txKey{}, state))
+	})
+	if err != nil {
+		// Compensations run even when the request that started the transaction was cancelled.
+		rctx := context.WithoutCancel(ctx)
+		for i := len(state.rollback) - 1; i >= 0; i-- {
+			state.rollback[i](rctx)
+		}
+		return err
+	}
+	for _, f := range state.after {
+		f()
+	}
+	return nil
+}
+
+// AfterCommit runs fn once the transaction of ctx commits; it is dropped on rollback. Without a transaction fn runs now.
+func AfterCommit(ctx context.Context, fn func()) {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		state.after = append(state.after, fn)
+		return
+	}
+	fn()
+}
+
+// OnRollback runs fn with the context outside the transaction, without its cancellation, if the transaction of
+// ctx rolls back, undoing work the database cannot (e.g. removing stored files); compensations run in reverse
+// order. Without a transaction fn is dropped.
+func OnRollback(ctx context.Context, fn func(ctx context.Context)) {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		state.rollback = append(state.rollback, fn)
+	}
+}
+
+// conn returns the transaction of ctx, or db outside of one, bound to ctx.
+func conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.db.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+// read is conn for queries a read replica may serve. Inside a transaction it is the transaction.
+func read(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return conn(ctx, db)
+	}
+	return database.Read(db.WithContext(ctx))
+}
@@ -0,0 +1,92 @@
+// repository/upload_repository: Persist resumable upload state (offset, expiry).
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+type UploadRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadRepository(db *gorm.DB) *UploadRepository {
+	return &UploadRepository{db: db}
+}
+
+func (r *UploadRepository) Create(ctx context.Context, u *model.Upload) error {
+	return conn(ctx, r.db).Create(u).Error
+}
+
+func (r *UploadRepository) GetByID(ctx context.Context, id string) (*model.Upload, error) {
+	var u model.Upload
+	err := conn(ctx, r.db).Where("id = ?", id).First(&u).Error
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *UploadRepository) Update(ctx context.Context, u *model.Upload) error {
+	return conn(ctx, r.db).Save(u).Error
+}
+
+// Claim gives the upload to the request holding token until until, provided it is still at offset and no other
+// request holds an unexpired claim on it. It reports whether the claim was made.
+func (r *UploadRepository) Claim(ctx context.Context, id string, offset int64, token string, until, now time.Time) (bool, error) {
+	res := conn(ctx, r.db).Model(&model.Upload{}).
+		Where(`id = ? AND "offset" = ? AND (claimed_until IS NULL OR claimed_until < ?)`, id, offset, now).
+		Updates(map[string]any{"claim_token": token, "claimed_until": until})
+	return res.RowsAffected == 1, res.Error
+}
+
+// RenewClaim extends the claim of token until until; a claim that was lost stays lost.
+func (r *UploadRepository) RenewClaim(ctx context.Context, id, token string, until time.Time) error {
+	return conn(ctx, r.db).Model(&model.Upload{}).
+		Where("id = ? AND claim_token = ?", id, token).
+		Update("claimed_until", until).Error
+}
+
+// Advance saves the offset, completion and expiry of u, claimed by token at offset from, and ends the claim. It
+// reports false, saving nothing, when the claim was lost.
+func (r *UploadRepository) Advance(ctx context.Context, u *model.Upload, from int64, token string) (bool, error) {
+	res := conn(ctx, r.db).Model(&model.Upload{}).
+		Where(`id = ? AND "offset" = ? AND claim_token = ?`, u.ID, from, token).
+		Updates(map[string]any{
+			"offset":        u.Offset,
+			"completed_at":  u.CompletedAt,
+			"expires_at":    u.ExpiresAt,
+			"claim_token":   "",
+			"claimed_until": nil,
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// ReleaseClaim ends the claim of token without progress.
+func (r *UploadRepository) ReleaseClaim(ctx context.Context, id, token string) error {
+	return conn(ctx, r.db).Model(&model.Upload{}).
+		Where("id = ? AND claim_token = ?", id, token).
+		Updates(map[string]any{"claim_token": "", "claimed_until": nil}).Error
+}
+
+// Delete removes the upload, or returns gorm.ErrRecordNotFound when another request removed it first.
+func (r *UploadRepository) Delete(ctx context.Context, id string) error {
+	res := conn(ctx, r.db).Where("id = ?", id).Delete(&model.Upload{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListExpired returns uploads whose expiry is before now, finished or not, that no request is writing.
+func (r *UploadRepository) ListExpired(ctx context.Context, now time.Time) ([]model.Upload, error) {
+	var list []model.Upload
+	err := conn(ctx, r.db).Where("expires_at < ? AND (claimed_until IS NULL OR claimed_until < ?)", now, now).Find(&list).Error
+	return list, err
+}
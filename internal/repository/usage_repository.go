@@ -0,0 +1,104 @@
+// repository/usage_repository: Per-author upload accounting (bytes and files by media type) and quota checks.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UsageRepository struct {
+	db *gorm.DB
+}
+
+func NewUsageRepository(db *gorm.DB) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// Charge adds one file of bytes and type t to the author's usage and frees reserved bytes of their
+// reservations, unless that takes their stored and reserved bytes over quota (0 = unlimited). It reports
+// whether the charge was made. The check and the increment are one statement on the author's account row, so
+// concurrent uploads cannot both pass it.
+func (r *UsageRepository) Charge(ctx context.Context, authorID uint, t model.MediaType, bytes, reserved, quota int64) (bool, error) {
+	var ok bool
+	err := conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if ok, err = adjustAccount(tx, authorID, bytes, -reserved, quota); err != nil || !ok {
+			return err
+		}
+		return addUsage(tx, authorID, t, bytes, 1)
+	})
+	return ok, err
+}
+
+// Add adjusts the author's usage for a media type without a quota check; negative values release usage.
+func (r *UsageRepository) Add(ctx context.Context, authorID uint, t model.MediaType, bytes, files int64) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if _, err := adjustAccount(tx, authorID, bytes, 0, 0); err != nil {
+			return err
+		}
+		return addUsage(tx, authorID, t, bytes, files)
+	})
+}
+
+// Reserve holds bytes for an upload that has not been stored yet, unless that takes the author's stored and
+// reserved bytes over quota (0 = unlimited), and reports whether it did. Negative bytes free a reservation.
+func (r *UsageRepository) Reserve(ctx context.Context, authorID uint, bytes, quota int64) (bool, error) {
+	return adjustAccount(conn(ctx, r.db), authorID, 0, bytes, quota)
+}
+
+func (r *UsageRepository) ListByAuthor(ctx context.Context, authorID uint) ([]model.StorageUsage, error) {
+	var list []model.StorageUsage
+	err := conn(ctx, r.db).Where("author_id = ?", authorID).Order("type").Find(&list).Error
+	return list, err
+}
+
+// Account returns the author's stored and reserved bytes; zero for an author who never stored anything.
+func (r *UsageRepository) Account(ctx context.Context, authorID uint) (*model.StorageAccount, error) {
+	var a model.StorageAccount
+	err := conn(ctx, r.db).Where("author_id = ?", authorID).First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.StorageAccount{AuthorID: authorID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// adjustAccount adds used and reserved bytes to the author's account when the new total stays within quota
+// (0 = unlimited). A missing account is created; ON CONFLICT locks an existing one, so the WHERE sees the
+// latest committed total.
+func adjustAccount(db *gorm.DB, authorID uint, used, reserved, quota int64) (bool, error) {
+	if quota > 0 && used+reserved > quota {
+		return false, nil
+	}
+	res := db.Exec(`INSERT INTO storage_accounts (author_id, used_bytes, reserved_bytes, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (author_id) DO UPDATE SET
+			used_bytes = storage_accounts.used_bytes + excluded.used_bytes,
+			reserved_bytes = storage_accounts.reserved_bytes + excluded.reserved_bytes,
+			updated_at = excluded.updated_at
+		WHERE CAST(? AS bigint) <= 0 OR excluded.used_bytes + excluded.reserved_bytes <= 0
+			OR storage_accounts.used_bytes + storage_accounts.reserved_bytes + excluded.used_bytes + excluded.reserved_bytes <= ?`,
+		authorID, used, reserved, quota, quota)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func addUsage(db *gorm.DB, authorID uint, t model.MediaType, bytes, files int64) error {
+	u := &model.StorageUsage{AuthorID: authorID, Type: t, Bytes: bytes, Files: files}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "author_id"}, {Name: "type"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"bytes":      gorm.Expr("storage_usages.bytes + ?", bytes),
+			"files":      gorm.Expr("storage_usages.files + ?", files),
+			"updated_at": gorm.Expr("CURRENT_TIMESTAMP"),
+		}),
+	}).Create(u).Error
+}
@@ -0,0 +1,150 @@
+// repository/webhook_repository: Webhook subscriptions and their delivery log: enqueue, claim due deliveries and record outcomes.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, w *model.Webhook) error {
+	return conn(ctx, r.db).Create(w).Error
+}
+
+func (r *WebhookRepository) GetByID(ctx context.Context, id uint) (*model.Webhook, error) {
+	var w model.Webhook
+	if err := conn(ctx, r.db).First(&w, id).Error; err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r *WebhookRepository) List(ctx context.Context) ([]model.Webhook, error) {
+	var items []model.Webhook
+	err := conn(ctx, r.db).Order("id").Find(&items).Error
+	return items, err
+}
+
+// ListActive returns the webhooks that receive events.
+func (r *WebhookRepository) ListActive(ctx context.Context) ([]model.Webhook, error) {
+	var items []model.Webhook
+	err := conn(ctx, r.db).Where("active = ?", true).Order("id").Find(&items).Error
+	return items, err
+}
+
+func (r *WebhookRepository) Update(ctx context.Context, w *model.Webhook) error {
+	return conn(ctx, r.db).Save(w).Error
+}
+
+// Delete removes the webhook and its delivery log.
+func (r *WebhookRepository) Delete(ctx context.Context, id uint) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", id).Delete(&model.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Webhook{}, id).Error
+	})
+}
+
+// CreateDeliveries stores deliveries in one batch, skipping those whose webhook already has the event.
+func (r *WebhookRepository) CreateDeliveries(ctx context.Context, ds []model.WebhookDelivery) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	return conn(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).Create(&ds).Error
+}
+
+func (r *WebhookRepository) GetDelivery(ctx context.Context, id uint) (*model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	if err := conn(ctx, r.db).First(&d, id).Error; err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ClaimDue marks the oldest due delivery as sending until now+lease and returns it, or nil when none is due.
+// Deliveries whose lease expired are due again; see OutboxEmailRepository.ClaimDue for why the claim is safe.
+func (r *WebhookRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.WebhookDelivery, error) {
+	db := conn(ctx, r.db)
+	due := func(q *gorm.DB) *gorm.DB {
+		return q.Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_until < ?)",
+			model.WebhookDeliveryPending, now, model.WebhookDeliverySending, now)
+	}
+	for i := 0; i < 3; i++ {
+		var d model.WebhookDelivery
+		err := due(db.Model(&model.WebhookDelivery{})).Order("next_attempt_at, id").Limit(1).Take(&d).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		until := now.Add(lease)
+		res := due(db.Model(&model.WebhookDelivery{}).Where("id = ?", d.ID)).
+			Updates(map[string]interface{}{"status": model.WebhookDeliverySending, "locked_until": until})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			d.Status, d.LockedUntil = model.WebhookDeliverySending, &until
+			return &d, nil
+		}
+	}
+	return nil, nil
+}
+
+// SaveAttempt records the outcome of an attempt stored in d: status, attempts, response, error and next attempt.
+func (r *WebhookRepository) SaveAttempt(ctx context.Context, d *model.WebhookDelivery) error {
+	return conn(ctx, r.db).Model(&model.WebhookDelivery{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+		"status":          d.Status,
+		"attempts":        d.Attempts,
+		"next_attempt_at": d.NextAttemptAt,
+		"locked_until":    nil,
+		"response_status": d.ResponseStatus,
+		"response_body":   d.ResponseBody,
+		"duration_ms":     d.DurationMs,
+		"last_error":      d.LastError,
+		"delivered_at":    d.DeliveredAt,
+	}).Error
+}
+
+// Requeue makes a dead delivery pending again with a fresh attempt budget. Returns false when it is not dead.
+func (r *WebhookRepository) Requeue(ctx context.Context, id uint, now time.Time) (bool, error) {
+	res := conn(ctx, r.db).Model(&model.WebhookDelivery{}).Where("id = ? AND status = ?", id, model.WebhookDeliveryDead).
+		Updates(map[string]interface{}{"status": model.WebhookDeliveryPending, "attempts": 0, "next_attempt_at": now})
+	return res.RowsAffected == 1, res.Error
+}
+
+// ListDeliveries returns the deliveries of a webhook, newest first, optionally filtered by status.
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, webhookID uint, status model.WebhookDeliveryStatus, limit, offset int) ([]model.WebhookDelivery, error) {
+	var items []model.WebhookDelivery
+	q := conn(ctx, r.db).Where("webhook_id = ?", webhookID).Order("id DESC").Limit(limit).Offset(offset)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	err := q.Find(&items).Error
+	return items, err
+}
+
+// CountDeliveries returns the number of deliveries of a webhook, optionally filtered by status.
+func (r *WebhookRepository) CountDeliveries(ctx context.Context, webhookID uint, status model.WebhookDeliveryStatus) (int64, error) {
+	var n int64
+	q := conn(ctx, r.db).Model(&model.WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	err := q.Count(&n).Error
+	return n, err
+}
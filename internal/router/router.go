@@ -7,21 +7,28 @@ import (
 
 	"github.com/aliakbar-zohour/go_blog/internal/config"
 	"github.com/aliakbar-zohour/go_blog/internal/handler"
+	"github.com/aliakbar-zohour/go_blog/internal/mailqueue"
 	"github.com/aliakbar-zohour/go_blog/internal/middleware"
+	"github.com/aliakbar-zohour/go_blog/internal/pubsub"
 	"github.com/aliakbar-zohour/go_blog/internal/service"
+	"github.com/aliakbar-zohour/go_blog/internal/webhook"
 	"github.com/go-chi/chi/v5"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"gorm.io/gorm"
 )
 
-func New(db *gorm.DB, postSvc *service.PostService, authorSvc *service.AuthorService, categorySvc *service.CategoryService, commentSvc *service.CommentService, authSvc *service.AuthService, cfg *config.Config) http.Handler {
+func New(db *gorm.DB, postSvc *service.PostService, authorSvc *service.AuthorService, categorySvc *service.CategoryService, commentSvc *service.CommentService, authSvc *service.AuthService, uploadSvc *service.UploadService, mediaSvc *service.MediaService, mediaURLSvc *service.MediaURLService, newsletterSvc *service.NewsletterService, notificationSvc *service.NotificationService, mailQueue *mailqueue.Queue, webhooks *webhook.Dispatcher, events *pubsub.Hub, cfg *config.Config) http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.Recover, middleware.SecureHeaders, middleware.CORS(cfg.CORSOrigins), middleware.Gzip, middleware.RequestID, middleware.Log)
-	r.Get("/health", handler.NewHealthHandler(db).Health)
+	health := handler.NewHealthHandler(db)
+	r.Get("/health", health.Health)
 	r.Get("/docs/*", httpSwagger.WrapHandler)
-	r.Handle("/uploads/*", http.StripPrefix("/uploads/", http.FileServer(http.Dir(cfg.UploadDir))))
+	r.Handle("/uploads/*", handler.NewFileHandler(mediaURLSvc, cfg.UploadDir))
 	r.Route("/api", func(r chi.Router) {
 		r.Use(middleware.MaxBytes(cfg.BodyLimitBytes))
+		if len(cfg.DBReplicas) > 0 {
+			r.Use(middleware.NewStickyPrimary(cfg.DBReplicaSticky).Middleware)
+		}
 		authRateLimit := middleware.NewRateLimit(cfg.AuthRatePerMin, time.Minute)
 		r.Route("/auth", func(r chi.Router) {
 			r.Use(authRateLimit.Middleware)
@@ -31,18 +38,47 @@ func New(db *gorm.DB, postSvc *service.PostService, authorSvc *service.AuthorSer
 			r.Post("/login", authH.Login)
 		})
 		authMW := middleware.RequireAuth(cfg.JWTSecret)
+		optionalAuthMW := middleware.OptionalAuth(cfg.JWTSecret)
+		r.Route("/subscriptions", func(r chi.Router) {
+			sh := handler.NewSubscriptionHandler(newsletterSvc)
+			r.With(authRateLimit.Middleware).Post("/", sh.Subscribe)
+			r.Get("/confirm", sh.Confirm)
+			r.Get("/{id}/unsubscribe", sh.Get)
+			r.Post("/{id}/unsubscribe", sh.Unsubscribe)
+		})
 		r.Route("/posts", func(r chi.Router) {
 			ph := handler.NewPostHandler(postSvc, cfg)
-			r.Get("/", ph.List)
+			r.With(optionalAuthMW).Get("/", ph.List)
 			r.Route("/{postId}/comments", func(r chi.Router) {
 				ch := handler.NewCommentHandler(commentSvc)
 				r.Get("/", ch.ListByPostID)
 				r.With(authMW).Post("/", ch.Create)
 			})
-			r.Get("/{id}", ph.GetByID)
+			r.With(optionalAuthMW).Get("/{id}", ph.GetByID)
+			eh := handler.NewEventHandler(events, postSvc, cfg.SSEHeartbeat)
+			r.Get("/events", eh.Posts)
+			r.Get("/{id}/events", eh.Post)
 			r.With(authMW).Post("/", ph.Create)
 			r.With(authMW).Put("/{id}", ph.Update)
 			r.With(authMW).Delete("/{id}", ph.Delete)
+			r.With(authMW).Post("/{id}/media", ph.AttachMedia)
+			r.With(authMW).Delete("/{id}/media/{mediaId}", ph.DetachMedia)
+		})
+		r.Route("/media", func(r chi.Router) {
+			r.Use(authMW)
+			mh := handler.NewMediaHandler(mediaSvc, cfg)
+			r.Post("/", mh.Upload)
+			r.Get("/", mh.List)
+			r.Get("/{id}", mh.GetByID)
+			r.Delete("/{id}", mh.Delete)
+		})
+		r.Route("/uploads", func(r chi.Router) {
+			th := handler.NewTusHandler(uploadSvc, "/api/uploads")
+			r.Options("/", th.Options)
+			r.With(authMW).Post("/", th.Create)
+			r.With(authMW).Head("/{id}", th.Head)
+			r.With(authMW).Patch("/{id}", th.Patch)
+			r.With(authMW).Delete("/{id}", th.Delete)
 		})
 		r.Route("/authors", func(r chi.Router) {
 			ah := handler.NewAuthorHandler(authorSvc, cfg)
@@ -51,6 +87,7 @@ func New(db *gorm.DB, postSvc *service.PostService, authorSvc *service.AuthorSer
 			r.Get("/{id}", ah.GetByID)
 			r.With(authMW).Put("/{id}", ah.Update)
 			r.With(authMW).Delete("/{id}", ah.Delete)
+			r.With(authMW).Get("/{id}/usage", ah.Usage)
 		})
 		r.Route("/categories", func(r chi.Router) {
 			ch := handler.NewCategoryHandler(categorySvc)
@@ -59,12 +96,45 @@ func New(db *gorm.DB, postSvc *service.PostService, authorSvc *service.AuthorSer
 			r.Get("/{id}", ch.GetByID)
 			r.With(authMW).Put("/{id}", ch.Update)
 			r.With(authMW).Delete("/{id}", ch.Delete)
+			nh := handler.NewNotificationHandler(notificationSvc)
+			r.With(authMW).Put("/{id}/watch", nh.WatchCategory)
+			r.With(authMW).Delete("/{id}/watch", nh.UnwatchCategory)
 		})
 		r.Route("/comments", func(r chi.Router) {
 			ch := handler.NewCommentHandler(commentSvc)
 			r.With(authMW).Put("/{id}", ch.Update)
 			r.With(authMW).Delete("/{id}", ch.Delete)
 		})
+		r.Route("/notifications", func(r chi.Router) {
+			r.Use(authMW)
+			nh := handler.NewNotificationHandler(notificationSvc)
+			r.Get("/", nh.List)
+			r.Get("/unread-count", nh.UnreadCount)
+			r.Post("/read-all", nh.MarkAllRead)
+			r.Post("/{id}/read", nh.MarkRead)
+			r.Get("/watches", nh.Watches)
+			r.Get("/preferences", nh.GetPreferences)
+			r.Put("/preferences", nh.UpdatePreferences)
+		})
+		r.With(authMW).Get("/ws", handler.NewWebSocketHandler(events, postSvc, cfg.CORSOrigins).Connect)
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(authMW, middleware.RequireAdmin(cfg.AdminAuthorIDs))
+			eh := handler.NewAdminEmailHandler(mailQueue)
+			r.Get("/emails", eh.List)
+			r.Get("/emails/{id}", eh.GetByID)
+			r.Post("/emails/{id}/resend", eh.Resend)
+			wh := handler.NewAdminWebhookHandler(webhooks)
+			r.Get("/webhooks", wh.List)
+			r.Post("/webhooks", wh.Create)
+			r.Get("/webhooks/{id}", wh.GetByID)
+			r.Put("/webhooks/{id}", wh.Update)
+			r.Delete("/webhooks/{id}", wh.Delete)
+			r.Post("/webhooks/{id}/test", wh.SendTest)
+			r.Get("/webhooks/{id}/deliveries", wh.Deliveries)
+			r.Post("/webhooks/{id}/deliveries/{deliveryID}/redeliver", wh.Redeliver)
+			r.Get("/database", health.Database)
+			r.Put("/authors/{id}/quota", handler.NewAuthorHandler(authorSvc, cfg).SetQuota)
+		})
 	})
 	return r
 }
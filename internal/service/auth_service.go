@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/rand"
 	"errors"
+	"fmt"
 	"log"
 	"math/big"
 	"strings"
@@ -21,14 +22,23 @@ import (
 const codeLength = 6
 const codeExpiryMinutes = 15
 
+// ErrEmailNotSent is returned when the verification email could not be handed to the mail transport.
+var ErrEmailNotSent = errors.New("could not send verification email")
+
 type AuthService struct {
-	authorRepo   *repository.AuthorRepository
-	evRepo       *repository.EmailVerificationRepository
-	cfg          *config.Config
+	authorRepo repository.AuthorStore
+	evRepo     repository.EmailVerificationStore
+	mailer     mail.Mailer
+	templates  *mail.Templates
+	tx         repository.TxRunner
+	outbox     repository.EventStore
+	cfg        *config.Config
 }
 
-func NewAuthService(authorRepo *repository.AuthorRepository, evRepo *repository.EmailVerificationRepository, cfg *config.Config) *AuthService {
-	return &AuthService{authorRepo: authorRepo, evRepo: evRepo, cfg: cfg}
+// NewAuthService returns an AuthService. Registrations run in transactions of tx and record author.registered
+// in outbox; outbox may be nil to record no events.
+func NewAuthService(authorRepo repository.AuthorStore, evRepo repository.EmailVerificationStore, mailer mail.Mailer, templates *mail.Templates, tx repository.TxRunner, outbox repository.EventStore, cfg *config.Config) *AuthService {
+	return &AuthService{authorRepo: authorRepo, evRepo: evRepo, mailer: mailer, templates: templates, tx: tx, outbox: outbox, cfg: cfg}
 }
 
 func isValidEmailFormat(s string) bool {
@@ -53,8 +63,10 @@ func isValidEmailFormat(s string) bool {
 	return false
 }
 
-// RequestVerification sends a 6-digit code to the email. Returns the code when SMTP is not configured (for dev/testing so you can use it in Swagger).
-func (s *AuthService) RequestVerification(ctx context.Context, email string) (devCode string, err error) {
+// RequestVerification sends a 6-digit code to the email in the given locale (e.g. "fa", "en-US"; empty uses the default).
+// Returns the code when mail is not delivered over SMTP (for dev/testing so you can use it in Swagger).
+// A failed send is reported as ErrEmailNotSent.
+func (s *AuthService) RequestVerification(ctx context.Context, email, locale string) (devCode string, err error) {
 	email = normalizeEmail(email)
 	if email == "" {
 		return "", errors.New("email is required")
@@ -62,6 +74,7 @@ func (s *AuthService) RequestVerification(ctx context.Context, email string) (de
 	if !isValidEmailFormat(email) {
 		return "", errors.New("invalid email format")
 	}
+	locale = mail.NormalizeLocale(locale)
 	code, err := generateCode(codeLength)
 	if err != nil {
 		return "", err
@@ -70,16 +83,25 @@ func (s *AuthService) RequestVerification(ctx context.Context, email string) (de
 	ev := &model.EmailVerification{
 		Email:     email,
 		Code:      code,
+		Locale:    locale,
 		ExpiresAt: time.Now().Add(codeExpiryMinutes * time.Minute),
 	}
 	if err := s.evRepo.Create(ctx, ev); err != nil {
 		return "", err
 	}
-	if s.cfg.SMTPHost == "" {
-		log.Printf("[auth] SMTP not configured; verification code for %s: %s", email, code)
+	msg, err := s.templates.Message("verification", locale, mail.VerificationData{AppName: appName, Code: code, ExpiresMinutes: codeExpiryMinutes})
+	if err != nil {
+		return "", err
+	}
+	msg.From, msg.To = s.cfg.SMTPFrom, []string{email}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Printf("[auth] send verification email to %s: %v", email, err)
+		return "", fmt.Errorf("%w: %v", ErrEmailNotSent, err)
+	}
+	if s.cfg.MailDriver != mail.DriverSMTP {
+		log.Printf("[auth] mail driver %q; verification code for %s: %s", s.cfg.MailDriver, email, code)
 		return code, nil
 	}
-	_ = mail.SendVerificationCode(email, code, s.cfg.SMTPHost, s.cfg.SMTPPort, s.cfg.SMTPUser, s.cfg.SMTPPass, s.cfg.SMTPFrom)
 	return "", nil
 }
 
@@ -96,7 +118,7 @@ func (s *AuthService) VerifyAndRegister(ctx context.Context, email, code, name,
 	if len(password) < 8 {
 		return nil, "", errors.New("password must be at least 8 characters")
 	}
-	_, err := s.evRepo.FindValid(ctx, email, code)
+	ev, err := s.evRepo.FindValid(ctx, email, code)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, "", errors.New("invalid or expired code")
@@ -118,8 +140,15 @@ func (s *AuthService) VerifyAndRegister(ctx context.Context, email, code, name,
 		Email:           &email,
 		PasswordHash:    hash,
 		EmailVerifiedAt: &now,
+		Locale:          ev.Locale,
 	}
-	if err := s.authorRepo.Create(ctx, a); err != nil {
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.authorRepo.Create(ctx, a); err != nil {
+			return err
+		}
+		return record(ctx, s.outbox, "", EventAuthorRegistered, registeredEvent{ID: a.ID, Name: a.Name, CreatedAt: a.CreatedAt})
+	})
+	if err != nil {
 		return nil, "", err
 	}
 	token, err := auth.NewToken(a.ID, s.cfg.JWTSecret, s.cfg.JWTExpiryHours)
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/mail"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+)
+
+func TestAuthService_RequestVerification_SendsThroughMailer(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{MailDriver: mail.DriverSMTP, SMTPFrom: "noreply@example.com"}
+	mailer := mail.NewMemoryMailer()
+	svc := NewAuthService(repository.NewAuthorRepository(db), repository.NewEmailVerificationRepository(db), mailer, mail.NewTemplates("", mail.DefaultLocale), repository.NewTransactor(db), nil, cfg)
+	ctx := context.Background()
+
+	devCode, err := svc.RequestVerification(ctx, "Writer@Example.com", "")
+	if err != nil {
+		t.Fatalf("RequestVerification: %v", err)
+	}
+	if devCode != "" {
+		t.Errorf("smtp driver must not expose the code, got %q", devCode)
+	}
+	msgs := mailer.Messages()
+	if len(msgs) != 1 || msgs[0].To[0] != "writer@example.com" || msgs[0].From != cfg.SMTPFrom {
+		t.Fatalf("unexpected messages: %+v", msgs)
+	}
+
+	mailer.Err = errors.New("connection refused")
+	if _, err := svc.RequestVerification(ctx, "writer@example.com", ""); !errors.Is(err, ErrEmailNotSent) {
+		t.Errorf("want ErrEmailNotSent, got %v", err)
+	}
+
+	mailer.Err = nil
+	cfg.MailDriver = mail.DriverMemory
+	devCode, err = svc.RequestVerification(ctx, "writer@example.com", "fa-IR")
+	if err != nil || len(devCode) != codeLength {
+		t.Fatalf("dev code: %q, %v", devCode, err)
+	}
+	last := mailer.Messages()[1]
+	if !strings.Contains(last.HTML, devCode) || !strings.Contains(last.Text, devCode) {
+		t.Errorf("email does not contain the code %s", devCode)
+	}
+	if last.Locale != "fa" {
+		t.Errorf("want fa template for fa-IR, got %q", last.Locale)
+	}
+}
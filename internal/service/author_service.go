@@ -15,28 +15,40 @@ import (
 )
 
 type AuthorService struct {
-	repo *repository.AuthorRepository
-	cfg  *config.Config
+	repo     repository.AuthorStore
+	blobRepo repository.BlobStore
+	usage    *UsageService
+	tx       repository.TxRunner
+	cfg      *config.Config
 }
 
-func NewAuthorService(repo *repository.AuthorRepository, cfg *config.Config) *AuthorService {
-	return &AuthorService{repo: repo, cfg: cfg}
+// NewAuthorService returns an AuthorService. Avatar changes run in transactions of tx.
+func NewAuthorService(repo repository.AuthorStore, blobRepo repository.BlobStore, usage *UsageService, tx repository.TxRunner, cfg *config.Config) *AuthorService {
+	return &AuthorService{repo: repo, blobRepo: blobRepo, usage: usage, tx: tx, cfg: cfg}
 }
 
+// Create adds an author. An avatar is charged to the new author's quota in the same transaction; if it does not
+// fit, nothing is created and ErrQuotaExceeded is returned.
 func (s *AuthorService) Create(ctx context.Context, name string, avatar *multipart.FileHeader) (*model.Author, error) {
 	name = strings.TrimSpace(name)
 	if name == "" {
 		return nil, errors.New("name is required")
 	}
 	a := &model.Author{Name: name}
-	if avatar != nil {
-		maxBytes := int64(s.cfg.MaxFileMB * 1024 * 1024)
-		path, err := upload.SaveSingleImage(avatar, s.cfg.UploadDir, "avatars", maxBytes)
-		if err == nil {
-			a.AvatarPath = path
+	b := s.storeAvatar(avatar)
+	err := s.doWithAvatar(ctx, b, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, a); err != nil {
+			return err
 		}
-	}
-	if err := s.repo.Create(ctx, a); err != nil {
+		if b == nil {
+			return nil
+		}
+		if err := s.setAvatar(ctx, a, b); err != nil {
+			return err
+		}
+		return s.repo.Update(ctx, a)
+	})
+	if err != nil {
 		return nil, err
 	}
 	return s.repo.GetByID(ctx, a.ID)
@@ -61,19 +73,111 @@ func (s *AuthorService) Update(ctx context.Context, id uint, name string, avatar
 	if name != "" {
 		a.Name = strings.TrimSpace(name)
 	}
+	var b *upload.Blob
 	if avatar != nil {
-		maxBytes := int64(s.cfg.MaxFileMB * 1024 * 1024)
-		path, err := upload.SaveSingleImage(avatar, s.cfg.UploadDir, "avatars", maxBytes)
-		if err == nil {
-			a.AvatarPath = path
+		if err := s.usage.Check(ctx, a.ID, avatar.Size); err != nil {
+			return nil, err
+		}
+		if b = s.storeAvatar(avatar); b != nil && b.Path == a.AvatarPath {
+			b = nil
 		}
 	}
-	if err := s.repo.Update(ctx, a); err != nil {
+	err = s.doWithAvatar(ctx, b, func(ctx context.Context) error {
+		oldAvatar := a.AvatarPath
+		if b != nil {
+			if err := s.setAvatar(ctx, a, b); err != nil {
+				return err
+			}
+		}
+		if err := s.repo.Update(ctx, a); err != nil {
+			return err
+		}
+		if b == nil || oldAvatar == "" {
+			return nil
+		}
+		if err := s.blobRepo.Release(ctx, oldAvatar); err != nil {
+			return err
+		}
+		return s.usage.Release(ctx, a.ID, model.MediaTypeImage, upload.Size(s.cfg.UploadDir, oldAvatar))
+	})
+	if err != nil {
 		return nil, err
 	}
 	return s.repo.GetByID(ctx, id)
 }
 
+// storeAvatar stores an uploaded avatar; nil when there is none or it is not an image that can be stored.
+func (s *AuthorService) storeAvatar(avatar *multipart.FileHeader) *upload.Blob {
+	if avatar == nil {
+		return nil
+	}
+	maxBytes := int64(s.cfg.MaxFileMB * 1024 * 1024)
+	b, err := upload.SaveSingleImage(avatar, s.cfg.UploadDir, maxBytes)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// setAvatar charges a stored avatar to the author's quota and sets it on the author (not saved). Call it in the
+// transaction of the change.
+func (s *AuthorService) setAvatar(ctx context.Context, a *model.Author, b *upload.Blob) error {
+	if err := s.blobRepo.Acquire(ctx, b.Hash, b.Path, b.Size); err != nil {
+		return err
+	}
+	if err := s.usage.Record(ctx, a.ID, model.MediaTypeImage, b.Size); err != nil {
+		return err
+	}
+	a.AvatarPath = b.Path
+	a.AvatarBlurHash, a.AvatarColor = b.BlurHash, b.DominantColor
+	return nil
+}
+
+// doWithAvatar runs fn in a transaction and removes the newly stored avatar b (may be nil) if it fails, or if
+// an outer transaction it joined rolls back later.
+func (s *AuthorService) doWithAvatar(ctx context.Context, b *upload.Blob, fn func(ctx context.Context) error) error {
+	err := s.tx.Do(ctx, func(ctx context.Context) error {
+		repository.OnRollback(ctx, func(ctx context.Context) {
+			discardBlobs(ctx, s.blobRepo, s.cfg.UploadDir, b)
+		})
+		return fn(ctx)
+	})
+	if err != nil {
+		discardBlobs(ctx, s.blobRepo, s.cfg.UploadDir, b)
+	}
+	return err
+}
+
+// Usage returns the author's storage quota and usage by media type; nil when the author does not exist.
+func (s *AuthorService) Usage(ctx context.Context, id uint) (*UsageReport, error) {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return s.usage.Report(ctx, id)
+}
+
+// SetQuota sets the author's storage quota override in bytes (0 = unlimited, nil = the configured default) and
+// returns their usage; nil when the author does not exist.
+func (s *AuthorService) SetQuota(ctx context.Context, id uint, quota *int64) (*UsageReport, error) {
+	return s.usage.SetQuota(ctx, id, quota)
+}
+
+// Delete removes the author and releases the avatar blob.
 func (s *AuthorService) Delete(ctx context.Context, id uint) error {
-	return s.repo.Delete(ctx, id)
+	a, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.blobRepo.Release(ctx, a.AvatarPath)
+	})
 }
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"github.com/aliakbar-zohour/go_blog/internal/upload"
+)
+
+func TestAuthorService_AvatarIsChargedInTheTransaction(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{UploadDir: t.TempDir(), MaxFileMB: 4, QuotaMB: 1}
+	authorRepo, blobRepo := repository.NewAuthorRepository(db), repository.NewBlobRepository(db)
+	usage := NewUsageService(repository.NewUsageRepository(db), authorRepo, cfg)
+	svc := NewAuthorService(authorRepo, blobRepo, usage, repository.NewTransactor(db), cfg)
+	ctx := context.Background()
+
+	// An avatar over the quota creates no author and leaves no file behind.
+	big := fileHeader(t, "big.png", strings.Repeat("x", 1024*1024))
+	if _, err := svc.Create(ctx, "Big", big); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Create over quota: want ErrQuotaExceeded, got %v", err)
+	}
+	if list, _ := svc.List(ctx); len(list) != 0 {
+		t.Errorf("authors after a refused create: %+v", list)
+	}
+	if files := filesUnder(t, cfg.UploadDir); len(files) != 0 {
+		t.Errorf("files after a refused create: %v", files)
+	}
+
+	a, err := svc.Create(ctx, "Jane", fileHeader(t, "a.png", "first"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	first := a.AvatarPath
+	if a, err = svc.Update(ctx, a.ID, "", fileHeader(t, "b.png", "second")); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if a.AvatarPath == first {
+		t.Fatalf("avatar not replaced: %q", a.AvatarPath)
+	}
+	rep, err := usage.Report(ctx, a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := upload.Size(cfg.UploadDir, a.AvatarPath); rep.Files != 1 || rep.UsedBytes != want {
+		t.Errorf("usage after replacing the avatar: %+v, want 1 file of %d bytes", rep, want)
+	}
+	if b, err := blobRepo.GetByPath(ctx, first); err != nil || b.RefCount != 0 {
+		t.Errorf("old avatar blob: %+v (%v), want released", b, err)
+	}
+}
+
+// filesUnder lists the files under dir.
+func filesUnder(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
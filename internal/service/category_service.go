@@ -12,10 +12,10 @@ import (
 )
 
 type CategoryService struct {
-	repo *repository.CategoryRepository
+	repo repository.CategoryStore
 }
 
-func NewCategoryService(repo *repository.CategoryRepository) *CategoryService {
+func NewCategoryService(repo repository.CategoryStore) *CategoryService {
 	return &CategoryService{repo: repo}
 }
 
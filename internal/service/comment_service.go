@@ -14,20 +14,27 @@ import (
 var (
 	ErrCommentForbidden = errors.New("you can only edit your own comment")
 	ErrDeleteCommentForbidden = errors.New("you can only delete your own comment")
+	ErrParentCommentNotFound = errors.New("parent comment not found on this post")
 )
 
 type CommentService struct {
-	repo     *repository.CommentRepository
-	postRepo *repository.PostRepository
+	repo     repository.CommentStore
+	postRepo repository.PostStore
+	tx       repository.TxRunner
+	outbox   repository.EventStore
 }
 
-func NewCommentService(repo *repository.CommentRepository, postRepo *repository.PostRepository) *CommentService {
-	return &CommentService{repo: repo, postRepo: postRepo}
+// NewCommentService returns a CommentService. Changes run in transactions of tx and record their events in
+// outbox, which notify the authors concerned; outbox may be nil to record no events.
+func NewCommentService(repo repository.CommentStore, postRepo repository.PostStore, tx repository.TxRunner, outbox repository.EventStore) *CommentService {
+	return &CommentService{repo: repo, postRepo: postRepo, tx: tx, outbox: outbox}
 }
 
 const maxCommentBodyLen = 2000
 
-func (s *CommentService) Create(ctx context.Context, postID uint, body, authorName string, authorID *uint) (*model.Comment, error) {
+// Create adds a comment to postID, as a reply when parentID is set. Its comment.created event notifies the
+// post's author, the author of the parent comment and mentioned authors. Returns nil when the post does not exist.
+func (s *CommentService) Create(ctx context.Context, postID uint, parentID *uint, body, authorName string, authorID *uint) (*model.Comment, error) {
 	body = strings.TrimSpace(body)
 	if body == "" {
 		return nil, errors.New("body is required")
@@ -41,11 +48,31 @@ func (s *CommentService) Create(ctx context.Context, postID uint, body, authorNa
 		}
 		return nil, err
 	}
+	var parent *model.Comment
+	if parentID != nil && *parentID > 0 {
+		var err error
+		parent, err = s.repo.GetByID(ctx, *parentID)
+		if err != nil || parent.PostID != postID {
+			return nil, ErrParentCommentNotFound
+		}
+	}
 	c := &model.Comment{PostID: postID, Body: body, AuthorID: authorID, AuthorName: strings.TrimSpace(authorName)}
-	if err := s.repo.Create(ctx, c); err != nil {
+	if parent != nil {
+		c.ParentID = &parent.ID
+	}
+	var created *model.Comment
+	err := s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, c); err != nil {
+			return err
+		}
+		var err error
+		created, err = s.changed(ctx, c.ID, EventCommentCreated)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
-	return s.repo.GetByID(ctx, c.ID)
+	return created, nil
 }
 
 func (s *CommentService) ListByPostID(ctx context.Context, postID uint) ([]model.Comment, error) {
@@ -74,10 +101,32 @@ func (s *CommentService) Update(ctx context.Context, id uint, body string, autho
 		}
 		c.Body = b
 	}
-	if err := s.repo.Update(ctx, c); err != nil {
+	var updated *model.Comment
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Update(ctx, c); err != nil {
+			return err
+		}
+		var err error
+		updated, err = s.changed(ctx, id, EventCommentUpdated)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
-	return s.repo.GetByID(ctx, id)
+	return updated, nil
+}
+
+// changed reloads a created or updated comment and records the event on its post's topic. Call it in the
+// transaction of the change.
+func (s *CommentService) changed(ctx context.Context, id uint, typ string) (*model.Comment, error) {
+	c, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := record(ctx, s.outbox, PostTopic(c.PostID), typ, c); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 func (s *CommentService) Delete(ctx context.Context, id uint, authorID uint) error {
@@ -91,5 +140,10 @@ func (s *CommentService) Delete(ctx context.Context, id uint, authorID uint) err
 	if c.AuthorID == nil || *c.AuthorID != authorID {
 		return ErrDeleteCommentForbidden
 	}
-	return s.repo.Delete(ctx, id)
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return record(ctx, s.outbox, PostTopic(c.PostID), EventCommentDeleted, deletedEvent{ID: id, PostID: c.PostID})
+	})
 }
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/mail"
+	"github.com/aliakbar-zohour/go_blog/internal/memrepo"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"gorm.io/gorm"
+)
+
+// Runs on the in-memory repositories, so it needs neither a database nor cgo.
+func TestCommentService_InMemory(t *testing.T) {
+	db := memrepo.New()
+	posts, authors, notificationRepo := memrepo.NewPostRepository(db), memrepo.NewAuthorRepository(db), memrepo.NewNotificationRepository(db)
+	events := memrepo.NewEventRepository(db)
+	commentRepo := memrepo.NewCommentRepository(db)
+	notifications := NewNotificationService(notificationRepo, authors, memrepo.NewCategoryRepository(db), posts, commentRepo, mail.NewMemoryMailer(), mail.NewTemplates("", mail.DefaultLocale), memrepo.NewTransactor(), events, &config.Config{})
+	comments := NewCommentService(commentRepo, posts, memrepo.NewTransactor(), events)
+	ctx := context.Background()
+	alice, bob := &model.Author{Name: "Alice"}, &model.Author{Name: "Bob"}
+	_ = authors.Create(ctx, alice)
+	_ = authors.Create(ctx, bob)
+	post := &model.Post{Title: "Lisbon", AuthorID: alice.ID}
+	_ = posts.Create(ctx, post)
+
+	top, err := comments.Create(ctx, post.ID, nil, "Lovely photos", "", &bob.ID)
+	if err != nil || top == nil {
+		t.Fatalf("Create: %+v, %v", top, err)
+	}
+	reply, err := comments.Create(ctx, post.ID, &top.ID, "Thanks!", "", &alice.ID)
+	if err != nil || reply.ParentID == nil || *reply.ParentID != top.ID {
+		t.Fatalf("reply: %+v, %v", reply, err)
+	}
+	if list, _ := comments.ListByPostID(ctx, post.ID); len(list) != 2 || list[0].ID != top.ID {
+		t.Fatalf("ListByPostID = %+v", list)
+	}
+	// Events handed over twice notify once.
+	created := events.Events()
+	for i := 0; i < 2; i++ {
+		if err := notifications.Handle(ctx, created); err != nil {
+			t.Fatalf("Handle: %v", err)
+		}
+	}
+	if n, _ := notificationRepo.Count(ctx, alice.ID, true); n != 1 {
+		t.Errorf("post author has %d notifications", n)
+	}
+	if n, _ := notificationRepo.Count(ctx, bob.ID, true); n != 1 {
+		t.Errorf("replied commenter has %d notifications", n)
+	}
+	var types []string
+	for _, e := range events.Events() {
+		types = append(types, e.Type)
+	}
+	if len(types) != 4 || types[1] != EventCommentCreated || types[2] != EventNotificationCreated {
+		t.Errorf("events = %v", types)
+	}
+
+	if _, err := comments.Update(ctx, top.ID, "Edited", alice.ID); !errors.Is(err, ErrCommentForbidden) {
+		t.Errorf("editing another author's comment: want ErrCommentForbidden, got %v", err)
+	}
+	// Comments of deleted posts are kept, but the post takes no new ones.
+	_ = posts.Delete(ctx, post.ID)
+	if c, err := comments.Create(ctx, post.ID, nil, "Too late", "", &bob.ID); c != nil || err != nil {
+		t.Errorf("comment on a deleted post: %+v, %v", c, err)
+	}
+	if err := comments.Delete(ctx, reply.ID, alice.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := comments.GetByID(ctx, reply.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("deleted comment: want ErrRecordNotFound, got %v", err)
+	}
+}
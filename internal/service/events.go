@@ -0,0 +1,72 @@
+// service/events: Domain events services record in the outbox, and the topics they are streamed on.
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+)
+
+// PostsTopic carries post.created events for every new post.
+const PostsTopic = "posts"
+
+const (
+	EventPostCreated    = "post.created"
+	EventPostUpdated    = "post.updated"
+	EventPostDeleted    = "post.deleted"
+	EventCommentCreated = "comment.created"
+	EventCommentUpdated = "comment.updated"
+	EventCommentDeleted = "comment.deleted"
+
+	EventNotificationCreated = "notification.created"
+	EventNotificationRead    = "notification.read"
+
+	EventAuthorRegistered = "author.registered" // not streamed
+)
+
+// PostTopic carries the post.updated, post.deleted and comment.* events of one post.
+func PostTopic(postID uint) string {
+	return "post:" + strconv.FormatUint(uint64(postID), 10)
+}
+
+// NotificationsTopic carries the notification.* events of one author; only that author may subscribe to it.
+func NotificationsTopic(authorID uint) string {
+	return "author:" + strconv.FormatUint(uint64(authorID), 10) + ":notifications"
+}
+
+// notificationReadEvent is the payload of notification.read: one notification, or all of them.
+type notificationReadEvent struct {
+	ID  uint `json:"id,omitempty"`
+	All bool `json:"all,omitempty"`
+}
+
+// deletedEvent is the payload of *.deleted events.
+type deletedEvent struct {
+	ID     uint `json:"id"`
+	PostID uint `json:"post_id,omitempty"`
+}
+
+// registeredEvent is the payload of author.registered. The email address is left out on purpose.
+type registeredEvent struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// record appends an event of type typ with payload v to the outbox, in the transaction of ctx so it is only
+// relayed if the change it describes commits. topic is the real-time topic to stream it on, or empty.
+// A nil outbox records nothing.
+func record(ctx context.Context, outbox repository.EventStore, topic, typ string, v any) error {
+	if outbox == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return outbox.Append(ctx, &model.OutboxEvent{Topic: topic, Type: typ, Payload: string(data)})
+}
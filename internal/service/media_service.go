@@ -0,0 +1,142 @@
+// service/media_service: Author-scoped media library (upload, list, delete) independent of posts.
+package service
+
+import (
+	"context"
+	"errors"
+	"mime/multipart"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"github.com/aliakbar-zohour/go_blog/internal/upload"
+	"gorm.io/gorm"
+)
+
+// ErrMediaNotFound is returned for media ids that do not exist or belong to another author.
+var ErrMediaNotFound = errors.New("media not found")
+
+// MediaListResult holds a page of media library items and the total matching the filter.
+type MediaListResult struct {
+	Items []model.Media `json:"items"`
+	Total int64         `json:"total"`
+}
+
+type MediaService struct {
+	repo     repository.MediaStore
+	blobRepo repository.BlobStore
+	urls     *MediaURLService
+	usage    *UsageService
+	tx       repository.TxRunner
+	cfg      *config.Config
+}
+
+func NewMediaService(repo repository.MediaStore, blobRepo repository.BlobStore, urls *MediaURLService, usage *UsageService, tx repository.TxRunner, cfg *config.Config) *MediaService {
+	return &MediaService{repo: repo, blobRepo: blobRepo, urls: urls, usage: usage, tx: tx, cfg: cfg}
+}
+
+// Upload stores a file in the author's library without attaching it to a post.
+func (s *MediaService) Upload(ctx context.Context, authorID uint, file *multipart.FileHeader) (*model.Media, error) {
+	if file == nil {
+		return nil, errors.New("file is required")
+	}
+	if err := s.usage.Check(ctx, authorID, file.Size); err != nil {
+		return nil, err
+	}
+	m, b, err := upload.SaveFile(file, s.cfg.UploadDir, authorID, int64(s.cfg.MaxFileMB*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, m); err != nil {
+			return err
+		}
+		if err := s.blobRepo.Acquire(ctx, b.Hash, b.Path, b.Size); err != nil {
+			return err
+		}
+		return s.usage.Record(ctx, authorID, m.Type, b.Size)
+	})
+	if err != nil {
+		if b.New {
+			_ = upload.Remove(s.cfg.UploadDir, b.Path)
+		}
+		return nil, err
+	}
+	s.decorate(m)
+	return m, nil
+}
+
+// List returns the author's media matching f (f.AuthorID is overwritten), newest first.
+func (s *MediaService) List(ctx context.Context, authorID uint, f repository.MediaFilter, limit, offset int) (*MediaListResult, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	f.AuthorID = authorID
+	total, err := s.repo.Count(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repo.List(ctx, f, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		s.decorate(&items[i])
+	}
+	return &MediaListResult{Items: items, Total: total}, nil
+}
+
+// Get returns one of the author's media items.
+func (s *MediaService) Get(ctx context.Context, authorID, id uint) (*model.Media, error) {
+	m, err := s.owned(ctx, authorID, id)
+	if err != nil {
+		return nil, err
+	}
+	s.decorate(m)
+	return m, nil
+}
+
+// Delete removes the item from the library and every post it is attached to, releases its blob and
+// gives the author back the storage.
+func (s *MediaService) Delete(ctx context.Context, authorID, id uint) error {
+	m, err := s.owned(ctx, authorID, id)
+	if err != nil {
+		return err
+	}
+	size := upload.Size(s.cfg.UploadDir, m.Path)
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.DeleteByID(ctx, id); err != nil {
+			return err
+		}
+		// A private post it was attached to no longer uses the file.
+		if err := s.urls.RefreshPrivacy(ctx, &model.Post{Media: []model.Media{*m}}); err != nil {
+			return err
+		}
+		if err := s.blobRepo.Release(ctx, m.Path); err != nil {
+			return err
+		}
+		return s.usage.Release(ctx, authorID, m.Type, size)
+	})
+}
+
+func (s *MediaService) owned(ctx context.Context, authorID, id uint) (*model.Media, error) {
+	m, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMediaNotFound
+		}
+		return nil, err
+	}
+	if m.AuthorID != authorID {
+		return nil, ErrMediaNotFound
+	}
+	return m, nil
+}
+
+// decorate sets a signed URL: a library item may be attached to private posts, and a signed link also works for public files.
+func (s *MediaService) decorate(m *model.Media) {
+	m.URL = s.urls.URL(m.Path, true)
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"path/filepath"
+	"testing"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"gorm.io/gorm"
+)
+
+// Magic numbers that make test content detected as an image or a video.
+const (
+	pngMagic  = "\x89PNG\r\n\x1a\n"
+	webmMagic = "\x1a\x45\xdf\xa3"
+)
+
+// mediaContent prefixes content with the magic number of name's extension, so uploads checked by content accept it.
+func mediaContent(name, content string) string {
+	switch filepath.Ext(name) {
+	case ".png":
+		return pngMagic + content
+	case ".mp4":
+		return webmMagic + content
+	}
+	return content
+}
+
+// fileHeader builds a multipart file header as a parsed form would hold it, with content detected as name's type.
+func fileHeader(t *testing.T, name, content string) *multipart.FileHeader {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte(mediaContent(name, content)))
+	mw.Close()
+	form, err := multipart.NewReader(&buf, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.File["file"][0]
+}
+
+func newMediaService(db *gorm.DB, cfg *config.Config) *MediaService {
+	usage := NewUsageService(repository.NewUsageRepository(db), repository.NewAuthorRepository(db), cfg)
+	urls := NewMediaURLService(repository.NewStorageRepository(db), cfg)
+	return NewMediaService(repository.NewMediaRepository(db), repository.NewBlobRepository(db), urls, usage, repository.NewTransactor(db), cfg)
+}
+
+func TestMediaService_LibraryAndAttach(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{UploadDir: t.TempDir(), MaxFileMB: 1, MediaURLSecret: "secret"}
+	svc := newMediaService(db, cfg)
+	postSvc := newPostService(db, cfg)
+	ctx := context.Background()
+
+	img, err := svc.Upload(ctx, 1, fileHeader(t, "Inline.png", "pixels"))
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if img.AuthorID != 1 || img.URL == "" {
+		t.Errorf("want author 1 and url, got %+v", img)
+	}
+	if _, err := svc.Upload(ctx, 1, fileHeader(t, "clip.mp4", "frames")); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if _, err := svc.Upload(ctx, 2, fileHeader(t, "other.png", "theirs")); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	res, err := svc.List(ctx, 1, repository.MediaFilter{Type: model.MediaTypeImage, Query: "inline"}, 10, 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if res.Total != 1 || len(res.Items) != 1 || res.Items[0].ID != img.ID {
+		t.Fatalf("filtered list: want only %d, got %+v", img.ID, res)
+	}
+
+	var posts []*model.Post
+	for i := 0; i < 2; i++ {
+		p := &model.Post{Title: "Post", AuthorID: 1, CategoryID: 1}
+		if err := db.Create(p).Error; err != nil {
+			t.Fatalf("Create post: %v", err)
+		}
+		got, err := postSvc.AttachMedia(ctx, p.ID, 1, []uint{img.ID})
+		if err != nil {
+			t.Fatalf("AttachMedia: %v", err)
+		}
+		if len(got.Media) != 1 || got.Media[0].ID != img.ID {
+			t.Fatalf("post %d media: %+v", p.ID, got.Media)
+		}
+		posts = append(posts, p)
+	}
+	if _, err := postSvc.AttachMedia(ctx, posts[0].ID, 2, []uint{img.ID}); !errors.Is(err, ErrMediaNotFound) {
+		t.Errorf("attaching another author's media: want ErrMediaNotFound, got %v", err)
+	}
+	res, _ = svc.List(ctx, 1, repository.MediaFilter{Unattached: true}, 10, 0)
+	if res.Total != 1 || res.Items[0].Type != model.MediaTypeVideo {
+		t.Errorf("unattached: want only the video, got %+v", res)
+	}
+
+	if err := postSvc.Delete(ctx, posts[0].ID); err != nil {
+		t.Fatalf("Delete post: %v", err)
+	}
+	if _, err := svc.Get(ctx, 1, img.ID); err != nil {
+		t.Errorf("media must outlive a deleted post: %v", err)
+	}
+	if err := svc.Delete(ctx, 2, img.ID); !errors.Is(err, ErrMediaNotFound) {
+		t.Errorf("delete by other author: want ErrMediaNotFound, got %v", err)
+	}
+	if err := svc.Delete(ctx, 1, img.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	got, err := postSvc.GetByID(ctx, posts[1].ID, 1)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if len(got.Media) != 0 {
+		t.Errorf("deleted media should be detached, got %+v", got.Media)
+	}
+}
@@ -0,0 +1,107 @@
+// service/media_url_service: Public and signed, expiring URLs for uploaded files, and access checks for serving them.
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"github.com/aliakbar-zohour/go_blog/pkg/signurl"
+)
+
+// UploadsPrefix is the URL path under which uploaded files are served.
+const UploadsPrefix = "/uploads/"
+
+var ErrMediaForbidden = errors.New("a valid signature is required for this file")
+
+type MediaURLService struct {
+	storageRepo repository.StorageStore
+	cfg         *config.Config
+}
+
+func NewMediaURLService(storageRepo repository.StorageStore, cfg *config.Config) *MediaURLService {
+	return &MediaURLService{storageRepo: storageRepo, cfg: cfg}
+}
+
+// URL returns the URL for a stored file. Private files get a signed URL valid for MediaURLTTL.
+func (s *MediaURLService) URL(path string, private bool) string {
+	if path == "" {
+		return ""
+	}
+	u := UploadsPrefix + path
+	if private {
+		u += "?" + signurl.Sign(s.cfg.MediaURLSecret, path, time.Now().Add(s.cfg.MediaURLTTL))
+	}
+	return u
+}
+
+// DecoratePosts fills BannerURL and each media URL for viewerID, 0 when anonymous. The media of a private post are
+// only for its author, with signed URLs; anyone else gets the post without its banner and media. Files of a
+// public post are signed too when a private post shares them, since the file server asks for a signature.
+func (s *MediaURLService) DecoratePosts(ctx context.Context, viewerID uint, posts ...*model.Post) error {
+	var shared []string
+	for _, p := range posts {
+		if p.Private && (viewerID == 0 || viewerID != p.AuthorID) {
+			p.BannerPath, p.BannerURL, p.BannerBlurHash, p.BannerColor = "", "", "", ""
+			p.Media = nil
+			continue
+		}
+		if !p.Private {
+			shared = append(shared, postPaths(p)...)
+		}
+	}
+	private, err := s.storageRepo.PrivatePaths(ctx, shared)
+	if err != nil {
+		return err
+	}
+	for _, p := range posts {
+		p.BannerURL = s.URL(p.BannerPath, p.Private || private[p.BannerPath])
+		for i := range p.Media {
+			p.Media[i].URL = s.URL(p.Media[i].Path, p.Private || private[p.Media[i].Path])
+		}
+	}
+	return nil
+}
+
+// RefreshPrivacy updates which files need a signature after a change to posts. Pass each changed post as it was
+// before and after the change (nil when it did not exist), in the transaction of the change.
+func (s *MediaURLService) RefreshPrivacy(ctx context.Context, posts ...*model.Post) error {
+	var paths []string
+	for _, p := range posts {
+		if p != nil {
+			paths = append(paths, postPaths(p)...)
+		}
+	}
+	return s.storageRepo.RefreshPrivacy(ctx, paths)
+}
+
+// postPaths returns the paths of the banner and media of p.
+func postPaths(p *model.Post) []string {
+	var paths []string
+	if p.BannerPath != "" {
+		paths = append(paths, p.BannerPath)
+	}
+	for _, m := range p.Media {
+		paths = append(paths, m.Path)
+	}
+	return paths
+}
+
+// Authorize allows serving path when no private post uses it or the query carries a valid, unexpired signature.
+func (s *MediaURLService) Authorize(ctx context.Context, path string, q url.Values) error {
+	private, err := s.storageRepo.IsPrivate(ctx, path)
+	if err != nil {
+		return err
+	}
+	if !private {
+		return nil
+	}
+	if err := signurl.Verify(s.cfg.MediaURLSecret, path, q, time.Now()); err != nil {
+		return ErrMediaForbidden
+	}
+	return nil
+}
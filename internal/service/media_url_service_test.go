@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+)
+
+func TestMediaURLService_PrivatePostNeedsSignature(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{MediaURLSecret: "secret", MediaURLTTL: time.Minute}
+	svc := NewMediaURLService(repository.NewStorageRepository(db), cfg)
+	blobs := repository.NewBlobRepository(db)
+	ctx := context.Background()
+	const secret = "blobs/aa/bb/secret.png"
+	if err := blobs.Acquire(ctx, "secret", secret, 4); err != nil {
+		t.Fatal(err)
+	}
+	private := &model.Post{Title: "private", BannerPath: secret, Private: true, AuthorID: 5}
+	if err := db.Create(private).Error; err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := svc.Authorize(ctx, secret, url.Values{}); err != nil {
+		t.Errorf("blob not refreshed yet should be public: %v", err)
+	}
+	if err := svc.RefreshPrivacy(ctx, private); err != nil {
+		t.Fatalf("RefreshPrivacy: %v", err)
+	}
+	if err := svc.Authorize(ctx, secret, url.Values{}); !errors.Is(err, ErrMediaForbidden) {
+		t.Errorf("unsigned: want ErrMediaForbidden, got %v", err)
+	}
+	anonymous := *private
+	if err := svc.DecoratePosts(ctx, 0, &anonymous); err != nil || anonymous.BannerURL != "" || anonymous.BannerPath != "" {
+		t.Errorf("anonymous reader got banner %q (%q), %v", anonymous.BannerURL, anonymous.BannerPath, err)
+	}
+	if err := svc.DecoratePosts(ctx, 5, private); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(private.BannerURL)
+	if err != nil || !strings.HasPrefix(u.Path, UploadsPrefix) {
+		t.Fatalf("banner url %q: %v", private.BannerURL, err)
+	}
+	if err := svc.Authorize(ctx, secret, u.Query()); err != nil {
+		t.Errorf("signed: %v", err)
+	}
+	if err := svc.Authorize(ctx, "blobs/aa/bb/other.png", url.Values{}); err != nil {
+		t.Errorf("unreferenced file should be public: %v", err)
+	}
+
+	// A public post sharing the blob does not make it public; its readers get signed URLs instead.
+	public := &model.Post{Title: "public", BannerPath: secret, AuthorID: 6}
+	if err := db.Create(public).Error; err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := svc.RefreshPrivacy(ctx, public); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Authorize(ctx, secret, url.Values{}); !errors.Is(err, ErrMediaForbidden) {
+		t.Errorf("blob of a private post shared with a public one: want ErrMediaForbidden, got %v", err)
+	}
+	if err := svc.DecoratePosts(ctx, 0, public); err != nil || !strings.Contains(public.BannerURL, "sig=") {
+		t.Errorf("public post sharing a private blob: banner %q, %v", public.BannerURL, err)
+	}
+
+	// Once no private post uses it, the blob is public again.
+	if err := db.Delete(private).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.RefreshPrivacy(ctx, private); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Authorize(ctx, secret, url.Values{}); err != nil {
+		t.Errorf("blob without private posts should be public: %v", err)
+	}
+
+	// Files stored before blobs have no row; their posts decide.
+	legacy := &model.Post{Title: "legacy", BannerPath: "banners/old.png", Private: true, AuthorID: 5}
+	if err := db.Create(legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Authorize(ctx, "banners/old.png", url.Values{}); !errors.Is(err, ErrMediaForbidden) {
+		t.Errorf("legacy file of a private post: want ErrMediaForbidden, got %v", err)
+	}
+}
@@ -0,0 +1,469 @@
+// service/newsletter_service: Reader subscriptions with double opt-in, signed unsubscribe links and new-post emails.
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/mail"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"github.com/aliakbar-zohour/go_blog/pkg/signurl"
+	"gorm.io/gorm"
+)
+
+const (
+	appName             = "Go Blog"
+	confirmExpiryHours  = 48
+	unsubscribeLinkTTL  = 365 * 24 * time.Hour // unsubscribe links in old emails keep working for a year
+	newPostExcerptRunes = 280
+	digestExcerptRunes  = 160
+	digestMaxPosts      = 20
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrInvalidConfirmToken  = errors.New("invalid or expired confirmation link")
+	ErrInvalidUnsubscribe   = errors.New("invalid unsubscribe link")
+)
+
+type NewsletterService struct {
+	repo         repository.SubscriptionStore
+	postRepo     repository.PostStore
+	authorRepo   repository.AuthorStore
+	categoryRepo repository.CategoryStore
+	mailer       mail.Mailer
+	templates    *mail.Templates
+	tx           repository.TxRunner
+	cfg          *config.Config
+}
+
+// NewNewsletterService returns a NewsletterService. New posts are mailed when the service handles their
+// post.created events as an outbox sink.
+func NewNewsletterService(repo repository.SubscriptionStore, postRepo repository.PostStore, authorRepo repository.AuthorStore, categoryRepo repository.CategoryStore, mailer mail.Mailer, templates *mail.Templates, tx repository.TxRunner, cfg *config.Config) *NewsletterService {
+	return &NewsletterService{repo: repo, postRepo: postRepo, authorRepo: authorRepo, categoryRepo: categoryRepo, mailer: mailer, templates: templates, tx: tx, cfg: cfg}
+}
+
+// Name identifies the service as an outbox sink.
+func (s *NewsletterService) Name() string { return "newsletter" }
+
+// Handle mails the posts of post.created events to instant subscribers; other events are ignored. Private posts
+// and posts deleted or made private meanwhile are not mailed.
+func (s *NewsletterService) Handle(ctx context.Context, events []model.OutboxEvent) error {
+	for _, ev := range events {
+		if ev.Type != EventPostCreated {
+			continue
+		}
+		var post model.Post
+		if err := json.Unmarshal([]byte(ev.Payload), &post); err != nil {
+			return fmt.Errorf("%s %d: %w", ev.Type, ev.ID, err)
+		}
+		current, err := s.postRepo.GetByID(ctx, post.ID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+		if post.Private || current.Private {
+			continue
+		}
+		n, err := s.NotifyNewPost(ctx, &post)
+		if err != nil {
+			return fmt.Errorf("%s %d: %w", ev.Type, ev.ID, err)
+		}
+		if n > 0 {
+			log.Printf("[newsletter] post %d sent to %d subscribers", post.ID, n)
+		}
+	}
+	return nil
+}
+
+// Subscribe records a pending subscription and mails a confirmation link; nothing is sent to the address
+// until it is confirmed. frequency is instant (default), daily or weekly; timezone is an IANA name (default UTC)
+// deciding when digests arrive. Subscribing again re-sends the link and updates the settings. An already
+// confirmed subscription is left as it is and no email is sent, so the response does not reveal who is subscribed.
+// Returns the confirmation token only when cfg.DevTokens is set (for dev/testing).
+func (s *NewsletterService) Subscribe(ctx context.Context, email string, scope model.SubscriptionScope, targetID uint, frequency model.SubscriptionFrequency, timezone, locale string) (devToken string, err error) {
+	email = normalizeEmail(email)
+	if !isValidEmailFormat(email) {
+		return "", errors.New("invalid email format")
+	}
+	if scope == "" {
+		scope = model.SubscriptionBlog
+	}
+	switch frequency {
+	case "":
+		frequency = model.FrequencyInstant
+	case model.FrequencyInstant, model.FrequencyDaily, model.FrequencyWeekly:
+	default:
+		return "", errors.New("frequency must be instant, daily or weekly")
+	}
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(timezone); err != nil || len(timezone) > 64 {
+		return "", errors.New("unknown timezone")
+	}
+	topic, err := s.topic(ctx, scope, targetID)
+	if err != nil {
+		return "", err
+	}
+	if scope == model.SubscriptionBlog {
+		targetID = 0
+	}
+	locale = mail.NormalizeLocale(locale)
+	sub, err := s.repo.Find(ctx, email, scope, targetID)
+	if err != nil {
+		return "", err
+	}
+	if sub != nil && sub.ConfirmedAt != nil {
+		return "", nil
+	}
+	if sub == nil {
+		sub = &model.Subscription{Email: email, Scope: scope, TargetID: targetID, Locale: locale, Frequency: frequency, Timezone: timezone}
+		if err := s.repo.Create(ctx, sub); err != nil {
+			return "", err
+		}
+	} else {
+		if locale != "" {
+			sub.Locale = locale
+		}
+		sub.Frequency, sub.Timezone = frequency, timezone
+		if err := s.repo.Update(ctx, sub); err != nil {
+			return "", err
+		}
+	}
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	c := &model.SubscriptionConfirmation{SubscriptionID: sub.ID, Token: token, ExpiresAt: time.Now().Add(confirmExpiryHours * time.Hour)}
+	if err := s.repo.ReplaceConfirmation(ctx, c); err != nil {
+		return "", err
+	}
+	msg, err := s.templates.Message("subscription_confirm", sub.Locale, mail.SubscriptionConfirmData{
+		AppName:      appName,
+		Scope:        string(scope),
+		Topic:        topic,
+		Frequency:    string(frequency),
+		ConfirmURL:   s.cfg.PublicBaseURL + "/api/subscriptions/confirm?token=" + token,
+		ExpiresHours: confirmExpiryHours,
+	})
+	if err != nil {
+		return "", err
+	}
+	msg.From, msg.To = s.cfg.SMTPFrom, []string{email}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Printf("[newsletter] send confirmation to %s: %v", email, err)
+		return "", fmt.Errorf("%w: %v", ErrEmailNotSent, err)
+	}
+	if s.cfg.DevTokens {
+		return token, nil
+	}
+	return "", nil
+}
+
+// Confirm completes the double opt-in for token.
+func (s *NewsletterService) Confirm(ctx context.Context, token string) (*model.Subscription, error) {
+	if token == "" {
+		return nil, ErrInvalidConfirmToken
+	}
+	c, err := s.repo.FindValidConfirmation(ctx, token)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidConfirmToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Confirm(ctx, c.SubscriptionID, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, c.SubscriptionID)
+}
+
+// Get returns the subscription an unsubscribe link points to, after checking its signature.
+func (s *NewsletterService) Get(ctx context.Context, id uint, q url.Values) (*model.Subscription, error) {
+	if err := signurl.Verify(s.cfg.JWTSecret, unsubscribePath(id), q, time.Now()); err != nil {
+		return nil, ErrInvalidUnsubscribe
+	}
+	sub, err := s.repo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSubscriptionNotFound
+	}
+	return sub, err
+}
+
+// Unsubscribe deletes the subscription of a signed unsubscribe link. Unsubscribing twice is not an error.
+func (s *NewsletterService) Unsubscribe(ctx context.Context, id uint, q url.Values) error {
+	if err := signurl.Verify(s.cfg.JWTSecret, unsubscribePath(id), q, time.Now()); err != nil {
+		return ErrInvalidUnsubscribe
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// UnsubscribeURL returns the signed link that removes subscription id.
+func (s *NewsletterService) UnsubscribeURL(id uint) string {
+	return s.cfg.PublicBaseURL + "/api/" + unsubscribePath(id) + "?" + signurl.Sign(s.cfg.JWTSecret, unsubscribePath(id), time.Now().Add(unsubscribeLinkTTL))
+}
+
+// NotifyNewPost mails post to every confirmed subscriber of the blog, its category or its author.
+// An address subscribed several ways gets one email, attributed to the most specific subscription
+// so its unsubscribe link stops exactly that kind of email. Each email is queued together with a
+// post_deliveries row, so calling it again for the same post mails nobody twice. Returns the number of
+// emails queued by this call.
+func (s *NewsletterService) NotifyNewPost(ctx context.Context, post *model.Post) (int, error) {
+	subs, err := s.repo.ListConfirmedForPost(ctx, post.AuthorID, post.CategoryID)
+	if err != nil {
+		return 0, err
+	}
+	byEmail := make(map[string]model.Subscription)
+	var order []string
+	for _, sub := range subs {
+		cur, seen := byEmail[sub.Email]
+		if !seen {
+			order = append(order, sub.Email)
+		}
+		if !seen || scopeRank(sub.Scope) > scopeRank(cur.Scope) {
+			byEmail[sub.Email] = sub
+		}
+	}
+	authorName := ""
+	if post.Author != nil {
+		authorName = post.Author.Name
+	}
+	topics := make(map[model.SubscriptionScope]string)
+	sent := 0
+	for _, email := range order {
+		sub := byEmail[email]
+		topic, ok := topics[sub.Scope]
+		if !ok {
+			// Every subscription here targets this post's author or category, so one lookup per scope suffices.
+			if topic, err = s.topic(ctx, sub.Scope, sub.TargetID); err != nil {
+				return sent, err
+			}
+			topics[sub.Scope] = topic
+		}
+		unsubscribe := s.UnsubscribeURL(sub.ID)
+		msg, err := s.templates.Message("new_post", sub.Locale, mail.NewPostData{
+			AppName:        appName,
+			Scope:          string(sub.Scope),
+			Topic:          topic,
+			Title:          post.Title,
+			AuthorName:     authorName,
+			Excerpt:        excerpt(post.Body, newPostExcerptRunes),
+			PostURL:        s.cfg.PublicBaseURL + "/api/posts/" + strconv.FormatUint(uint64(post.ID), 10),
+			UnsubscribeURL: unsubscribe,
+		})
+		if err != nil {
+			return sent, err
+		}
+		msg.From, msg.To = s.cfg.SMTPFrom, []string{email}
+		msg.Headers = listUnsubscribeHeaders(unsubscribe)
+		claimed := false
+		err = s.tx.Do(ctx, func(ctx context.Context) error {
+			var err error
+			claimed, err = s.repo.ClaimPostDelivery(ctx, &model.PostDelivery{SubscriptionID: sub.ID, PostID: post.ID})
+			if err != nil || !claimed {
+				return err
+			}
+			return s.mailer.Send(ctx, msg)
+		})
+		if err != nil {
+			return sent, fmt.Errorf("send post %d to subscription %d: %w", post.ID, sub.ID, err)
+		}
+		if claimed {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// SendDigests sends every daily or weekly digest whose period ended before now and has not been handled yet.
+// A period ends at cfg.DigestHour in the subscriber's timezone (weekly: on Monday). Each period is claimed
+// in digest_deliveries before the email is queued, so reruns, restarts and parallel instances never send
+// it twice. Posts created before the period end and after the previous digest are included; a period
+// without posts is recorded but not mailed. Returns the number of digests sent.
+func (s *NewsletterService) SendDigests(ctx context.Context, now time.Time) (int, error) {
+	subs, err := s.repo.ListConfirmedDigests(ctx)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for i := range subs {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		ok, err := s.sendDigest(ctx, &subs[i], now)
+		if err != nil {
+			log.Printf("[newsletter] digest for subscription %d: %v", subs[i].ID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+func (s *NewsletterService) sendDigest(ctx context.Context, sub *model.Subscription, now time.Time) (bool, error) {
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	key, end := digestPeriod(sub.Frequency, loc, s.cfg.DigestHour, now)
+	start := *sub.ConfirmedAt
+	if sub.LastDigestAt != nil {
+		start = *sub.LastDigestAt
+	}
+	// The first digest covers the first full period after confirming.
+	if !end.After(start) {
+		return false, nil
+	}
+	d := &model.DigestDelivery{SubscriptionID: sub.ID, PeriodKey: key}
+	claimed, err := s.repo.ClaimDigest(ctx, d)
+	if err != nil || !claimed {
+		return false, err
+	}
+	var authorID, categoryID uint
+	switch sub.Scope {
+	case model.SubscriptionAuthor:
+		authorID = sub.TargetID
+	case model.SubscriptionCategory:
+		categoryID = sub.TargetID
+	}
+	posts, err := s.postRepo.ListPublicCreatedBetween(ctx, start, end, authorID, categoryID, digestMaxPosts)
+	if err != nil {
+		_ = s.repo.ReleaseDigest(ctx, d.ID)
+		return false, err
+	}
+	d.PostCount = len(posts)
+	if len(posts) > 0 {
+		if err := s.mailDigest(ctx, sub, posts); err != nil {
+			_ = s.repo.ReleaseDigest(ctx, d.ID)
+			return false, err
+		}
+		sentAt := time.Now()
+		d.SentAt = &sentAt
+	}
+	return d.SentAt != nil, s.repo.FinishDigest(ctx, d, end)
+}
+
+func (s *NewsletterService) mailDigest(ctx context.Context, sub *model.Subscription, posts []model.Post) error {
+	topic, err := s.topic(ctx, sub.Scope, sub.TargetID)
+	if err != nil {
+		return err
+	}
+	items := make([]mail.DigestPost, len(posts))
+	for i, p := range posts {
+		items[i] = mail.DigestPost{
+			Title:   p.Title,
+			Excerpt: excerpt(p.Body, digestExcerptRunes),
+			URL:     s.cfg.PublicBaseURL + "/api/posts/" + strconv.FormatUint(uint64(p.ID), 10),
+		}
+		if p.Author != nil {
+			items[i].AuthorName = p.Author.Name
+		}
+	}
+	unsubscribe := s.UnsubscribeURL(sub.ID)
+	msg, err := s.templates.Message("digest", sub.Locale, mail.DigestData{
+		AppName:        appName,
+		Scope:          string(sub.Scope),
+		Topic:          topic,
+		Frequency:      string(sub.Frequency),
+		Posts:          items,
+		UnsubscribeURL: unsubscribe,
+	})
+	if err != nil {
+		return err
+	}
+	msg.From, msg.To = s.cfg.SMTPFrom, []string{sub.Email}
+	msg.Headers = listUnsubscribeHeaders(unsubscribe)
+	return s.mailer.Send(ctx, msg)
+}
+
+// digestPeriod returns the key and end of the most recent digest period that ended at or before now:
+// the last hour:00 in loc for daily digests, the last Monday hour:00 for weekly ones.
+func digestPeriod(freq model.SubscriptionFrequency, loc *time.Location, hour int, now time.Time) (string, time.Time) {
+	local := now.In(loc)
+	end := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, loc)
+	if end.After(local) {
+		end = end.AddDate(0, 0, -1)
+	}
+	if freq == model.FrequencyWeekly {
+		back := (int(end.Weekday()) + 6) % 7 // days since Monday
+		end = time.Date(end.Year(), end.Month(), end.Day()-back, hour, 0, 0, 0, loc)
+	}
+	return string(freq) + ":" + end.Format("2006-01-02"), end
+}
+
+// listUnsubscribeHeaders enables RFC 8058 one-click unsubscribe: mail clients POST "List-Unsubscribe=One-Click" to the URL.
+func listUnsubscribeHeaders(unsubscribeURL string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// topic returns the display name of what a subscription is for, checking that the target exists.
+func (s *NewsletterService) topic(ctx context.Context, scope model.SubscriptionScope, targetID uint) (string, error) {
+	switch scope {
+	case model.SubscriptionBlog:
+		return appName, nil
+	case model.SubscriptionCategory:
+		c, err := s.categoryRepo.GetByID(ctx, targetID)
+		if err != nil {
+			return "", errors.New("category not found")
+		}
+		return c.Name, nil
+	case model.SubscriptionAuthor:
+		a, err := s.authorRepo.GetByID(ctx, targetID)
+		if err != nil {
+			return "", errors.New("author not found")
+		}
+		return a.Name, nil
+	}
+	return "", errors.New("scope must be blog, category or author")
+}
+
+func scopeRank(scope model.SubscriptionScope) int {
+	switch scope {
+	case model.SubscriptionAuthor:
+		return 2
+	case model.SubscriptionCategory:
+		return 1
+	}
+	return 0
+}
+
+func unsubscribePath(id uint) string {
+	return fmt.Sprintf("subscriptions/%d/unsubscribe", id)
+}
+
+// excerpt returns the first n runes of body with whitespace collapsed.
+func excerpt(body string, n int) string {
+	text := strings.Join(strings.Fields(body), " ")
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:n])) + "…"
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/mail"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+)
+
+func TestNewsletterService_DoubleOptInNotifyAndUnsubscribe(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{MailDriver: mail.DriverMemory, DevTokens: true, SMTPFrom: "noreply@example.com", PublicBaseURL: "https://blog.example.com", JWTSecret: "secret"}
+	mailer := mail.NewMemoryMailer()
+	svc := NewNewsletterService(repository.NewSubscriptionRepository(db), repository.NewPostRepository(db), repository.NewAuthorRepository(db), repository.NewCategoryRepository(db), mailer, mail.NewTemplates("", mail.DefaultLocale), repository.NewTransactor(db), cfg)
+	ctx := context.Background()
+	author := &model.Author{Name: "Jane"}
+	category := &model.Category{Name: "Travel"}
+	db.Create(author)
+	db.Create(category)
+
+	if _, err := svc.Subscribe(ctx, "reader@example.com", model.SubscriptionCategory, 999, "", "", ""); err == nil {
+		t.Error("subscribing to an unknown category should fail")
+	}
+	tokenBlog, err := svc.Subscribe(ctx, "Reader@Example.com", model.SubscriptionBlog, 0, "", "", "")
+	if err != nil || tokenBlog == "" {
+		t.Fatalf("Subscribe blog: %q %v", tokenBlog, err)
+	}
+	tokenAuthor, _ := svc.Subscribe(ctx, "reader@example.com", model.SubscriptionAuthor, author.ID, "", "", "fa")
+	tokenPending, _ := svc.Subscribe(ctx, "pending@example.com", model.SubscriptionCategory, category.ID, "", "", "")
+	if tokenPending == "" {
+		t.Fatal("no token for pending subscription")
+	}
+	// Without DEV_TOKENS the token only travels in the email, whatever the mail driver.
+	cfg.DevTokens = false
+	if tok, err := svc.Subscribe(ctx, "quiet@example.com", model.SubscriptionBlog, 0, "", "", ""); err != nil || tok != "" {
+		t.Errorf("Subscribe without DevTokens: token=%q err=%v", tok, err)
+	}
+	cfg.DevTokens = true
+	confirm := mailer.Messages()[0]
+	if !strings.Contains(confirm.Text, "https://blog.example.com/api/subscriptions/confirm?token="+tokenBlog) {
+		t.Errorf("confirmation email lacks link:\n%s", confirm.Text)
+	}
+	for _, tok := range []string{tokenBlog, tokenAuthor} {
+		if _, err := svc.Confirm(ctx, tok); err != nil {
+			t.Fatalf("Confirm: %v", err)
+		}
+	}
+	if _, err := svc.Confirm(ctx, tokenBlog); !errors.Is(err, ErrInvalidConfirmToken) {
+		t.Errorf("token reused: want ErrInvalidConfirmToken, got %v", err)
+	}
+	// Re-subscribing a confirmed address sends nothing.
+	mailer.Reset()
+	if tok, err := svc.Subscribe(ctx, "reader@example.com", model.SubscriptionBlog, 0, "", "", ""); err != nil || tok != "" || len(mailer.Messages()) != 0 {
+		t.Errorf("confirmed resubscribe: token=%q err=%v mails=%d", tok, err, len(mailer.Messages()))
+	}
+
+	post := &model.Post{ID: 7, Title: "Lisbon", Body: "Trams   and\n\ntiles.", AuthorID: author.ID, CategoryID: category.ID, Author: author}
+	n, err := svc.NotifyNewPost(ctx, post)
+	if err != nil || n != 1 {
+		t.Fatalf("NotifyNewPost: n=%d err=%v (pending subscribers must not be mailed, duplicates merged)", n, err)
+	}
+	msg := mailer.Messages()[0]
+	if msg.To[0] != "reader@example.com" || msg.Locale != "fa" || !strings.Contains(msg.Text, "Trams and tiles.") {
+		t.Errorf("unexpected post email (want the author subscription's fa template): %+v", msg)
+	}
+	if msg.Headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("missing List-Unsubscribe-Post: %v", msg.Headers)
+	}
+	link := strings.Trim(msg.Headers["List-Unsubscribe"], "<>")
+	u, err := url.Parse(link)
+	if err != nil || !strings.HasPrefix(u.Path, "/api/subscriptions/") {
+		t.Fatalf("bad unsubscribe link %q", link)
+	}
+	if !strings.Contains(msg.Text, link) {
+		t.Error("body does not contain the unsubscribe link")
+	}
+	// The relay may hand the post.created event over again; it mails nobody twice.
+	mailer.Reset()
+	db.Create(post)
+	payload, _ := json.Marshal(post)
+	if err := svc.Handle(ctx, []model.OutboxEvent{{ID: 1, Type: EventPostCreated, Payload: string(payload)}}); err != nil || len(mailer.Messages()) != 0 {
+		t.Errorf("post mailed again: %d emails, %v", len(mailer.Messages()), err)
+	}
+	// Private posts are never mailed.
+	hidden := &model.Post{Title: "Draft", AuthorID: post.AuthorID, CategoryID: post.CategoryID, Private: true}
+	db.Create(hidden)
+	payload, _ = json.Marshal(hidden)
+	if err := svc.Handle(ctx, []model.OutboxEvent{{ID: 2, Type: EventPostCreated, Payload: string(payload)}}); err != nil || len(mailer.Messages()) != 0 {
+		t.Errorf("private post mailed: %d emails, %v", len(mailer.Messages()), err)
+	}
+	var sub model.Subscription
+	db.Where("email = ? AND scope = ?", "reader@example.com", model.SubscriptionAuthor).First(&sub)
+	tampered := u.Query()
+	tampered.Set("expires", tampered.Get("expires")+"0")
+	if err := svc.Unsubscribe(ctx, sub.ID, tampered); !errors.Is(err, ErrInvalidUnsubscribe) {
+		t.Errorf("tampered link: want ErrInvalidUnsubscribe, got %v", err)
+	}
+	if err := svc.Unsubscribe(ctx, sub.ID+1, u.Query()); !errors.Is(err, ErrInvalidUnsubscribe) {
+		t.Errorf("link for another subscription: want ErrInvalidUnsubscribe, got %v", err)
+	}
+	if err := svc.Unsubscribe(ctx, sub.ID, u.Query()); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	if err := svc.Unsubscribe(ctx, sub.ID, u.Query()); err != nil {
+		t.Errorf("second unsubscribe: %v", err)
+	}
+
+	// The blog-wide subscription still receives posts, now in English.
+	mailer.Reset()
+	if n, _ := svc.NotifyNewPost(ctx, post); n != 1 || mailer.Messages()[0].Locale != "en" {
+		t.Errorf("after unsubscribing from the author: n=%d", n)
+	}
+}
+
+func TestDigestPeriod(t *testing.T) {
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Skipf("tzdata not available: %v", err)
+	}
+	// Wednesday 2025-03-12 06:00 UTC is 09:30 in Tehran.
+	now := time.Date(2025, 3, 12, 6, 0, 0, 0, time.UTC)
+	cases := []struct {
+		freq model.SubscriptionFrequency
+		loc  *time.Location
+		hour int
+		key  string
+	}{
+		{model.FrequencyDaily, time.UTC, 8, "daily:2025-03-11"},
+		{model.FrequencyDaily, time.UTC, 6, "daily:2025-03-12"},
+		{model.FrequencyDaily, tehran, 8, "daily:2025-03-12"},
+		{model.FrequencyWeekly, time.UTC, 8, "weekly:2025-03-10"},
+		{model.FrequencyWeekly, tehran, 10, "weekly:2025-03-10"},
+	}
+	for _, tc := range cases {
+		key, end := digestPeriod(tc.freq, tc.loc, tc.hour, now)
+		if key != tc.key || end.After(now) || end.In(tc.loc).Hour() != tc.hour {
+			t.Errorf("digestPeriod(%s, %s, %d) = %s %v, want %s", tc.freq, tc.loc, tc.hour, key, end, tc.key)
+		}
+	}
+	// Monday before the hour still belongs to the previous week.
+	if key, _ := digestPeriod(model.FrequencyWeekly, time.UTC, 8, time.Date(2025, 3, 17, 7, 0, 0, 0, time.UTC)); key != "weekly:2025-03-10" {
+		t.Errorf("Monday 07:00: got %s", key)
+	}
+}
+
+func TestNewsletterService_SendDigestsOncePerPeriod(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{MailDriver: mail.DriverMemory, DevTokens: true, SMTPFrom: "noreply@example.com", PublicBaseURL: "https://blog.example.com", JWTSecret: "secret", DigestHour: 8}
+	mailer := mail.NewMemoryMailer()
+	newSvc := func() *NewsletterService {
+		return NewNewsletterService(repository.NewSubscriptionRepository(db), repository.NewPostRepository(db), repository.NewAuthorRepository(db), repository.NewCategoryRepository(db), mailer, mail.NewTemplates("", mail.DefaultLocale), repository.NewTransactor(db), cfg)
+	}
+	svc := newSvc()
+	ctx := context.Background()
+	travel, food := &model.Category{Name: "Travel"}, &model.Category{Name: "Food"}
+	author := &model.Author{Name: "Jane"}
+	db.Create(travel)
+	db.Create(food)
+	db.Create(author)
+
+	token, err := svc.Subscribe(ctx, "reader@example.com", model.SubscriptionCategory, travel.ID, model.FrequencyWeekly, "UTC", "")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if _, err := svc.Subscribe(ctx, "x@example.com", model.SubscriptionBlog, 0, "hourly", "", ""); err == nil {
+		t.Error("unknown frequency accepted")
+	}
+	if _, err := svc.Subscribe(ctx, "x@example.com", model.SubscriptionBlog, 0, model.FrequencyDaily, "Mars/Olympus", ""); err == nil {
+		t.Error("unknown timezone accepted")
+	}
+	sub, err := svc.Confirm(ctx, token)
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	confirmed := time.Date(2025, 3, 5, 12, 0, 0, 0, time.UTC) // Wednesday
+	db.Model(sub).Update("confirmed_at", confirmed)
+	mailer.Reset()
+
+	// Digest posts are not sent one by one.
+	if n, _ := svc.NotifyNewPost(ctx, &model.Post{Title: "x", AuthorID: author.ID, CategoryID: travel.ID}); n != 0 {
+		t.Errorf("weekly subscriber got an instant email")
+	}
+	for _, p := range []model.Post{
+		{Title: "Before confirming", AuthorID: author.ID, CategoryID: travel.ID, CreatedAt: confirmed.Add(-time.Hour)},
+		{Title: "Lisbon", AuthorID: author.ID, CategoryID: travel.ID, CreatedAt: confirmed.Add(time.Hour)},
+		{Title: "Pasta", AuthorID: author.ID, CategoryID: food.ID, CreatedAt: confirmed.Add(time.Hour)},
+		{Title: "Secret draft", AuthorID: author.ID, CategoryID: travel.ID, CreatedAt: confirmed.Add(time.Hour), Private: true},
+		{Title: "Porto", AuthorID: author.ID, CategoryID: travel.ID, CreatedAt: time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)},
+	} {
+		p := p
+		db.Create(&p)
+	}
+
+	// Before the first Monday 08:00 after confirming nothing is due.
+	if n, _ := svc.SendDigests(ctx, time.Date(2025, 3, 10, 7, 0, 0, 0, time.UTC)); n != 0 {
+		t.Fatalf("digest sent before the period ended")
+	}
+	monday := time.Date(2025, 3, 10, 8, 15, 0, 0, time.UTC)
+	if n, err := svc.SendDigests(ctx, monday); err != nil || n != 1 {
+		t.Fatalf("SendDigests: n=%d err=%v", n, err)
+	}
+	msg := mailer.Messages()[0]
+	if !strings.Contains(msg.Text, "Lisbon") || strings.Contains(msg.Text, "Pasta") || strings.Contains(msg.Text, "Porto") || strings.Contains(msg.Text, "Before confirming") || strings.Contains(msg.Text, "Secret draft") {
+		t.Errorf("digest has the wrong posts:\n%s", msg.Text)
+	}
+	if !strings.Contains(msg.Subject, "weekly") || msg.Headers["List-Unsubscribe"] == "" {
+		t.Errorf("unexpected digest: subject=%q headers=%v", msg.Subject, msg.Headers)
+	}
+	// Reruns and a restarted service do not send the period again.
+	if n, _ := svc.SendDigests(ctx, monday.Add(time.Hour)); n != 0 {
+		t.Error("digest sent twice")
+	}
+	if n, _ := newSvc().SendDigests(ctx, monday.Add(2*time.Hour)); n != 0 {
+		t.Error("digest sent twice after restart")
+	}
+	if len(mailer.Messages()) != 1 {
+		t.Fatalf("want 1 email, got %d", len(mailer.Messages()))
+	}
+	// The post after Monday 08:00 goes into the next week's digest.
+	mailer.Reset()
+	if n, _ := svc.SendDigests(ctx, monday.AddDate(0, 0, 7)); n != 1 || !strings.Contains(mailer.Messages()[0].Text, "Porto") {
+		t.Errorf("second week: n=%d", n)
+	}
+	// A week without posts is recorded but not mailed.
+	mailer.Reset()
+	if n, _ := svc.SendDigests(ctx, monday.AddDate(0, 0, 14)); n != 0 || len(mailer.Messages()) != 0 {
+		t.Errorf("empty week mailed")
+	}
+	var deliveries int64
+	db.Model(&model.DigestDelivery{}).Count(&deliveries)
+	if deliveries != 3 {
+		t.Errorf("want 3 recorded periods, got %d", deliveries)
+	}
+}
@@ -0,0 +1,389 @@
+// service/notification_service: Notification inbox of authors; works out who to notify about comments and posts,
+// stores the notifications and emails them, honouring per-type preferences.
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/mail"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"gorm.io/gorm"
+)
+
+const (
+	notificationExcerptRunes = 200
+	maxMentions              = 10
+)
+
+var (
+	ErrUnknownNotificationType = errors.New("unknown notification type")
+	ErrNotificationNotFound    = errors.New("notification not found")
+	ErrCategoryNotFound        = errors.New("category not found")
+)
+
+type NotificationService struct {
+	repo         repository.NotificationStore
+	authorRepo   repository.AuthorStore
+	categoryRepo repository.CategoryStore
+	postRepo     repository.PostStore
+	commentRepo  repository.CommentStore
+	mailer       mail.Mailer
+	templates    *mail.Templates
+	tx           repository.TxRunner
+	outbox       repository.EventStore
+	cfg          *config.Config
+}
+
+// NewNotificationService returns a NotificationService. Inbox changes record notification.* events in outbox,
+// which are pushed to the author's live connections; outbox may be nil to record no events. Authors are notified
+// about new posts and comments when the service handles their events as an outbox sink.
+func NewNotificationService(repo repository.NotificationStore, authorRepo repository.AuthorStore, categoryRepo repository.CategoryStore, postRepo repository.PostStore, commentRepo repository.CommentStore, mailer mail.Mailer, templates *mail.Templates, tx repository.TxRunner, outbox repository.EventStore, cfg *config.Config) *NotificationService {
+	return &NotificationService{repo: repo, authorRepo: authorRepo, categoryRepo: categoryRepo, postRepo: postRepo, commentRepo: commentRepo, mailer: mailer, templates: templates, tx: tx, outbox: outbox, cfg: cfg}
+}
+
+// Name identifies the service as an outbox sink.
+func (s *NotificationService) Name() string { return "notifications" }
+
+// Handle notifies authors about post.created events of posts that are not private and comment.created events;
+// other events are ignored. Each method works out the recipients itself; nobody is notified about their own
+// action, nor twice about one event, even when the relay hands the event over again.
+func (s *NotificationService) Handle(ctx context.Context, events []model.OutboxEvent) error {
+	for _, ev := range events {
+		var err error
+		switch ev.Type {
+		case EventPostCreated:
+			var post model.Post
+			if err = json.Unmarshal([]byte(ev.Payload), &post); err == nil {
+				err = s.postCreated(ctx, ev.ID, &post)
+			}
+		case EventCommentCreated:
+			var c model.Comment
+			if err = json.Unmarshal([]byte(ev.Payload), &c); err == nil {
+				err = s.commentCreated(ctx, ev.ID, &c)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s %d: %w", ev.Type, ev.ID, err)
+		}
+	}
+	return nil
+}
+
+// recipients collects who to notify about one event, skipping the actor and anyone already added.
+type recipients struct {
+	actor uint
+	seen  map[uint]bool
+	list  []recipient
+}
+
+type recipient struct {
+	authorID uint
+	typ      model.NotificationType
+}
+
+func newRecipients(actor *uint) *recipients {
+	r := &recipients{seen: make(map[uint]bool)}
+	if actor != nil {
+		r.actor = *actor
+	}
+	return r
+}
+
+func (r *recipients) add(typ model.NotificationType, ids ...uint) {
+	for _, id := range ids {
+		if id == 0 || id == r.actor || r.seen[id] {
+			continue
+		}
+		r.seen[id] = true
+		r.list = append(r.list, recipient{id, typ})
+	}
+}
+
+// commentCreated notifies the author of the parent comment (comment_reply), the post's author
+// (comment_on_post) and authors @mentioned in the comment (mention), in that order of precedence. Comments of
+// posts deleted meanwhile notify nobody.
+func (s *NotificationService) commentCreated(ctx context.Context, eventID uint64, c *model.Comment) error {
+	post, err := s.postRepo.GetByID(ctx, c.PostID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	to := newRecipients(c.AuthorID)
+	if c.ParentID != nil {
+		parent, err := s.commentRepo.GetByID(ctx, *c.ParentID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if parent != nil && parent.AuthorID != nil {
+			to.add(model.NotificationCommentReply, *parent.AuthorID)
+		}
+	}
+	to.add(model.NotificationCommentOnPost, post.AuthorID)
+	mentioned, err := s.mentioned(ctx, c.Body)
+	if err != nil {
+		return err
+	}
+	to.add(model.NotificationMention, mentioned...)
+	return s.deliver(ctx, to, model.Notification{
+		ActorID:   c.AuthorID,
+		ActorName: c.AuthorName,
+		PostID:    post.ID,
+		PostTitle: post.Title,
+		CommentID: &c.ID,
+		Excerpt:   excerpt(c.Body, notificationExcerptRunes),
+		EventID:   &eventID,
+	})
+}
+
+// postCreated notifies authors @mentioned in the post (mention) and those watching its category
+// (new_post_in_category).
+func (s *NotificationService) postCreated(ctx context.Context, eventID uint64, post *model.Post) error {
+	// Private posts are not announced: watchers and mentioned authors would get their excerpt.
+	if post.Private {
+		return nil
+	}
+	actor := post.AuthorID
+	to := newRecipients(&actor)
+	mentioned, err := s.mentioned(ctx, post.Body)
+	if err != nil {
+		return err
+	}
+	to.add(model.NotificationMention, mentioned...)
+	watchers, err := s.repo.CategoryWatchers(ctx, post.CategoryID)
+	if err != nil {
+		return err
+	}
+	to.add(model.NotificationCategoryPost, watchers...)
+	return s.deliver(ctx, to, model.Notification{
+		ActorID:   &actor,
+		PostID:    post.ID,
+		PostTitle: post.Title,
+		Excerpt:   excerpt(post.Body, notificationExcerptRunes),
+		EventID:   &eventID,
+	})
+}
+
+// deliver sends a copy of n to every recipient. Recipients deleted meanwhile are skipped.
+func (s *NotificationService) deliver(ctx context.Context, to *recipients, n model.Notification) error {
+	if len(to.list) == 0 {
+		return nil
+	}
+	if n.ActorName == "" && n.ActorID != nil {
+		if a, err := s.authorRepo.GetByID(ctx, *n.ActorID); err == nil {
+			n.ActorName = a.Name
+		}
+	}
+	for _, r := range to.list {
+		n := n
+		n.AuthorID, n.Type = r.authorID, r.typ
+		if err := s.Notify(ctx, &n); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%s for author %d: %w", r.typ, r.authorID, err)
+		}
+	}
+	return nil
+}
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_]+)`)
+
+// mentionHandles returns the distinct handles @mentioned in text (at most maxMentions), in the form
+// AuthorRepository.ListByHandles expects. Email addresses are not mentions.
+func mentionHandles(text string) []string {
+	var handles []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		h := strings.ToLower(strings.ReplaceAll(m[1], "_", ""))
+		if h == "" || seen[h] {
+			continue
+		}
+		seen[h] = true
+		handles = append(handles, h)
+		if len(handles) == maxMentions {
+			break
+		}
+	}
+	return handles
+}
+
+// mentioned returns the IDs of the authors @mentioned in text. Authors sharing a name are all mentioned.
+func (s *NotificationService) mentioned(ctx context.Context, text string) ([]uint, error) {
+	handles := mentionHandles(text)
+	if len(handles) == 0 {
+		return nil, nil
+	}
+	authors, err := s.authorRepo.ListByHandles(ctx, handles)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(authors))
+	for i, a := range authors {
+		ids[i] = a.ID
+	}
+	return ids, nil
+}
+
+// Notify stores n in the inbox of n.AuthorID, pushes it to the author's live connections and emails it,
+// unless the recipient switched n.Type off or already has the notification of n.EventID. Authors without an
+// email address get no email. The notification, its event and the queued email are stored together.
+func (s *NotificationService) Notify(ctx context.Context, n *model.Notification) error {
+	prefs, err := s.repo.Preferences(ctx, n.AuthorID)
+	if err != nil {
+		return err
+	}
+	if enabled, ok := prefs[n.Type]; ok && !enabled {
+		return nil
+	}
+	recipient, err := s.authorRepo.GetByID(ctx, n.AuthorID)
+	if err != nil {
+		return err
+	}
+	var msg *mail.Message
+	if recipient.Email != nil && *recipient.Email != "" {
+		msg, err = s.templates.Message("notification", recipient.Locale, mail.NotificationData{
+			AppName:   appName,
+			Type:      string(n.Type),
+			ActorName: n.ActorName,
+			PostTitle: n.PostTitle,
+			Excerpt:   n.Excerpt,
+			PostURL:   s.cfg.PublicBaseURL + "/api/posts/" + strconv.FormatUint(uint64(n.PostID), 10),
+		})
+		if err != nil {
+			return err
+		}
+		msg.From, msg.To = s.cfg.SMTPFrom, []string{*recipient.Email}
+	}
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		created, err := s.repo.CreateOnce(ctx, n)
+		if err != nil || !created {
+			return err
+		}
+		if err := record(ctx, s.outbox, NotificationsTopic(n.AuthorID), EventNotificationCreated, n); err != nil {
+			return err
+		}
+		if msg == nil {
+			return nil
+		}
+		return s.mailer.Send(ctx, msg)
+	})
+}
+
+// NotificationListResult holds a page of notifications and the total count.
+type NotificationListResult struct {
+	Items []model.Notification `json:"items"`
+	Total int64                `json:"total"`
+}
+
+// List returns the notifications of authorID, newest first; only unread ones when unreadOnly is set.
+func (s *NotificationService) List(ctx context.Context, authorID uint, unreadOnly bool, limit, offset int) (*NotificationListResult, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	total, err := s.repo.Count(ctx, authorID, unreadOnly)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.repo.List(ctx, authorID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &NotificationListResult{Items: items, Total: total}, nil
+}
+
+func (s *NotificationService) UnreadCount(ctx context.Context, authorID uint) (int64, error) {
+	return s.repo.Count(ctx, authorID, true)
+}
+
+// MarkRead marks one notification of authorID as read. Returns ErrNotificationNotFound for other authors' notifications.
+func (s *NotificationService) MarkRead(ctx context.Context, authorID, id uint) error {
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		ok, err := s.repo.MarkRead(ctx, authorID, id, time.Now())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrNotificationNotFound
+		}
+		return record(ctx, s.outbox, NotificationsTopic(authorID), EventNotificationRead, notificationReadEvent{ID: id})
+	})
+}
+
+// MarkAllRead marks every notification of authorID as read and returns how many were unread.
+func (s *NotificationService) MarkAllRead(ctx context.Context, authorID uint) (int64, error) {
+	var n int64
+	err := s.tx.Do(ctx, func(ctx context.Context) error {
+		var err error
+		if n, err = s.repo.MarkAllRead(ctx, authorID, time.Now()); err != nil || n == 0 {
+			return err
+		}
+		return record(ctx, s.outbox, NotificationsTopic(authorID), EventNotificationRead, notificationReadEvent{All: true})
+	})
+	return n, err
+}
+
+// WatchCategory makes authorID receive new_post_in_category notifications for categoryID.
+func (s *NotificationService) WatchCategory(ctx context.Context, authorID, categoryID uint) error {
+	if _, err := s.categoryRepo.GetByID(ctx, categoryID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCategoryNotFound
+		}
+		return err
+	}
+	return s.repo.Watch(ctx, authorID, categoryID)
+}
+
+func (s *NotificationService) UnwatchCategory(ctx context.Context, authorID, categoryID uint) error {
+	return s.repo.Unwatch(ctx, authorID, categoryID)
+}
+
+func (s *NotificationService) Watches(ctx context.Context, authorID uint) ([]model.CategoryWatch, error) {
+	return s.repo.Watches(ctx, authorID)
+}
+
+// Preferences returns whether each notification type is enabled for authorID.
+func (s *NotificationService) Preferences(ctx context.Context, authorID uint) (map[model.NotificationType]bool, error) {
+	stored, err := s.repo.Preferences(ctx, authorID)
+	if err != nil {
+		return nil, err
+	}
+	prefs := make(map[model.NotificationType]bool, len(model.NotificationTypes))
+	for _, t := range model.NotificationTypes {
+		enabled, ok := stored[t]
+		prefs[t] = !ok || enabled
+	}
+	return prefs, nil
+}
+
+// UpdatePreferences switches the given types on or off and returns all preferences. Unknown types are rejected.
+func (s *NotificationService) UpdatePreferences(ctx context.Context, authorID uint, changes map[model.NotificationType]bool) (map[model.NotificationType]bool, error) {
+	for t := range changes {
+		if !isNotificationType(t) {
+			return nil, fmt.Errorf("%w %q", ErrUnknownNotificationType, t)
+		}
+	}
+	if err := s.repo.SetPreferences(ctx, authorID, changes); err != nil {
+		return nil, err
+	}
+	return s.Preferences(ctx, authorID)
+}
+
+func isNotificationType(t model.NotificationType) bool {
+	for _, known := range model.NotificationTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
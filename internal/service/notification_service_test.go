@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/mail"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/outbox"
+	"github.com/aliakbar-zohour/go_blog/internal/pubsub"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+)
+
+func TestMentionHandles(t *testing.T) {
+	got := mentionHandles("Thanks @Jane_Doe and @bob! Mail me at me@example.com, cc @janedoe.")
+	if strings.Join(got, ",") != "janedoe,bob" {
+		t.Errorf("mentionHandles = %v", got)
+	}
+}
+
+func TestCommentService_CreateNotifiesAuthorsAndRepliedCommenters(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{SMTPFrom: "noreply@example.com", PublicBaseURL: "https://blog.example.com"}
+	mailer := mail.NewMemoryMailer()
+	posts, commentRepo, events := repository.NewPostRepository(db), repository.NewCommentRepository(db), repository.NewOutboxEventRepository(db)
+	notifications := NewNotificationService(repository.NewNotificationRepository(db), repository.NewAuthorRepository(db), repository.NewCategoryRepository(db), posts, commentRepo, mailer, mail.NewTemplates("", mail.DefaultLocale), repository.NewTransactor(db), nil, cfg)
+	relay := outbox.New(events, outbox.Options{})
+	relay.Add(notifications, outbox.Shared)
+	comments := NewCommentService(commentRepo, posts, repository.NewTransactor(db), events)
+	ctx := context.Background()
+	// create adds a comment and hands its event to the notifications, like the relay of a running server.
+	create := func(postID uint, parentID *uint, body string, authorID *uint) (*model.Comment, error) {
+		t.Helper()
+		c, err := comments.Create(ctx, postID, parentID, body, "", authorID)
+		if _, rerr := relay.ProcessOnce(ctx); rerr != nil {
+			t.Fatalf("relay: %v", rerr)
+		}
+		return c, err
+	}
+	emailA, emailB := "a@example.com", "b@example.com"
+	a := &model.Author{Name: "Alice", Email: &emailA}
+	b := &model.Author{Name: "Bob", Email: &emailB, Locale: "fa"}
+	c := &model.Author{Name: "Carol"}
+	for _, au := range []*model.Author{a, b, c} {
+		db.Create(au)
+	}
+	post := &model.Post{Title: "Lisbon", Body: "Trams", AuthorID: a.ID}
+	other := &model.Post{Title: "Porto", Body: "Bridges", AuthorID: a.ID}
+	db.Create(post)
+	db.Create(other)
+	received := func(id uint) []model.Notification {
+		var ns []model.Notification
+		db.Where("author_id = ?", id).Order("id").Find(&ns)
+		return ns
+	}
+
+	// A comment on Alice's post notifies Alice.
+	top, err := create(post.ID, nil, "Lovely   photos!", &b.ID)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if ns := received(a.ID); len(ns) != 1 || ns[0].Type != model.NotificationCommentOnPost || ns[0].ActorName != "Bob" || ns[0].CommentID == nil || *ns[0].CommentID != top.ID {
+		t.Fatalf("post author notifications = %+v", ns)
+	}
+	msgs := mailer.Messages()
+	if len(msgs) != 1 || msgs[0].To[0] != emailA || !strings.Contains(msgs[0].Subject, "Bob commented on your post") || !strings.Contains(msgs[0].Text, "Lovely photos!") {
+		t.Fatalf("unexpected emails: %+v", msgs)
+	}
+
+	// An event handed over again notifies nobody twice.
+	var handled []model.OutboxEvent
+	db.Order("id").Find(&handled)
+	if err := notifications.Handle(ctx, handled); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if len(received(a.ID)) != 1 || len(mailer.Messages()) != 1 {
+		t.Fatalf("redelivered event notified again: %d mails", len(mailer.Messages()))
+	}
+
+	// Alice replying on her own post notifies Bob only.
+	mailer.Reset()
+	if _, err := create(post.ID, &top.ID, "Thanks!", &a.ID); err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	if ns := received(b.ID); len(ns) != 1 || ns[0].Type != model.NotificationCommentReply {
+		t.Fatalf("replied commenter notifications = %+v", ns)
+	}
+	if n := len(received(a.ID)); n != 1 {
+		t.Errorf("author was notified about their own reply (%d notifications)", n)
+	}
+	if msgs := mailer.Messages(); len(msgs) != 1 || msgs[0].To[0] != emailB || msgs[0].Locale != "fa" {
+		t.Errorf("reply email = %+v", msgs)
+	}
+
+	// A third person's reply reaches both; Carol has no email, so only records are stored for her.
+	mailer.Reset()
+	if _, err := create(post.ID, &top.ID, "Agreed", &c.ID); err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	if len(received(a.ID)) != 2 || len(received(b.ID)) != 2 || len(mailer.Messages()) != 2 {
+		t.Errorf("want both post author and parent commenter notified, got %d mails", len(mailer.Messages()))
+	}
+
+	// Switched-off types are neither stored nor emailed.
+	if _, err := notifications.UpdatePreferences(ctx, a.ID, map[model.NotificationType]bool{"bogus": true}); !errors.Is(err, ErrUnknownNotificationType) {
+		t.Errorf("want ErrUnknownNotificationType, got %v", err)
+	}
+	prefs, err := notifications.UpdatePreferences(ctx, a.ID, map[model.NotificationType]bool{model.NotificationCommentOnPost: false})
+	if err != nil || prefs[model.NotificationCommentOnPost] || !prefs[model.NotificationCommentReply] {
+		t.Fatalf("UpdatePreferences: %v %v", prefs, err)
+	}
+	mailer.Reset()
+	if _, err := create(post.ID, nil, "Another one", &c.ID); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if len(received(a.ID)) != 2 || len(mailer.Messages()) != 0 {
+		t.Errorf("disabled preference still notified: %d mails", len(mailer.Messages()))
+	}
+
+	if _, err := create(other.ID, &top.ID, "Wrong thread", &c.ID); !errors.Is(err, ErrParentCommentNotFound) {
+		t.Errorf("parent from another post: want ErrParentCommentNotFound, got %v", err)
+	}
+}
+
+func TestNotificationService_InboxMentionsAndWatches(t *testing.T) {
+	db := setupTestDB(t)
+	hub := pubsub.New(16)
+	events := repository.NewOutboxEventRepository(db)
+	relay := outbox.New(events, outbox.Options{})
+	posts, commentRepo := repository.NewPostRepository(db), repository.NewCommentRepository(db)
+	svc := NewNotificationService(repository.NewNotificationRepository(db), repository.NewAuthorRepository(db), repository.NewCategoryRepository(db), posts, commentRepo, mail.NewMemoryMailer(), mail.NewTemplates("", mail.DefaultLocale), repository.NewTransactor(db), events, &config.Config{})
+	relay.Add(svc, outbox.Shared)
+	relay.Add(outbox.HubSink{Hub: hub}, outbox.Local)
+	comments := NewCommentService(commentRepo, posts, repository.NewTransactor(db), events)
+	ctx := context.Background()
+	relayed := func() {
+		t.Helper()
+		if _, err := relay.ProcessOnce(ctx); err != nil {
+			t.Fatalf("relay: %v", err)
+		}
+	}
+	alice, bob, carol := &model.Author{Name: "Alice"}, &model.Author{Name: "Bob"}, &model.Author{Name: "Carol Ann"}
+	for _, a := range []*model.Author{alice, bob, carol} {
+		db.Create(a)
+	}
+	category := &model.Category{Name: "Travel"}
+	db.Create(category)
+	if err := svc.WatchCategory(ctx, bob.ID, 999); !errors.Is(err, ErrCategoryNotFound) {
+		t.Errorf("watching unknown category: want ErrCategoryNotFound, got %v", err)
+	}
+	for _, id := range []uint{bob.ID, bob.ID, carol.ID, alice.ID} {
+		if err := svc.WatchCategory(ctx, id, category.ID); err != nil {
+			t.Fatalf("WatchCategory: %v", err)
+		}
+	}
+
+	// A mentioned watcher gets the mention only; the post's own author gets nothing.
+	live, _, _ := hub.Subscribe(NotificationsTopic(bob.ID), 0)
+	post := &model.Post{Title: "Lisbon", Body: "Shot with @carol_ann, ask @alice.", AuthorID: alice.ID, CategoryID: category.ID}
+	db.Create(post)
+	if err := record(ctx, events, PostsTopic, EventPostCreated, post); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	relayed()
+	select {
+	case ev := <-live.C:
+		if ev.Type != EventNotificationCreated || !strings.Contains(string(ev.Data), `"new_post_in_category"`) {
+			t.Errorf("live event = %+v", ev)
+		}
+	default:
+		t.Error("notification was not published to the author's topic")
+	}
+	types := func(id uint) []string {
+		res, err := svc.List(ctx, id, false, 0, 0)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		var ts []string
+		for _, n := range res.Items {
+			ts = append(ts, string(n.Type))
+		}
+		return ts
+	}
+	if got := strings.Join(types(carol.ID), ","); got != "mention" {
+		t.Errorf("carol: %s", got)
+	}
+	if got := strings.Join(types(bob.ID), ","); got != "new_post_in_category" {
+		t.Errorf("bob: %s", got)
+	}
+	if got := types(alice.ID); len(got) != 0 {
+		t.Errorf("alice notified about her own post: %v", got)
+	}
+
+	// Private posts notify neither watchers nor mentioned authors.
+	hidden := &model.Post{Title: "Draft", Body: "For @carol_ann", AuthorID: alice.ID, CategoryID: category.ID, Private: true}
+	db.Create(hidden)
+	if err := record(ctx, events, PostTopic(hidden.ID), EventPostCreated, hidden); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	relayed()
+	if got := len(types(carol.ID)) + len(types(bob.ID)); got != 2 {
+		t.Errorf("private post notified: carol %v, bob %v", types(carol.ID), types(bob.ID))
+	}
+
+	// Mentioning the post's author in a comment does not notify her twice.
+	if _, err := comments.Create(ctx, post.ID, nil, "Great trip @Alice", "", &bob.ID); err != nil {
+		t.Fatalf("comment: %v", err)
+	}
+	relayed()
+	if got := strings.Join(types(alice.ID), ","); got != "comment_on_post" {
+		t.Errorf("alice: %s", got)
+	}
+	n, _ := svc.List(ctx, alice.ID, false, 0, 0)
+	if it := n.Items[0]; it.ActorName != "Bob" || it.PostTitle != "Lisbon" || it.Excerpt != "Great trip @Alice" {
+		t.Errorf("unexpected notification %+v", it)
+	}
+
+	// Read state.
+	if _, err := comments.Create(ctx, post.ID, nil, "Me too @bob", "", &carol.ID); err != nil {
+		t.Fatalf("comment: %v", err)
+	}
+	relayed()
+	if c, _ := svc.UnreadCount(ctx, bob.ID); c != 2 {
+		t.Fatalf("bob unread = %d, want 2", c)
+	}
+	first := n.Items[0]
+	if err := svc.MarkRead(ctx, bob.ID, first.ID); !errors.Is(err, ErrNotificationNotFound) {
+		t.Errorf("marking someone else's notification: want ErrNotificationNotFound, got %v", err)
+	}
+	unread, _ := svc.List(ctx, bob.ID, true, 0, 0)
+	if err := svc.MarkRead(ctx, bob.ID, unread.Items[0].ID); err != nil {
+		t.Fatalf("MarkRead: %v", err)
+	}
+	if err := svc.MarkRead(ctx, bob.ID, unread.Items[0].ID); err != nil {
+		t.Errorf("MarkRead twice: %v", err)
+	}
+	if unread, _ = svc.List(ctx, bob.ID, true, 0, 0); unread.Total != 1 {
+		t.Errorf("unread total = %d, want 1", unread.Total)
+	}
+	if updated, err := svc.MarkAllRead(ctx, bob.ID); err != nil || updated != 1 {
+		t.Errorf("MarkAllRead = %d %v", updated, err)
+	}
+	if c, _ := svc.UnreadCount(ctx, bob.ID); c != 0 {
+		t.Errorf("bob unread after MarkAllRead = %d", c)
+	}
+
+	if err := svc.UnwatchCategory(ctx, bob.ID, category.ID); err != nil {
+		t.Fatalf("UnwatchCategory: %v", err)
+	}
+	if w, _ := svc.Watches(ctx, bob.ID); len(w) != 0 {
+		t.Errorf("bob still watches %v", w)
+	}
+}
@@ -4,7 +4,9 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"mime/multipart"
+	"path/filepath"
 	"strings"
 
 	"github.com/aliakbar-zohour/go_blog/internal/config"
@@ -15,18 +17,26 @@ import (
 )
 
 type PostService struct {
-	postRepo  *repository.PostRepository
-	mediaRepo *repository.MediaRepository
-	cfg       *config.Config
+	postRepo   repository.PostStore
+	mediaRepo  repository.MediaStore
+	uploadRepo repository.UploadStore
+	blobRepo   repository.BlobStore
+	urls       *MediaURLService
+	usage      *UsageService
+	tx         repository.TxRunner
+	outbox     repository.EventStore
+	cfg        *config.Config
 }
 
-func NewPostService(postRepo *repository.PostRepository, mediaRepo *repository.MediaRepository, cfg *config.Config) *PostService {
-	return &PostService{postRepo: postRepo, mediaRepo: mediaRepo, cfg: cfg}
+// NewPostService returns a PostService. Changes run in transactions of tx and record their events in outbox,
+// whose post.created events notify mentioned authors and category watchers; outbox may be nil to record no events.
+func NewPostService(postRepo repository.PostStore, mediaRepo repository.MediaStore, uploadRepo repository.UploadStore, blobRepo repository.BlobStore, urls *MediaURLService, usage *UsageService, tx repository.TxRunner, outbox repository.EventStore, cfg *config.Config) *PostService {
+	return &PostService{postRepo: postRepo, mediaRepo: mediaRepo, uploadRepo: uploadRepo, blobRepo: blobRepo, urls: urls, usage: usage, tx: tx, outbox: outbox, cfg: cfg}
 }
 
 const maxTitleLen = 500
 
-func (s *PostService) Create(ctx context.Context, title, body string, authorID, categoryID *uint, banner *multipart.FileHeader, files []*multipart.FileHeader) (*model.Post, error) {
+func (s *PostService) Create(ctx context.Context, title, body string, authorID, categoryID *uint, private bool, banner *multipart.FileHeader, files []*multipart.FileHeader) (*model.Post, error) {
 	title = strings.TrimSpace(title)
 	if title == "" {
 		return nil, errors.New("title is required")
@@ -37,29 +47,52 @@ func (s *PostService) Create(ctx context.Context, title, body string, authorID,
 	if authorID == nil || categoryID == nil {
 		return nil, errors.New("author_id and category_id are required")
 	}
-	post := &model.Post{Title: title, Body: trim(body), AuthorID: *authorID, CategoryID: *categoryID}
-	if err := s.postRepo.Create(ctx, post); err != nil {
+	maxBytes := int64(s.cfg.MaxFileMB * 1024 * 1024)
+	if err := checkFiles(banner, files, maxBytes); err != nil {
 		return nil, err
 	}
-	maxBytes := int64(s.cfg.MaxFileMB * 1024 * 1024)
-	if banner != nil {
-		if path, err := upload.SaveSingleImage(banner, s.cfg.UploadDir, "banners", maxBytes); err == nil {
-			post.BannerPath = path
-			_ = s.postRepo.Update(ctx, post)
-		}
+	if err := s.usage.Check(ctx, *authorID, uploadSize(banner, files)); err != nil {
+		return nil, err
 	}
-	for _, f := range files {
-		m, _, err := upload.SaveFile(f, s.cfg.UploadDir, post.ID, maxBytes)
-		if err != nil {
-			continue
+	stored, err := s.storeFiles(ctx, *authorID, banner, files, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	post := &model.Post{Title: title, Body: trim(body), AuthorID: *authorID, CategoryID: *categoryID, Private: private}
+	var created *model.Post
+	err = s.doWithFiles(ctx, stored, func(ctx context.Context) error {
+		if stored.banner != nil {
+			if err := s.setBanner(ctx, post, stored.banner); err != nil {
+				return err
+			}
+		}
+		if err := s.postRepo.Create(ctx, post); err != nil {
+			return err
 		}
-		_ = s.mediaRepo.Create(ctx, m)
+		if err := s.addMedia(ctx, post.ID, post.AuthorID, stored); err != nil {
+			return err
+		}
+		var err error
+		created, err = s.changed(ctx, post.ID, EventPostCreated, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return s.postRepo.GetByID(ctx, post.ID)
+	return created, nil
 }
 
-func (s *PostService) GetByID(ctx context.Context, id uint) (*model.Post, error) {
-	return s.postRepo.GetByID(ctx, id)
+// GetByID returns the post as viewerID (0 when anonymous) may see it, with banner and media URLs filled: the
+// media of a private post are only shown, signed, to its author.
+func (s *PostService) GetByID(ctx context.Context, id, viewerID uint) (*model.Post, error) {
+	post, err := s.postRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.urls.DecoratePosts(ctx, viewerID, post); err != nil {
+		return nil, err
+	}
+	return post, nil
 }
 
 // ListResult holds paginated posts and total count.
@@ -68,7 +101,8 @@ type ListResult struct {
 	Total int64        `json:"total"`
 }
 
-func (s *PostService) List(ctx context.Context, limit, offset int, categoryID *uint) (*ListResult, error) {
+// List returns a page of posts as viewerID (0 when anonymous) may see them, like GetByID.
+func (s *PostService) List(ctx context.Context, limit, offset int, categoryID *uint, viewerID uint) (*ListResult, error) {
 	if limit <= 0 || limit > 100 {
 		limit = 20
 	}
@@ -83,10 +117,17 @@ func (s *PostService) List(ctx context.Context, limit, offset int, categoryID *u
 	if err != nil {
 		return nil, err
 	}
+	list := make([]*model.Post, len(posts))
+	for i := range posts {
+		list[i] = &posts[i]
+	}
+	if err := s.urls.DecoratePosts(ctx, viewerID, list...); err != nil {
+		return nil, err
+	}
 	return &ListResult{Items: posts, Total: total}, nil
 }
 
-func (s *PostService) Update(ctx context.Context, id uint, title, body string, authorID, categoryID *uint, banner *multipart.FileHeader, files []*multipart.FileHeader) (*model.Post, error) {
+func (s *PostService) Update(ctx context.Context, id uint, title, body string, authorID, categoryID *uint, private *bool, banner *multipart.FileHeader, files []*multipart.FileHeader) (*model.Post, error) {
 	post, err := s.postRepo.GetByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -94,6 +135,7 @@ func (s *PostService) Update(ctx context.Context, id uint, title, body string, a
 		}
 		return nil, err
 	}
+	before := *post
 	if title != "" {
 		t := strings.TrimSpace(title)
 		if len(t) > maxTitleLen {
@@ -110,28 +152,412 @@ func (s *PostService) Update(ctx context.Context, id uint, title, body string, a
 	if categoryID != nil {
 		post.CategoryID = *categoryID
 	}
-	if banner != nil {
-		maxBytes := int64(s.cfg.MaxFileMB * 1024 * 1024)
-		if path, err := upload.SaveSingleImage(banner, s.cfg.UploadDir, "banners", maxBytes); err == nil {
-			post.BannerPath = path
+	if private != nil {
+		post.Private = *private
+	}
+	maxBytes := int64(s.cfg.MaxFileMB * 1024 * 1024)
+	if err := checkFiles(banner, files, maxBytes); err != nil {
+		return nil, err
+	}
+	if err := s.usage.Check(ctx, post.AuthorID, uploadSize(banner, files)); err != nil {
+		return nil, err
+	}
+	stored, err := s.storeFiles(ctx, post.AuthorID, banner, files, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	var updated *model.Post
+	err = s.doWithFiles(ctx, stored, func(ctx context.Context) error {
+		oldBanner := ""
+		if b := stored.banner; b != nil && b.Path != post.BannerPath {
+			oldBanner = post.BannerPath
+			if err := s.setBanner(ctx, post, b); err != nil {
+				return err
+			}
 		}
+		if err := s.postRepo.Update(ctx, post); err != nil {
+			return err
+		}
+		if oldBanner != "" {
+			if err := s.blobRepo.Release(ctx, oldBanner); err != nil {
+				return err
+			}
+			if err := s.usage.Release(ctx, post.AuthorID, model.MediaTypeImage, upload.Size(s.cfg.UploadDir, oldBanner)); err != nil {
+				return err
+			}
+		}
+		if err := s.addMedia(ctx, post.ID, post.AuthorID, stored); err != nil {
+			return err
+		}
+		var err error
+		updated, err = s.changed(ctx, id, EventPostUpdated, &before)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	if err := s.postRepo.Update(ctx, post); err != nil {
+	return updated, nil
+}
+
+// changed reloads a created or updated post, refreshes which of the files it uses, or used before (nil for a new
+// post), need a signature and records the event: new posts are streamed on PostsTopic, except private ones, and
+// changes on the post's topic. The event carries the post as anonymous readers see it; the post returned is the
+// one for its author, who made the change. Call it in the transaction of the change.
+func (s *PostService) changed(ctx context.Context, id uint, typ string, before *model.Post) (*model.Post, error) {
+	post, err := s.postRepo.GetByID(ctx, id)
+	if err != nil {
 		return nil, err
 	}
-	maxBytes := int64(s.cfg.MaxFileMB * 1024 * 1024)
-	for _, f := range files {
-		m, _, err := upload.SaveFile(f, s.cfg.UploadDir, post.ID, maxBytes)
+	if err := s.urls.RefreshPrivacy(ctx, before, post); err != nil {
+		return nil, err
+	}
+	public, err := s.GetByID(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	topic := PostTopic(id)
+	if typ == EventPostCreated && !public.Private {
+		topic = PostsTopic
+	}
+	if err := record(ctx, s.outbox, topic, typ, public); err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, id, public.AuthorID)
+}
+
+// storedFiles are the files of a request, stored as blobs before its transaction begins: hashing and decoding
+// them does not hold a database connection.
+type storedFiles struct {
+	banner *upload.Blob
+	media  []*model.Media
+	blobs  []*upload.Blob // the blob of each media item
+}
+
+// all returns every stored blob.
+func (f *storedFiles) all() []*upload.Blob {
+	if f.banner == nil {
+		return f.blobs
+	}
+	return append([]*upload.Blob{f.banner}, f.blobs...)
+}
+
+// storeFiles stores the banner image and the files of a request for authorID's media library. When a file
+// fails, the files stored before it are removed again.
+func (s *PostService) storeFiles(ctx context.Context, authorID uint, banner *multipart.FileHeader, files []*multipart.FileHeader, maxBytes int64) (*storedFiles, error) {
+	stored := &storedFiles{}
+	if banner != nil {
+		b, err := upload.SaveSingleImage(banner, s.cfg.UploadDir, maxBytes)
 		if err != nil {
+			return nil, fileError("banner", 0, banner, err)
+		}
+		stored.banner = b
+	}
+	for i, f := range files {
+		m, b, err := upload.SaveFile(f, s.cfg.UploadDir, authorID, maxBytes)
+		if err != nil {
+			s.discard(ctx, stored.all()...)
+			return nil, fileError("files", i, f, err)
+		}
+		stored.media = append(stored.media, m)
+		stored.blobs = append(stored.blobs, b)
+	}
+	return stored, nil
+}
+
+// doWithFiles runs fn in a transaction and removes the newly stored files of stored if it fails, or if an
+// outer transaction it joined rolls back later.
+func (s *PostService) doWithFiles(ctx context.Context, stored *storedFiles, fn func(ctx context.Context) error) error {
+	err := s.tx.Do(ctx, func(ctx context.Context) error {
+		s.discardOnRollback(ctx, stored.all()...)
+		return fn(ctx)
+	})
+	if err != nil {
+		// Also covers a transaction that could not begin, and running without one; removing twice is harmless.
+		s.discard(ctx, stored.all()...)
+	}
+	return err
+}
+
+// setBanner charges a stored banner to the post's author and sets it on the post (not saved).
+func (s *PostService) setBanner(ctx context.Context, post *model.Post, b *upload.Blob) error {
+	if err := s.blobRepo.Acquire(ctx, b.Hash, b.Path, b.Size); err != nil {
+		return err
+	}
+	if err := s.usage.Record(ctx, post.AuthorID, model.MediaTypeImage, b.Size); err != nil {
+		return err
+	}
+	post.BannerPath = b.Path
+	post.BannerBlurHash, post.BannerColor = b.BlurHash, b.DominantColor
+	return nil
+}
+
+// addMedia adds the stored files to authorID's media library, charges them to the author and attaches them to
+// the post. Call it in the transaction of the change.
+func (s *PostService) addMedia(ctx context.Context, postID, authorID uint, stored *storedFiles) error {
+	ids := make([]uint, 0, len(stored.media))
+	for i, m := range stored.media {
+		b := stored.blobs[i]
+		if err := s.mediaRepo.Create(ctx, m); err != nil {
+			return err
+		}
+		if err := s.blobRepo.Acquire(ctx, b.Hash, b.Path, b.Size); err != nil {
+			return err
+		}
+		if err := s.usage.Record(ctx, authorID, m.Type, b.Size); err != nil {
+			return err
+		}
+		ids = append(ids, m.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.postRepo.AttachMedia(ctx, postID, ids...)
+}
+
+// discard removes the newly stored files of blobs, unless a blob row for the same content was committed
+// meanwhile by another request. It runs even when the request was cancelled.
+func (s *PostService) discard(ctx context.Context, blobs ...*upload.Blob) {
+	discardBlobs(ctx, s.blobRepo, s.cfg.UploadDir, blobs...)
+}
+
+// discardBlobs removes from uploadDir the newly stored files of blobs that have no blob row in blobRepo.
+func discardBlobs(ctx context.Context, blobRepo repository.BlobStore, uploadDir string, blobs ...*upload.Blob) {
+	ctx = context.WithoutCancel(ctx)
+	for _, b := range blobs {
+		if b == nil || !b.New {
 			continue
 		}
-		_ = s.mediaRepo.Create(ctx, m)
+		if _, err := blobRepo.GetByPath(ctx, b.Path); errors.Is(err, gorm.ErrRecordNotFound) {
+			_ = upload.Remove(uploadDir, b.Path)
+		}
 	}
-	return s.postRepo.GetByID(ctx, id)
 }
 
+// discardOnRollback discards blobs if the transaction of ctx rolls back.
+func (s *PostService) discardOnRollback(ctx context.Context, blobs ...*upload.Blob) {
+	repository.OnRollback(ctx, func(ctx context.Context) {
+		s.discard(ctx, blobs...)
+	})
+}
+
+// FileError is a rejected file of a request: its form field, its position among that field's files and why.
+type FileError struct {
+	Field    string `json:"field" example:"files"`
+	Index    int    `json:"index" example:"1"`
+	Filename string `json:"filename" example:"notes.pdf"`
+	Error    string `json:"error" example:"file type not allowed"`
+}
+
+// InvalidFilesError is returned when files of a request fail validation; the change was not made.
+type InvalidFilesError struct {
+	Files []FileError `json:"files"`
+}
+
+func (e *InvalidFilesError) Error() string {
+	if len(e.Files) == 1 {
+		return e.Files[0].Filename + ": " + e.Files[0].Error
+	}
+	return fmt.Sprintf("%d files are invalid", len(e.Files))
+}
+
+// checkFiles validates the type and declared size of every file of a request before anything is stored and
+// reports all invalid ones at once.
+func checkFiles(banner *multipart.FileHeader, files []*multipart.FileHeader, maxBytes int64) error {
+	var invalid []FileError
+	if banner != nil {
+		if err := upload.CheckImage(banner, maxBytes); err != nil {
+			invalid = append(invalid, newFileError("banner", 0, banner, err))
+		}
+	}
+	for i, f := range files {
+		if err := upload.CheckFile(f, maxBytes); err != nil {
+			invalid = append(invalid, newFileError("files", i, f, err))
+		}
+	}
+	if len(invalid) > 0 {
+		return &InvalidFilesError{Files: invalid}
+	}
+	return nil
+}
+
+// fileError turns a validation error found while storing a file (e.g. more bytes than declared) into an
+// *InvalidFilesError; other errors are returned as they are.
+func fileError(field string, index int, f *multipart.FileHeader, err error) error {
+	if errors.Is(err, upload.ErrTypeNotAllowed) || errors.Is(err, upload.ErrTooLarge) {
+		return &InvalidFilesError{Files: []FileError{newFileError(field, index, f, err)}}
+	}
+	return err
+}
+
+func newFileError(field string, index int, f *multipart.FileHeader, err error) FileError {
+	return FileError{Field: field, Index: index, Filename: filepath.Base(f.Filename), Error: err.Error()}
+}
+
+// uploadSize is the total declared size of the files in a request, used for the quota check before storing.
+func uploadSize(banner *multipart.FileHeader, files []*multipart.FileHeader) int64 {
+	var n int64
+	if banner != nil {
+		n += banner.Size
+	}
+	for _, f := range files {
+		n += f.Size
+	}
+	return n
+}
+
+// AttachUpload moves a finished resumable upload owned by authorID into the author's media library, attaches it
+// to the post and removes the upload record.
+func (s *PostService) AttachUpload(ctx context.Context, postID uint, uploadID string, authorID uint) (*model.Post, error) {
+	post, err := s.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	u, err := s.uploadRepo.GetByID(ctx, uploadID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	if u.AuthorID != authorID {
+		return nil, ErrUploadNotFound
+	}
+	if !u.Completed() {
+		return nil, ErrUploadIncomplete
+	}
+	var updated *model.Post
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		// Deleting first makes a concurrent attach of the same upload wait here and then find it gone.
+		if err := s.uploadRepo.Delete(ctx, u.ID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUploadNotFound
+			}
+			return err
+		}
+		m, b, err := upload.ImportUpload(s.cfg.UploadDir, u.Path, u.Filename, u.AuthorID, u.Length)
+		if err != nil {
+			return err
+		}
+		s.discardOnRollback(ctx, b)
+		if err := s.mediaRepo.Create(ctx, m); err != nil {
+			return err
+		}
+		if err := s.blobRepo.Acquire(ctx, b.Hash, b.Path, b.Size); err != nil {
+			return err
+		}
+		// The upload's reservation becomes the file's usage.
+		if err := s.usage.RecordReserved(ctx, u.AuthorID, m.Type, b.Size, u.Length); err != nil {
+			return err
+		}
+		if err := s.postRepo.AttachMedia(ctx, post.ID, m.ID); err != nil {
+			return err
+		}
+		// The partial file stays until the upload row is gone, so a rolled back attach can be retried.
+		repository.AfterCommit(ctx, func() {
+			_ = upload.Remove(s.cfg.UploadDir, u.Path)
+		})
+		updated, err = s.changed(ctx, post.ID, EventPostUpdated, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// AttachMedia attaches items of authorID's media library to the post. Returns nil post when it does not exist
+// and ErrMediaNotFound when an id is unknown or belongs to another author.
+func (s *PostService) AttachMedia(ctx context.Context, postID, authorID uint, mediaIDs []uint) (*model.Post, error) {
+	if _, err := s.postRepo.GetByID(ctx, postID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	items, err := s.mediaRepo.GetByIDs(ctx, mediaIDs)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[uint]bool, len(items))
+	for _, m := range items {
+		if m.AuthorID == authorID {
+			owned[m.ID] = true
+		}
+	}
+	for _, id := range mediaIDs {
+		if !owned[id] {
+			return nil, ErrMediaNotFound
+		}
+	}
+	var updated *model.Post
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.postRepo.AttachMedia(ctx, postID, mediaIDs...); err != nil {
+			return err
+		}
+		var err error
+		updated, err = s.changed(ctx, postID, EventPostUpdated, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DetachMedia removes a media item from the post; it stays in the author's library.
+func (s *PostService) DetachMedia(ctx context.Context, postID, mediaID uint) (*model.Post, error) {
+	post, err := s.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var updated *model.Post
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.postRepo.DetachMedia(ctx, postID, mediaID); err != nil {
+			return err
+		}
+		var err error
+		updated, err = s.changed(ctx, postID, EventPostUpdated, post)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Delete soft-deletes the post, releases its banner blob and gives the author back its storage.
+// Attached media stay in the author's library until deleted there.
 func (s *PostService) Delete(ctx context.Context, id uint) error {
-	return s.postRepo.Delete(ctx, id)
+	post, err := s.postRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.postRepo.Delete(ctx, id); err != nil {
+			return err
+		}
+		if err := s.urls.RefreshPrivacy(ctx, post); err != nil {
+			return err
+		}
+		if post.BannerPath != "" {
+			if err := s.blobRepo.Release(ctx, post.BannerPath); err != nil {
+				return err
+			}
+			if err := s.usage.Release(ctx, post.AuthorID, model.MediaTypeImage, upload.Size(s.cfg.UploadDir, post.BannerPath)); err != nil {
+				return err
+			}
+		}
+		return record(ctx, s.outbox, PostTopic(id), EventPostDeleted, deletedEvent{ID: id})
+	})
 }
 
 func trim(s string) string {
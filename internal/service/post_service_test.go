@@ -2,38 +2,51 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"mime/multipart"
+	"net/url"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/memrepo"
 	"github.com/aliakbar-zohour/go_blog/internal/model"
 	"github.com/aliakbar-zohour/go_blog/internal/repository"
-	"gorm.io/driver/sqlite"
+	"github.com/aliakbar-zohour/go_blog/internal/testdb"
 	"gorm.io/gorm"
 )
 
+// setupTestDB returns a migrated in-memory database of its own for each test, so rows do not leak between tests.
 func setupTestDB(t *testing.T) *gorm.DB {
-	t.Helper()
-	// SQLite driver requires CGO on Windows; skip if unavailable.
-	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
-	if err != nil {
-		t.Skipf("sqlite (CGO) not available: %v", err)
-	}
-	if err := db.AutoMigrate(&model.Post{}, &model.Media{}, &model.Author{}, &model.Category{}); err != nil {
-		t.Fatalf("migrate: %v", err)
-	}
-	return db
+	return testdb.Open(t)
+}
+
+// newMemPostService wires a PostService and its collaborators on the in-memory repositories of db.
+func newMemPostService(db *memrepo.DB, cfg *config.Config) *PostService {
+	usage := NewUsageService(memrepo.NewUsageRepository(db), memrepo.NewAuthorRepository(db), cfg)
+	urls := NewMediaURLService(memrepo.NewStorageRepository(db), cfg)
+	return NewPostService(memrepo.NewPostRepository(db), memrepo.NewMediaRepository(db), memrepo.NewUploadRepository(db), memrepo.NewBlobRepository(db), urls, usage, memrepo.NewTransactor(), nil, cfg)
+}
+
+// newPostService wires a PostService and its collaborators on db, for tests that need transactions.
+func newPostService(db *gorm.DB, cfg *config.Config) *PostService {
+	usage := NewUsageService(repository.NewUsageRepository(db), repository.NewAuthorRepository(db), cfg)
+	urls := NewMediaURLService(repository.NewStorageRepository(db), cfg)
+	return NewPostService(repository.NewPostRepository(db), repository.NewMediaRepository(db), repository.NewUploadRepository(db), repository.NewBlobRepository(db), urls, usage, repository.NewTransactor(db), nil, cfg)
 }
 
 func TestPostService_List_ReturnsTotalAndItems(t *testing.T) {
-	db := setupTestDB(t)
-	postRepo := repository.NewPostRepository(db)
-	mediaRepo := repository.NewMediaRepository(db)
+	db := memrepo.New()
+	postRepo := memrepo.NewPostRepository(db)
 	cfg := &config.Config{UploadDir: "uploads", MaxFileMB: 50}
-	svc := NewPostService(postRepo, mediaRepo, cfg)
+	svc := newMemPostService(db, cfg)
 	ctx := context.Background()
 
 	// Empty list
-	result, err := svc.List(ctx, 10, 0, nil)
+	result, err := svc.List(ctx, 10, 0, nil, 0)
 	if err != nil {
 		t.Fatalf("List: %v", err)
 	}
@@ -47,7 +60,7 @@ func TestPostService_List_ReturnsTotalAndItems(t *testing.T) {
 		t.Fatalf("Create post: %v", err)
 	}
 
-	result, err = svc.List(ctx, 10, 0, nil)
+	result, err = svc.List(ctx, 10, 0, nil, 0)
 	if err != nil {
 		t.Fatalf("List: %v", err)
 	}
@@ -60,11 +73,10 @@ func TestPostService_List_ReturnsTotalAndItems(t *testing.T) {
 }
 
 func TestPostService_List_RespectsLimitAndOffset(t *testing.T) {
-	db := setupTestDB(t)
-	postRepo := repository.NewPostRepository(db)
-	mediaRepo := repository.NewMediaRepository(db)
+	db := memrepo.New()
+	postRepo := memrepo.NewPostRepository(db)
 	cfg := &config.Config{UploadDir: "uploads", MaxFileMB: 50}
-	svc := NewPostService(postRepo, mediaRepo, cfg)
+	svc := newMemPostService(db, cfg)
 	ctx := context.Background()
 
 	for i := 0; i < 5; i++ {
@@ -72,7 +84,7 @@ func TestPostService_List_RespectsLimitAndOffset(t *testing.T) {
 		_ = postRepo.Create(ctx, post)
 	}
 
-	result, err := svc.List(ctx, 2, 1, nil)
+	result, err := svc.List(ctx, 2, 1, nil, 0)
 	if err != nil {
 		t.Fatalf("List: %v", err)
 	}
@@ -80,3 +92,118 @@ func TestPostService_List_RespectsLimitAndOffset(t *testing.T) {
 		t.Errorf("want total=5, items=2; got total=%d, items=%d", result.Total, len(result.Items))
 	}
 }
+
+func TestPostService_CreateIsAtomic(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{UploadDir: t.TempDir(), MaxFileMB: 1}
+	svc := newPostService(db, cfg)
+	svc.tx = repository.NewTransactor(db)
+	ctx := context.Background()
+	author, category := uint(1), uint(1)
+	stored := func() int {
+		n := 0
+		_ = filepath.WalkDir(filepath.Join(cfg.UploadDir, "blobs"), func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+	rows := func(v interface{}) (n int64) {
+		db.Model(v).Count(&n)
+		return n
+	}
+
+	// Every invalid file is reported and nothing is stored.
+	files := []*multipart.FileHeader{fileHeader(t, "a.png", "one"), fileHeader(t, "notes.pdf", "text"), fileHeader(t, "clip.avi", "frames")}
+	_, err := svc.Create(ctx, "Lisbon", "", &author, &category, false, fileHeader(t, "banner.txt", "x"), files)
+	var invalid *InvalidFilesError
+	if !errors.As(err, &invalid) || len(invalid.Files) != 3 {
+		t.Fatalf("want 3 invalid files, got %v", err)
+	}
+	if f := invalid.Files[1]; f.Field != "files" || f.Index != 1 || f.Filename != "notes.pdf" {
+		t.Errorf("unexpected file error %+v", f)
+	}
+	if stored() != 0 || rows(&model.Post{}) != 0 || rows(&model.Media{}) != 0 {
+		t.Fatal("rejected request left files or rows behind")
+	}
+
+	// A rollback after the files were stored removes them with the rows.
+	failed := errors.New("later step failed")
+	err = svc.tx.Do(ctx, func(ctx context.Context) error {
+		if _, err := svc.Create(ctx, "Lisbon", "", &author, &category, false, fileHeader(t, "banner.png", "banner"), files[:1]); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Do = %v", err)
+	}
+	if stored() != 0 || rows(&model.Post{}) != 0 || rows(&model.Media{}) != 0 || rows(&model.Blob{}) != 0 {
+		t.Fatal("rolled back create left files or rows behind")
+	}
+
+	post, err := svc.Create(ctx, "Lisbon", "", &author, &category, false, fileHeader(t, "banner.png", "banner"), files[:1])
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if post.BannerPath == "" || len(post.Media) != 1 || stored() != 2 {
+		t.Fatalf("created post %+v with %d files", post, stored())
+	}
+}
+
+func TestPostService_PrivatePostsStayOffThePostsTopic(t *testing.T) {
+	db := memrepo.New()
+	cfg := &config.Config{UploadDir: t.TempDir(), MaxFileMB: 1}
+	events := memrepo.NewEventRepository(db)
+	svc := newMemPostService(db, cfg)
+	svc.outbox = events
+	ctx := context.Background()
+	author, category := uint(1), uint(1)
+	public, err := svc.Create(ctx, "Lisbon", "", &author, &category, false, nil, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	private, err := svc.Create(ctx, "Draft", "", &author, &category, true, nil, nil)
+	if err != nil {
+		t.Fatalf("Create private: %v", err)
+	}
+	topics := map[uint]string{}
+	for _, ev := range events.Events() {
+		var p model.Post
+		if err := json.Unmarshal([]byte(ev.Payload), &p); err != nil {
+			t.Fatal(err)
+		}
+		topics[p.ID] = ev.Topic
+	}
+	if topics[public.ID] != PostsTopic || topics[private.ID] != PostTopic(private.ID) {
+		t.Errorf("post.created topics: %v", topics)
+	}
+}
+
+func TestPostService_BlobPrivacyFollowsPosts(t *testing.T) {
+	db := memrepo.New()
+	cfg := &config.Config{UploadDir: t.TempDir(), MaxFileMB: 1, MediaURLSecret: "secret", MediaURLTTL: time.Minute}
+	svc := newMemPostService(db, cfg)
+	ctx := context.Background()
+	author, category := uint(1), uint(1)
+	post, err := svc.Create(ctx, "Draft", "", &author, &category, true, fileHeader(t, "banner.png", "banner"), nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	path := post.BannerPath
+	unsigned := func() error {
+		return svc.urls.Authorize(ctx, path, url.Values{})
+	}
+	if err := unsigned(); !errors.Is(err, ErrMediaForbidden) {
+		t.Errorf("banner of a private post: want ErrMediaForbidden, got %v", err)
+	}
+	public := false
+	if _, err := svc.Update(ctx, post.ID, "", "", nil, nil, &public, nil, nil); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := unsigned(); err != nil {
+		t.Errorf("banner of a post made public: %v", err)
+	}
+}
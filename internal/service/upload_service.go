@@ -0,0 +1,279 @@
+// service/upload_service: Resumable (tus) uploads: creation, chunk offsets, termination and expiry.
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"github.com/aliakbar-zohour/go_blog/internal/upload"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadExpired        = errors.New("upload expired")
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match")
+	ErrUploadTooLarge       = errors.New("upload exceeds maximum allowed size")
+	ErrUploadIncomplete     = errors.New("upload is not complete")
+	ErrUploadChunkTooLarge  = errors.New("chunk exceeds the remaining upload length")
+	ErrUploadLocked         = errors.New("upload is being written by another request")
+)
+
+// uploadClaimTTL is how long a PATCH's claim on its upload lasts without renewal; a PATCH renews it every third
+// of that while it writes, so the upload frees up soon after a request dies.
+const uploadClaimTTL = time.Minute
+
+type UploadService struct {
+	repo  repository.UploadStore
+	usage *UsageService
+	tx    repository.TxRunner
+	cfg   *config.Config
+}
+
+func NewUploadService(repo repository.UploadStore, usage *UsageService, tx repository.TxRunner, cfg *config.Config) *UploadService {
+	return &UploadService{repo: repo, usage: usage, tx: tx, cfg: cfg}
+}
+
+// MaxSize is the largest upload accepted, in bytes.
+func (s *UploadService) MaxSize() int64 {
+	return int64(s.cfg.MaxFileMB) * 1024 * 1024
+}
+
+// Create registers a new upload of length bytes for filename and creates its empty partial file. The length is
+// reserved against the author's quota until the upload is attached, terminated or expires.
+func (s *UploadService) Create(ctx context.Context, authorID uint, length int64, filename, metadata string) (*model.Upload, error) {
+	if length < 0 {
+		return nil, errors.New("upload length must not be negative")
+	}
+	if length > s.MaxSize() {
+		return nil, ErrUploadTooLarge
+	}
+	filename = filepath.Base(filename)
+	if filename == "" || filename == "." {
+		return nil, errors.New("filename metadata is required")
+	}
+	mediaType, err := upload.MediaTypeFor(filename)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	path, err := upload.CreatePartial(s.cfg.UploadDir, id)
+	if err != nil {
+		return nil, err
+	}
+	u := &model.Upload{
+		ID:        id,
+		AuthorID:  authorID,
+		Type:      mediaType,
+		Filename:  filename,
+		Metadata:  metadata,
+		Path:      path,
+		Length:    length,
+		ExpiresAt: time.Now().Add(s.cfg.UploadExpiry),
+	}
+	if u.Completed() {
+		now := time.Now()
+		u.CompletedAt = &now
+	}
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.usage.Reserve(ctx, authorID, length); err != nil {
+			return err
+		}
+		return s.repo.Create(ctx, u)
+	})
+	if err != nil {
+		_ = upload.Remove(s.cfg.UploadDir, path)
+		return nil, err
+	}
+	return u, nil
+}
+
+// Get returns the author's unexpired upload. Uploads of other authors are reported as not found.
+func (s *UploadService) Get(ctx context.Context, authorID uint, id string) (*model.Upload, error) {
+	u, err := s.owned(ctx, authorID, id)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(u.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	return u, nil
+}
+
+// Append writes a chunk starting at offset. Bytes received before a connection drop are kept, so the
+// returned upload reflects the new offset even when err is non-nil. A chunk longer than the rest of the upload
+// is refused whole, and so is a chunk for an upload another request, on any instance, is still writing. Progress
+// extends the upload's expiry.
+func (s *UploadService) Append(ctx context.Context, authorID uint, id string, offset int64, src io.Reader) (*model.Upload, error) {
+	u, err := s.Get(ctx, authorID, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != u.Offset {
+		return u, ErrUploadOffsetMismatch
+	}
+	token, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	ok, err := s.repo.Claim(ctx, id, offset, token, now.Add(uploadClaimTTL), now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if current, err := s.repo.GetByID(ctx, id); err == nil && current.Offset != offset {
+			return current, ErrUploadOffsetMismatch
+		}
+		return u, ErrUploadLocked
+	}
+	// The claim is settled even when the client went away: the bytes it sent are kept.
+	ctx = context.WithoutCancel(ctx)
+	stop := s.renewClaim(ctx, id, token)
+	n, writeErr := upload.AppendChunk(s.cfg.UploadDir, u.Path, offset, src, u.Length-u.Offset)
+	stop()
+	if n == 0 || errors.Is(writeErr, upload.ErrChunkTooLarge) || errors.Is(writeErr, upload.ErrOffsetMismatch) {
+		if err := s.repo.ReleaseClaim(ctx, id, token); err != nil {
+			log.Printf("[upload] release claim on %s: %v", id, err)
+		}
+		switch {
+		case errors.Is(writeErr, upload.ErrOffsetMismatch):
+			return u, ErrUploadOffsetMismatch
+		case errors.Is(writeErr, upload.ErrChunkTooLarge):
+			return u, ErrUploadChunkTooLarge
+		}
+		return u, writeErr
+	}
+	u.Offset += n
+	if u.Completed() {
+		now := time.Now()
+		u.CompletedAt = &now
+	}
+	u.ExpiresAt = time.Now().Add(s.cfg.UploadExpiry)
+	ok, err = s.repo.Advance(ctx, u, offset, token)
+	if err == nil && !ok {
+		err = ErrUploadLocked
+	}
+	if err != nil {
+		// The new offset was not saved: cut the file back to the saved one, so the client can send the chunk again.
+		if terr := upload.TruncatePartial(s.cfg.UploadDir, u.Path, offset); terr != nil {
+			log.Printf("[upload] truncate %s to %d: %v", id, offset, terr)
+		}
+		if rerr := s.repo.ReleaseClaim(ctx, id, token); rerr != nil {
+			log.Printf("[upload] release claim on %s: %v", id, rerr)
+		}
+		return nil, err
+	}
+	return u, writeErr
+}
+
+// renewClaim keeps the claim of token on upload id alive until the returned stop is called.
+func (s *UploadService) renewClaim(ctx context.Context, id, token string) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(uploadClaimTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.repo.RenewClaim(ctx, id, token, time.Now().Add(uploadClaimTTL)); err != nil {
+					log.Printf("[upload] renew claim on %s: %v", id, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// Terminate deletes the upload and its partial file and gives back its reservation.
+func (s *UploadService) Terminate(ctx context.Context, authorID uint, id string) error {
+	u, err := s.owned(ctx, authorID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.delete(ctx, u); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUploadNotFound
+		}
+		return err
+	}
+	return upload.Remove(s.cfg.UploadDir, u.Path)
+}
+
+// PurgeExpired removes expired uploads and their files and gives back their reservations. Returns the number
+// removed.
+func (s *UploadService) PurgeExpired(ctx context.Context) (int, error) {
+	list, err := s.repo.ListExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, u := range list {
+		if err := upload.Remove(s.cfg.UploadDir, u.Path); err != nil {
+			log.Printf("[upload] remove expired %s: %v", u.ID, err)
+			continue
+		}
+		if err := s.delete(ctx, &u); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue // attached or terminated meanwhile
+			}
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// delete removes the upload row and its reservation together. It returns gorm.ErrRecordNotFound when another
+// request removed the upload first, which then also took the reservation.
+func (s *UploadService) delete(ctx context.Context, u *model.Upload) error {
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, u.ID); err != nil {
+			return err
+		}
+		return s.usage.Unreserve(ctx, u.AuthorID, u.Length)
+	})
+}
+
+func (s *UploadService) owned(ctx context.Context, authorID uint, id string) (*model.Upload, error) {
+	u, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	if u.AuthorID != authorID {
+		return nil, ErrUploadNotFound
+	}
+	return u, nil
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"gorm.io/gorm"
+)
+
+func newUploadService(db *gorm.DB, cfg *config.Config) *UploadService {
+	usage := NewUsageService(repository.NewUsageRepository(db), repository.NewAuthorRepository(db), cfg)
+	return NewUploadService(repository.NewUploadRepository(db), usage, repository.NewTransactor(db), cfg)
+}
+
+func TestUploadService_ResumeAndAttach(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{UploadDir: t.TempDir(), MaxFileMB: 1, UploadExpiry: time.Hour}
+	postRepo := repository.NewPostRepository(db)
+	svc := newUploadService(db, cfg)
+	postSvc := newPostService(db, cfg)
+	ctx := context.Background()
+
+	u, err := svc.Create(ctx, 7, 10, "clip.mp4", "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if u.Type != model.MediaTypeVideo {
+		t.Errorf("type want video, got %s", u.Type)
+	}
+	if _, err := svc.Get(ctx, 8, u.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("other author: want ErrUploadNotFound, got %v", err)
+	}
+	if u, err = svc.Append(ctx, 7, u.ID, 0, strings.NewReader(webmMagic+"o")); err != nil || u.Offset != 5 {
+		t.Fatalf("first chunk: offset=%d err=%v", u.Offset, err)
+	}
+	if _, err := svc.Append(ctx, 7, u.ID, 0, strings.NewReader("again")); !errors.Is(err, ErrUploadOffsetMismatch) {
+		t.Errorf("stale offset: want ErrUploadOffsetMismatch, got %v", err)
+	}
+
+	post := &model.Post{Title: "Video", AuthorID: 7, CategoryID: 1}
+	if err := postRepo.Create(ctx, post); err != nil {
+		t.Fatalf("Create post: %v", err)
+	}
+	if _, err := postSvc.AttachUpload(ctx, post.ID, u.ID, 7); !errors.Is(err, ErrUploadIncomplete) {
+		t.Errorf("attach partial: want ErrUploadIncomplete, got %v", err)
+	}
+	// A chunk longer than the rest is refused whole rather than cut off.
+	if _, err := svc.Append(ctx, 7, u.ID, 5, strings.NewReader("world, extra bytes")); !errors.Is(err, ErrUploadChunkTooLarge) {
+		t.Errorf("long chunk: want ErrUploadChunkTooLarge, got %v", err)
+	}
+	// A PATCH on another instance claimed the upload.
+	if ok, err := svc.repo.Claim(ctx, u.ID, 5, "other", time.Now().Add(time.Minute), time.Now()); !ok || err != nil {
+		t.Fatalf("Claim: %v %v", ok, err)
+	}
+	if _, err := svc.Append(ctx, 7, u.ID, 5, strings.NewReader("world")); !errors.Is(err, ErrUploadLocked) {
+		t.Errorf("concurrent PATCH: want ErrUploadLocked, got %v", err)
+	}
+	if err := svc.repo.ReleaseClaim(ctx, u.ID, "other"); err != nil {
+		t.Fatal(err)
+	}
+	expires := u.ExpiresAt
+	if u, err = svc.Append(ctx, 7, u.ID, 5, strings.NewReader("world")); err != nil || !u.Completed() {
+		t.Fatalf("last chunk: offset=%d err=%v", u.Offset, err)
+	}
+	if !u.ExpiresAt.After(expires) {
+		t.Errorf("expiry not extended by progress: %v, was %v", u.ExpiresAt, expires)
+	}
+	// A rolled back attach removes the blob it stored and keeps the upload, which can be attached again.
+	postSvc.tx = repository.NewTransactor(db)
+	failed := errors.New("later step failed")
+	err = postSvc.tx.Do(ctx, func(ctx context.Context) error {
+		if _, err := postSvc.AttachUpload(ctx, post.ID, u.ID, 7); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Do = %v", err)
+	}
+	if blobs, _ := filepath.Glob(filepath.Join(cfg.UploadDir, "blobs", "*", "*", "*")); len(blobs) != 0 {
+		t.Fatalf("rolled back attach left %v", blobs)
+	}
+	if _, err := svc.Get(ctx, 7, u.ID); err != nil {
+		t.Fatalf("upload gone after a rolled back attach: %v", err)
+	}
+	got, err := postSvc.AttachUpload(ctx, post.ID, u.ID, 7)
+	if err != nil {
+		t.Fatalf("AttachUpload: %v", err)
+	}
+	if len(got.Media) != 1 {
+		t.Fatalf("want 1 media, got %d", len(got.Media))
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.UploadDir, filepath.FromSlash(got.Media[0].Path)))
+	if err != nil || string(data) != webmMagic+"oworld" {
+		t.Errorf("stored content want both chunks, got %q (%v)", data, err)
+	}
+	if _, err := svc.Get(ctx, 7, u.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("attached upload should be gone, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.UploadDir, filepath.FromSlash(u.Path))); !os.IsNotExist(err) {
+		t.Errorf("partial file of the attached upload: %v", err)
+	}
+
+	empty, err := svc.Create(ctx, 7, 0, "empty.png", "")
+	if err != nil || !empty.Completed() || empty.CompletedAt == nil {
+		t.Errorf("empty upload: %+v, %v", empty, err)
+	}
+}
+
+func TestPostService_AttachUpload_SharesBlob(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{UploadDir: t.TempDir(), MaxFileMB: 1, UploadExpiry: time.Hour}
+	postRepo := repository.NewPostRepository(db)
+	blobRepo := repository.NewBlobRepository(db)
+	svc := newUploadService(db, cfg)
+	postSvc := newPostService(db, cfg)
+	ctx := context.Background()
+
+	var paths []string
+	for i := 0; i < 2; i++ {
+		post := &model.Post{Title: "Post", AuthorID: 1, CategoryID: 1}
+		if err := postRepo.Create(ctx, post); err != nil {
+			t.Fatalf("Create post: %v", err)
+		}
+		content := mediaContent("banner.png", "pixels")
+		u, err := svc.Create(ctx, 1, int64(len(content)), "banner.png", "")
+		if err != nil {
+			t.Fatalf("Create upload: %v", err)
+		}
+		if _, err := svc.Append(ctx, 1, u.ID, 0, strings.NewReader(content)); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+		got, err := postSvc.AttachUpload(ctx, post.ID, u.ID, 1)
+		if err != nil {
+			t.Fatalf("AttachUpload: %v", err)
+		}
+		paths = append(paths, got.Media[0].Path)
+	}
+	if paths[0] != paths[1] {
+		t.Fatalf("identical content should share a blob: %s vs %s", paths[0], paths[1])
+	}
+	b, err := blobRepo.GetByPath(ctx, paths[0])
+	if err != nil {
+		t.Fatalf("GetByPath: %v", err)
+	}
+	if b.RefCount != 2 {
+		t.Errorf("ref count want 2, got %d", b.RefCount)
+	}
+}
+
+func TestUploadService_ReservesQuota(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{UploadDir: t.TempDir(), MaxFileMB: 1, UploadExpiry: time.Hour}
+	authorRepo := repository.NewAuthorRepository(db)
+	usage := NewUsageService(repository.NewUsageRepository(db), authorRepo, cfg)
+	svc := newUploadService(db, cfg)
+	postSvc := newPostService(db, cfg)
+	ctx := context.Background()
+	quota := int64(10)
+	a := &model.Author{Name: "Limited", QuotaBytes: &quota}
+	if err := authorRepo.Create(ctx, a); err != nil {
+		t.Fatalf("Create author: %v", err)
+	}
+	reserved := func() int64 {
+		t.Helper()
+		rep, err := usage.Report(ctx, a.ID)
+		if err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+		return rep.ReservedBytes
+	}
+
+	first, err := svc.Create(ctx, a.ID, 6, "clip.mp4", "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// Nothing is stored yet, but the first upload's length already counts.
+	if _, err := svc.Create(ctx, a.ID, 6, "other.mp4", ""); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("second upload over quota: want ErrQuotaExceeded, got %v", err)
+	}
+	if got := reserved(); got != 6 {
+		t.Errorf("reserved want 6, got %d", got)
+	}
+	if err := svc.Terminate(ctx, a.ID, first.ID); err != nil {
+		t.Fatalf("Terminate: %v", err)
+	}
+	if err := svc.Terminate(ctx, a.ID, first.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("second Terminate: want ErrUploadNotFound, got %v", err)
+	}
+	if got := reserved(); got != 0 {
+		t.Errorf("reserved after Terminate want 0, got %d", got)
+	}
+
+	u, err := svc.Create(ctx, a.ID, 6, "clip.mp4", "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := svc.Append(ctx, a.ID, u.ID, 0, strings.NewReader(webmMagic+"px")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	post := &model.Post{Title: "Video", AuthorID: a.ID, CategoryID: 1}
+	if err := repository.NewPostRepository(db).Create(ctx, post); err != nil {
+		t.Fatalf("Create post: %v", err)
+	}
+	if _, err := postSvc.AttachUpload(ctx, post.ID, u.ID, a.ID); err != nil {
+		t.Fatalf("AttachUpload: %v", err)
+	}
+	rep, _ := usage.Report(ctx, a.ID)
+	if rep.UsedBytes != 6 || rep.ReservedBytes != 0 {
+		t.Errorf("after attach want 6 used and 0 reserved, got %+v", rep)
+	}
+
+	cfg.UploadExpiry = -time.Minute
+	if _, err := svc.Create(ctx, a.ID, 4, "late.mp4", ""); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if n, err := svc.PurgeExpired(ctx); err != nil || n != 1 {
+		t.Fatalf("PurgeExpired = %d, %v", n, err)
+	}
+	if got := reserved(); got != 0 {
+		t.Errorf("reserved after expiry want 0, got %d", got)
+	}
+}
+
+// failingAdvance is an UploadStore whose Advance fails, as when the database is unreachable after a chunk was written.
+type failingAdvance struct {
+	repository.UploadStore
+}
+
+func (failingAdvance) Advance(ctx context.Context, u *model.Upload, from int64, token string) (bool, error) {
+	return false, errors.New("database unavailable")
+}
+
+func TestUploadService_UnsavedChunkIsCutFromTheFile(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.Config{UploadDir: t.TempDir(), MaxFileMB: 1, UploadExpiry: time.Hour}
+	svc := newUploadService(db, cfg)
+	ctx := context.Background()
+	u, err := svc.Create(ctx, 7, 10, "clip.mp4", "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	svc.repo = failingAdvance{svc.repo}
+	if _, err := svc.Append(ctx, 7, u.ID, 0, strings.NewReader(webmMagic+"o")); err == nil {
+		t.Fatal("Append with a failing store succeeded")
+	}
+	if info, err := os.Stat(filepath.Join(cfg.UploadDir, filepath.FromSlash(u.Path))); err != nil || info.Size() != 0 {
+		t.Fatalf("partial file after the failed save: %v (%v), want it empty", info, err)
+	}
+
+	// The claim was given up, so the client can send the chunk again.
+	svc.repo = svc.repo.(failingAdvance).UploadStore
+	if u, err = svc.Append(ctx, 7, u.ID, 0, strings.NewReader(webmMagic+"o")); err != nil || u.Offset != 5 {
+		t.Fatalf("retry: offset=%d err=%v", u.Offset, err)
+	}
+}
@@ -0,0 +1,171 @@
+// service/usage_service: Per-author storage quotas and upload accounting.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"gorm.io/gorm"
+)
+
+// ErrQuotaExceeded is returned when an upload would take an author over their storage quota.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// ErrInvalidQuota is returned when a quota override is negative.
+var ErrInvalidQuota = errors.New("quota_bytes must not be negative")
+
+// UsageReport is the storage usage of one author. QuotaBytes 0 means unlimited; ReservedBytes are held by
+// resumable uploads that have not been attached yet and count against the quota.
+type UsageReport struct {
+	AuthorID      uint                 `json:"author_id"`
+	QuotaBytes    int64                `json:"quota_bytes"`
+	UsedBytes     int64                `json:"used_bytes"`
+	ReservedBytes int64                `json:"reserved_bytes"`
+	Files         int64                `json:"files"`
+	ByType        []model.StorageUsage `json:"by_type"`
+}
+
+type UsageService struct {
+	repo       repository.UsageStore
+	authorRepo repository.AuthorStore
+	cfg        *config.Config
+}
+
+func NewUsageService(repo repository.UsageStore, authorRepo repository.AuthorStore, cfg *config.Config) *UsageService {
+	return &UsageService{repo: repo, authorRepo: authorRepo, cfg: cfg}
+}
+
+// Quota returns the author's quota in bytes (0 = unlimited): the per-author override or the configured default.
+func (s *UsageService) Quota(ctx context.Context, authorID uint) (int64, error) {
+	a, err := s.authorRepo.GetByID(ctx, authorID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+	if a != nil && a.QuotaBytes != nil {
+		return *a.QuotaBytes, nil
+	}
+	return int64(s.cfg.QuotaMB) * 1024 * 1024, nil
+}
+
+// Check returns ErrQuotaExceeded when storing bytes more would take the author over quota. It is an early
+// answer that spares storing files bound to be refused; Record and Reserve enforce the quota.
+func (s *UsageService) Check(ctx context.Context, authorID uint, bytes int64) error {
+	if authorID == 0 || bytes <= 0 {
+		return nil
+	}
+	quota, err := s.Quota(ctx, authorID)
+	if err != nil || quota == 0 {
+		return err
+	}
+	acct, err := s.repo.Account(ctx, authorID)
+	if err != nil {
+		return err
+	}
+	if used := acct.UsedBytes + acct.ReservedBytes; used+bytes > quota {
+		return fmt.Errorf("%w: %d of %d bytes used, upload needs %d", ErrQuotaExceeded, used, quota, bytes)
+	}
+	return nil
+}
+
+// Record charges a stored file to the author, or returns ErrQuotaExceeded when it does not fit their quota.
+func (s *UsageService) Record(ctx context.Context, authorID uint, t model.MediaType, bytes int64) error {
+	return s.RecordReserved(ctx, authorID, t, bytes, 0)
+}
+
+// RecordReserved charges a stored file to the author in place of a reservation of reserved bytes made by
+// Reserve, or returns ErrQuotaExceeded when it does not fit their quota.
+func (s *UsageService) RecordReserved(ctx context.Context, authorID uint, t model.MediaType, bytes, reserved int64) error {
+	if authorID == 0 {
+		return nil
+	}
+	quota, err := s.Quota(ctx, authorID)
+	if err != nil {
+		return err
+	}
+	ok, err := s.repo.Charge(ctx, authorID, t, bytes, reserved, quota)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %d of %d bytes needed", ErrQuotaExceeded, bytes, quota)
+	}
+	return nil
+}
+
+// Reserve holds bytes of the author's quota for an upload still in progress, or returns ErrQuotaExceeded.
+func (s *UsageService) Reserve(ctx context.Context, authorID uint, bytes int64) error {
+	if authorID == 0 || bytes <= 0 {
+		return nil
+	}
+	quota, err := s.Quota(ctx, authorID)
+	if err != nil {
+		return err
+	}
+	ok, err := s.repo.Reserve(ctx, authorID, bytes, quota)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %d of %d bytes needed", ErrQuotaExceeded, bytes, quota)
+	}
+	return nil
+}
+
+// Unreserve gives back a reservation made by Reserve for an upload that will not be stored.
+func (s *UsageService) Unreserve(ctx context.Context, authorID uint, bytes int64) error {
+	if authorID == 0 || bytes <= 0 {
+		return nil
+	}
+	_, err := s.repo.Reserve(ctx, authorID, -bytes, 0)
+	return err
+}
+
+// Release gives back the bytes of a file the author no longer uses.
+func (s *UsageService) Release(ctx context.Context, authorID uint, t model.MediaType, bytes int64) error {
+	if authorID == 0 {
+		return nil
+	}
+	return s.repo.Add(ctx, authorID, t, -bytes, -1)
+}
+
+// Report returns the author's quota and usage by media type.
+func (s *UsageService) Report(ctx context.Context, authorID uint) (*UsageReport, error) {
+	quota, err := s.Quota(ctx, authorID)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.repo.ListByAuthor(ctx, authorID)
+	if err != nil {
+		return nil, err
+	}
+	acct, err := s.repo.Account(ctx, authorID)
+	if err != nil {
+		return nil, err
+	}
+	rep := &UsageReport{AuthorID: authorID, QuotaBytes: quota, ReservedBytes: acct.ReservedBytes, ByType: list}
+	for _, u := range list {
+		rep.UsedBytes += u.Bytes
+		rep.Files += u.Files
+	}
+	return rep, nil
+}
+
+// SetQuota sets the author's quota override in bytes (0 = unlimited); nil reverts to the configured default.
+// It returns the author's new report, or nil when the author does not exist. Lowering a quota below the
+// author's usage keeps their files but refuses new uploads.
+func (s *UsageService) SetQuota(ctx context.Context, authorID uint, quota *int64) (*UsageReport, error) {
+	if quota != nil && *quota < 0 {
+		return nil, ErrInvalidQuota
+	}
+	if err := s.authorRepo.SetQuota(ctx, authorID, quota); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return s.Report(ctx, authorID)
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aliakbar-zohour/go_blog/internal/config"
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+)
+
+func TestUsageService_QuotaAndReport(t *testing.T) {
+	db := setupTestDB(t)
+	authorRepo := repository.NewAuthorRepository(db)
+	svc := NewUsageService(repository.NewUsageRepository(db), authorRepo, &config.Config{QuotaMB: 1})
+	ctx := context.Background()
+	quota := int64(10)
+	a := &model.Author{Name: "Limited", QuotaBytes: &quota}
+	if err := authorRepo.Create(ctx, a); err != nil {
+		t.Fatalf("Create author: %v", err)
+	}
+
+	if err := svc.Check(ctx, a.ID, 10); err != nil {
+		t.Errorf("upload within quota: %v", err)
+	}
+	_ = svc.Record(ctx, a.ID, model.MediaTypeImage, 4)
+	_ = svc.Record(ctx, a.ID, model.MediaTypeVideo, 4)
+	if err := svc.Check(ctx, a.ID, 3); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("upload over quota: want ErrQuotaExceeded, got %v", err)
+	}
+	_ = svc.Release(ctx, a.ID, model.MediaTypeVideo, 4)
+	if err := svc.Check(ctx, a.ID, 3); err != nil {
+		t.Errorf("after release: %v", err)
+	}
+
+	rep, err := svc.Report(ctx, a.ID)
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if rep.QuotaBytes != 10 || rep.UsedBytes != 4 || rep.Files != 1 || len(rep.ByType) != 2 {
+		t.Errorf("unexpected report: %+v", rep)
+	}
+	if q, _ := svc.Quota(ctx, 999); q != 1024*1024 {
+		t.Errorf("default quota want 1MB, got %d", q)
+	}
+}
+
+func TestUsageService_RecordChecksQuotaAtomically(t *testing.T) {
+	db := setupTestDB(t)
+	authorRepo := repository.NewAuthorRepository(db)
+	svc := NewUsageService(repository.NewUsageRepository(db), authorRepo, &config.Config{})
+	ctx := context.Background()
+	quota := int64(10)
+	a := &model.Author{Name: "Limited", QuotaBytes: &quota}
+	if err := authorRepo.Create(ctx, a); err != nil {
+		t.Fatalf("Create author: %v", err)
+	}
+
+	// Every upload passes the early Check; only the ones that fit are charged.
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		if err := svc.Check(ctx, a.ID, 4); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = svc.Record(ctx, a.ID, model.MediaTypeImage, 4)
+		}(i)
+	}
+	wg.Wait()
+	charged := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			charged++
+		case !errors.Is(err, ErrQuotaExceeded):
+			t.Errorf("Record: %v", err)
+		}
+	}
+	rep, err := svc.Report(ctx, a.ID)
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if charged != 2 || rep.UsedBytes != 8 || rep.Files != 2 {
+		t.Errorf("want 2 uploads charged for 8 bytes, got %d and %+v", charged, rep)
+	}
+
+	if _, err := svc.SetQuota(ctx, a.ID, &[]int64{-1}[0]); !errors.Is(err, ErrInvalidQuota) {
+		t.Errorf("negative quota: want ErrInvalidQuota, got %v", err)
+	}
+	unlimited := int64(0)
+	if rep, err := svc.SetQuota(ctx, a.ID, &unlimited); err != nil || rep.QuotaBytes != 0 {
+		t.Fatalf("SetQuota(0) = %+v, %v", rep, err)
+	}
+	if err := svc.Record(ctx, a.ID, model.MediaTypeImage, 4); err != nil {
+		t.Errorf("unlimited quota: %v", err)
+	}
+	if rep, err := svc.SetQuota(ctx, 999, nil); err != nil || rep != nil {
+		t.Errorf("unknown author: want nil report, got %+v, %v", rep, err)
+	}
+}
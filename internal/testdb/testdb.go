@@ -0,0 +1,30 @@
+// testdb: In-memory SQLite databases for tests, with the schema of the embedded migrations, so tests run
+// against the same tables as production instead of what AutoMigrate makes of the models.
+package testdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aliakbar-zohour/go_blog/internal/migrate"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// Open returns an empty database named after the test, migrated to the latest version. Driver errors are
+// translated as in production (e.g. gorm.ErrDuplicatedKey).
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	m, err := migrate.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
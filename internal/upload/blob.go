@@ -0,0 +1,177 @@
+// upload/blob: Content-addressed storage; files are hashed with SHA-256 while streaming and stored once per content.
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+)
+
+const blobDir = "blobs"
+
+// Blob is a stored file identified by the SHA-256 of its content.
+type Blob struct {
+	Hash string
+	Path string // relative to the upload dir, e.g. blobs/ab/cd/abcd....jpg
+	Size int64
+	Type model.MediaType // detected from the content
+	New  bool            // false when identical content was already stored
+
+	BlurHash      string // image placeholder, empty for videos and undecodable images
+	DominantColor string // #rrggbb
+}
+
+// StoreBlob streams src to a temp file while hashing it, then moves it to blobs/<h[0:2]>/<h[2:4]>/<hash><ext>,
+// where ext follows the detected content type, so the same bytes map to one blob whatever the uploaded file was
+// called. When the blob already exists the temp file is discarded. Reading more than maxBytes fails, and so does
+// content that is not an allowed media type of kind t, whatever its name claims (ErrTypeNotAllowed).
+func StoreBlob(src io.Reader, uploadDir string, maxBytes int64, t model.MediaType) (*Blob, error) {
+	tmpDir := filepath.Join(uploadDir, blobDir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(tmpDir, "blob-*")
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op after a successful rename
+	h := sha256.New()
+	head := &sniffBuffer{}
+	n, err := io.Copy(io.MultiWriter(tmp, h, head), io.LimitReader(src, maxBytes+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n > maxBytes {
+		return nil, ErrTooLarge
+	}
+	ct, ok := detectContent(head.data)
+	if !ok || ct.kind != t {
+		return nil, ErrTypeNotAllowed
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	relPath := BlobPath(hash, ct.ext)
+	dst := filepath.Join(uploadDir, filepath.FromSlash(relPath))
+	// Reuse refreshes the modification time, so the collector's grace period covers the new reference too. A
+	// blob collected since it was last used is stored again.
+	now := time.Now()
+	err = os.Chtimes(dst, now, now)
+	if err == nil {
+		return &Blob{Hash: hash, Path: relPath, Size: n, Type: t}, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return nil, err
+	}
+	return &Blob{Hash: hash, Path: relPath, Size: n, Type: t, New: true}, nil
+}
+
+// BlobPath returns the relative storage path for a content hash and extension.
+func BlobPath(hash, ext string) string {
+	return blobDir + "/" + hash[0:2] + "/" + hash[2:4] + "/" + hash + ext
+}
+
+// Servable reports whether rel, relative to the upload dir, may be a stored file served to clients: a blob
+// (blobs/<hh>/<hh>/<file>) or a file of the layout before blobs (posts/<id>/<file>, banners/<file>,
+// avatars/<file>). Partial tus uploads and the blob temp dir are never served.
+func Servable(rel string) bool {
+	parts := strings.Split(rel, "/")
+	for _, p := range parts {
+		if p == "" || p == "." || p == ".." {
+			return false
+		}
+	}
+	switch {
+	case len(parts) == 4 && parts[0] == blobDir:
+		return isHex(parts[1]) && len(parts[1]) == 2 && isHex(parts[2]) && len(parts[2]) == 2
+	case len(parts) == 3 && parts[0] == "posts":
+		_, err := strconv.ParseUint(parts[1], 10, 64)
+		return err == nil
+	case len(parts) == 2:
+		return parts[0] == "banners" || parts[0] == "avatars"
+	}
+	return false
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+type contentType struct {
+	mime string
+	ext  string
+	kind model.MediaType
+}
+
+// contentTypes are the media types uploads may have, by the type http.DetectContentType reports.
+var contentTypes = map[string]contentType{
+	"image/jpeg": {"image/jpeg", ".jpg", model.MediaTypeImage},
+	"image/png":  {"image/png", ".png", model.MediaTypeImage},
+	"image/gif":  {"image/gif", ".gif", model.MediaTypeImage},
+	"image/webp": {"image/webp", ".webp", model.MediaTypeImage},
+	"video/mp4":  {"video/mp4", ".mp4", model.MediaTypeVideo},
+	"video/webm": {"video/webm", ".webm", model.MediaTypeVideo},
+}
+
+// QuickTime is an ISO media file with the "qt  " brand, which http.DetectContentType does not know.
+var quickTime = contentType{"video/quicktime", ".mov", model.MediaTypeVideo}
+
+// detectContent returns the media type of the content starting with head; false when it is not one uploads may
+// have. HTML, SVG, scripts and anything else a browser could run are never stored.
+func detectContent(head []byte) (contentType, bool) {
+	if ct, ok := contentTypes[http.DetectContentType(head)]; ok {
+		return ct, true
+	}
+	if len(head) >= 12 && string(head[4:12]) == "ftypqt  " {
+		return quickTime, true
+	}
+	return contentType{}, false
+}
+
+// ServedType returns the Content-Type to serve the stored file rel with, by its extension; false when rel is not
+// a media file (e.g. a blob stored without an extension before uploads were checked by content).
+func ServedType(rel string) (string, bool) {
+	ext := strings.ToLower(path.Ext(rel))
+	if ext == ".jpeg" {
+		ext = ".jpg"
+	}
+	if ext == quickTime.ext {
+		return quickTime.mime, true
+	}
+	for _, ct := range contentTypes {
+		if ct.ext == ext {
+			return ct.mime, true
+		}
+	}
+	return "", false
+}
+
+// sniffBuffer keeps the first bytes written to it, enough to detect the content type.
+type sniffBuffer struct {
+	data []byte
+}
+
+func (b *sniffBuffer) Write(p []byte) (int, error) {
+	if rest := 512 - len(b.data); rest > 0 {
+		b.data = append(b.data, p[:min(rest, len(p))]...)
+	}
+	return len(p), nil
+}
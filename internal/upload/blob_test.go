@@ -0,0 +1,79 @@
+package upload
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+)
+
+// gif is the smallest content StoreBlob accepts as an image.
+const gif = "GIF89a\x01\x00\x01\x00\x00\x00\x00;"
+
+func TestStoreBlob_DeduplicatesByContent(t *testing.T) {
+	dir := t.TempDir()
+	first, err := StoreBlob(strings.NewReader(gif), dir, 1024, model.MediaTypeImage)
+	if err != nil {
+		t.Fatalf("StoreBlob: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	_ = os.Chtimes(filepath.Join(dir, filepath.FromSlash(first.Path)), old, old)
+	if !first.New || first.Size != int64(len(gif)) {
+		t.Errorf("first store: want new blob of %d bytes, got new=%v size=%d", len(gif), first.New, first.Size)
+	}
+	second, err := StoreBlob(strings.NewReader(gif), dir, 1024, model.MediaTypeImage)
+	if err != nil {
+		t.Fatalf("StoreBlob: %v", err)
+	}
+	if second.New || second.Path != first.Path || second.Hash != first.Hash {
+		t.Errorf("second store: want existing blob %s, got new=%v path=%s", first.Path, second.New, second.Path)
+	}
+	if !strings.HasPrefix(first.Path, "blobs/"+first.Hash[:2]+"/"+first.Hash[2:4]+"/") {
+		t.Errorf("unexpected blob path %s", first.Path)
+	}
+	// Reuse restarts the collector's grace period.
+	if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(first.Path))); err != nil || info.ModTime().Before(time.Now().Add(-time.Hour)) {
+		t.Errorf("reused blob keeps its old modification time: %v", err)
+	}
+	tmp, _ := os.ReadDir(filepath.Join(dir, "blobs", "tmp"))
+	if len(tmp) != 0 {
+		t.Errorf("temp files left behind: %d", len(tmp))
+	}
+}
+
+func TestStoreBlob_RejectsOversized(t *testing.T) {
+	if _, err := StoreBlob(strings.NewReader(gif), t.TempDir(), 5, model.MediaTypeImage); err == nil {
+		t.Error("StoreBlob over maxBytes should fail")
+	}
+}
+
+func TestStoreBlob_ExtensionFollowsContent(t *testing.T) {
+	dir := t.TempDir()
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 32)
+	b, err := StoreBlob(strings.NewReader(png), dir, 1024, model.MediaTypeImage)
+	if err != nil || !strings.HasSuffix(b.Path, ".png") || b.Type != model.MediaTypeImage {
+		t.Fatalf("PNG content: blob=%+v err=%v", b, err)
+	}
+	// Whatever the upload was called, content a browser could run, or of the other kind, is not stored.
+	for name, content := range map[string]string{
+		"html":       "<!DOCTYPE html><script>alert(1)</script>",
+		"svg":        `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`,
+		"javascript": "alert(document.cookie)",
+		"text":       "plain text",
+	} {
+		if b, err := StoreBlob(strings.NewReader(content), dir, 1024, model.MediaTypeImage); !errors.Is(err, ErrTypeNotAllowed) {
+			t.Errorf("%s content: want ErrTypeNotAllowed, got blob=%+v err=%v", name, b, err)
+		}
+	}
+	if _, err := StoreBlob(strings.NewReader(png), dir, 1024, model.MediaTypeVideo); !errors.Is(err, ErrTypeNotAllowed) {
+		t.Errorf("PNG content as a video: want ErrTypeNotAllowed, got %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "blobs", "tmp"))
+	if len(entries) != 0 {
+		t.Errorf("rejected content left %d temp files", len(entries))
+	}
+}
@@ -0,0 +1,123 @@
+// upload/placeholder: BlurHash and dominant colour of stored images, used by clients as loading placeholders.
+package upload
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aliakbar-zohour/go_blog/pkg/blurhash"
+)
+
+const (
+	placeholderSide = 64 // images are sampled down to at most this many pixels per side before encoding
+	// maxPlaceholderPixels bounds the images decoded for a placeholder: decoding allocates the whole bitmap, so a
+	// small file declaring huge dimensions could otherwise exhaust memory.
+	maxPlaceholderPixels = 40_000_000
+	blurXComponents      = 4
+	blurYComponents      = 3
+)
+
+// Placeholder decodes the stored image at relPath and returns its BlurHash and dominant colour (#rrggbb).
+// Formats without a stdlib decoder (e.g. WebP) return an error; callers store the image without a placeholder.
+// Images above maxPlaceholderPixels are not decoded and get an empty hash and colour.
+func Placeholder(uploadDir, relPath string) (hash, colour string, err error) {
+	f, err := os.Open(filepath.Join(uploadDir, filepath.FromSlash(relPath)))
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return "", "", err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxPlaceholderPixels {
+		return "", "", nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", "", err
+	}
+	small := downsample(img, placeholderSide)
+	hash, err = blurhash.Encode(small, blurXComponents, blurYComponents)
+	if err != nil {
+		return "", "", err
+	}
+	return hash, dominantColour(small), nil
+}
+
+// fillPlaceholder sets the blob's placeholder fields for images; failures leave them empty.
+func fillPlaceholder(uploadDir string, b *Blob) {
+	b.BlurHash, b.DominantColor, _ = Placeholder(uploadDir, b.Path)
+}
+
+// downsample returns img scaled (nearest neighbour) so neither side exceeds max pixels.
+func downsample(img image.Image, max int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= max && h <= max {
+		return img
+	}
+	nw, nh := max, max
+	if w > h {
+		nh = h * max / w
+	} else {
+		nw = w * max / h
+	}
+	if nw < 1 {
+		nw = 1
+	}
+	if nh < 1 {
+		nh = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	for y := 0; y < nh; y++ {
+		for x := 0; x < nw; x++ {
+			dst.Set(x, y, img.At(bounds.Min.X+x*w/nw, bounds.Min.Y+y*h/nh))
+		}
+	}
+	return dst
+}
+
+// dominantColour buckets pixels into a 4-bit-per-channel histogram and returns the mean colour of the fullest bucket.
+// Fully transparent pixels are ignored.
+func dominantColour(img image.Image) string {
+	type bucket struct{ n, r, g, b uint64 }
+	buckets := make(map[uint32]*bucket)
+	var best *bucket
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a == 0 {
+				continue
+			}
+			r, g, b = r>>8, g>>8, b>>8
+			key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+			bk := buckets[key]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.n++
+			bk.r += uint64(r)
+			bk.g += uint64(g)
+			bk.b += uint64(b)
+			if best == nil || bk.n > best.n {
+				best = bk
+			}
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.n, best.g/best.n, best.b/best.n)
+}
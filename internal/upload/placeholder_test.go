@@ -0,0 +1,78 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlaceholder_PNG(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			c := color.RGBA{R: 0x20, G: 0x80, B: 0xc0, A: 0xff}
+			if x < 40 {
+				c = color.RGBA{R: 0xff, A: 0xff}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	f, err := os.Create(filepath.Join(dir, "banner.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	hash, colour, err := Placeholder(dir, "banner.png")
+	if err != nil {
+		t.Fatalf("Placeholder: %v", err)
+	}
+	if len(hash) != 28 {
+		t.Errorf("want 28-char 4x3 blurhash, got %q", hash)
+	}
+	if colour != "#2080c0" {
+		t.Errorf("want dominant colour #2080c0, got %s", colour)
+	}
+}
+
+func TestPlaceholder_UndecodableImage(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "x.webp"), []byte("RIFF....WEBP"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Placeholder(dir, "x.webp"); err == nil {
+		t.Error("want error for undecodable image")
+	}
+}
+
+func TestPlaceholder_SkipsHugeImages(t *testing.T) {
+	// A PNG header declaring 20000x20000 pixels, with no image data: only the header may be read.
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], 20000)
+	binary.BigEndian.PutUint32(ihdr[8:], 20000)
+	ihdr[12], ihdr[13] = 8, 2 // 8-bit RGB
+	binary.Write(&buf, binary.BigEndian, uint32(13))
+	buf.Write(ihdr)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "huge.png"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, colour, err := Placeholder(dir, "huge.png")
+	if err != nil || hash != "" || colour != "" {
+		t.Errorf("huge image: got %q, %q, %v; want no placeholder", hash, colour, err)
+	}
+}
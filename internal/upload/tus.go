@@ -0,0 +1,111 @@
+// upload/tus: File storage for resumable (tus) uploads: partial files, chunk appends and import as blobs.
+package upload
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+)
+
+const tusDir = "tus"
+
+var (
+	// ErrOffsetMismatch is returned when a chunk does not start at the current end of the partial file.
+	ErrOffsetMismatch = errors.New("upload offset does not match")
+	// ErrChunkTooLarge is returned when a chunk is longer than the bytes the upload still expects.
+	ErrChunkTooLarge = errors.New("chunk exceeds the remaining upload length")
+)
+
+// CreatePartial creates an empty partial file for upload id under uploadDir/tus. Returns relative path.
+func CreatePartial(uploadDir, id string) (string, error) {
+	dir := filepath.Join(uploadDir, tusDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return tusDir + "/" + id, nil
+}
+
+// AppendChunk writes src to the partial file at relPath starting at offset. A chunk longer than maxBytes is
+// discarded with ErrChunkTooLarge. Returns the number of bytes written; on a short read the bytes already
+// received are kept so the client can resume.
+func AppendChunk(uploadDir, relPath string, offset int64, src io.Reader, maxBytes int64) (int64, error) {
+	f, err := os.OpenFile(filepath.Join(uploadDir, filepath.FromSlash(relPath)), os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() != offset {
+		return 0, ErrOffsetMismatch
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, io.LimitReader(src, maxBytes))
+	if err != nil {
+		return n, err
+	}
+	if n == maxBytes {
+		if extra, _ := io.CopyN(io.Discard, src, 1); extra > 0 {
+			if err := f.Truncate(offset); err != nil {
+				return n, err
+			}
+			return 0, ErrChunkTooLarge
+		}
+	}
+	return n, f.Sync()
+}
+
+// TruncatePartial cuts the partial file at relPath back to size bytes, dropping bytes written past it.
+func TruncatePartial(uploadDir, relPath string, size int64) error {
+	return os.Truncate(filepath.Join(uploadDir, filepath.FromSlash(relPath)), size)
+}
+
+// ImportUpload stores a finished partial file as a content-addressed blob and returns the media record for
+// authorID's library (not yet saved) and the blob. The partial file is left in place: the caller removes it
+// once the upload record is gone.
+func ImportUpload(uploadDir, relPath, filename string, authorID uint, maxBytes int64) (*model.Media, *Blob, error) {
+	mediaType, err := MediaTypeFor(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	src, err := os.Open(filepath.Join(uploadDir, filepath.FromSlash(relPath)))
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := StoreBlob(src, uploadDir, maxBytes, mediaType)
+	src.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	if mediaType == model.MediaTypeImage {
+		fillPlaceholder(uploadDir, b)
+	}
+	safeName := filepath.Base(filename)
+	if safeName == "" || safeName == "." {
+		safeName = filepath.Base(b.Path)
+	}
+	return newMedia(authorID, mediaType, safeName, b), b, nil
+}
+
+// Remove deletes a stored file by its relative path. A missing file is not an error.
+func Remove(uploadDir, relPath string) error {
+	err := os.Remove(filepath.Join(uploadDir, filepath.FromSlash(relPath)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -2,13 +2,12 @@
 package upload
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/aliakbar-zohour/go_blog/internal/model"
 )
@@ -18,85 +17,122 @@ var (
 	allowedVideos = map[string]bool{".mp4": true, ".webm": true, ".mov": true}
 )
 
-func SaveFile(file *multipart.FileHeader, uploadDir string, postID uint, maxBytes int64) (*model.Media, string, error) {
-	if file == nil {
-		return nil, "", fmt.Errorf("file header is nil")
+// Validation errors of a single file, returned by CheckFile, CheckImage and the Save functions.
+var (
+	ErrTypeNotAllowed = errors.New("file type not allowed")
+	ErrTooLarge       = errors.New("file size exceeds maximum allowed")
+)
+
+// CheckFile validates a media file's extension and declared size without storing it.
+func CheckFile(file *multipart.FileHeader, maxBytes int64) error {
+	if _, err := MediaTypeFor(file.Filename); err != nil {
+		return err
 	}
-	if maxBytes <= 0 {
-		return nil, "", fmt.Errorf("max file size must be positive")
+	if file.Size > maxBytes {
+		return ErrTooLarge
 	}
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	mediaType := model.MediaTypeImage
-	if allowedVideos[ext] {
-		mediaType = model.MediaTypeVideo
-	} else if !allowedImages[ext] {
-		return nil, "", fmt.Errorf("file type not allowed")
+	return nil
+}
+
+// CheckImage validates an image's extension and declared size without storing it.
+func CheckImage(file *multipart.FileHeader, maxBytes int64) error {
+	if !allowedImages[strings.ToLower(filepath.Ext(file.Filename))] {
+		return ErrTypeNotAllowed
 	}
 	if file.Size > maxBytes {
-		return nil, "", fmt.Errorf("file size exceeds maximum allowed")
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// SaveFile stores a media file for authorID's library as a content-addressed blob and returns the media record (not yet saved) and the blob.
+// Images get a BlurHash and dominant colour.
+func SaveFile(file *multipart.FileHeader, uploadDir string, authorID uint, maxBytes int64) (*model.Media, *Blob, error) {
+	if file == nil {
+		return nil, nil, fmt.Errorf("file header is nil")
+	}
+	if maxBytes <= 0 {
+		return nil, nil, fmt.Errorf("max file size must be positive")
 	}
-	dir := filepath.Join(uploadDir, "posts", fmt.Sprintf("%d", postID))
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, "", err
+	if err := CheckFile(file, maxBytes); err != nil {
+		return nil, nil, err
 	}
-	newName := fmt.Sprintf("%d_%d%s", time.Now().UnixNano(), postID, ext)
-	dstPath := filepath.Join(dir, newName)
+	mediaType, _ := MediaTypeFor(file.Filename)
 	src, err := file.Open()
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 	defer src.Close()
-	dst, err := os.Create(dstPath)
+	b, err := StoreBlob(src, uploadDir, maxBytes, mediaType)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
-	defer dst.Close()
-	if _, err := io.Copy(dst, src); err != nil {
-		_ = os.Remove(dstPath)
-		return nil, "", err
+	if mediaType == model.MediaTypeImage {
+		fillPlaceholder(uploadDir, b)
 	}
-	relPath := "posts/" + fmt.Sprintf("%d", postID) + "/" + newName
 	safeName := filepath.Base(file.Filename)
 	if safeName == "" || safeName == "." {
-		safeName = newName
+		safeName = filepath.Base(b.Path)
 	}
-	return &model.Media{PostID: postID, Type: mediaType, Path: relPath, Filename: safeName}, relPath, nil
+	return newMedia(authorID, mediaType, safeName, b), b, nil
 }
 
-// SaveSingleImage saves one image under uploadDir/subDir (e.g. "banners", "avatars"). Returns relative path.
-func SaveSingleImage(file *multipart.FileHeader, uploadDir, subDir string, maxBytes int64) (string, error) {
+// SaveSingleImage stores one image (banner, avatar) as a content-addressed blob with its placeholder. Blob.Path is the relative path.
+func SaveSingleImage(file *multipart.FileHeader, uploadDir string, maxBytes int64) (*Blob, error) {
 	if file == nil {
-		return "", fmt.Errorf("file header is nil")
+		return nil, fmt.Errorf("file header is nil")
 	}
 	if maxBytes <= 0 {
-		return "", fmt.Errorf("max file size must be positive")
+		return nil, fmt.Errorf("max file size must be positive")
 	}
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	if !allowedImages[ext] {
-		return "", fmt.Errorf("file type not allowed")
+	if err := CheckImage(file, maxBytes); err != nil {
+		return nil, err
 	}
-	if file.Size > maxBytes {
-		return "", fmt.Errorf("file size exceeds maximum allowed")
-	}
-	dir := filepath.Join(uploadDir, subDir)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", err
-	}
-	newName := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	dstPath := filepath.Join(dir, newName)
 	src, err := file.Open()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer src.Close()
-	dst, err := os.Create(dstPath)
+	b, err := StoreBlob(src, uploadDir, maxBytes, model.MediaTypeImage)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	fillPlaceholder(uploadDir, b)
+	return b, nil
+}
+
+func newMedia(authorID uint, mediaType model.MediaType, filename string, b *Blob) *model.Media {
+	return &model.Media{
+		AuthorID:      authorID,
+		Type:          mediaType,
+		Path:          b.Path,
+		Filename:      filename,
+		BlobHash:      b.Hash,
+		BlurHash:      b.BlurHash,
+		DominantColor: b.DominantColor,
 	}
-	defer dst.Close()
-	if _, err := io.Copy(dst, src); err != nil {
-		_ = os.Remove(dstPath)
-		return "", err
+}
+
+// MediaTypeFor returns the media type for a filename based on its extension, or an error if the type is not allowed.
+func MediaTypeFor(filename string) (model.MediaType, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if allowedVideos[ext] {
+		return model.MediaTypeVideo, nil
+	}
+	if allowedImages[ext] {
+		return model.MediaTypeImage, nil
+	}
+	return "", ErrTypeNotAllowed
+}
+
+// Size returns the size of a stored file, or 0 when it does not exist.
+func Size(uploadDir, relPath string) int64 {
+	if relPath == "" {
+		return 0
+	}
+	info, err := os.Stat(filepath.Join(uploadDir, filepath.FromSlash(relPath)))
+	if err != nil {
+		return 0
 	}
-	return subDir + "/" + newName, nil
+	return info.Size()
 }
@@ -0,0 +1,593 @@
+// webhook: Outgoing webhooks. As an outbox sink, the dispatcher stores one delivery per event and subscribed
+// webhook; a worker pool POSTs them with an HMAC-SHA256 signature, retrying with exponential backoff and logging
+// every response.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"gorm.io/gorm"
+)
+
+// Headers of every delivery.
+const (
+	SignatureHeader = "X-Blog-Signature" // t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+	EventHeader     = "X-Blog-Event"
+	DeliveryHeader  = "X-Blog-Delivery" // the event ID, the same on retries; receivers use it to drop duplicates
+)
+
+// responseBodyLimit is how much of a response body the delivery log keeps.
+const responseBodyLimit = 1024
+
+var (
+	ErrNotFound         = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrNotDead          = errors.New("only dead deliveries can be redelivered")
+	ErrInvalidURL       = errors.New("url must be an absolute http or https URL")
+	ErrInvalidEvents    = errors.New("events must list at least one of post.created, post.updated, post.deleted, comment.created, author.registered")
+	ErrBlockedAddress   = errors.New("webhook address is not public")
+)
+
+// Options tune the workers. Zero values use the defaults below.
+type Options struct {
+	Workers      int           // concurrent senders (default 2)
+	MaxAttempts  int           // attempts before a delivery is dead (default 10)
+	PollInterval time.Duration // how often idle workers look for due deliveries (default 5s)
+	BaseBackoff  time.Duration // delay after the first failure, doubled per attempt (default 30s)
+	MaxBackoff   time.Duration // cap of the delay (default 6h)
+	Lease        time.Duration // how long a claimed delivery is reserved for one attempt (default 2m)
+	Timeout      time.Duration // HTTP timeout of one attempt (default 10s)
+	AllowPrivate bool          // allow loopback, private and link-local addresses, e.g. for receivers on the same network
+}
+
+func (o *Options) defaults() {
+	if o.Workers <= 0 {
+		o.Workers = 2
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 10
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 5 * time.Second
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 30 * time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 6 * time.Hour
+	}
+	if o.Lease <= 0 {
+		o.Lease = 2 * time.Minute
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+}
+
+type Dispatcher struct {
+	repo   repository.WebhookStore
+	client *http.Client
+	opts   Options
+	wake   chan struct{}
+	now    func() time.Time
+}
+
+// New returns a dispatcher. Call Start to run the workers.
+func New(repo repository.WebhookStore, opts Options) *Dispatcher {
+	opts.defaults()
+	client := &http.Client{
+		Timeout: opts.Timeout,
+		// A redirect is a failed delivery: the signed request must reach the configured URL.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	if !opts.AllowPrivate {
+		client.Transport = publicTransport()
+	}
+	return &Dispatcher{repo: repo, client: client, opts: opts, wake: make(chan struct{}, 1), now: time.Now}
+}
+
+// publicTransport returns a transport that only connects to public addresses, so a webhook cannot reach the
+// services next to the API. The check runs on the address dialled, after DNS resolution, so a hostname that
+// resolves (or is rebound) to an internal address is refused too. Proxies are not used: the check would apply
+// to the proxy instead of the receiver.
+func publicTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: publicOnly}
+	t.DialContext = dialer.DialContext
+	return t
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), internal to providers but not in IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicOnly is a net.Dialer Control refusing loopback, private, link-local, multicast and unspecified addresses.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+	}
+	return nil
+}
+
+// Envelope is the JSON body of every delivery.
+type Envelope struct {
+	ID        string          `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Name identifies the dispatcher as an outbox sink.
+func (d *Dispatcher) Name() string { return "webhooks" }
+
+// Handle queues a delivery of each event for every active webhook subscribed to it; other events, and events of
+// private posts, are ignored. Deliveries are unique per webhook and event, so events handed over again by the
+// relay are not sent twice.
+func (d *Dispatcher) Handle(ctx context.Context, events []model.OutboxEvent) error {
+	hooks, err := d.repo.ListActive(ctx)
+	if err != nil {
+		return err
+	}
+	var deliveries []model.WebhookDelivery
+	for _, ev := range events {
+		if privatePost(ev) {
+			continue
+		}
+		env := &Envelope{ID: "evt_" + strconv.FormatUint(ev.ID, 10), Event: ev.Type, CreatedAt: ev.CreatedAt.UTC(), Data: json.RawMessage(ev.Payload)}
+		var payload []byte
+		for _, w := range hooks {
+			if !w.Subscribed(ev.Type) {
+				continue
+			}
+			if payload == nil {
+				if payload, err = json.Marshal(env); err != nil {
+					return err
+				}
+			}
+			deliveries = append(deliveries, d.delivery(w.ID, env, payload))
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := d.repo.CreateDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// privatePost reports whether ev carries a private post, which is not sent outside the blog.
+func privatePost(ev model.OutboxEvent) bool {
+	if ev.Type != model.WebhookEventPostCreated && ev.Type != model.WebhookEventPostUpdated {
+		return false
+	}
+	var post struct {
+		Private bool `json:"private"`
+	}
+	return json.Unmarshal([]byte(ev.Payload), &post) == nil && post.Private
+}
+
+// ping returns the envelope and body of a test event.
+func (d *Dispatcher) ping(data any) (*Envelope, []byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, nil, err
+	}
+	env := &Envelope{ID: "ping_" + id, Event: model.WebhookEventPing, CreatedAt: d.now().UTC(), Data: raw}
+	payload, err := json.Marshal(env)
+	return env, payload, err
+}
+
+func (d *Dispatcher) delivery(webhookID uint, env *Envelope, payload []byte) model.WebhookDelivery {
+	return model.WebhookDelivery{
+		WebhookID:     webhookID,
+		EventID:       env.ID,
+		Event:         env.Event,
+		Payload:       string(payload),
+		Status:        model.WebhookDeliveryPending,
+		NextAttemptAt: d.now(),
+	}
+}
+
+// Start runs the worker pool until ctx is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) work(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			worked, err := d.ProcessOnce(ctx)
+			if err != nil {
+				log.Printf("[webhook] %v", err)
+			}
+			if !worked || ctx.Err() != nil {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// ProcessOnce claims one due delivery and sends it. Reports whether a delivery was claimed.
+func (d *Dispatcher) ProcessOnce(ctx context.Context) (bool, error) {
+	del, err := d.repo.ClaimDue(ctx, d.now(), d.opts.Lease)
+	if err != nil || del == nil {
+		return false, err
+	}
+	w, err := d.repo.GetByID(ctx, del.WebhookID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		del.Status, del.LastError = model.WebhookDeliveryDead, "webhook was deleted"
+		return true, d.repo.SaveAttempt(ctx, del)
+	case err != nil:
+		return true, err
+	case !w.Active:
+		del.Status, del.LastError = model.WebhookDeliveryDead, "webhook is disabled"
+		return true, d.repo.SaveAttempt(ctx, del)
+	}
+	d.attempt(ctx, w, del)
+	return true, d.repo.SaveAttempt(ctx, del)
+}
+
+// attempt POSTs del to w and records the outcome in del. Any 2xx response is a success; other responses and
+// network errors are retried after a backoff until MaxAttempts. Test pings are not retried.
+func (d *Dispatcher) attempt(ctx context.Context, w *model.Webhook, del *model.WebhookDelivery) {
+	del.Attempts++
+	del.ResponseStatus, del.ResponseBody, del.LastError = 0, "", ""
+	start := d.now()
+	err := d.post(ctx, w, del)
+	now := d.now()
+	del.DurationMs = now.Sub(start).Milliseconds()
+	if err == nil {
+		del.Status, del.DeliveredAt = model.WebhookDeliverySucceeded, &now
+		return
+	}
+	del.LastError = err.Error()
+	if del.Attempts >= d.opts.MaxAttempts || del.Event == model.WebhookEventPing {
+		del.Status = model.WebhookDeliveryDead
+		log.Printf("[webhook] delivery %d of %s to webhook %d is dead after %d attempts: %v", del.ID, del.Event, w.ID, del.Attempts, err)
+		return
+	}
+	del.Status, del.NextAttemptAt = model.WebhookDeliveryPending, now.Add(d.backoff(del.Attempts))
+}
+
+func (d *Dispatcher) post(ctx context.Context, w *model.Webhook, del *model.WebhookDelivery) error {
+	body := []byte(del.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go_blog-webhooks/1")
+	req.Header.Set(EventHeader, del.Event)
+	req.Header.Set(DeliveryHeader, del.EventID)
+	req.Header.Set(SignatureHeader, Sign(w.Secret, d.now(), body))
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(res.Body, responseBodyLimit))
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10)) // let the connection be reused
+	del.ResponseStatus, del.ResponseBody = res.StatusCode, string(snippet)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("endpoint answered %s", res.Status)
+	}
+	return nil
+}
+
+// backoff is BaseBackoff*2^(attempts-1), capped at MaxBackoff, with up to 10% jitter.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	b := d.opts.BaseBackoff
+	for i := 1; i < attempts && b < d.opts.MaxBackoff; i++ {
+		b *= 2
+	}
+	if b > d.opts.MaxBackoff {
+		b = d.opts.MaxBackoff
+	}
+	return b + time.Duration(mrand.Int63n(int64(b)/10+1))
+}
+
+// Sign returns the SignatureHeader value for body sent at t: "t=<unix seconds>,v1=<hex HMAC-SHA256(secret, "<t>.<body>")>".
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + signature(secret, ts, body)
+}
+
+// Verify checks a SignatureHeader value against body. Signatures older than tolerance are rejected to limit replays.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) bool {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return false
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(signature(secret, ts, body)))
+}
+
+func signature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Input holds the fields of a webhook to create or change; nil fields are left unchanged on update.
+type Input struct {
+	URL         *string  `json:"url"`
+	Secret      *string  `json:"secret"` // generated when empty on create
+	Events      []string `json:"events"`
+	Description *string  `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+// Created is a new webhook with its secret, which is only shown once.
+type Created struct {
+	model.Webhook
+	Secret string `json:"secret"`
+}
+
+// Create adds a webhook. It is active unless in.Active is false.
+func (d *Dispatcher) Create(ctx context.Context, in Input) (*Created, error) {
+	w := &model.Webhook{Active: true}
+	if in.URL == nil {
+		return nil, ErrInvalidURL
+	}
+	if in.Events == nil {
+		return nil, ErrInvalidEvents
+	}
+	if err := apply(w, in); err != nil {
+		return nil, err
+	}
+	if w.Secret == "" {
+		secret, err := randomHex(32)
+		if err != nil {
+			return nil, err
+		}
+		w.Secret = "whsec_" + secret
+	}
+	if err := d.repo.Create(ctx, w); err != nil {
+		return nil, err
+	}
+	return &Created{Webhook: *w, Secret: w.Secret}, nil
+}
+
+// Update changes the fields set in in.
+func (d *Dispatcher) Update(ctx context.Context, id uint, in Input) (*model.Webhook, error) {
+	w, err := d.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := apply(w, in); err != nil {
+		return nil, err
+	}
+	if err := d.repo.Update(ctx, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// apply validates in and copies its set fields to w.
+func apply(w *model.Webhook, in Input) error {
+	if in.URL != nil {
+		u, err := url.Parse(strings.TrimSpace(*in.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(u.String()) > 2048 {
+			return ErrInvalidURL
+		}
+		w.URL = u.String()
+	}
+	if in.Secret != nil {
+		w.Secret = strings.TrimSpace(*in.Secret)
+	}
+	if in.Events != nil {
+		events, err := validEvents(in.Events)
+		if err != nil {
+			return err
+		}
+		w.Events = events
+	}
+	if in.Description != nil {
+		w.Description = strings.TrimSpace(*in.Description)
+		if len(w.Description) > 255 {
+			w.Description = w.Description[:255]
+		}
+	}
+	if in.Active != nil {
+		w.Active = *in.Active
+	}
+	return nil
+}
+
+// validEvents returns the distinct events of list, in model.WebhookEvents order; unknown events are an error.
+func validEvents(list []string) ([]string, error) {
+	want := make(map[string]bool, len(list))
+	for _, e := range list {
+		want[strings.TrimSpace(e)] = true
+	}
+	var events []string
+	for _, e := range model.WebhookEvents {
+		if want[e] {
+			events = append(events, e)
+			delete(want, e)
+		}
+	}
+	if len(events) == 0 || len(want) > 0 {
+		return nil, ErrInvalidEvents
+	}
+	return events, nil
+}
+
+func (d *Dispatcher) Get(ctx context.Context, id uint) (*model.Webhook, error) {
+	w, err := d.repo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	return w, err
+}
+
+func (d *Dispatcher) List(ctx context.Context) ([]model.Webhook, error) {
+	return d.repo.List(ctx)
+}
+
+// Delete removes a webhook and its delivery log.
+func (d *Dispatcher) Delete(ctx context.Context, id uint) error {
+	if _, err := d.Get(ctx, id); err != nil {
+		return err
+	}
+	return d.repo.Delete(ctx, id)
+}
+
+// SendTest sends a ping event to the webhook right away, whether or not it is active, and returns the
+// logged delivery. A failed ping is not retried.
+func (d *Dispatcher) SendTest(ctx context.Context, id uint) (*model.WebhookDelivery, error) {
+	w, err := d.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	env, payload, err := d.ping(map[string]any{"webhook_id": w.ID, "events": w.Events})
+	if err != nil {
+		return nil, err
+	}
+	del := d.delivery(w.ID, env, payload)
+	// Claimed from the start so no worker sends it too.
+	until := d.now().Add(d.opts.Lease)
+	del.Status, del.LockedUntil = model.WebhookDeliverySending, &until
+	ds := []model.WebhookDelivery{del}
+	if err := d.repo.CreateDeliveries(ctx, ds); err != nil {
+		return nil, err
+	}
+	saved := &ds[0]
+	d.attempt(ctx, w, saved)
+	if err := d.repo.SaveAttempt(ctx, saved); err != nil {
+		return nil, err
+	}
+	saved.LockedUntil = nil
+	return saved, nil
+}
+
+// DeliveryListResult holds a page of deliveries and the total for the filter.
+type DeliveryListResult struct {
+	Items []model.WebhookDelivery `json:"items"`
+	Total int64                   `json:"total"`
+}
+
+// Deliveries returns the delivery log of a webhook, newest first, optionally filtered by status.
+func (d *Dispatcher) Deliveries(ctx context.Context, id uint, status model.WebhookDeliveryStatus, limit, offset int) (*DeliveryListResult, error) {
+	if _, err := d.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	total, err := d.repo.CountDeliveries(ctx, id, status)
+	if err != nil {
+		return nil, err
+	}
+	items, err := d.repo.ListDeliveries(ctx, id, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &DeliveryListResult{Items: items, Total: total}, nil
+}
+
+// Redeliver moves a dead delivery of webhook id back to pending with a fresh attempt budget and wakes a worker.
+func (d *Dispatcher) Redeliver(ctx context.Context, id, deliveryID uint) (*model.WebhookDelivery, error) {
+	del, err := d.repo.GetDelivery(ctx, deliveryID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && del.WebhookID != id) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	ok, err := d.repo.Requeue(ctx, deliveryID, d.now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotDead
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return d.repo.GetDelivery(ctx, deliveryID)
+}
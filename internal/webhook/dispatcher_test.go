@@ -0,0 +1,236 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliakbar-zohour/go_blog/internal/model"
+	"github.com/aliakbar-zohour/go_blog/internal/repository"
+	"github.com/aliakbar-zohour/go_blog/internal/testdb"
+)
+
+func setupDispatcher(t *testing.T, opts Options) (*Dispatcher, *time.Time) {
+	t.Helper()
+	db := testdb.Open(t)
+	// The receivers of the tests listen on loopback.
+	opts.AllowPrivate = true
+	d := New(repository.NewWebhookRepository(db), opts)
+	clock := time.Now().UTC().Truncate(time.Second)
+	d.now = func() time.Time { return clock }
+	return d, &clock
+}
+
+// receiver records requests and answers with the next status of statuses (the last one repeats).
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	status := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte("status " + http.StatusText(status)))
+}
+
+func strp(s string) *string { return &s }
+
+func TestDispatcher_HandleSignsAndDelivers(t *testing.T) {
+	d, clock := setupDispatcher(t, Options{})
+	rc := &receiver{statuses: []int{http.StatusNoContent}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	ctx := context.Background()
+
+	hook, err := d.Create(ctx, Input{URL: strp(srv.URL), Events: []string{"post.created", "post.created"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook.Secret == "" || len(hook.Events) != 1 {
+		t.Fatalf("created webhook: %+v", hook)
+	}
+	other, _ := d.Create(ctx, Input{URL: strp(srv.URL), Events: []string{"comment.created"}})
+
+	ev := model.OutboxEvent{ID: 41, Type: model.WebhookEventPostCreated, Payload: `{"id":7,"title":"Hello"}`, CreatedAt: *clock}
+	private := model.OutboxEvent{ID: 43, Type: model.WebhookEventPostCreated, Payload: `{"id":8,"private":true}`, CreatedAt: *clock}
+	if err := d.Handle(ctx, []model.OutboxEvent{ev, {ID: 42, Type: "post.viewed", Payload: `{}`}, private}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Handle(ctx, []model.OutboxEvent{ev}); err != nil {
+		t.Fatalf("event handed over again: %v", err)
+	}
+	if len(rc.requests) != 0 {
+		t.Fatal("Handle must not deliver synchronously")
+	}
+	if worked, err := d.ProcessOnce(ctx); err != nil || !worked {
+		t.Fatalf("ProcessOnce: worked=%v err=%v", worked, err)
+	}
+	if worked, _ := d.ProcessOnce(ctx); worked {
+		t.Fatal("a webhook not subscribed to post.created, or a private post, got a delivery")
+	}
+
+	req, body := rc.requests[0], rc.bodies[0]
+	if req.Header.Get(EventHeader) != "post.created" || req.Header.Get(DeliveryHeader) != "evt_41" {
+		t.Fatalf("headers: %v", req.Header)
+	}
+	if !Verify(hook.Secret, req.Header.Get(SignatureHeader), body, *clock, 5*time.Minute) {
+		t.Fatalf("signature %q does not verify", req.Header.Get(SignatureHeader))
+	}
+	if Verify(hook.Secret, req.Header.Get(SignatureHeader), append(body, ' '), *clock, 5*time.Minute) {
+		t.Fatal("signature verifies a changed body")
+	}
+	if Verify(hook.Secret, req.Header.Get(SignatureHeader), body, clock.Add(time.Hour), 5*time.Minute) {
+		t.Fatal("stale signature accepted")
+	}
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil || env.Event != "post.created" || env.ID != req.Header.Get(DeliveryHeader) || string(env.Data) != `{"id":7,"title":"Hello"}` {
+		t.Fatalf("envelope: %+v err=%v", env, err)
+	}
+
+	log, _ := d.Deliveries(ctx, hook.ID, "", 0, 0)
+	if log.Total != 1 || log.Items[0].Status != model.WebhookDeliverySucceeded || log.Items[0].ResponseStatus != http.StatusNoContent || log.Items[0].DeliveredAt == nil {
+		t.Fatalf("delivery log: %+v", log)
+	}
+	if log, _ := d.Deliveries(ctx, other.ID, "", 0, 0); log.Total != 0 {
+		t.Fatalf("unsubscribed webhook has deliveries: %+v", log)
+	}
+}
+
+func TestDispatcher_RetriesThenDeadThenRedeliver(t *testing.T) {
+	d, clock := setupDispatcher(t, Options{MaxAttempts: 2, BaseBackoff: time.Minute})
+	rc := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	ctx := context.Background()
+	hook, _ := d.Create(ctx, Input{URL: strp(srv.URL), Events: []string{"comment.created"}})
+	if err := d.Handle(ctx, []model.OutboxEvent{{ID: 1, Type: model.WebhookEventCommentCreated, Payload: `{"id":1}`}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if worked, err := d.ProcessOnce(ctx); err != nil || !worked {
+		t.Fatalf("first attempt: worked=%v err=%v", worked, err)
+	}
+	del, _ := d.repo.GetDelivery(ctx, 1)
+	if del.Status != model.WebhookDeliveryPending || del.Attempts != 1 || del.ResponseStatus != 500 || del.LastError == "" {
+		t.Fatalf("after first failure: %+v", del)
+	}
+	if worked, _ := d.ProcessOnce(ctx); worked {
+		t.Fatal("retried before its backoff")
+	}
+	*clock = clock.Add(2 * time.Minute)
+	_, _ = d.ProcessOnce(ctx)
+	del, _ = d.repo.GetDelivery(ctx, 1)
+	if del.Status != model.WebhookDeliveryDead || del.Attempts != 2 || del.ResponseStatus != 502 {
+		t.Fatalf("after max attempts: %+v", del)
+	}
+	if rc.requests[0].Header.Get(DeliveryHeader) != rc.requests[1].Header.Get(DeliveryHeader) {
+		t.Fatal("retries must keep the delivery ID")
+	}
+
+	if _, err := d.Redeliver(ctx, hook.ID+1, del.ID); err != ErrDeliveryNotFound {
+		t.Fatalf("redeliver through another webhook: %v", err)
+	}
+	if _, err := d.Redeliver(ctx, hook.ID, del.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = d.ProcessOnce(ctx)
+	del, _ = d.repo.GetDelivery(ctx, 1)
+	if del.Status != model.WebhookDeliverySucceeded || del.Attempts != 1 {
+		t.Fatalf("after redeliver: %+v", del)
+	}
+	if _, err := d.Redeliver(ctx, hook.ID, del.ID); err != ErrNotDead {
+		t.Fatalf("redeliver of a succeeded delivery: %v", err)
+	}
+}
+
+func TestDispatcher_SendTest(t *testing.T) {
+	d, _ := setupDispatcher(t, Options{})
+	rc := &receiver{statuses: []int{http.StatusNotFound}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	ctx := context.Background()
+	hook, _ := d.Create(ctx, Input{URL: strp(srv.URL), Secret: strp("s3cret"), Events: []string{"post.deleted"}})
+
+	del, err := d.SendTest(ctx, hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.requests) != 1 || rc.requests[0].Header.Get(EventHeader) != model.WebhookEventPing {
+		t.Fatalf("test event not sent: %d requests", len(rc.requests))
+	}
+	if del.Status != model.WebhookDeliveryDead || del.ResponseStatus != http.StatusNotFound || del.ResponseBody != "status Not Found" {
+		t.Fatalf("test delivery: %+v", del)
+	}
+	if worked, _ := d.ProcessOnce(ctx); worked {
+		t.Fatal("a failed test event was queued for retry")
+	}
+	if _, err := d.SendTest(ctx, hook.ID+1); err != ErrNotFound {
+		t.Fatalf("unknown webhook: %v", err)
+	}
+}
+
+func TestDispatcher_RefusesInternalAddresses(t *testing.T) {
+	d := New(repository.NewWebhookRepository(testdb.Open(t)), Options{})
+	rc := &receiver{statuses: []int{http.StatusNoContent}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	ctx := context.Background()
+	// localhost resolves to loopback, so the check must hold after DNS resolution too.
+	local := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	for _, target := range []string{srv.URL, local} {
+		hook, err := d.Create(ctx, Input{URL: strp(target), Events: []string{"post.created"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		del, err := d.SendTest(ctx, hook.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if del.Status != model.WebhookDeliveryDead || !strings.Contains(del.LastError, ErrBlockedAddress.Error()) {
+			t.Errorf("delivery to %s: %+v", target, del)
+		}
+	}
+	if len(rc.requests) != 0 {
+		t.Fatalf("internal receiver got %d requests", len(rc.requests))
+	}
+
+	for addr, blocked := range map[string]bool{
+		"10.1.2.3:80": true, "169.254.169.254:80": true, "[::1]:443": true, "[::ffff:192.168.0.1]:80": true,
+		"100.64.0.1:80": true, "0.0.0.0:80": true, "93.184.216.34:443": false, "[2606:4700::1111]:443": false,
+	} {
+		if err := publicOnly("tcp", addr, nil); (err != nil) != blocked {
+			t.Errorf("publicOnly(%s) = %v", addr, err)
+		}
+	}
+}
+
+func TestDispatcher_CreateValidates(t *testing.T) {
+	d, _ := setupDispatcher(t, Options{})
+	ctx := context.Background()
+	for _, in := range []Input{
+		{URL: strp("ftp://example.com"), Events: []string{"post.created"}},
+		{URL: strp("/relative"), Events: []string{"post.created"}},
+		{URL: strp("https://example.com/hook"), Events: []string{"post.published"}},
+		{URL: strp("https://example.com/hook")},
+	} {
+		if _, err := d.Create(ctx, in); err == nil {
+			t.Errorf("Create(%q, %v) accepted", *in.URL, in.Events)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package blurhash
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solid(c color.Color, w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestEncode_Length(t *testing.T) {
+	hash, err := Encode(solid(color.RGBA{200, 40, 90, 255}, 16, 12), 4, 3)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	// 1 size flag + 1 max AC + 4 DC + 2 per AC component.
+	if want := 1 + 1 + 4 + 2*(4*3-1); len(hash) != want {
+		t.Errorf("length want %d, got %d (%s)", want, len(hash), hash)
+	}
+}
+
+func TestEncode_DCIsAverageColour(t *testing.T) {
+	hash, err := Encode(solid(color.RGBA{255, 255, 255, 255}, 8, 8), 2, 1)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if got, want := hash[2:6], encode83(0xffffff, 4); got != want {
+		t.Errorf("DC want %s, got %s", want, got)
+	}
+}
+
+func TestEncode_InvalidComponents(t *testing.T) {
+	if _, err := Encode(solid(color.Black, 2, 2), 0, 3); err != ErrInvalidComponents {
+		t.Errorf("want ErrInvalidComponents, got %v", err)
+	}
+}
@@ -40,6 +40,11 @@ func ErrWithCode(w http.ResponseWriter, status int, code, errMsg string) {
 	JSON(w, status, Body{Success: false, Error: errMsg, Code: code})
 }
 
+// ErrWithData sends an error response with a code and details in data (e.g. the rejected fields).
+func ErrWithData(w http.ResponseWriter, status int, code, errMsg string, data interface{}) {
+	JSON(w, status, Body{Success: false, Data: data, Error: errMsg, Code: code})
+}
+
 func BadRequest(w http.ResponseWriter, errMsg string) {
 	Err(w, http.StatusBadRequest, errMsg)
 }
@@ -0,0 +1,35 @@
+package signurl
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret-key"
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Now()
+	q, err := url.ParseQuery(Sign(testSecret, "blobs/ab/cd/x.png", now.Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("ParseQuery: %v", err)
+	}
+	if err := Verify(testSecret, "blobs/ab/cd/x.png", q, now); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := Verify(testSecret, "blobs/ab/cd/y.png", q, now); err != ErrInvalid {
+		t.Errorf("other path: want ErrInvalid, got %v", err)
+	}
+	if err := Verify("wrong-secret", "blobs/ab/cd/x.png", q, now); err != ErrInvalid {
+		t.Errorf("wrong secret: want ErrInvalid, got %v", err)
+	}
+	if err := Verify(testSecret, "blobs/ab/cd/x.png", q, now.Add(2*time.Minute)); err != ErrExpired {
+		t.Errorf("after expiry: want ErrExpired, got %v", err)
+	}
+}
+
+func TestVerify_Missing(t *testing.T) {
+	if err := Verify(testSecret, "a.png", url.Values{}, time.Now()); err != ErrMissing {
+		t.Errorf("want ErrMissing, got %v", err)
+	}
+}